@@ -0,0 +1,97 @@
+// Command migrate applies, reverts and reports schema migrations from ./migrations.
+//
+//	migrate up          apply every pending migration (the server also does this on boot)
+//	migrate down [n]    revert the latest n applied migrations (default 1)
+//	migrate status      list migrations and whether each is applied
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/example/ai-avatar-studio/internal/config"
+	"github.com/example/ai-avatar-studio/internal/task"
+)
+
+func main() {
+	ctx := context.Background()
+
+	cmd := "up"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+	dir := os.Getenv("MIGRATIONS_DIR")
+	if dir == "" {
+		dir = "migrations"
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	pool, err := cfg.ConnectPostgres(ctx)
+	if err != nil {
+		log.Fatalf("connect postgres: %v", err)
+	}
+	defer pool.Close()
+
+	migrator, err := task.NewMigrator(pool, dir)
+	if err != nil {
+		log.Fatalf("load migrations: %v", err)
+	}
+
+	switch cmd {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, v := range applied {
+			fmt.Printf("applied  %s\n", v)
+		}
+		if err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("nothing to apply")
+		}
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			if steps, err = strconv.Atoi(os.Args[2]); err != nil || steps <= 0 {
+				log.Fatalf("down: invalid step count %q", os.Args[2])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, v := range reverted {
+			fmt.Printf("reverted %s\n", v)
+		}
+		if err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			switch {
+			case st.Missing:
+				state = "missing"
+			case st.Modified:
+				state = "modified"
+			case st.Applied:
+				state = "applied"
+			}
+			at := ""
+			if st.AppliedAt != nil {
+				at = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-9s %-19s %s\n", state, at, st.Version)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "usage: migrate [up | down [n] | status]\n")
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,50 @@
+// Command reencrypt-secrets seals provider API keys under the active master key. Run it once after
+// enabling SECRET_MASTER_KEYS to encrypt legacy plaintext rows, and again after putting a new
+// master key first in the list; retired keys can be dropped once it reports nothing left to do.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/example/ai-avatar-studio/internal/config"
+	"github.com/example/ai-avatar-studio/internal/pkg/secrets"
+	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/example/ai-avatar-studio/internal/task"
+)
+
+func main() {
+	ctx := context.Background()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	keys, err := secrets.ParseKeyring(cfg.SecretMasterKeys)
+	if err != nil {
+		log.Fatalf("parse SECRET_MASTER_KEYS: %v", err)
+	}
+	if keys == nil {
+		log.Fatalf("SECRET_MASTER_KEYS is not set")
+	}
+
+	pool, err := cfg.ConnectPostgres(ctx)
+	if err != nil {
+		log.Fatalf("connect postgres: %v", err)
+	}
+	defer pool.Close()
+
+	if err := task.RunMigrations(ctx, pool, "migrations"); err != nil {
+		log.Fatalf("run migrations: %v", err)
+	}
+
+	models, err := repository.NewConfigRepository(pool, keys).ReencryptAPIKeys(ctx)
+	if err != nil {
+		log.Fatalf("re-encrypt model keys: %v", err)
+	}
+	providers, err := repository.NewImageProviderRepository(pool, keys).ReencryptAPIKeys(ctx)
+	if err != nil {
+		log.Fatalf("re-encrypt image provider keys: %v", err)
+	}
+	log.Printf("re-encrypted %d model keys and %d image provider keys with master key %s", models, providers, keys.ActiveVersion())
+}
@@ -30,9 +30,12 @@ import (
 	"github.com/example/ai-avatar-studio/internal/pkg/mailer"
 	"github.com/example/ai-avatar-studio/internal/pkg/password"
 	"github.com/example/ai-avatar-studio/internal/pkg/redisclient"
+	"github.com/example/ai-avatar-studio/internal/pkg/secrets"
 	"github.com/example/ai-avatar-studio/internal/repository"
 	"github.com/example/ai-avatar-studio/internal/router"
 	imageadminhandler "github.com/example/ai-avatar-studio/internal/handler/imageadmin"
+	memoryhandler "github.com/example/ai-avatar-studio/internal/handler/memory"
+	personahandler "github.com/example/ai-avatar-studio/internal/handler/persona"
 	imagehandler "github.com/example/ai-avatar-studio/internal/handler/image"
 	adminsvc "github.com/example/ai-avatar-studio/internal/service/admin"
 	authsvc "github.com/example/ai-avatar-studio/internal/service/auth"
@@ -40,8 +43,10 @@ import (
 	communitysvc "github.com/example/ai-avatar-studio/internal/service/community"
 	creatorsvc "github.com/example/ai-avatar-studio/internal/service/creator"
 	memorysvc "github.com/example/ai-avatar-studio/internal/service/memory"
+	personasvc "github.com/example/ai-avatar-studio/internal/service/persona"
 	notificationsvc "github.com/example/ai-avatar-studio/internal/service/notification"
 	imagesvc "github.com/example/ai-avatar-studio/internal/service/image"
+	healthsvc "github.com/example/ai-avatar-studio/internal/service/health"
 	presetsvc "github.com/example/ai-avatar-studio/internal/service/preset"
 	profilesvc "github.com/example/ai-avatar-studio/internal/service/profile"
 	ragservice "github.com/example/ai-avatar-studio/internal/service/rag"
@@ -68,6 +73,11 @@ func main() {
 	}
 	defer pool.Close()
 
+	store, err := cfg.NewStorage()
+	if err != nil {
+		log.Fatalf("init storage: %v", err)
+	}
+
 	redisNative := cfg.NewRedisClient()
 	defer redisNative.Close()
 	cache := redisclient.New(redisNative)
@@ -76,9 +86,6 @@ func main() {
 		log.Fatalf("run migrations: %v", err)
 	}
 
-	dispatcher := task.NewDispatcher(32)
-	defer dispatcher.Stop()
-
 	notifyURL := cfg.PayNotifyURL
 	if notifyURL == "" {
 		notifyURL = fmt.Sprintf("http://localhost:%s/api/store/payments/notify", cfg.ServerPort)
@@ -88,24 +95,41 @@ func main() {
 		returnURL = fmt.Sprintf("http://localhost:%s/api/store/payments/return", cfg.ServerPort)
 	}
 
+	keys, err := secrets.ParseKeyring(cfg.SecretMasterKeys)
+	if err != nil {
+		log.Fatalf("parse SECRET_MASTER_KEYS: %v", err)
+	}
+	if keys == nil {
+		if cfg.AllowPlaintextSecrets {
+			keys = secrets.Plaintext()
+			log.Printf("SECRET_MASTER_KEYS not set and ALLOW_PLAINTEXT_SECRETS=true: provider API keys are stored in plaintext")
+		} else {
+			log.Printf("SECRET_MASTER_KEYS not set: saving provider API keys is refused until it is (or ALLOW_PLAINTEXT_SECRETS=true)")
+		}
+	}
+
 	// repositories
 	userRepo := repository.NewUserRepository(pool)
 	roleRepo := repository.NewRoleRepository(pool)
 	worldRepo := repository.NewWorldbookRepository(pool)
 	chatRepo := repository.NewChatRepository(pool)
 	communityRepo := repository.NewCommunityRepository(pool)
-	configRepo := repository.NewConfigRepository(pool)
+	configRepo := repository.NewConfigRepository(pool, keys)
 	revenueRepo := repository.NewRevenueRepository(pool)
 	notificationRepo := repository.NewNotificationRepository(pool)
 	memoryRepo := repository.NewMemoryRepository(pool)
+	personaRepo := repository.NewPersonaRepository(pool)
 	documentRepo := repository.NewDocumentRepository(pool)
 	assetRepo := repository.NewUserAssetRepository(pool)
 	paymentRepo := repository.NewPaymentRepository(pool)
 	presetRepo := repository.NewPresetRepository(pool)
 	verificationRepo := repository.NewVerificationRepository(pool)
-	imageProviderRepo := repository.NewImageProviderRepository(pool)
+	imageProviderRepo := repository.NewImageProviderRepository(pool, keys)
 	imagePresetRepo := repository.NewImagePresetRepository(pool)
 	imageJobRepo := repository.NewImageJobRepository(pool)
+	healthCheckRepo := repository.NewHealthCheckRepository(pool)
+	jobRepo := repository.NewJobRepository(pool)
+	jobQueue := task.NewQueue(jobRepo, cfg.JobWorkers)
 
 	seedAdminUser(ctx, userRepo, cfg)
 
@@ -113,37 +137,68 @@ func main() {
 	emailer := mailer.NewSMTPClient(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPFrom)
 	authService := authsvc.NewService(userRepo, verificationRepo, emailer, cfg.JWTSecret, cfg.AdminSecret)
 	roleService := rolesvc.NewService(roleRepo)
-	ragService := ragservice.NewService(documentRepo)
-	memoryService := memorysvc.NewService(memoryRepo)
-	revenueService := revenuesvc.NewService(revenueRepo)
+	ragService := ragservice.NewService(documentRepo, configRepo, &http.Client{Timeout: 60 * time.Second}, cfg.EmbeddingModelID, jobQueue)
+	revenueService := revenuesvc.NewService(revenueRepo, assetRepo)
 	llmClient := llm.NewRouterClient(&http.Client{Timeout: 60 * time.Second})
-	chatService := chatsvc.NewService(chatRepo, roleRepo, worldRepo, configRepo, ragService, memoryService, cache, llmClient, cfg.DefaultModelID, assetRepo, revenueService)
-	communityService := communitysvc.NewService(communityRepo, userRepo, notificationRepo, dispatcher, configRepo)
-	storeService := storesvc.NewService(roleRepo, revenueService)
+	memoryService := memorysvc.NewService(memoryRepo, roleRepo, configRepo, llmClient, jobQueue, cfg.MemoryModelID)
+	llmBreaker := llm.NewBreaker()
+	personaService := personasvc.NewService(personaRepo)
+	chatService := chatsvc.NewService(chatRepo, roleRepo, worldRepo, configRepo, ragService, memoryService, personaService, cache, llmClient, llmBreaker, jobQueue, cfg.DefaultModelID, assetRepo, revenueService)
+	communityService := communitysvc.NewService(communityRepo, userRepo, notificationRepo, jobQueue, configRepo)
+	storeService := storesvc.NewService(roleRepo, revenueService, notificationRepo, storesvc.Options{Amounts: cfg.TipAmounts, Descriptions: cfg.TipDescriptions})
 	creatorService := creatorsvc.NewService(roleRepo, revenueRepo)
 	notificationService := notificationsvc.NewService(notificationRepo)
-	adminService := adminsvc.NewService(configRepo, roleRepo, communityRepo, userRepo, notificationRepo)
+	adminService := adminsvc.NewService(configRepo, roleRepo, communityRepo, userRepo, notificationRepo, assetRepo, jobRepo)
 	profileService := profilesvc.NewService(userRepo, communityRepo, chatRepo, roleRepo, assetRepo, revenueRepo)
 	presetService := presetsvc.NewService(presetRepo)
 	paymentService := paymentsvc.NewService(paymentRepo, assetRepo, notificationRepo, cfg.PayMerchantID, cfg.PayKey, cfg.PayGateway, notifyURL, returnURL, cfg.CoinsPerYuan)
-	imageService := imagesvc.NewService(imageProviderRepo, imagePresetRepo, imageJobRepo, chatRepo, configRepo, llmClient)
+	// Refund coin holds that were never settled, e.g. when a previous process died mid-generation.
+	go task.Every(ctx, time.Minute, func(ctx context.Context) {
+		if n, err := assetRepo.ReleaseExpiredHolds(ctx, 100); err != nil {
+			log.Printf("release expired coin holds: %v", err)
+		} else if n > 0 {
+			log.Printf("released %d expired coin holds", n)
+		}
+	})
+	imageService := imagesvc.NewService(imageProviderRepo, imagePresetRepo, imageJobRepo, chatRepo, roleRepo, personaService, configRepo, llmClient, jobQueue, store, cfg.MediaSecret)
+	go func() {
+		if n, err := imageService.ImportLegacyImages(ctx); err != nil {
+			log.Printf("import legacy images: %v", err)
+		} else if n > 0 {
+			log.Printf("moved %d legacy data-url images to storage", n)
+		}
+	}()
+	healthService := healthsvc.NewService(configRepo, imageProviderRepo, healthCheckRepo, llmClient, imageService, cfg.HealthProbeFailures)
+	if cfg.HealthProbeMinutes > 0 {
+		go task.Every(ctx, time.Duration(cfg.HealthProbeMinutes)*time.Minute, healthService.ProbeAll)
+	}
+
+	notificationService.RegisterJobs(jobQueue)
+	ragService.RegisterJobs(jobQueue)
+	chatService.RegisterJobs(jobQueue)
+	memoryService.RegisterJobs(jobQueue)
+	imageService.RegisterJobs(jobQueue)
+	jobQueue.Start()
+	go task.Every(ctx, time.Hour, jobQueue.PruneSucceeded)
 
 	handlers := router.Handlers{
 		Auth:         authhandler.NewHandler(authService, cfg.JWTSecret),
 		Roles:        rolehandler.NewHandler(roleService, cfg.JWTSecret),
 		Chat:         chathandler.NewHandler(chatService, cfg.JWTSecret),
+		Memories:     memoryhandler.NewHandler(memoryService, cfg.JWTSecret),
+		Personas:     personahandler.NewHandler(personaService, cfg.JWTSecret),
 		Community:    communityhandler.NewHandler(communityService, cfg.JWTSecret),
-		Creator:      creatorhandler.NewHandler(creatorService, roleService, cfg.JWTSecret),
+		Creator:      creatorhandler.NewHandler(creatorService, roleService, ragService, cfg.JWTSecret),
 		Store:        storehandler.NewHandler(storeService, cfg.JWTSecret),
 		Notification: notificationhandler.NewHandler(notificationService, cfg.JWTSecret),
-		Admin:        adminhandler.NewHandler(adminService, authService, revenueService, cfg.JWTSecret, cfg.AdminAccessKey),
+		Admin:        adminhandler.NewHandler(adminService, authService, revenueService, healthService, cfg.JWTSecret, cfg.AdminAccessKey),
 		Revenue:      revenuehandler.NewHandler(revenueService, cfg.JWTSecret),
 		Profile:      profilehandler.NewHandler(profileService, cfg.JWTSecret),
 		Upload:       uploadhandler.NewHandler(cfg.UploadDir, cfg.JWTSecret, authService),
 		Presets:      presethandler.NewPresetHandler(presetService, cfg.JWTSecret),
 		Payment:      paymenthandler.NewHandler(paymentService, cfg.JWTSecret),
 		Images:       imagehandler.NewHandler(imageService, cfg.JWTSecret),
-		ImageAdmin:   imageadminhandler.NewHandler(imageProviderRepo, imagePresetRepo, cfg.JWTSecret),
+		ImageAdmin:   imageadminhandler.NewHandler(imageProviderRepo, imagePresetRepo, healthService, cfg.JWTSecret),
 	}
 
 	engine := router.New(cfg, handlers)
@@ -183,6 +238,7 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("server shutdown error: %v", err)
 	}
+	jobQueue.Stop(shutdownCtx)
 }
 
 func seedAdminUser(ctx context.Context, repo *repository.UserRepository, cfg *config.Config) {
@@ -8,6 +8,7 @@ import (
 	"time"
 	"strconv"
 
+	"github.com/example/ai-avatar-studio/internal/pkg/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
@@ -26,6 +27,8 @@ type Config struct {
 	AdminAccessKey       string
 	FrontendOrigin       []string
 	DefaultModelID       string
+	EmbeddingModelID     string
+	MemoryModelID        string
 	AdminBootstrapUser   string
 	AdminBootstrapPass   string
 	AdminBootstrapEmail  string
@@ -37,11 +40,30 @@ type Config struct {
 	PayNotifyURL         string
 	PayReturnURL         string
 	CoinsPerYuan         int64
+	TipAmounts           []int64
+	TipDescriptions      []string
 	SMTPHost             string
 	SMTPPort             int
 	SMTPUser             string
 	SMTPPass             string
 	SMTPFrom             string
+	HealthProbeMinutes   int
+	SecretMasterKeys     string
+	JobWorkers           int
+	StorageBackend       string
+	MediaDir             string
+	MediaSecret          string
+	S3Endpoint           string
+	S3Region             string
+	S3Bucket             string
+	S3AccessKey          string
+	S3SecretKey          string
+
+	// AllowPlaintextSecrets lets a setup without SECRET_MASTER_KEYS store provider API keys unencrypted.
+	AllowPlaintextSecrets bool
+
+	// HealthProbeFailures is how many consecutive failed probes mark a model or provider degraded.
+	HealthProbeFailures int
 }
 
 // Load reads environment variables and .env if present.
@@ -62,6 +84,8 @@ func Load() (*Config, error) {
 		AdminSecret:         getEnv("ADMIN_SECRET", "admin-secret"),
 		AdminAccessKey:      strings.TrimSpace(os.Getenv("ADMIN_ACCESS_KEY")),
 		DefaultModelID:      strings.TrimSpace(os.Getenv("DEFAULT_MODEL_ID")),
+		EmbeddingModelID:    strings.TrimSpace(os.Getenv("EMBEDDING_MODEL_ID")),
+		MemoryModelID:       strings.TrimSpace(os.Getenv("MEMORY_MODEL_ID")),
 		AdminBootstrapUser:  strings.TrimSpace(os.Getenv("ADMIN_BOOTSTRAP_USERNAME")),
 		AdminBootstrapPass:  strings.TrimSpace(os.Getenv("ADMIN_BOOTSTRAP_PASSWORD")),
 		AdminBootstrapEmail: strings.TrimSpace(os.Getenv("ADMIN_BOOTSTRAP_EMAIL")),
@@ -78,6 +102,27 @@ func Load() (*Config, error) {
 		SMTPUser:            strings.TrimSpace(os.Getenv("SMTP_USER")),
 		SMTPPass:            strings.TrimSpace(os.Getenv("SMTP_PASS")),
 		SMTPFrom:            strings.TrimSpace(os.Getenv("SMTP_FROM")),
+		HealthProbeMinutes:  parseInt(getEnv("HEALTH_PROBE_MINUTES", "0"), 0),
+		SecretMasterKeys:    strings.TrimSpace(os.Getenv("SECRET_MASTER_KEYS")),
+		JobWorkers:          parseInt(getEnv("JOB_WORKERS", "4"), 4),
+		StorageBackend:      strings.ToLower(getEnv("STORAGE_BACKEND", "local")),
+		MediaDir:            getEnv("MEDIA_DIR", "media"),
+		MediaSecret:         getEnv("MEDIA_SECRET", "dev-media-secret"),
+		S3Endpoint:          strings.TrimSpace(os.Getenv("S3_ENDPOINT")),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:            strings.TrimSpace(os.Getenv("S3_BUCKET")),
+		S3AccessKey:         strings.TrimSpace(os.Getenv("S3_ACCESS_KEY_ID")),
+		S3SecretKey:         strings.TrimSpace(os.Getenv("S3_SECRET_ACCESS_KEY")),
+	}
+	cfg.AllowPlaintextSecrets, _ = strconv.ParseBool(getEnv("ALLOW_PLAINTEXT_SECRETS", "false"))
+	cfg.HealthProbeFailures = parseInt(getEnv("HEALTH_PROBE_FAILURES", "3"), 3)
+	for _, raw := range strings.Split(getEnv("TIP_AMOUNTS", "5,10,20"), ",") {
+		if n := parseInt64(strings.TrimSpace(raw), 0); n > 0 {
+			cfg.TipAmounts = append(cfg.TipAmounts, n)
+		}
+	}
+	for _, d := range strings.Split(getEnv("TIP_DESCRIPTIONS", "Buy a coffee|Cheer loudly|Monthly pass"), "|") {
+		cfg.TipDescriptions = append(cfg.TipDescriptions, strings.TrimSpace(d))
 	}
 	origins := getEnv("FRONTEND_ORIGIN", "*")
 	for _, o := range strings.Split(origins, ",") {
@@ -95,6 +140,15 @@ func Load() (*Config, error) {
 	if cfg.AdminSecret == "" {
 		return nil, fmt.Errorf("ADMIN_SECRET is required")
 	}
+	switch cfg.StorageBackend {
+	case "local":
+	case "s3":
+		if cfg.S3Bucket == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+			return nil, fmt.Errorf("STORAGE_BACKEND=s3 requires S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (want local or s3)", cfg.StorageBackend)
+	}
 	if cfg.PayGateway == "" || cfg.PayMerchantID == "" || cfg.PayKey == "" {
 		return nil, fmt.Errorf("payment gateway config (PAY_GATEWAY, PAY_MERCHANT_ID, PAY_KEY) is required")
 	}
@@ -107,6 +161,9 @@ func Load() (*Config, error) {
 		if cfg.AdminSecret == "admin-secret" || len(cfg.AdminSecret) < 16 {
 			return nil, fmt.Errorf("production requires a strong ADMIN_SECRET")
 		}
+		if cfg.MediaSecret == "dev-media-secret" || len(cfg.MediaSecret) < 24 || cfg.MediaSecret == cfg.JWTSecret {
+			return nil, fmt.Errorf("production requires a strong MEDIA_SECRET distinct from JWT_SECRET")
+		}
 		if cfg.AdminAccessKey == "" {
 			return nil, fmt.Errorf("ADMIN_ACCESS_KEY is required in production")
 		}
@@ -119,6 +176,9 @@ func Load() (*Config, error) {
 		if cfg.PayKey == "" || cfg.PayKey == "i0AJIXg3Gx4al4N9a0LnLJoN1ad0hg0l" {
 			return nil, fmt.Errorf("PAY_KEY must be set for production")
 		}
+		if cfg.SecretMasterKeys == "" {
+			return nil, fmt.Errorf("SECRET_MASTER_KEYS is required in production to encrypt provider API keys")
+		}
 		if cfg.SMTPHost == "" || cfg.SMTPUser == "" || cfg.SMTPPass == "" || cfg.SMTPFrom == "" {
 			return nil, fmt.Errorf("SMTP_HOST/SMTP_USER/SMTP_PASS/SMTP_FROM are required in production for email verification")
 		}
@@ -158,6 +218,14 @@ func (c *Config) NewRedisClient() *redis.Client {
 	})
 }
 
+// NewStorage returns the object store selected by STORAGE_BACKEND.
+func (c *Config) NewStorage() (storage.Store, error) {
+	if c.StorageBackend == "s3" {
+		return storage.NewS3(c.S3Endpoint, c.S3Region, c.S3Bucket, c.S3AccessKey, c.S3SecretKey)
+	}
+	return storage.NewLocal(c.MediaDir), nil
+}
+
 func getEnv(key, fallback string) string {
 	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
 		return v
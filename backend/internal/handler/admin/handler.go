@@ -11,6 +11,7 @@ import (
 	"github.com/example/ai-avatar-studio/internal/pkg/response"
 	adminsvc "github.com/example/ai-avatar-studio/internal/service/admin"
 	authsvc "github.com/example/ai-avatar-studio/internal/service/auth"
+	healthsvc "github.com/example/ai-avatar-studio/internal/service/health"
 	revenuesvc "github.com/example/ai-avatar-studio/internal/service/revenue"
 	"github.com/gin-gonic/gin"
 )
@@ -22,10 +23,11 @@ type Handler struct {
 	secret     string
 	accessKey  string
 	revenue    *revenuesvc.Service
+	health     *healthsvc.Service
 }
 
-func NewHandler(service *adminsvc.Service, auth *authsvc.Service, revenue *revenuesvc.Service, secret, accessKey string) *Handler {
-	return &Handler{service: service, auth: auth, revenue: revenue, secret: secret, accessKey: accessKey}
+func NewHandler(service *adminsvc.Service, auth *authsvc.Service, revenue *revenuesvc.Service, health *healthsvc.Service, secret, accessKey string) *Handler {
+	return &Handler{service: service, auth: auth, revenue: revenue, health: health, secret: secret, accessKey: accessKey}
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
@@ -35,6 +37,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	secured.POST("/models", h.createModel)
 	secured.PUT("/models/:id", h.updateModel)
 	secured.DELETE("/models/:id", h.deleteModel)
+	secured.POST("/models/:id/test", h.testModel)
 	secured.GET("/dictionary", h.dictionary)
 	secured.POST("/dictionary", h.saveDictionary)
 	secured.DELETE("/dictionary/:id", h.deleteDictionary)
@@ -49,6 +52,8 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	secured.POST("/users/:id/ban", h.banUser)
 	secured.POST("/users/:id/unban", h.unbanUser)
 	secured.DELETE("/users/:id", h.deleteUser)
+	secured.GET("/users/:id/ledger", h.userLedger)
+	secured.POST("/users/:id/balance/rebuild", h.rebuildBalance)
 	secured.GET("/comments", h.listComments)
 	secured.POST("/comments/:id/hide", h.hideComment)
 	secured.DELETE("/comments/:id", h.deleteComment)
@@ -56,6 +61,8 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	secured.POST("/payouts/:id/approve", h.approvePayout)
 	secured.POST("/payouts/:id/reject", h.rejectPayout)
 	secured.POST("/notifications/broadcast", h.broadcastNotifications)
+	secured.GET("/jobs", h.listJobs)
+	secured.POST("/jobs/:id/retry", h.retryJob)
 }
 
 func (h *Handler) login(c *gin.Context) {
@@ -100,9 +107,23 @@ func (h *Handler) models(c *gin.Context) {
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if err := h.health.AnnotateModels(c.Request.Context(), models); err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
 	response.Success(c, models)
 }
 
+// testModel sends a minimal request to the model and reports latency, the served model and any error.
+func (h *Handler) testModel(c *gin.Context) {
+	check, err := h.health.TestModel(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Success(c, check)
+}
+
 func (h *Handler) createModel(c *gin.Context) {
 	payload, err := bindModelPayload(c)
 	if err != nil {
@@ -234,6 +255,31 @@ func (h *Handler) listUsers(c *gin.Context) {
 	response.Success(c, users)
 }
 
+// listJobs shows background jobs, dead-lettered ones by default; pass status=all for every job.
+func (h *Handler) listJobs(c *gin.Context) {
+	status := c.DefaultQuery("status", model.JobDead)
+	if status == "all" {
+		status = ""
+	}
+	limit := parseIntDefault(c.Query("limit"), 50)
+	offset := parseIntDefault(c.Query("offset"), 0)
+	jobs, err := h.service.Jobs(c.Request.Context(), status, c.Query("type"), limit, offset)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, jobs)
+}
+
+func (h *Handler) retryJob(c *gin.Context) {
+	job, err := h.service.RetryJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(c, job)
+}
+
 func (h *Handler) createUser(c *gin.Context) {
 	var payload struct {
 		Username string `json:"username"`
@@ -278,6 +324,25 @@ func (h *Handler) deleteUser(c *gin.Context) {
 	response.Success(c, gin.H{"status": "deleted"})
 }
 
+func (h *Handler) userLedger(c *gin.Context) {
+	limit := parseIntDefault(c.Query("limit"), 50)
+	entries, err := h.service.UserLedger(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, entries)
+}
+
+func (h *Handler) rebuildBalance(c *gin.Context) {
+	asset, err := h.service.RebuildUserBalance(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, asset)
+}
+
 func (h *Handler) listComments(c *gin.Context) {
 	limit := parseIntDefault(c.Query("limit"), 50)
 	offset := parseIntDefault(c.Query("offset"), 0)
@@ -380,9 +445,18 @@ type modelPayload struct {
 	IsDefault   bool     `json:"is_default"`
 	IsEnabled   *bool    `json:"is_enabled"`
 	PriceCoins  *int64   `json:"price_coins"`
+	InputPrice  *float64 `json:"input_price_per_1k"`
+	OutputPrice *float64 `json:"output_price_per_1k"`
 	PriceHint   string   `json:"price_hint"`
 	ShareRole   *float64 `json:"share_role_pct"`
 	SharePreset *float64 `json:"share_preset_pct"`
+
+	FallbackModelIDs       []string `json:"fallback_model_ids"`
+	MaxRetries             *int     `json:"max_retries"`
+	RetryBackoffMs         *int     `json:"retry_backoff_ms"`
+	BreakerThreshold       *int     `json:"breaker_threshold"`
+	BreakerCooldownSeconds *int     `json:"breaker_cooldown_seconds"`
+	ThinkingBudgetTokens   *int     `json:"thinking_budget_tokens"`
 }
 
 func bindModelPayload(c *gin.Context) (*model.ModelConfig, error) {
@@ -418,7 +492,11 @@ func bindModelPayload(c *gin.Context) (*model.ModelConfig, error) {
 		cfg.Provider = "openai"
 	}
 	if cfg.BaseURL == "" {
-		cfg.BaseURL = "https://api.openai.com/v1"
+		if strings.EqualFold(cfg.Provider, "anthropic") {
+			cfg.BaseURL = "https://api.anthropic.com"
+		} else {
+			cfg.BaseURL = "https://api.openai.com/v1"
+		}
 	}
 	if cfg.Status == "" {
 		cfg.Status = "active"
@@ -438,6 +516,15 @@ func bindModelPayload(c *gin.Context) (*model.ModelConfig, error) {
 	if body.PriceCoins != nil {
 		cfg.PriceCoins = *body.PriceCoins
 	}
+	if body.InputPrice != nil {
+		cfg.InputPricePer1K = *body.InputPrice
+	}
+	if body.OutputPrice != nil {
+		cfg.OutputPricePer1K = *body.OutputPrice
+	}
+	if cfg.PriceCoins < 0 || cfg.InputPricePer1K < 0 || cfg.OutputPricePer1K < 0 {
+		return nil, errors.New("价格不能为负数")
+	}
 	cfg.ShareRolePct = clampShare(body.ShareRole)
 	cfg.SharePresetPct = clampShare(body.SharePreset)
 	cfg.PriceHint = strings.TrimSpace(body.PriceHint)
@@ -447,7 +534,38 @@ func bindModelPayload(c *gin.Context) (*model.ModelConfig, error) {
 	if body.IsEnabled != nil {
 		cfg.IsEnabled = *body.IsEnabled
 	} else {
-		cfg.IsEnabled = strings.EqualFold(cfg.Status, "active")
+		cfg.IsEnabled = cfg.Serviceable()
+	}
+	// fallback chain, in order; the model itself and repeats are dropped
+	seen := map[string]bool{cfg.ID: true}
+	cfg.FallbackModelIDs = []string{}
+	for _, id := range body.FallbackModelIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		cfg.FallbackModelIDs = append(cfg.FallbackModelIDs, id)
+	}
+	clampInt := func(v *int, def, min, max int) int {
+		if v == nil {
+			return def
+		}
+		if *v < min {
+			return min
+		}
+		if *v > max {
+			return max
+		}
+		return *v
+	}
+	cfg.MaxRetries = clampInt(body.MaxRetries, 0, 0, 5)
+	cfg.RetryBackoffMs = clampInt(body.RetryBackoffMs, 500, 0, 10000)
+	cfg.BreakerThreshold = clampInt(body.BreakerThreshold, 5, 0, 100)
+	cfg.BreakerCooldownSeconds = clampInt(body.BreakerCooldownSeconds, 60, 1, 3600)
+	cfg.ThinkingBudgetTokens = clampInt(body.ThinkingBudgetTokens, 0, 0, 64000)
+	if cfg.ThinkingBudgetTokens > 0 && cfg.ThinkingBudgetTokens < 1024 {
+		cfg.ThinkingBudgetTokens = 1024 // the smallest budget Anthropic accepts
 	}
 	return cfg, nil
 }
@@ -2,10 +2,14 @@ package chat
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	"github.com/example/ai-avatar-studio/internal/pkg/middleware"
 	"github.com/example/ai-avatar-studio/internal/pkg/response"
 	chatsvc "github.com/example/ai-avatar-studio/internal/service/chat"
@@ -27,13 +31,26 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.POST("/chat/sessions", auth, h.createSession)
 	rg.GET("/chat/sessions", auth, h.listSessions)
 	rg.GET("/chat/sessions/:id", auth, h.overview)
+	rg.GET("/chat/sessions/:id/context", auth, h.contextPreview)
 	rg.POST("/chat/sessions/:id/messages", auth, h.sendMessage)
+	rg.POST("/chat/sessions/:id/stop", auth, h.stopGeneration)
+	rg.GET("/chat/generations/:id/stream", auth, h.resumeGeneration)
 	rg.PATCH("/chat/messages/:id", auth, h.updateMessage)
 	rg.DELETE("/chat/messages/:id", auth, h.deleteMessage)
 	rg.DELETE("/chat/sessions/:id", auth, h.deleteSession)
 	rg.POST("/chat/messages/:id/retry", auth, h.retryMessage)
+	rg.GET("/chat/messages/:id/candidates", auth, h.messageCandidates)
+	rg.POST("/chat/messages/:id/select", auth, h.selectMessage)
+	rg.POST("/chat/messages/:id/fork", auth, h.forkMessage)
 	rg.DELETE("/chat/sessions/:id/messages", auth, h.clearSession)
 	rg.PATCH("/chat/sessions/:id/settings", auth, h.updateSettings)
+	rg.PUT("/chat/sessions/:id/persona", auth, h.setPersona)
+	rg.GET("/chat/sessions/:id/summary", auth, h.summary)
+	rg.GET("/chat/sessions/:id/summary/versions", auth, h.summaryVersions)
+	rg.PATCH("/chat/sessions/:id/summary/:summaryId", auth, h.editSummary)
+	rg.POST("/chat/sessions/:id/summary/regenerate", auth, h.regenerateSummary)
+	rg.GET("/chat/sessions/:id/variables", auth, h.variables)
+	rg.PUT("/chat/sessions/:id/variables", auth, h.setVariables)
 	rg.GET("/chat/models", auth, h.listModels)
 }
 
@@ -67,17 +84,28 @@ func (h *Handler) listSessions(c *gin.Context) {
 }
 
 func (h *Handler) overview(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
-	view, err := h.service.SessionOverview(c.Request.Context(), userID, c.Param("id"))
+	actor := middleware.CurrentActor(c)
+	view, err := h.service.SessionOverview(c.Request.Context(), actor, c.Param("id"))
 	if err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, view)
 }
 
+// contextPreview reports how the next turn's context is fitted into the model's window.
+func (h *Handler) contextPreview(c *gin.Context) {
+	actor := middleware.CurrentActor(c)
+	window, err := h.service.ContextPreview(c.Request.Context(), actor, c.Param("id"), c.Query("draft"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, window)
+}
+
 func (h *Handler) sendMessage(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
+	actor := middleware.CurrentActor(c)
 	var req struct {
 		Content string       `json:"content"`
 		Preset  *model.Preset `json:"preset"`
@@ -87,44 +115,133 @@ func (h *Handler) sendMessage(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "invalid body")
 		return
 	}
-	if req.Stream {
+	if req.Stream && strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		h.streamSSE(c, actor, req.Content, req.Preset)
+	} else if req.Stream {
 		flusher, ok := c.Writer.(http.Flusher)
 		if !ok {
 			response.Error(c, http.StatusInternalServerError, "stream not supported")
 			return
 		}
+		genID, err := h.service.StartGeneration(c.Request.Context(), actor, c.Param("id"), req.Content, req.Preset)
+		if err != nil {
+			response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+			return
+		}
 		c.Writer.Header().Set("Content-Type", "application/json")
 		c.Writer.Header().Set("Transfer-Encoding", "chunked")
-		_, _ = c.Writer.Write([]byte{}) // ensure headers are sent
-		flusher.Flush()
-		_, err := h.service.SendMessageStream(c.Request.Context(), userID, c.Param("id"), req.Content, req.Preset, func(delta, reasoning string) {
-			payload, _ := json.Marshal(gin.H{
-				"content":   delta,
-				"reasoning": reasoning,
-			})
+		c.Writer.Header().Set("X-Generation-ID", genID)
+		writeLine := func(v interface{}) {
+			payload, _ := json.Marshal(v)
 			_, _ = c.Writer.Write(append(payload, '\n'))
 			flusher.Flush()
+		}
+		writeLine(gin.H{"generation_id": genID})
+		err = h.service.StreamGeneration(c.Request.Context(), actor, genID, 0, func(ev chatsvc.GenerationEvent) {
+			var data map[string]interface{}
+			_ = json.Unmarshal(ev.Data, &data)
+			switch ev.Event {
+			case "delta":
+				writeLine(gin.H{"content": data["content"], "reasoning": ""})
+			case "reasoning":
+				writeLine(gin.H{"content": "", "reasoning": data["content"]})
+			case "error":
+				writeLine(gin.H{"error": data["message"]})
+			case "done":
+				data["done"] = true
+				writeLine(data)
+			}
 		})
 		if err != nil {
-			log.Printf("chat: stream send failed user=%s session=%s err=%v", userID, c.Param("id"), err)
-			return
+			log.Printf("chat: stream send failed user=%s session=%s generation=%s err=%v", actor.UserID, c.Param("id"), genID, err)
 		}
-		_, _ = c.Writer.Write([]byte(`{"done":true}` + "\n"))
-		flusher.Flush()
 	} else {
-		msgs, err := h.service.SendMessage(c.Request.Context(), userID, c.Param("id"), req.Content, req.Preset)
+		msgs, err := h.service.SendMessage(c.Request.Context(), actor, c.Param("id"), req.Content, req.Preset)
 		if err != nil {
 			// Log the error with session/user context for easier troubleshooting.
-			log.Printf("chat: send message failed user=%s session=%s err=%v", userID, c.Param("id"), err)
-			response.Error(c, http.StatusBadRequest, err.Error())
+			log.Printf("chat: send message failed user=%s session=%s err=%v", actor.UserID, c.Param("id"), err)
+			response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 			return
 		}
 		response.Success(c, msgs)
 	}
 }
 
+// streamSSE starts a detached generation and relays it as text/event-stream. Event IDs are buffer
+// offsets, so a dropped client can resume through /chat/generations/:id/stream.
+func (h *Handler) streamSSE(c *gin.Context, actor authz.Actor, content string, preset *model.Preset) {
+	if _, ok := c.Writer.(http.Flusher); !ok {
+		response.Error(c, http.StatusInternalServerError, "stream not supported")
+		return
+	}
+	genID, err := h.service.StartGeneration(c.Request.Context(), actor, c.Param("id"), content, preset)
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	h.relaySSE(c, actor, genID, 0)
+}
+
+// resumeGeneration reattaches to a generation from ?from=<offset> (or after Last-Event-ID).
+func (h *Handler) resumeGeneration(c *gin.Context) {
+	if _, ok := c.Writer.(http.Flusher); !ok {
+		response.Error(c, http.StatusInternalServerError, "stream not supported")
+		return
+	}
+	var from int64
+	if raw := c.Query("from"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			response.Error(c, http.StatusBadRequest, "invalid from")
+			return
+		}
+		from = v
+	} else if raw := c.GetHeader("Last-Event-ID"); raw != "" {
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil && v >= 0 {
+			from = v + 1
+		}
+	}
+	h.relaySSE(c, middleware.CurrentActor(c), c.Param("id"), from)
+}
+
+func (h *Handler) relaySSE(c *gin.Context, actor authz.Actor, genID string, from int64) {
+	if err := h.service.CheckGeneration(c.Request.Context(), actor, genID); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	flusher := c.Writer.(http.Flusher)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Header().Set("X-Generation-ID", genID)
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "event: generation\ndata: {\"generation_id\":%q}\n\n", genID)
+	flusher.Flush()
+	err := h.service.StreamGeneration(c.Request.Context(), actor, genID, from, func(ev chatsvc.GenerationEvent) {
+		fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.Offset, ev.Event, ev.Data)
+		flusher.Flush()
+	})
+	if err == nil || c.Request.Context().Err() != nil {
+		return
+	}
+	log.Printf("chat: sse relay failed user=%s generation=%s err=%v", actor.UserID, genID, err)
+	payload, _ := json.Marshal(gin.H{"message": err.Error()})
+	fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", payload)
+	flusher.Flush()
+}
+
+func (h *Handler) stopGeneration(c *gin.Context) {
+	actor := middleware.CurrentActor(c)
+	if err := h.service.StopGeneration(c.Request.Context(), actor, c.Param("id")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, gin.H{"status": "stopping"})
+}
+
 func (h *Handler) updateSettings(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
+	actor := middleware.CurrentActor(c)
 	var req struct {
 		Mode           string   `json:"mode"`
 		ModelKey       string   `json:"model_key"`
@@ -141,7 +258,7 @@ func (h *Handler) updateSettings(c *gin.Context) {
 	}
 	session, err := h.service.UpdateSettings(
 		c.Request.Context(),
-		userID,
+		actor,
 		c.Param("id"),
 		req.Mode,
 		req.ModelKey,
@@ -155,14 +272,14 @@ func (h *Handler) updateSettings(c *gin.Context) {
 		},
 	)
 	if err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, session)
 }
 
 func (h *Handler) updateMessage(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
+	actor := middleware.CurrentActor(c)
 	var req struct {
 		Content string `json:"content"`
 	}
@@ -170,50 +287,166 @@ func (h *Handler) updateMessage(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "invalid body")
 		return
 	}
-	if err := h.service.UpdateMessage(c.Request.Context(), userID, c.Param("id"), req.Content); err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+	if err := h.service.UpdateMessage(c.Request.Context(), actor, c.Param("id"), req.Content); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"status": "updated"})
 }
 
 func (h *Handler) deleteMessage(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
-	if err := h.service.DeleteMessage(c.Request.Context(), userID, c.Param("id")); err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+	actor := middleware.CurrentActor(c)
+	if err := h.service.DeleteMessage(c.Request.Context(), actor, c.Param("id")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"status": "deleted"})
 }
 
 func (h *Handler) deleteSession(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
-	if err := h.service.DeleteSession(c.Request.Context(), userID, c.Param("id")); err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+	actor := middleware.CurrentActor(c)
+	if err := h.service.DeleteSession(c.Request.Context(), actor, c.Param("id")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"status": "deleted"})
 }
 
 func (h *Handler) retryMessage(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
-	msgs, err := h.service.RetryAssistantMessage(c.Request.Context(), userID, c.Param("id"))
+	actor := middleware.CurrentActor(c)
+	msgs, err := h.service.RetryAssistantMessage(c.Request.Context(), actor, c.Param("id"))
 	if err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, msgs)
+}
+
+func (h *Handler) messageCandidates(c *gin.Context) {
+	actor := middleware.CurrentActor(c)
+	msgs, err := h.service.MessageCandidates(c.Request.Context(), actor, c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, msgs)
+}
+
+func (h *Handler) selectMessage(c *gin.Context) {
+	actor := middleware.CurrentActor(c)
+	msgs, err := h.service.SelectMessage(c.Request.Context(), actor, c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, msgs)
+}
+
+func (h *Handler) forkMessage(c *gin.Context) {
+	actor := middleware.CurrentActor(c)
+	msgs, err := h.service.ForkFromMessage(c.Request.Context(), actor, c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, msgs)
 }
 
 func (h *Handler) clearSession(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
-	if err := h.service.ClearSession(c.Request.Context(), userID, c.Param("id")); err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+	actor := middleware.CurrentActor(c)
+	if err := h.service.ClearSession(c.Request.Context(), actor, c.Param("id")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"status": "cleared"})
 }
 
+// setPersona overrides the session's persona; an empty persona_id restores the user's default.
+func (h *Handler) setPersona(c *gin.Context) {
+	var req struct {
+		PersonaID string `json:"persona_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	view, err := h.service.SetSessionPersona(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"), req.PersonaID)
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, view)
+}
+
+func (h *Handler) summary(c *gin.Context) {
+	view, err := h.service.Summary(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, view)
+}
+
+func (h *Handler) summaryVersions(c *gin.Context) {
+	versions, err := h.service.SummaryVersions(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, versions)
+}
+
+func (h *Handler) editSummary(c *gin.Context) {
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	view, err := h.service.EditSummary(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"), c.Param("summaryId"), req.Content)
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, view)
+}
+
+// regenerateSummary discards the current summaries; the new ones are built in the background.
+func (h *Handler) regenerateSummary(c *gin.Context) {
+	view, err := h.service.RegenerateSummary(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, view)
+}
+
+func (h *Handler) variables(c *gin.Context) {
+	vars, err := h.service.Variables(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, vars)
+}
+
+func (h *Handler) setVariables(c *gin.Context) {
+	var req struct {
+		Variables map[string]string `json:"variables"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	vars, err := h.service.SetVariables(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"), req.Variables)
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, vars)
+}
+
 func (h *Handler) listModels(c *gin.Context) {
 	models, err := h.service.ListModels(c.Request.Context())
 	if err != nil {
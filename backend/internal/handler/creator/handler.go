@@ -1,24 +1,29 @@
 package creator
 
 import (
+	"io"
 	"net/http"
 
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	"github.com/example/ai-avatar-studio/internal/pkg/middleware"
 	"github.com/example/ai-avatar-studio/internal/pkg/response"
 	creatorsvc "github.com/example/ai-avatar-studio/internal/service/creator"
+	ragsvc "github.com/example/ai-avatar-studio/internal/service/rag"
 	rolesvc "github.com/example/ai-avatar-studio/internal/service/role"
 	"github.com/gin-gonic/gin"
 )
 
 // Handler exposes APIs for the creator control center.
 type Handler struct {
-	service *creatorsvc.Service
-	roles   *rolesvc.Service
-	secret  string
+	service   *creatorsvc.Service
+	roles     *rolesvc.Service
+	documents *ragsvc.Service
+	secret    string
 }
 
-func NewHandler(service *creatorsvc.Service, roles *rolesvc.Service, secret string) *Handler {
-	return &Handler{service: service, roles: roles, secret: secret}
+func NewHandler(service *creatorsvc.Service, roles *rolesvc.Service, documents *ragsvc.Service, secret string) *Handler {
+	return &Handler{service: service, roles: roles, documents: documents, secret: secret}
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
@@ -26,6 +31,11 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.GET("/creator/dashboard", auth, h.dashboard)
 	rg.GET("/creator/roles", auth, h.rolesList)
 	rg.GET("/creator/roles/:id", auth, h.roleDetail)
+	rg.GET("/creator/roles/:id/documents", auth, h.listDocuments)
+	rg.POST("/creator/roles/:id/documents", auth, h.uploadDocument)
+	rg.GET("/creator/roles/:id/documents/:docId", auth, h.getDocument)
+	rg.POST("/creator/roles/:id/documents/:docId/rechunk", auth, h.rechunkDocument)
+	rg.DELETE("/creator/roles/:id/documents/:docId", auth, h.deleteDocument)
 }
 
 func (h *Handler) dashboard(c *gin.Context) {
@@ -49,15 +59,138 @@ func (h *Handler) rolesList(c *gin.Context) {
 }
 
 func (h *Handler) roleDetail(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
-	role, err := h.roles.Get(c.Request.Context(), c.Param("id"))
-	if err != nil || role == nil {
-		response.Error(c, http.StatusNotFound, "role not found")
+	role, ok := h.ownedRole(c)
+	if !ok {
 		return
 	}
-	if role.CreatorID != userID {
-		response.Error(c, http.StatusForbidden, "forbidden")
+	response.Success(c, role)
+}
+
+func (h *Handler) listDocuments(c *gin.Context) {
+	role, ok := h.ownedRole(c)
+	if !ok {
 		return
 	}
-	response.Success(c, role)
+	docs, err := h.documents.ListDocuments(c.Request.Context(), role.ID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, docs)
+}
+
+// uploadDocument accepts either a multipart "file" or a JSON body with inline content.
+func (h *Handler) uploadDocument(c *gin.Context) {
+	role, ok := h.ownedRole(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title        string `json:"title" form:"title"`
+		Format       string `json:"format" form:"format"`
+		Content      string `json:"content" form:"content"`
+		ChunkSize    int    `json:"chunk_size" form:"chunk_size"`
+		ChunkOverlap int    `json:"chunk_overlap" form:"chunk_overlap"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	source := "inline"
+	if header, err := c.FormFile("file"); err == nil {
+		if header.Size > 4<<20 {
+			response.Error(c, http.StatusBadRequest, "file too large (limit 4MB)")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "cannot read file")
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, 4<<20+1))
+		file.Close()
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "cannot read file")
+			return
+		}
+		req.Content = string(data)
+		source = header.Filename
+	}
+	format, err := ragsvc.DetectFormat(req.Format, source)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	doc, err := h.documents.UploadDocument(c.Request.Context(), role.ID, req.Title, source, format, req.Content, ragsvc.ChunkOptions{
+		Size:    req.ChunkSize,
+		Overlap: req.ChunkOverlap,
+	})
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": doc})
+}
+
+func (h *Handler) getDocument(c *gin.Context) {
+	role, ok := h.ownedRole(c)
+	if !ok {
+		return
+	}
+	doc, err := h.documents.GetDocument(c.Request.Context(), role.ID, c.Param("docId"))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if doc == nil {
+		response.Error(c, http.StatusNotFound, "document not found")
+		return
+	}
+	response.Success(c, doc)
+}
+
+func (h *Handler) rechunkDocument(c *gin.Context) {
+	role, ok := h.ownedRole(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		ChunkSize    int `json:"chunk_size"`
+		ChunkOverlap int `json:"chunk_overlap"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	doc, err := h.documents.Rechunk(c.Request.Context(), role.ID, c.Param("docId"), ragsvc.ChunkOptions{
+		Size:    req.ChunkSize,
+		Overlap: req.ChunkOverlap,
+	})
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": doc})
+}
+
+func (h *Handler) deleteDocument(c *gin.Context) {
+	role, ok := h.ownedRole(c)
+	if !ok {
+		return
+	}
+	if err := h.documents.DeleteDocument(c.Request.Context(), role.ID, c.Param("docId")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, gin.H{"status": "deleted"})
+}
+
+// ownedRole loads the :id role and aborts unless the caller created it (or is an admin).
+func (h *Handler) ownedRole(c *gin.Context) (*model.Role, bool) {
+	role, err := h.roles.GetOwned(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return nil, false
+	}
+	return role, true
 }
@@ -1,10 +1,17 @@
 package image
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	"github.com/example/ai-avatar-studio/internal/pkg/middleware"
 	"github.com/example/ai-avatar-studio/internal/pkg/response"
+	"github.com/example/ai-avatar-studio/internal/pkg/storage"
 	imagesvc "github.com/example/ai-avatar-studio/internal/service/image"
 	"github.com/gin-gonic/gin"
 )
@@ -23,10 +30,12 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	auth := middleware.Authenticator(h.secret)
 	rg.POST("/chat/images", auth, h.create)
 	rg.GET("/chat/images/:id", auth, h.detail)
+	rg.GET("/chat/images/:id/events", auth, h.events)
+	// Signed links, so <img> tags work without an Authorization header.
+	rg.GET("/media/*key", h.media)
 }
 
 func (h *Handler) create(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
 	var req struct {
 		SessionID string `json:"session_id"`
 		MessageID string `json:"message_id"`
@@ -36,23 +45,69 @@ func (h *Handler) create(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "invalid body")
 		return
 	}
-	job, err := h.service.RequestImage(c.Request.Context(), userID, req.SessionID, req.MessageID, req.Prompt)
+	job, err := h.service.RequestImage(c.Request.Context(), middleware.CurrentActor(c), req.SessionID, req.MessageID, req.Prompt)
 	if err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Created(c, job)
 }
 
 func (h *Handler) detail(c *gin.Context) {
-	job, err := h.service.GetJob(c.Request.Context(), c.Param("id"))
+	job, err := h.service.GetJob(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"))
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, err.Error())
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, job)
+}
+
+// events streams the job as a text/event-stream "status" event on every change until it finishes.
+func (h *Handler) events(c *gin.Context) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		response.Error(c, http.StatusInternalServerError, "stream not supported")
+		return
+	}
+	actor := middleware.CurrentActor(c)
+	job, err := h.service.GetJob(c.Request.Context(), actor, c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
 		return
 	}
-	if job == nil {
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	err = h.service.WatchJob(c.Request.Context(), actor, job.ID, func(j *model.ImageJob) {
+		payload, _ := json.Marshal(j)
+		fmt.Fprintf(c.Writer, "event: status\ndata: %s\n\n", payload)
+		flusher.Flush()
+	})
+	if err != nil && c.Request.Context().Err() == nil {
+		payload, _ := json.Marshal(gin.H{"message": err.Error()})
+		fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", payload)
+		flusher.Flush()
+	}
+}
+
+func (h *Handler) media(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	rc, contentType, err := h.service.OpenMedia(c.Request.Context(), key, c.Query("exp"), c.Query("sig"))
+	switch {
+	case errors.Is(err, imagesvc.ErrMediaForbidden):
+		response.Error(c, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, storage.ErrNotFound):
 		response.Error(c, http.StatusNotFound, "not found")
 		return
+	case err != nil:
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
 	}
-	response.Success(c, job)
+	defer rc.Close()
+	// Keys are content hashes, so the bytes behind a link never change.
+	c.Header("Cache-Control", "private, max-age=86400, immutable")
+	c.DataFromReader(http.StatusOK, -1, contentType, rc, nil)
 }
@@ -3,12 +3,16 @@ package imageadmin
 import (
 	"net/http"
 	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/macro"
 	"github.com/example/ai-avatar-studio/internal/pkg/middleware"
 	"github.com/example/ai-avatar-studio/internal/pkg/response"
 	"github.com/example/ai-avatar-studio/internal/repository"
+	healthsvc "github.com/example/ai-avatar-studio/internal/service/health"
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,11 +20,12 @@ import (
 type Handler struct {
 	providers *repository.ImageProviderRepository
 	presets   *repository.ImagePresetRepository
+	health    *healthsvc.Service
 	secret    string
 }
 
-func NewHandler(providers *repository.ImageProviderRepository, presets *repository.ImagePresetRepository, secret string) *Handler {
-	return &Handler{providers: providers, presets: presets, secret: secret}
+func NewHandler(providers *repository.ImageProviderRepository, presets *repository.ImagePresetRepository, health *healthsvc.Service, secret string) *Handler {
+	return &Handler{providers: providers, presets: presets, health: health, secret: secret}
 }
 
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
@@ -29,6 +34,7 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	admin.POST("/image-providers", h.saveProvider)
 	admin.PUT("/image-providers/:id", h.saveProvider)
 	admin.DELETE("/image-providers/:id", h.deleteProvider)
+	admin.POST("/image-providers/:id/test", h.testProvider)
 
 	admin.GET("/image-presets", h.listPresets)
 	admin.POST("/image-presets", h.savePreset)
@@ -42,15 +48,37 @@ func (h *Handler) listProviders(c *gin.Context) {
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if err := h.health.AnnotateProviders(c.Request.Context(), items); err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
 	response.Success(c, items)
 }
 
+// testProvider checks the provider's endpoint and key without generating an image.
+func (h *Handler) testProvider(c *gin.Context) {
+	check, err := h.health.TestProvider(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Success(c, check)
+}
+
+// providerPayload accepts api_key on writes; ImageProvider itself never serializes it.
+type providerPayload struct {
+	model.ImageProvider
+	APIKey string `json:"api_key"`
+}
+
 func (h *Handler) saveProvider(c *gin.Context) {
-	var payload model.ImageProvider
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	var body providerPayload
+	if err := c.ShouldBindJSON(&body); err != nil {
 		response.Error(c, http.StatusBadRequest, "invalid body")
 		return
 	}
+	payload := body.ImageProvider
+	payload.APIKey = strings.TrimSpace(body.APIKey)
 	if payload.ID == "" {
 		payload.ID = c.Param("id")
 	}
@@ -116,6 +144,10 @@ func (h *Handler) savePreset(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "preset_json must be valid JSON")
 		return
 	}
+	if err := validateMacros(payload.PresetJSON); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
 	item, err := h.presets.Save(c.Request.Context(), &payload)
 	if err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
@@ -139,3 +171,19 @@ func validateJSON(raw string) error {
 	var v interface{}
 	return json.Unmarshal([]byte(raw), &v)
 }
+
+// validateMacros checks the macros in the preset's instruction and style.
+func validateMacros(raw string) error {
+	var cfg struct {
+		Instruction string `json:"instruction"`
+		Style       string `json:"style"`
+	}
+	_ = json.Unmarshal([]byte(raw), &cfg)
+	if err := macro.Validate(cfg.Instruction); err != nil {
+		return fmt.Errorf("instruction: %w", err)
+	}
+	if err := macro.Validate(cfg.Style); err != nil {
+		return fmt.Errorf("style: %w", err)
+	}
+	return nil
+}
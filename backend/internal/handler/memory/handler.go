@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"net/http"
+
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/pkg/middleware"
+	"github.com/example/ai-avatar-studio/internal/pkg/response"
+	memorysvc "github.com/example/ai-avatar-studio/internal/service/memory"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler lets users review, pin, edit and forget what a role remembers about them.
+type Handler struct {
+	service *memorysvc.Service
+	secret  string
+}
+
+func NewHandler(service *memorysvc.Service, secret string) *Handler {
+	return &Handler{service: service, secret: secret}
+}
+
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	auth := middleware.Authenticator(h.secret)
+	rg.GET("/chat/roles/:id/memories", auth, h.list)
+	rg.POST("/chat/roles/:id/memories", auth, h.create)
+	rg.PATCH("/chat/roles/:id/memories/:memoryId", auth, h.update)
+	rg.DELETE("/chat/roles/:id/memories/:memoryId", auth, h.forget)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	items, err := h.service.List(c.Request.Context(), middleware.CurrentUserID(c), c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, items)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var req struct {
+		Kind    string `json:"kind"`
+		Content string `json:"content"`
+		Pinned  bool   `json:"pinned"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	capsule, err := h.service.Create(c.Request.Context(), middleware.CurrentUserID(c), c.Param("id"), req.Kind, req.Content, req.Pinned)
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Created(c, capsule)
+}
+
+func (h *Handler) update(c *gin.Context) {
+	var patch memorysvc.MemoryPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	capsule, err := h.service.Update(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"), c.Param("memoryId"), patch)
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, capsule)
+}
+
+func (h *Handler) forget(c *gin.Context) {
+	if err := h.service.Forget(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"), c.Param("memoryId")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, gin.H{"status": "deleted"})
+}
@@ -0,0 +1,84 @@
+package persona
+
+import (
+	"net/http"
+
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/pkg/middleware"
+	"github.com/example/ai-avatar-studio/internal/pkg/response"
+	personasvc "github.com/example/ai-avatar-studio/internal/service/persona"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes CRUD for the personas users play in chats.
+type Handler struct {
+	service *personasvc.Service
+	secret  string
+}
+
+func NewHandler(service *personasvc.Service, secret string) *Handler {
+	return &Handler{service: service, secret: secret}
+}
+
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	auth := middleware.Authenticator(h.secret)
+	rg.GET("/personas", auth, h.list)
+	rg.POST("/personas", auth, h.create)
+	rg.PATCH("/personas/:id", auth, h.update)
+	rg.DELETE("/personas/:id", auth, h.delete)
+	rg.POST("/personas/:id/default", auth, h.setDefault)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	items, err := h.service.List(c.Request.Context(), middleware.CurrentUserID(c))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, items)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var in personasvc.Input
+	if err := c.ShouldBindJSON(&in); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	persona, err := h.service.Create(c.Request.Context(), middleware.CurrentUserID(c), in)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Created(c, persona)
+}
+
+func (h *Handler) update(c *gin.Context) {
+	var in personasvc.Input
+	if err := c.ShouldBindJSON(&in); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid body")
+		return
+	}
+	persona, err := h.service.Update(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"), in)
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
+		return
+	}
+	response.Success(c, persona)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	if err := h.service.Delete(c.Request.Context(), middleware.CurrentActor(c), c.Param("id")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, gin.H{"status": "deleted"})
+}
+
+func (h *Handler) setDefault(c *gin.Context) {
+	persona, err := h.service.SetDefault(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"))
+	if err != nil {
+		response.Error(c, authz.Status(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	response.Success(c, persona)
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	"github.com/example/ai-avatar-studio/internal/pkg/middleware"
 	"github.com/example/ai-avatar-studio/internal/pkg/response"
 	rolesvc "github.com/example/ai-avatar-studio/internal/service/role"
@@ -68,47 +69,45 @@ func (h *Handler) get(c *gin.Context) {
 }
 
 func (h *Handler) create(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
 	var payload model.Role
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		response.Error(c, http.StatusBadRequest, "invalid body")
 		return
 	}
-	role, err := h.service.Save(c.Request.Context(), userID, &payload)
+	role, err := h.service.Save(c.Request.Context(), middleware.CurrentActor(c), &payload)
 	if err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Created(c, role)
 }
 
 func (h *Handler) update(c *gin.Context) {
-	userID := middleware.CurrentUserID(c)
 	var payload model.Role
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		response.Error(c, http.StatusBadRequest, "invalid body")
 		return
 	}
 	payload.ID = c.Param("id")
-	role, err := h.service.Save(c.Request.Context(), userID, &payload)
+	role, err := h.service.Save(c.Request.Context(), middleware.CurrentActor(c), &payload)
 	if err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, role)
 }
 
 func (h *Handler) publish(c *gin.Context) {
-	if err := h.service.Publish(c.Request.Context(), c.Param("id")); err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+	if err := h.service.Publish(c.Request.Context(), middleware.CurrentActor(c), c.Param("id")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"status": "published"})
 }
 
 func (h *Handler) archive(c *gin.Context) {
-	if err := h.service.Archive(c.Request.Context(), c.Param("id")); err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+	if err := h.service.Archive(c.Request.Context(), middleware.CurrentActor(c), c.Param("id")); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"status": "archived"})
@@ -122,8 +121,8 @@ func (h *Handler) snapshotPrompt(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "prompt required")
 		return
 	}
-	if err := h.service.SnapshotPrompt(c.Request.Context(), c.Param("id"), req.Prompt); err != nil {
-		response.Error(c, http.StatusBadRequest, err.Error())
+	if err := h.service.SnapshotPrompt(c.Request.Context(), middleware.CurrentActor(c), c.Param("id"), req.Prompt); err != nil {
+		response.Error(c, authz.Status(err, http.StatusBadRequest), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"status": "saved"})
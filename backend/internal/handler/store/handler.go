@@ -26,23 +26,25 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 }
 
 func (h *Handler) options(c *gin.Context) {
-	response.Success(c, gin.H{
-		"amounts":      []int{5, 10, 20},
-		"descriptions": []string{"Buy a coffee", "Cheer loudly", "Monthly pass"},
-	})
+	response.Success(c, h.service.Options())
 }
 
 func (h *Handler) tip(c *gin.Context) {
 	var req struct {
-		RoleID string `json:"role_id"`
-		Amount int64  `json:"amount"`
+		RoleID         string `json:"role_id"`
+		Amount         int64  `json:"amount"`
+		Message        string `json:"message"`
+		IdempotencyKey string `json:"idempotency_key"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, http.StatusBadRequest, "invalid body")
 		return
 	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	}
 	userID := middleware.CurrentUserID(c)
-	event, wallet, err := h.service.TipRole(c.Request.Context(), userID, req.RoleID, req.Amount)
+	event, wallet, err := h.service.TipRole(c.Request.Context(), userID, req.RoleID, req.Amount, req.Message, req.IdempotencyKey)
 	if err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
@@ -10,3 +10,40 @@ type UserAsset struct {
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
+
+// Coin ledger reasons.
+const (
+	LedgerReasonOpening   = "opening"
+	LedgerReasonRecharge  = "recharge"
+	LedgerReasonModelCall = "model_call"
+	LedgerReasonTip       = "tip"
+	LedgerReasonRefund    = "refund"
+)
+
+// CoinLedgerEntry is the user-facing leg of a double-entry balance change.
+type CoinLedgerEntry struct {
+	ID             string    `json:"id"`
+	TransactionID  string    `json:"transaction_id"`
+	UserID         string    `json:"user_id"`
+	Amount         int64     `json:"amount"`
+	BalanceAfter   int64     `json:"balance_after"`
+	Reason         string    `json:"reason"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	RefID          string    `json:"ref_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Replayed is set when the idempotency key had already been applied and nothing changed.
+	Replayed bool `json:"-"`
+}
+
+// CoinHold reserves coins for an in-flight model call until it is captured or released.
+type CoinHold struct {
+	ID             string    `json:"id"`
+	UserID         string    `json:"user_id"`
+	Amount         int64     `json:"amount"`
+	CapturedAmount int64     `json:"captured_amount"`
+	Status         string    `json:"status"` // held | captured | released
+	RefID          string    `json:"ref_id,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -9,24 +9,62 @@ type ChatSession struct {
 	RoleID    string              `json:"role_id" db:"role_id"`
 	ModelKey  string              `json:"model_key" db:"model_key"`
 	Title     string              `json:"title" db:"title"`
-	Summary   string              `json:"summary" db:"summary"` // Auto-generated summary
+	Summary   string              `json:"summary" db:"summary"` // Rendered current summaries, see ChatSummary
 	LastMsg   string              `json:"last_message,omitempty" db:"last_message"`
 	Mode      string              `json:"mode" db:"mode"`       // "sfw", "nsfw"
 	Status    string              `json:"status" db:"status"`   // "active", "archived"
 	Settings  ChatSessionSettings `json:"settings" db:"settings"`
+	PersonaID string              `json:"persona_id,omitempty" db:"persona_id"` // overrides the user's default persona
+	Variables map[string]string   `json:"variables" db:"variables"`           // set by {{setvar}} macros
 	CreatedAt time.Time           `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time           `json:"updated_at" db:"updated_at"`
+
+	// SummaryWatermark is the last message covered by the summaries; later ones are not summarized yet.
+	SummaryWatermark string `json:"-" db:"summary_watermark"`
+}
+
+// Summary levels: chapters cover a run of messages, the arc folds older chapters together.
+const (
+	SummaryChapter = "chapter"
+	SummaryArc     = "arc"
+)
+
+// Summary sources.
+const (
+	SummaryAuto   = "auto"
+	SummaryEdited = "edited"
+)
+
+// ChatSummary is one version of a chapter or arc summary. Rows are never changed in place: an edit
+// or merge adds new rows and retires the old ones, so IsCurrent marks the live set.
+type ChatSummary struct {
+	ID               string    `json:"id"`
+	SessionID        string    `json:"session_id"`
+	Level            string    `json:"level"`
+	Position         int       `json:"position"` // order of chapters; an arc takes its last chapter's
+	Version          int       `json:"version"`  // per session, increases with every change
+	Content          string    `json:"content"`
+	ThroughMessageID string    `json:"through_message_id,omitempty"`
+	MessageCount     int       `json:"message_count"`
+	Source           string    `json:"source"`
+	IsCurrent        bool      `json:"is_current"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
-// ChatMessage stores each user or assistant exchange.
+// ChatMessage stores each user or assistant exchange. Messages form a tree per session: retries
+// add siblings and only the active child of each parent is on the visible path.
 type ChatMessage struct {
-	ID          string                 `json:"id"`
-	SessionID   string                 `json:"session_id"`
-	Role        string                 `json:"role"` // user, assistant, system
-	Content     string                 `json:"content"`
-	IsImportant bool                   `json:"is_important"`
-	Metadata    map[string]interface{} `json:"metadata"`
-	CreatedAt   time.Time              `json:"created_at"`
+	ID           string                 `json:"id"`
+	SessionID    string                 `json:"session_id"`
+	ParentID     string                 `json:"parent_id,omitempty"` // empty for a root message
+	Role         string                 `json:"role"`                // user, assistant, system
+	Content      string                 `json:"content"`
+	IsImportant  bool                   `json:"is_important"`
+	IsActive     bool                   `json:"is_active"`     // selected candidate among its siblings
+	SiblingIndex int                    `json:"sibling_index"` // 1-based swipe position
+	SiblingCount int                    `json:"sibling_count"`
+	Metadata     map[string]interface{} `json:"metadata"`
+	CreatedAt    time.Time              `json:"created_at"`
 }
 
 // ChatSessionSettings capture per-session knobs that influence prompting.
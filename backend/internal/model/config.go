@@ -1,29 +1,72 @@
 package model
 
-import "time"
+import (
+	"math"
+	"strings"
+	"time"
+)
 
 // ModelConfig describes an LLM option managed by admins.
 type ModelConfig struct {
-	ID               string    `json:"id"`
-	Name             string    `json:"name"`
-	Description      string    `json:"description"`
-	Provider         string    `json:"provider"`
-	BaseURL          string    `json:"base_url"`
-	ModelName        string    `json:"model_name"`
-	APIKey           string    `json:"-"`
-	Temperature      float64   `json:"temperature"`
-	MaxTokens        int       `json:"max_tokens"`
-	IsDefault        bool      `json:"is_default"`
-	IsEnabled        bool      `json:"is_enabled"`
-	Status           string    `json:"status"`
-	HasAPIKey        bool      `json:"has_api_key"`
-	MaxContextTokens int       `json:"max_context_tokens"`
-	PriceCoins       int64     `json:"price_coins"`
-	PriceHint        string    `json:"price_hint"`
-	ShareRolePct     float64   `json:"share_role_pct"`
-	SharePresetPct   float64   `json:"share_preset_pct"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               string  `json:"id"`
+	Name             string  `json:"name"`
+	Description      string  `json:"description"`
+	Provider         string  `json:"provider"`
+	BaseURL          string  `json:"base_url"`
+	ModelName        string  `json:"model_name"`
+	APIKey           string  `json:"-"`
+	Temperature      float64 `json:"temperature"`
+	MaxTokens        int     `json:"max_tokens"`
+	IsDefault        bool    `json:"is_default"`
+	IsEnabled        bool    `json:"is_enabled"`
+	Status           string  `json:"status"`
+	HasAPIKey        bool    `json:"has_api_key"`
+	APIKeyHint       string  `json:"api_key_hint,omitempty"` // masked suffix of the key, e.g. ****abcd
+	MaxContextTokens int     `json:"max_context_tokens"`
+	PriceCoins       int64   `json:"price_coins"`
+	PriceHint        string  `json:"price_hint"`
+	ShareRolePct     float64 `json:"share_role_pct"`
+	SharePresetPct   float64 `json:"share_preset_pct"`
+	InputPricePer1K  float64 `json:"input_price_per_1k"`
+	OutputPricePer1K float64 `json:"output_price_per_1k"`
+	// Resilience: models tried in order after this one fails, retries per model with jittered
+	// backoff, and the consecutive failures / cooldown of the per-model circuit breaker.
+	FallbackModelIDs       []string  `json:"fallback_model_ids"`
+	MaxRetries             int       `json:"max_retries"`
+	RetryBackoffMs         int       `json:"retry_backoff_ms"`
+	BreakerThreshold       int       `json:"breaker_threshold"`
+	BreakerCooldownSeconds int       `json:"breaker_cooldown_seconds"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+
+	// ThinkingBudgetTokens turns on extended thinking where the provider supports it (Anthropic);
+	// 0 leaves it off.
+	ThinkingBudgetTokens int `json:"thinking_budget_tokens"`
+
+	Health *HealthSummary `json:"health,omitempty"`
+}
+
+// Serviceable reports whether the model may answer chats; degraded models stay in rotation
+// while the prober watches them.
+func (m *ModelConfig) Serviceable() bool {
+	return strings.EqualFold(m.Status, "active") || strings.EqualFold(m.Status, "degraded")
+}
+
+// UsesTokenPricing reports whether the model bills per token rather than only per call.
+func (m *ModelConfig) UsesTokenPricing() bool {
+	return m.InputPricePer1K > 0 || m.OutputPricePer1K > 0
+}
+
+// CallCost returns the coins charged for one call: the flat price_coins fee plus the per-1K token
+// prices, rounded up so a paid call never rounds down to free.
+func (m *ModelConfig) CallCost(promptTokens, completionTokens int) int64 {
+	cost := float64(m.PriceCoins)
+	cost += float64(promptTokens) / 1000 * m.InputPricePer1K
+	cost += float64(completionTokens) / 1000 * m.OutputPricePer1K
+	if cost <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(cost))
 }
 
 // DictionaryItem stores curated vocabulary used by the UI.
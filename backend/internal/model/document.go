@@ -4,26 +4,68 @@ import "time"
 
 // Document stores unstructured knowledge base content for retrieval.
 type Document struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	Source    string    `json:"source"`
-	CreatedAt time.Time `json:"created_at"`
+	ID           string    `json:"id"`
+	RoleID       string    `json:"role_id,omitempty"`
+	WorldbookID  string    `json:"worldbook_id,omitempty"`
+	Title        string    `json:"title"`
+	Source       string    `json:"source"`
+	Format       string    `json:"format"` // text | markdown | json
+	Content      string    `json:"-"`
+	Status       string    `json:"status"` // pending | processing | ready | failed
+	Progress     int       `json:"progress"`
+	ChunkCount   int       `json:"chunk_count"`
+	ChunkSize    int       `json:"chunk_size"`
+	ChunkOverlap int       `json:"chunk_overlap"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // DocumentChunk stores embeddings for similarity search.
 type DocumentChunk struct {
-	ID         string    `json:"id"`
-	DocumentID string    `json:"document_id"`
-	Content    string    `json:"content"`
-	Embedding  []float32 `json:"embedding"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID             string    `json:"id"`
+	DocumentID     string    `json:"document_id"`
+	ChunkIndex     int       `json:"chunk_index"`
+	Content        string    `json:"content"`
+	Embedding      []float32 `json:"-"`
+	EmbeddingModel string    `json:"embedding_model"`
+	Score          float64   `json:"score,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
-// MemoryCapsule stores persona-specific preferences.
+// Memory kinds the extractor sorts facts into.
+const (
+	MemoryName         = "name"
+	MemoryRelationship = "relationship"
+	MemoryPreference   = "preference"
+	MemoryPromise      = "promise"
+	MemoryFact         = "fact"
+)
+
+// Memory sources: written by the user or extracted from the conversation by a model.
+const (
+	MemorySourceUser      = "user"
+	MemorySourceExtracted = "extracted"
+)
+
+// MemoryCapsule stores a durable fact about the user for one role.
 type MemoryCapsule struct {
 	ID        string    `json:"id"`
 	UserID    string    `json:"user_id"`
 	RoleID    string    `json:"role_id"`
+	Kind      string    `json:"kind"`
 	Content   string    `json:"content"`
+	Pinned    bool      `json:"pinned"`
+	Source    string    `json:"source"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ValidMemoryKind reports whether kind is one of the memory kinds.
+func ValidMemoryKind(kind string) bool {
+	switch kind {
+	case MemoryName, MemoryRelationship, MemoryPreference, MemoryPromise, MemoryFact:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Health check target types.
+const (
+	HealthTargetModel         = "model"
+	HealthTargetImageProvider = "image_provider"
+)
+
+// HealthCheck is the outcome of one connection test against a model or image provider.
+type HealthCheck struct {
+	ID            string    `json:"id"`
+	TargetType    string    `json:"target_type"`
+	TargetID      string    `json:"target_id"`
+	OK            bool      `json:"ok"`
+	LatencyMs     int       `json:"latency_ms"`
+	ResolvedModel string    `json:"resolved_model,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// HealthSummary aggregates recent checks for the admin lists.
+type HealthSummary struct {
+	LastCheckedAt time.Time `json:"last_checked_at"`
+	LastOK        bool      `json:"last_ok"`
+	LastLatencyMs int       `json:"last_latency_ms"`
+	LastError     string    `json:"last_error,omitempty"`
+	Checks        int       `json:"checks"`
+	Failures      int       `json:"failures"`
+	ErrorRate     float64   `json:"error_rate"`
+}
@@ -7,7 +7,9 @@ type ImageProvider struct {
 	ID             string    `json:"id"`
 	Name           string    `json:"name"`
 	BaseURL        string    `json:"base_url"`
-	APIKey         string    `json:"api_key"`
+	APIKey         string    `json:"-"`
+	HasAPIKey      bool      `json:"has_api_key"`
+	APIKeyHint     string    `json:"api_key_hint,omitempty"`
 	MaxConcurrency int       `json:"max_concurrency"`
 	Weight         int       `json:"weight"`
 	Status         string    `json:"status"`
@@ -15,6 +17,8 @@ type ImageProvider struct {
 	SelectedModel  string    `json:"selected_model,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+
+	Health *HealthSummary `json:"health,omitempty"`
 }
 
 // ImagePreset stores JSON-based prompt instructions.
@@ -28,20 +32,42 @@ type ImagePreset struct {
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+// Image job states: queued until a worker holds a provider slot, running while the provider
+// draws, then succeeded or failed. A failed attempt with attempts left goes back to queued.
+const (
+	ImageJobQueued    = "queued"
+	ImageJobRunning   = "running"
+	ImageJobSucceeded = "succeeded"
+	ImageJobFailed    = "failed"
+)
+
 // ImageJob tracks a single generation request.
 type ImageJob struct {
-	ID             string    `json:"id"`
-	UserID         string    `json:"user_id"`
-	SessionID      string    `json:"session_id"`
-	MessageID      string    `json:"message_id"`
-	ProviderID     string    `json:"provider_id"`
-	PresetID       string    `json:"preset_id"`
-	Prompt         string    `json:"prompt"`
-	NegativePrompt string    `json:"negative_prompt"`
-	FinalPrompt    string    `json:"final_prompt"`
-	Status         string    `json:"status"`
-	ResultURL      string    `json:"result_url"`
-	Error          string    `json:"error"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             string     `json:"id"`
+	UserID         string     `json:"user_id"`
+	SessionID      string     `json:"session_id"`
+	MessageID      string     `json:"message_id"`
+	ProviderID     string     `json:"provider_id"`
+	PresetID       string     `json:"preset_id"`
+	Prompt         string     `json:"prompt"`
+	NegativePrompt string     `json:"negative_prompt"`
+	FinalPrompt    string     `json:"final_prompt"`
+	Status         string     `json:"status"`
+	ResultURL      string     `json:"result_url"`
+	ThumbnailURL   string     `json:"thumbnail_url,omitempty"`
+	Error          string     `json:"error"`
+	Attempts       int        `json:"attempts"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	TriedProviderIDs []string `json:"-"`
+	// Storage keys of the image and its WebP thumbnail; clients get short-lived signed URLs.
+	ImageKey     string `json:"-"`
+	ThumbnailKey string `json:"-"`
+}
+
+// Done reports whether the job reached a terminal state.
+func (j *ImageJob) Done() bool {
+	return j.Status == ImageJobSucceeded || j.Status == ImageJobFailed
 }
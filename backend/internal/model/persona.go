@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Persona is a character the user plays in chats. Its name fills {{user}} in presets and role
+// fields and its description is sent as its own prompt section.
+type Persona struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsDefault   bool      `json:"is_default"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
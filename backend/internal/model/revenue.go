@@ -20,6 +20,7 @@ type RevenueEvent struct {
 	EventType string    `json:"event_type"`
 	Amount    int64     `json:"amount"`
 	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
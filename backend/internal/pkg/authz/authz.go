@@ -0,0 +1,45 @@
+// Package authz holds the ownership rules services apply before touching a user's resources.
+// Services return ErrNotFound when the resource does not exist and ErrForbidden when it exists but
+// belongs to someone else; handlers turn them into 404 and 403 with Status.
+package authz
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Actor is the caller of a service operation.
+type Actor struct {
+	UserID  string
+	IsAdmin bool
+}
+
+// Owns reports whether the actor may act on a resource owned by ownerID; admins may act on any.
+func (a Actor) Owns(ownerID string) bool {
+	return a.IsAdmin || (a.UserID != "" && a.UserID == ownerID)
+}
+
+// RequireOwner returns ErrForbidden unless the actor owns the resource.
+func RequireOwner(a Actor, ownerID string) error {
+	if !a.Owns(ownerID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Status maps authorization errors to 404/403 and anything else to fallback.
+func Status(err error, fallback int) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return fallback
+	}
+}
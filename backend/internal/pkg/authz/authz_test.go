@@ -0,0 +1,51 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestOwns(t *testing.T) {
+	cases := []struct {
+		name  string
+		actor Actor
+		owner string
+		want  bool
+	}{
+		{"owner", Actor{UserID: "u1"}, "u1", true},
+		{"non-owner", Actor{UserID: "u2"}, "u1", false},
+		{"admin", Actor{UserID: "u9", IsAdmin: true}, "u1", true},
+		{"anonymous", Actor{}, "u1", false},
+		{"anonymous on unowned resource", Actor{}, "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.actor.Owns(tc.owner); got != tc.want {
+				t.Fatalf("Owns(%q) = %v, want %v", tc.owner, got, tc.want)
+			}
+			err := RequireOwner(tc.actor, tc.owner)
+			if tc.want != (err == nil) || (err != nil && !errors.Is(err, ErrForbidden)) {
+				t.Fatalf("RequireOwner(%q) = %v", tc.owner, err)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{ErrNotFound, http.StatusNotFound},
+		{ErrForbidden, http.StatusForbidden},
+		{fmt.Errorf("load role: %w", ErrForbidden), http.StatusForbidden},
+		{errors.New("boom"), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if got := Status(tc.err, http.StatusBadRequest); got != tc.want {
+			t.Errorf("Status(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package embedding
+
+import (
+	"context"
+	"math"
+)
+
+// Embedder turns text into fixed-width vectors for similarity search.
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+	// Name identifies the vector space so chunks embedded by another model are never compared.
+	Name() string
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 when they are not comparable.
+func Cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func normalize(vec []float32) []float32 {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vec
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= norm
+	}
+	return vec
+}
@@ -0,0 +1,104 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+const defaultHashDims = 256
+
+// HashEmbedder is a deterministic, dependency-free embedder based on feature hashing.
+// Latin text is hashed per word, CJK text per character bigram. Useful for tests and offline setups.
+type HashEmbedder struct {
+	Dims int
+}
+
+func NewHashEmbedder(dims int) HashEmbedder {
+	if dims <= 0 {
+		dims = defaultHashDims
+	}
+	return HashEmbedder{Dims: dims}
+}
+
+func (h HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", h.dims())
+}
+
+func (h HashEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(inputs))
+	for _, text := range inputs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		out = append(out, h.embedOne(text))
+	}
+	return out, nil
+}
+
+func (h HashEmbedder) dims() int {
+	if h.Dims <= 0 {
+		return defaultHashDims
+	}
+	return h.Dims
+}
+
+func (h HashEmbedder) embedOne(text string) []float32 {
+	vec := make([]float32, h.dims())
+	for _, tok := range tokenize(text) {
+		hasher := fnv.New32a()
+		_, _ = hasher.Write([]byte(tok))
+		sum := hasher.Sum32()
+		idx := int(sum % uint32(len(vec)))
+		if sum&(1<<31) != 0 {
+			vec[idx]--
+		} else {
+			vec[idx]++
+		}
+	}
+	return normalize(vec)
+}
+
+// tokenize lowercases words and splits CJK runs into overlapping bigrams.
+func tokenize(text string) []string {
+	var (
+		tokens []string
+		word   strings.Builder
+		cjk    []rune
+	)
+	flushWord := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			tokens = append(tokens, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
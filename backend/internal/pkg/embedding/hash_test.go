@@ -0,0 +1,85 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func embed(t *testing.T, h HashEmbedder, inputs ...string) [][]float32 {
+	t.Helper()
+	out, err := h.Embed(context.Background(), inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestHashEmbedder(t *testing.T) {
+	h := NewHashEmbedder(0)
+	if h.Name() != "hash-256" || NewHashEmbedder(64).Name() != "hash-64" {
+		t.Fatalf("names = %s, %s", h.Name(), NewHashEmbedder(64).Name())
+	}
+	vecs := embed(t, h, "The harbour at dawn", "the HARBOUR, at dawn!", "The harbour at dawn", "", "!!!")
+	if len(vecs) != 5 || len(vecs[0]) != 256 {
+		t.Fatalf("got %d vectors of %d dims", len(vecs), len(vecs[0]))
+	}
+	var norm float64
+	for _, v := range vecs[0] {
+		norm += float64(v) * float64(v)
+	}
+	if math.Abs(norm-1) > 1e-5 {
+		t.Fatalf("|v|^2 = %f, want a unit vector", norm)
+	}
+	// Case and punctuation do not matter, and the same text always hashes the same way.
+	if c := Cosine(vecs[0], vecs[1]); math.Abs(c-1) > 1e-6 {
+		t.Fatalf("case/punctuation cosine = %f", c)
+	}
+	if c := Cosine(vecs[0], vecs[2]); math.Abs(c-1) > 1e-6 {
+		t.Fatalf("repeat cosine = %f", c)
+	}
+	// Text without tokens embeds to the zero vector, which is similar to nothing.
+	if c := Cosine(vecs[0], vecs[3]); c != 0 || Cosine(vecs[3], vecs[4]) != 0 {
+		t.Fatalf("empty cosine = %f", c)
+	}
+}
+
+func TestHashEmbedderSimilarity(t *testing.T) {
+	h := NewHashEmbedder(0)
+	vecs := embed(t, h, "dragons guard the mountain gold", "the mountain dragons", "a quiet library of books",
+		"北方的山上有一条龙", "山上的龙", "图书馆很安静")
+	if Cosine(vecs[0], vecs[1]) <= Cosine(vecs[0], vecs[2]) {
+		t.Fatal("shared words do not rank higher than unrelated text")
+	}
+	// Chinese is hashed by character bigrams, so shared phrases count.
+	if Cosine(vecs[3], vecs[4]) <= Cosine(vecs[3], vecs[5]) {
+		t.Fatal("shared bigrams do not rank higher than unrelated text")
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Hi 你好世界 ok2")
+	want := []string{"hi", "你好", "好世", "世界", "ok2"}
+	if len(got) != len(want) {
+		t.Fatalf("tokens = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("tokens = %q, want %q", got, want)
+		}
+	}
+	if got := tokenize("龙"); len(got) != 1 || got[0] != "龙" {
+		t.Fatalf("single CJK rune = %q", got)
+	}
+}
+
+func TestCosineMismatch(t *testing.T) {
+	if Cosine([]float32{1, 0}, []float32{1, 0, 0}) != 0 || Cosine(nil, nil) != 0 {
+		t.Fatal("vectors of different widths compared")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewHashEmbedder(0).Embed(ctx, []string{"x"}); err == nil {
+		t.Fatal("Embed ignored a cancelled context")
+	}
+}
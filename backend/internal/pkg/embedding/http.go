@@ -0,0 +1,99 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+const defaultAPIBase = "https://api.openai.com/v1"
+
+// HTTPEmbedder calls an OpenAI-compatible /embeddings endpoint described by a ModelConfig.
+type HTTPEmbedder struct {
+	client *http.Client
+	cfg    *model.ModelConfig
+}
+
+func NewHTTPEmbedder(client *http.Client, cfg *model.ModelConfig) *HTTPEmbedder {
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &HTTPEmbedder{client: client, cfg: cfg}
+}
+
+func (e *HTTPEmbedder) Name() string {
+	return "model:" + e.cfg.ID + "/" + e.cfg.ModelName
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	if strings.TrimSpace(e.cfg.ModelName) == "" {
+		return nil, errors.New("embedding model missing model_name")
+	}
+	baseURL := strings.TrimSpace(e.cfg.BaseURL)
+	if baseURL == "" {
+		baseURL = defaultAPIBase
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	payload, err := json.Marshal(map[string]interface{}{
+		"model": e.cfg.ModelName,
+		"input": inputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/embeddings", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("embedding provider error: status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+	if parsed.Error != nil {
+		return nil, errors.New(parsed.Error.Message)
+	}
+	if len(parsed.Data) != len(inputs) {
+		return nil, fmt.Errorf("embedding provider returned %d vectors for %d inputs", len(parsed.Data), len(inputs))
+	}
+	out := make([][]float32, len(inputs))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(out) {
+			return nil, fmt.Errorf("embedding provider returned out-of-range index %d", item.Index)
+		}
+		out[item.Index] = normalize(item.Embedding)
+	}
+	return out, nil
+}
@@ -0,0 +1,311 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+const (
+	defaultAnthropicBase      = "https://api.anthropic.com"
+	anthropicVersion          = "2023-06-01"
+	defaultAnthropicMaxTokens = 1024
+)
+
+// AnthropicClient talks to the Anthropic Messages API.
+type AnthropicClient struct {
+	client *http.Client
+}
+
+// NewAnthropicClient wraps the provided http.Client or creates a default one.
+func NewAnthropicClient(httpClient *http.Client) *AnthropicClient {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 150 * time.Second}
+	}
+	return &AnthropicClient{client: httpClient}
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func (u anthropicUsage) toUsage() Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return Usage{PromptTokens: prompt, CompletionTokens: u.OutputTokens, TotalTokens: prompt + u.OutputTokens}
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		Thinking string `json:"thinking"`
+	} `json:"content"`
+	Model      string          `json:"model"`
+	StopReason string          `json:"stop_reason"`
+	Usage      anthropicUsage  `json:"usage"`
+	Error      *anthropicError `json:"error,omitempty"`
+}
+
+// Generate sends a non-streaming Messages request.
+func (c *AnthropicClient) Generate(ctx context.Context, messages []Message, cfg *model.ModelConfig) (Completion, error) {
+	resp, err := c.do(ctx, messages, cfg, false)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Completion{}, err
+	}
+	var parsed anthropicResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		log.Printf("llm: anthropic decode error %v body=%s", err, string(body))
+		return Completion{}, err
+	}
+	if parsed.Error != nil {
+		return Completion{}, errors.New(parsed.Error.Message)
+	}
+	var text strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	out := Completion{
+		Content:      strings.TrimSpace(text.String()),
+		Usage:        parsed.Usage.toUsage(),
+		FinishReason: anthropicFinishReason(parsed.StopReason),
+		Model:        parsed.Model,
+	}
+	if out.Content == "" {
+		log.Printf("llm: anthropic empty content stop_reason=%s", parsed.StopReason)
+	}
+	fillUsage(&out, messages)
+	return out, nil
+}
+
+// StreamGenerate streams text_delta and thinking_delta events into onChunk. A stream that ends
+// without message_stop is an error, since the reply is incomplete.
+func (c *AnthropicClient) StreamGenerate(ctx context.Context, messages []Message, cfg *model.ModelConfig, onChunk func(contentDelta string, reasoningDelta string)) (Completion, error) {
+	resp, err := c.do(ctx, messages, cfg, true)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	var out Completion
+	var usage anthropicUsage
+	var content strings.Builder
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) && strings.TrimSpace(line) == "" {
+			// A complete stream ends with message_stop; anything else was cut off.
+			return Completion{}, fmt.Errorf("anthropic stream ended before message_stop: %w", ErrIncompleteStream)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Completion{}, err
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue // "event:" lines repeat the type carried in the data payload
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		var event struct {
+			Type    string `json:"type"`
+			Message struct {
+				Model string         `json:"model"`
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type       string `json:"type"`
+				Text       string `json:"text"`
+				Thinking   string `json:"thinking"`
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage *anthropicUsage `json:"usage"`
+			Error *anthropicError `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			log.Printf("llm: anthropic stream decode err=%v payload=%s", err, payload)
+			continue
+		}
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+			out.Model = event.Message.Model
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				content.WriteString(event.Delta.Text)
+				onChunk(event.Delta.Text, "")
+			case "thinking_delta":
+				onChunk("", event.Delta.Thinking)
+			}
+		case "message_delta":
+			// output_tokens here is cumulative for the whole message.
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+			if event.Delta.StopReason != "" {
+				out.FinishReason = anthropicFinishReason(event.Delta.StopReason)
+			}
+		case "error":
+			if event.Error != nil {
+				return Completion{}, errors.New(event.Error.Message)
+			}
+			return Completion{}, errors.New("anthropic stream error")
+		case "message_stop":
+			out.Content = content.String()
+			out.Usage = usage.toUsage()
+			fillUsage(&out, messages)
+			return out, nil
+		}
+	}
+}
+
+func (c *AnthropicClient) do(ctx context.Context, messages []Message, cfg *model.ModelConfig, stream bool) (*http.Response, error) {
+	if strings.TrimSpace(cfg.ModelName) == "" {
+		return nil, errors.New("model missing model_name")
+	}
+	system, turns := buildAnthropicMessages(messages)
+	maxTokens := cfg.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	reqBody := map[string]interface{}{
+		"model":    cfg.ModelName,
+		"messages": turns,
+	}
+	if system != "" {
+		reqBody["system"] = system
+	}
+	if budget := cfg.ThinkingBudgetTokens; budget > 0 {
+		// max_tokens covers thinking and reply, and thinking only runs at the default temperature.
+		reqBody["thinking"] = map[string]interface{}{"type": "enabled", "budget_tokens": budget}
+		maxTokens += budget
+	} else if cfg.Temperature > 0 {
+		// Messages API accepts 0..1.
+		reqBody["temperature"] = clampTemperature(cfg.Temperature, 1)
+	} else {
+		reqBody["temperature"] = 0.8
+	}
+	reqBody["max_tokens"] = maxTokens
+	if stream {
+		reqBody["stream"] = true
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, anthropicEndpoint(cfg.BaseURL), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", cfg.APIKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		perr := newProviderError(resp.StatusCode, body)
+		log.Printf("llm: %s", perr)
+		return nil, perr
+	}
+	return resp, nil
+}
+
+// anthropicEndpoint accepts a base URL with or without the /v1 suffix.
+func anthropicEndpoint(baseURL string) string {
+	base := strings.TrimSuffix(strings.TrimSpace(baseURL), "/")
+	if base == "" {
+		base = defaultAnthropicBase
+	}
+	if strings.HasSuffix(base, "/v1") {
+		return base + "/messages"
+	}
+	return base + "/v1/messages"
+}
+
+// buildAnthropicMessages moves the system messages that open the conversation into the top-level
+// system field and merges consecutive same-role turns, which the Messages API requires to
+// alternate. System messages placed later, e.g. after the chat history, are sent as user turns so
+// they keep their position.
+func buildAnthropicMessages(messages []Message) (string, []anthropicMessage) {
+	var system []string
+	var turns []anthropicMessage
+	for _, msg := range messages {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		role := normalizeRole(msg.Role)
+		if role == RoleSystem {
+			if len(turns) == 0 {
+				system = append(system, content)
+				continue
+			}
+			role = RoleUser
+		}
+		if n := len(turns); n > 0 && turns[n-1].Role == role {
+			turns[n-1].Content += "\n\n" + content
+			continue
+		}
+		turns = append(turns, anthropicMessage{Role: role, Content: content})
+	}
+	// The conversation must open with a user turn.
+	if len(turns) == 0 || turns[0].Role != RoleUser {
+		turns = append([]anthropicMessage{{Role: RoleUser, Content: "Generate based on the above instructions."}}, turns...)
+	}
+	return strings.Join(system, "\n\n"), turns
+}
+
+// anthropicFinishReason maps stop_reason onto the OpenAI finish_reason values the app uses.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "":
+		return ""
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func clampTemperature(v, max float64) float64 {
+	if v > max {
+		return max
+	}
+	return v
+}
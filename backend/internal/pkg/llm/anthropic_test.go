@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+// anthropicStub stands in for the Messages API: it records the last request body and answers with
+// reply, which is written as is.
+type anthropicStub struct {
+	t       *testing.T
+	status  int
+	reply   string
+	request map[string]interface{}
+	header  http.Header
+}
+
+func (s *anthropicStub) serve() *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			s.t.Errorf("path = %s, want /v1/messages", r.URL.Path)
+		}
+		s.header = r.Header.Clone()
+		s.request = map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&s.request); err != nil {
+			s.t.Errorf("decode request: %v", err)
+		}
+		if s.status != 0 {
+			w.WriteHeader(s.status)
+		}
+		fmt.Fprint(w, s.reply)
+	}))
+	s.t.Cleanup(srv.Close)
+	return srv
+}
+
+func anthropicModel(baseURL string) *model.ModelConfig {
+	return &model.ModelConfig{ID: "m1", Provider: "anthropic", BaseURL: baseURL, ModelName: "claude-test", APIKey: "sk-test", MaxTokens: 512, Temperature: 1.4}
+}
+
+// sse renders events as a Messages API stream.
+func sse(events ...string) string {
+	var b strings.Builder
+	for _, e := range events {
+		var head struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal([]byte(e), &head)
+		fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", head.Type, e)
+	}
+	return b.String()
+}
+
+var streamEvents = []string{
+	`{"type":"message_start","message":{"model":"claude-test-2024","usage":{"input_tokens":12,"cache_read_input_tokens":3,"output_tokens":1}}}`,
+	`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+	`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me think."}}`,
+	`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+	`{"type":"ping"}`,
+	`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":" there"}}`,
+	`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":7}}`,
+	`{"type":"message_stop"}`,
+}
+
+func TestAnthropicRequest(t *testing.T) {
+	messages := []Message{
+		{Role: RoleSystem, Content: "You are Aria."},
+		{Role: RoleSystem, Content: "Stay in character."},
+		{Role: RoleAssistant, Content: "Welcome!"},
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleUser, Content: "anyone there?"},
+		{Role: RoleSystem, Content: "Keep it short."},
+	}
+	t.Run("plain", func(t *testing.T) {
+		stub := &anthropicStub{t: t, reply: `{"content":[{"type":"text","text":"ok"}]}`}
+		srv := stub.serve()
+		if _, err := NewAnthropicClient(srv.Client()).Generate(context.Background(), messages, anthropicModel(srv.URL)); err != nil {
+			t.Fatal(err)
+		}
+		if got := stub.header.Get("x-api-key"); got != "sk-test" {
+			t.Errorf("x-api-key = %q", got)
+		}
+		if got := stub.header.Get("anthropic-version"); got != anthropicVersion {
+			t.Errorf("anthropic-version = %q", got)
+		}
+		req := stub.request
+		if req["system"] != "You are Aria.\n\nStay in character." {
+			t.Errorf("system = %q", req["system"])
+		}
+		raw, _ := json.Marshal(req["messages"])
+		var turns []anthropicMessage
+		_ = json.Unmarshal(raw, &turns)
+		want := []anthropicMessage{
+			{Role: RoleUser, Content: "Generate based on the above instructions."},
+			{Role: RoleAssistant, Content: "Welcome!"},
+			{Role: RoleUser, Content: "hi\n\nanyone there?\n\nKeep it short."},
+		}
+		if fmt.Sprint(turns) != fmt.Sprint(want) {
+			t.Errorf("messages = %+v\nwant %+v", turns, want)
+		}
+		if req["temperature"] != 1.0 || req["max_tokens"] != 512.0 {
+			t.Errorf("temperature = %v, max_tokens = %v", req["temperature"], req["max_tokens"])
+		}
+		if _, ok := req["thinking"]; ok {
+			t.Error("thinking sent for a model without a thinking budget")
+		}
+	})
+	t.Run("thinking", func(t *testing.T) {
+		stub := &anthropicStub{t: t, reply: `{"content":[{"type":"thinking","thinking":"hmm"},{"type":"text","text":"ok"}]}`}
+		srv := stub.serve()
+		cfg := anthropicModel(srv.URL + "/v1")
+		cfg.ThinkingBudgetTokens = 2048
+		out, err := NewAnthropicClient(srv.Client()).Generate(context.Background(), messages, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Content != "ok" {
+			t.Errorf("content = %q, want thinking left out", out.Content)
+		}
+		thinking, _ := json.Marshal(stub.request["thinking"])
+		if string(thinking) != `{"budget_tokens":2048,"type":"enabled"}` {
+			t.Errorf("thinking = %s", thinking)
+		}
+		if stub.request["max_tokens"] != 2560.0 {
+			t.Errorf("max_tokens = %v, want budget plus reply tokens", stub.request["max_tokens"])
+		}
+		if _, ok := stub.request["temperature"]; ok {
+			t.Error("temperature sent with thinking enabled")
+		}
+	})
+}
+
+func TestAnthropicGenerate(t *testing.T) {
+	stub := &anthropicStub{t: t, reply: `{"model":"claude-test-2024","stop_reason":"end_turn",
+		"content":[{"type":"text","text":"Hello "},{"type":"text","text":"there"}],
+		"usage":{"input_tokens":10,"cache_creation_input_tokens":5,"output_tokens":4}}`}
+	srv := stub.serve()
+	out, err := NewAnthropicClient(srv.Client()).Generate(context.Background(), Conversation("sys", nil), anthropicModel(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Content != "Hello there" || out.Model != "claude-test-2024" || out.FinishReason != "stop" {
+		t.Fatalf("out = %+v", out)
+	}
+	if out.Usage != (Usage{PromptTokens: 15, CompletionTokens: 4, TotalTokens: 19}) {
+		t.Fatalf("usage = %+v", out.Usage)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	stub := &anthropicStub{t: t, reply: sse(streamEvents...)}
+	srv := stub.serve()
+	var content, reasoning strings.Builder
+	out, err := NewAnthropicClient(srv.Client()).StreamGenerate(context.Background(), Conversation("sys", nil), anthropicModel(srv.URL), func(c, r string) {
+		content.WriteString(c)
+		reasoning.WriteString(r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.request["stream"] != true {
+		t.Error("stream not requested")
+	}
+	if content.String() != "Hello there" || reasoning.String() != "Let me think." {
+		t.Fatalf("content = %q, reasoning = %q", content.String(), reasoning.String())
+	}
+	if out.Content != "Hello there" || out.Model != "claude-test-2024" || !out.Truncated() {
+		t.Fatalf("out = %+v", out)
+	}
+	if out.Usage != (Usage{PromptTokens: 15, CompletionTokens: 7, TotalTokens: 22}) {
+		t.Fatalf("usage = %+v", out.Usage)
+	}
+}
+
+func TestAnthropicStreamErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		reply  string
+		want   string
+	}{
+		{"cut off", 0, sse(streamEvents[:4]...), "before message_stop"},
+		{"cut off mid line", 0, sse(streamEvents[:4]...) + `data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"x"}}`, "before message_stop"},
+		{"empty body", 0, "", "before message_stop"},
+		{"error event", 0, sse(streamEvents[0], `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`), "Overloaded"},
+		{"http error", http.StatusTooManyRequests, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`, "status=429"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := &anthropicStub{t: t, status: tc.status, reply: tc.reply}
+			srv := stub.serve()
+			_, err := NewAnthropicClient(srv.Client()).StreamGenerate(context.Background(), Conversation("sys", nil), anthropicModel(srv.URL), func(string, string) {})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want it to mention %q", err, tc.want)
+			}
+			if tc.status == http.StatusTooManyRequests && !IsRetryable(err) {
+				t.Fatal("429 is not retryable")
+			}
+		})
+	}
+	// The last event may arrive without a trailing newline.
+	stub := &anthropicStub{t: t, reply: strings.TrimRight(sse(streamEvents...), "\n")}
+	srv := stub.serve()
+	if _, err := NewAnthropicClient(srv.Client()).StreamGenerate(context.Background(), nil, anthropicModel(srv.URL), func(string, string) {}); err != nil {
+		t.Fatalf("stream without trailing newline: %v", err)
+	}
+}
+
+func TestRouterPicksAnthropic(t *testing.T) {
+	stub := &anthropicStub{t: t, reply: `{"content":[{"type":"text","text":"from anthropic"}]}`}
+	srv := stub.serve()
+	cfg := anthropicModel(srv.URL)
+	cfg.Provider = " Anthropic "
+	out, err := NewRouterClient(srv.Client()).Generate(context.Background(), Conversation("sys", nil), cfg)
+	if err != nil || out.Content != "from anthropic" {
+		t.Fatalf("out = %+v, err = %v", out, err)
+	}
+	if stub.request["model"] != "claude-test" {
+		t.Fatalf("model = %v", stub.request["model"])
+	}
+}
@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker is an in-process circuit breaker keyed by model ID. After threshold consecutive failures
+// the model is skipped until the cooldown passes; then one trial call per cooldown is let through
+// (half-open) and its outcome closes or re-opens the circuit.
+type Breaker struct {
+	mu     sync.Mutex
+	models map[string]*breakerState
+}
+
+type breakerState struct {
+	failures   int
+	cooldown   time.Duration
+	openUntil  time.Time
+	trialUntil time.Time // a trial call is in flight; a lost trial (e.g. cancelled) expires with it
+}
+
+// BreakerStatus is a snapshot of one model's circuit.
+type BreakerStatus struct {
+	ModelID   string    `json:"model_id"`
+	Failures  int       `json:"failures"`
+	Open      bool      `json:"open"`
+	OpenUntil time.Time `json:"open_until,omitempty"`
+}
+
+func NewBreaker() *Breaker {
+	return &Breaker{models: map[string]*breakerState{}}
+}
+
+// Allow reports whether a call to the model may proceed.
+func (b *Breaker) Allow(modelID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.models[modelID]
+	if st == nil || st.openUntil.IsZero() {
+		return true
+	}
+	now := time.Now()
+	if now.Before(st.openUntil) || now.Before(st.trialUntil) {
+		return false
+	}
+	st.trialUntil = now.Add(st.cooldown)
+	return true
+}
+
+// Success closes the model's circuit.
+func (b *Breaker) Success(modelID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.models, modelID)
+}
+
+// Failure records a failed call and opens the circuit once threshold consecutive failures are reached.
+func (b *Breaker) Failure(modelID string, threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.models[modelID]
+	if st == nil {
+		st = &breakerState{}
+		b.models[modelID] = st
+	}
+	st.failures++
+	st.cooldown = cooldown
+	st.trialUntil = time.Time{}
+	if st.failures >= threshold {
+		st.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+// Status returns the state of every model with recorded failures.
+func (b *Breaker) Status() []BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	out := make([]BreakerStatus, 0, len(b.models))
+	for id, st := range b.models {
+		out = append(out, BreakerStatus{
+			ModelID:   id,
+			Failures:  st.failures,
+			Open:      now.Before(st.openUntil),
+			OpenUntil: st.openUntil,
+		})
+	}
+	return out
+}
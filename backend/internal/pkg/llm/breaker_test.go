@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := NewBreaker()
+	b.Failure("m", 2, time.Hour)
+	if !b.Allow("m") {
+		t.Fatal("circuit opened below the threshold")
+	}
+	b.Failure("m", 2, time.Hour)
+	if b.Allow("m") {
+		t.Fatal("circuit closed at the threshold")
+	}
+	if !b.Allow("other") {
+		t.Fatal("one model's failures blocked another")
+	}
+	st := b.Status()
+	if len(st) != 1 || st[0].ModelID != "m" || st[0].Failures != 2 || !st[0].Open {
+		t.Fatalf("status = %+v", st)
+	}
+	b.Success("m")
+	if !b.Allow("m") || len(b.Status()) != 0 {
+		t.Fatal("Success did not close the circuit")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := NewBreaker()
+	cooldown := 20 * time.Millisecond
+	b.Failure("m", 1, cooldown)
+	if b.Allow("m") {
+		t.Fatal("circuit closed during the cooldown")
+	}
+	time.Sleep(cooldown + 5*time.Millisecond)
+	// One trial call goes through after the cooldown; others wait for its outcome.
+	if !b.Allow("m") {
+		t.Fatal("no trial after the cooldown")
+	}
+	if b.Allow("m") {
+		t.Fatal("a second call joined the trial")
+	}
+	// A failed trial re-opens the circuit for another cooldown.
+	b.Failure("m", 1, cooldown)
+	if b.Allow("m") {
+		t.Fatal("failed trial left the circuit closed")
+	}
+	time.Sleep(cooldown + 5*time.Millisecond)
+	if !b.Allow("m") {
+		t.Fatal("no trial after the second cooldown")
+	}
+	b.Success("m")
+	if !b.Allow("m") || !b.Allow("m") {
+		t.Fatal("successful trial did not close the circuit")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := NewBreaker()
+	for i := 0; i < 5; i++ {
+		b.Failure("m", 0, time.Hour)
+	}
+	if !b.Allow("m") || len(b.Status()) != 0 {
+		t.Fatal("threshold 0 still tracked failures")
+	}
+}
@@ -2,12 +2,73 @@ package llm
 
 import (
 	"context"
+	"strings"
 
 	"github.com/example/ai-avatar-studio/internal/model"
 )
 
-// Client defines the abstraction for LLM providers.
+// Client defines the abstraction for LLM providers. Callers pass the fully assembled conversation,
+// system instructions included, in send order.
 type Client interface {
-	Generate(ctx context.Context, prompt string, model *model.ModelConfig, history []model.ChatMessage) (string, error)
-	StreamGenerate(ctx context.Context, prompt string, model *model.ModelConfig, history []model.ChatMessage, onChunk func(contentDelta string, reasoningDelta string)) error
+	Generate(ctx context.Context, messages []Message, model *model.ModelConfig) (Completion, error)
+	StreamGenerate(ctx context.Context, messages []Message, model *model.ModelConfig, onChunk func(contentDelta string, reasoningDelta string)) (Completion, error)
+}
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one entry of the conversation sent to a provider.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Conversation builds the message list for a system prompt followed by chat history, the shape
+// most callers need. An empty prompt is left out.
+func Conversation(prompt string, history []model.ChatMessage) []Message {
+	messages := make([]Message, 0, len(history)+1)
+	if strings.TrimSpace(prompt) != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: prompt})
+	}
+	for _, msg := range history {
+		messages = append(messages, Message{Role: normalizeRole(msg.Role), Content: msg.Content})
+	}
+	return messages
+}
+
+// normalizeRole maps anything but system and assistant onto user.
+func normalizeRole(role string) string {
+	switch role {
+	case RoleSystem, RoleAssistant:
+		return role
+	}
+	return RoleUser
+}
+
+// FinishReasonLength marks a reply cut off by max_tokens; the UI can offer to continue it.
+const FinishReasonLength = "length"
+
+// Completion is the outcome of one provider call; StreamGenerate returns the concatenated content.
+type Completion struct {
+	Content      string
+	Usage        Usage
+	FinishReason string // normalised to OpenAI values: stop, length, tool_calls, content_filter
+	Model        string // model the provider reports having served, which may differ from the requested alias
+}
+
+// Truncated reports whether the provider stopped because it hit max_tokens.
+func (c Completion) Truncated() bool {
+	return c.FinishReason == FinishReasonLength
+}
+
+// Usage counts the tokens billed for a call. Estimated is set when the provider did not report usage.
+type Usage struct {
+	PromptTokens     int  `json:"prompt_tokens"`
+	CompletionTokens int  `json:"completion_tokens"`
+	TotalTokens      int  `json:"total_tokens"`
+	Estimated        bool `json:"estimated,omitempty"`
 }
@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// flexText decodes the text fields OpenAI-compatible servers send in different shapes: a plain
+// string, null, an array of strings, or an array of content parts such as {"type":"text","text":"..."}.
+// Thinking parts are not text and are left out; see splitParts.
+type flexText string
+
+func (t *flexText) UnmarshalJSON(data []byte) error {
+	text, _, err := splitParts(data)
+	*t = flexText(text)
+	return err
+}
+
+// splitParts decodes a flexText value into its text and the thinking parts some servers mix into a
+// content array ({"type":"thinking","thinking":"..."} or {"type":"reasoning","text":"..."}).
+func splitParts(data []byte) (text, thinking string, err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return "", "", nil
+	}
+	switch data[0] {
+	case '"':
+		err = json.Unmarshal(data, &text)
+		return text, "", err
+	case '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return "", "", err
+		}
+		var tb, rb strings.Builder
+		for _, item := range items {
+			t, r, err := splitParts(item)
+			if err != nil {
+				return "", "", err
+			}
+			tb.WriteString(t)
+			rb.WriteString(r)
+		}
+		return tb.String(), rb.String(), nil
+	case '{':
+		var part struct {
+			Type     string   `json:"type"`
+			Text     flexText `json:"text"`
+			Content  flexText `json:"content"`
+			Thinking flexText `json:"thinking"`
+		}
+		if err := json.Unmarshal(data, &part); err != nil {
+			return "", "", err
+		}
+		body := part.Text
+		if body == "" {
+			body = part.Content
+		}
+		switch strings.ToLower(part.Type) {
+		case "thinking", "reasoning", "redacted_thinking":
+			if part.Thinking != "" {
+				return "", string(part.Thinking), nil
+			}
+			return "", string(body), nil
+		}
+		if part.Thinking != "" && body == "" {
+			return "", string(part.Thinking), nil
+		}
+		return string(body), "", nil
+	default:
+		// Numbers or booleans carry no text.
+		return "", "", nil
+	}
+}
+
+// completionDelta is a streamed choice delta. Reasoning arrives as reasoning_content (DeepSeek,
+// vLLM), reasoning (OpenRouter and others) or as thinking parts inside content; tool calls are
+// accepted but not used.
+type completionDelta struct {
+	Content          flexText        `json:"content"`
+	ReasoningContent flexText        `json:"reasoning_content"`
+	Reasoning        flexText        `json:"reasoning"`
+	ToolCalls        json.RawMessage `json:"tool_calls,omitempty"`
+
+	// contentThinking holds the thinking parts found in content.
+	contentThinking string
+}
+
+func (d *completionDelta) UnmarshalJSON(data []byte) error {
+	type plain completionDelta
+	var raw struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = completionDelta(raw.plain)
+	text, thinking, err := splitParts(raw.Content)
+	if err != nil {
+		return err
+	}
+	d.Content, d.contentThinking = flexText(text), thinking
+	return nil
+}
+
+func (d completionDelta) reasoning() string {
+	switch {
+	case d.ReasoningContent != "":
+		return string(d.ReasoningContent)
+	case d.Reasoning != "":
+		return string(d.Reasoning)
+	}
+	return d.contentThinking
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+func TestCompletionDeltaShapes(t *testing.T) {
+	cases := []struct {
+		name, delta        string
+		content, reasoning string
+	}{
+		{"string", `{"content":"hi"}`, "hi", ""},
+		{"null", `{"content":null,"reasoning_content":"hmm"}`, "", "hmm"},
+		{"reasoning field", `{"content":"","reasoning":"hmm"}`, "", "hmm"},
+		{"string array", `{"content":["a","b"]}`, "ab", ""},
+		{"text parts", `{"content":[{"type":"text","text":"a"},{"type":"output_text","text":"b"}]}`, "ab", ""},
+		{"thinking part", `{"content":[{"type":"thinking","thinking":"plan"},{"type":"text","text":"answer"}]}`, "answer", "plan"},
+		{"reasoning part", `{"content":[{"type":"reasoning","text":"plan"},{"type":"text","text":"answer"}]}`, "answer", "plan"},
+		{"untyped thinking", `{"content":[{"thinking":"plan"}]}`, "", "plan"},
+		{"reasoning field wins", `{"content":[{"type":"thinking","thinking":"part"}],"reasoning_content":"field"}`, "", "field"},
+		{"number", `{"content":3}`, "", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var d completionDelta
+			if err := json.Unmarshal([]byte(tc.delta), &d); err != nil {
+				t.Fatal(err)
+			}
+			if string(d.Content) != tc.content || d.reasoning() != tc.reasoning {
+				t.Fatalf("content = %q, reasoning = %q; want %q, %q", d.Content, d.reasoning(), tc.content, tc.reasoning)
+			}
+		})
+	}
+	var text flexText
+	if err := json.Unmarshal([]byte(`[{"type":"thinking","thinking":"plan"},{"type":"text","text":"answer"}]`), &text); err != nil || text != "answer" {
+		t.Fatalf("flexText = %q, %v; want thinking left out", text, err)
+	}
+}
+
+func TestStreamRoutesThinkingParts(t *testing.T) {
+	chunks := []string{
+		`{"model":"m","choices":[{"delta":{"content":[{"type":"thinking","thinking":"Let me see."}]}}]}`,
+		`{"choices":[{"delta":{"content":[{"type":"text","text":"Hi"}]}}]}`,
+		`{"choices":[{"delta":{"content":" there"},"finish_reason":"stop"}]}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var content, reasoning strings.Builder
+	cfg := &model.ModelConfig{ID: "m1", BaseURL: srv.URL, ModelName: "m", MaxTokens: 64}
+	out, err := NewHTTPClient(srv.Client()).StreamGenerate(context.Background(), Conversation("sys", nil), cfg, func(c, r string) {
+		content.WriteString(c)
+		reasoning.WriteString(r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.String() != "Hi there" || reasoning.String() != "Let me see." {
+		t.Fatalf("content = %q, reasoning = %q", content.String(), reasoning.String())
+	}
+	if out.Content != "Hi there" {
+		t.Fatalf("out.Content = %q, want the thinking left out", out.Content)
+	}
+}
@@ -0,0 +1,44 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ProviderError is a non-2xx response from an LLM provider.
+type ProviderError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("llm provider error: status=%d body=%s", e.StatusCode, e.Body)
+}
+
+func newProviderError(status int, body []byte) *ProviderError {
+	return &ProviderError{StatusCode: status, Body: strings.TrimSpace(string(body))}
+}
+
+// ErrIncompleteStream reports a stream that ended before the provider marked the reply finished,
+// typically because the connection was cut.
+var ErrIncompleteStream = errors.New("llm stream ended before the reply finished")
+
+// IsRetryable reports whether another attempt (or another model) may succeed: rate limits, server
+// errors, timeouts and dropped connections. Cancellation and other 4xx responses are final.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.StatusCode == 408 || perr.StatusCode == 409 || perr.StatusCode == 429 || perr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrIncompleteStream) {
+		return true
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
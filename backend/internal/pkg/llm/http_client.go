@@ -6,7 +6,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -18,56 +17,68 @@ import (
 
 const defaultAPIBase = "https://api.openai.com/v1"
 
-// RouterClient dispatches to either the HTTP client or mock fallback based on model provider.
+// RouterClient dispatches to the Anthropic, OpenAI-compatible HTTP or mock client based on model provider.
 type RouterClient struct {
-	http *HTTPClient
-	mock Client
+	http      *HTTPClient
+	anthropic *AnthropicClient
+	mock      Client
 }
 
-// NewRouterClient builds a multi-provider client that supports HTTP + mock providers.
+// NewRouterClient builds a multi-provider client that supports Anthropic, OpenAI-compatible HTTP + mock providers.
 func NewRouterClient(httpClient *http.Client) *RouterClient {
 	if httpClient == nil {
 		httpClient = &http.Client{Timeout: 150 * time.Second}
 	}
 	return &RouterClient{
-		http: NewHTTPClient(httpClient),
-		mock: MockClient{},
+		http:      NewHTTPClient(httpClient),
+		anthropic: NewAnthropicClient(httpClient),
+		mock:      MockClient{},
 	}
 }
 
 // Generate delegates to the proper provider implementation.
-func (r *RouterClient) Generate(ctx context.Context, prompt string, cfg *model.ModelConfig, history []model.ChatMessage) (string, error) {
+func (r *RouterClient) Generate(ctx context.Context, messages []Message, cfg *model.ModelConfig) (Completion, error) {
 	if cfg == nil {
-		return "", errors.New("model not configured")
+		return Completion{}, errors.New("model not configured")
 	}
 	switch strings.ToLower(strings.TrimSpace(cfg.Provider)) {
 	case "mock":
-		return r.mock.Generate(ctx, prompt, cfg, history)
+		return r.mock.Generate(ctx, messages, cfg)
 	default:
 		if cfg.APIKey == "" {
 			log.Printf("llm: missing api key for model %s, falling back to mock", cfg.ID)
-			return r.mock.Generate(ctx, prompt, cfg, history)
+			return r.mock.Generate(ctx, messages, cfg)
 		}
-		return r.http.Generate(ctx, prompt, cfg, history)
+		if isAnthropic(cfg) {
+			return r.anthropic.Generate(ctx, messages, cfg)
+		}
+		return r.http.Generate(ctx, messages, cfg)
 	}
 }
 
-func (r *RouterClient) StreamGenerate(ctx context.Context, prompt string, cfg *model.ModelConfig, history []model.ChatMessage, onChunk func(contentDelta string, reasoningDelta string)) error {
+func (r *RouterClient) StreamGenerate(ctx context.Context, messages []Message, cfg *model.ModelConfig, onChunk func(contentDelta string, reasoningDelta string)) (Completion, error) {
 	if cfg == nil {
-		return errors.New("model not configured")
+		return Completion{}, errors.New("model not configured")
 	}
 	switch strings.ToLower(strings.TrimSpace(cfg.Provider)) {
 	case "mock":
-		return r.mock.StreamGenerate(ctx, prompt, cfg, history, onChunk)
+		return r.mock.StreamGenerate(ctx, messages, cfg, onChunk)
 	default:
 		if cfg.APIKey == "" {
 			log.Printf("llm: missing api key for model %s, falling back to mock", cfg.ID)
-			return r.mock.StreamGenerate(ctx, prompt, cfg, history, onChunk)
+			return r.mock.StreamGenerate(ctx, messages, cfg, onChunk)
+		}
+		if isAnthropic(cfg) {
+			return r.anthropic.StreamGenerate(ctx, messages, cfg, onChunk)
 		}
-		return r.http.StreamGenerate(ctx, prompt, cfg, history, onChunk)
+		return r.http.StreamGenerate(ctx, messages, cfg, onChunk)
 	}
 }
 
+func isAnthropic(cfg *model.ModelConfig) bool {
+	return strings.EqualFold(strings.TrimSpace(cfg.Provider), "anthropic")
+}
+
 // HTTPClient talks to OpenAI-compatible chat completion APIs.
 type HTTPClient struct {
 	client *http.Client
@@ -81,19 +92,18 @@ func NewHTTPClient(httpClient *http.Client) *HTTPClient {
 	return &HTTPClient{client: httpClient}
 }
 
-func (c *HTTPClient) Generate(ctx context.Context, prompt string, cfg *model.ModelConfig, history []model.ChatMessage) (string, error) {
+func (c *HTTPClient) Generate(ctx context.Context, messages []Message, cfg *model.ModelConfig) (Completion, error) {
 	if strings.TrimSpace(cfg.ModelName) == "" {
-		return "", errors.New("model missing model_name")
+		return Completion{}, errors.New("model missing model_name")
 	}
 	baseURL := strings.TrimSpace(cfg.BaseURL)
 	if baseURL == "" {
 		baseURL = defaultAPIBase
 	}
 	baseURL = strings.TrimSuffix(baseURL, "/")
-	messages := buildMessages(prompt, history)
 	reqBody := map[string]interface{}{
 		"model":    cfg.ModelName,
-		"messages": messages,
+		"messages": buildMessages(messages),
 	}
 	if cfg.Temperature > 0 {
 		reqBody["temperature"] = cfg.Temperature
@@ -105,73 +115,74 @@ func (c *HTTPClient) Generate(ctx context.Context, prompt string, cfg *model.Mod
 	}
 	payload, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", err
+		return Completion{}, err
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/chat/completions", bytes.NewReader(payload))
 	if err != nil {
-		return "", err
+		return Completion{}, err
 	}
 	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return "", err
+		return Completion{}, err
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return Completion{}, err
 	}
 	if resp.StatusCode >= 400 {
-		msg := fmt.Sprintf("llm provider error: status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
-		log.Printf("llm: %s", msg)
-		return "", errors.New(msg)
+		perr := newProviderError(resp.StatusCode, body)
+		log.Printf("llm: %s", perr)
+		return Completion{}, perr
 	}
 	var parsed completionResponse
 	if err := json.Unmarshal(body, &parsed); err != nil {
 		log.Printf("llm: decode error %v body=%s", err, string(body))
-		return "", err
+		return Completion{}, err
 	}
 	if parsed.Error != nil {
-		return "", errors.New(parsed.Error.Message)
+		return Completion{}, errors.New(parsed.Error.Message)
 	}
 	if len(parsed.Choices) == 0 {
 		log.Printf("llm: empty choices body=%s", strings.TrimSpace(string(body)))
-		return "", errors.New("llm returned no choices")
+		return Completion{}, errors.New("llm returned no choices")
 	}
-	out := strings.TrimSpace(parsed.Choices[0].Message.Content)
-	if out == "" {
+	out := Completion{
+		Content:      strings.TrimSpace(string(parsed.Choices[0].Message.Content)),
+		FinishReason: parsed.Choices[0].FinishReason,
+		Model:        parsed.Model,
+	}
+	if out.Content == "" {
 		log.Printf("llm: empty content body=%s", strings.TrimSpace(string(body)))
 	}
+	if parsed.Usage != nil {
+		out.Usage = *parsed.Usage
+	}
+	fillUsage(&out, messages)
 	return out, nil
 }
 
-func buildMessages(prompt string, history []model.ChatMessage) []completionMessage {
-	messages := []completionMessage{}
-	if strings.TrimSpace(prompt) != "" {
-		messages = append(messages, completionMessage{Role: "system", Content: prompt})
+// buildMessages maps the conversation onto chat completion roles; unknown roles are sent as user.
+func buildMessages(messages []Message) []completionMessage {
+	out := make([]completionMessage, 0, len(messages)+1)
+	dialogue := false
+	for _, msg := range messages {
+		role := normalizeRole(msg.Role)
+		if role != RoleSystem {
+			dialogue = true
+		}
+		out = append(out, completionMessage{Role: role, Content: msg.Content})
 	}
-	if len(history) == 0 {
+	if !dialogue {
 		// Some providers reject a chat with only system role; add a user turn to avoid “empty conversation”.
-		messages = append(messages, completionMessage{
-			Role:    "user",
+		out = append(out, completionMessage{
+			Role:    RoleUser,
 			Content: "Generate based on the above instructions.",
 		})
-		return messages
-	}
-	for _, msg := range history {
-		role := "user"
-		if msg.Role == "assistant" {
-			role = "assistant"
-		} else if msg.Role == "system" {
-			role = "system"
-		}
-		messages = append(messages, completionMessage{
-			Role:    role,
-			Content: msg.Content,
-		})
 	}
-	return messages
+	return out
 }
 
 type completionMessage struct {
@@ -180,31 +191,36 @@ type completionMessage struct {
 }
 
 type completionChoice struct {
-	Message completionMessage `json:"message"`
+	Message      completionDelta `json:"message"`
+	FinishReason string          `json:"finish_reason"`
 }
 
 type completionResponse struct {
+	Model   string             `json:"model"`
 	Choices []completionChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
 	Error   *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
-// StreamGenerate streams chunked responses (OpenAI-compatible stream).
-func (c *HTTPClient) StreamGenerate(ctx context.Context, prompt string, cfg *model.ModelConfig, history []model.ChatMessage, onChunk func(contentDelta string, reasoningDelta string)) error {
+// StreamGenerate streams chunked responses (OpenAI-compatible stream). A stream that ends without
+// [DONE] or a finish_reason was cut off and returns ErrIncompleteStream.
+func (c *HTTPClient) StreamGenerate(ctx context.Context, messages []Message, cfg *model.ModelConfig, onChunk func(contentDelta string, reasoningDelta string)) (Completion, error) {
 	if strings.TrimSpace(cfg.ModelName) == "" {
-		return errors.New("model missing model_name")
+		return Completion{}, errors.New("model missing model_name")
 	}
 	baseURL := strings.TrimSpace(cfg.BaseURL)
 	if baseURL == "" {
 		baseURL = defaultAPIBase
 	}
 	baseURL = strings.TrimSuffix(baseURL, "/")
-	messages := buildMessages(prompt, history)
 	reqBody := map[string]interface{}{
 		"model":    cfg.ModelName,
-		"messages": messages,
+		"messages": buildMessages(messages),
 		"stream":   true,
+		// Ask for a trailing usage chunk; providers without support simply ignore it.
+		"stream_options": map[string]interface{}{"include_usage": true},
 	}
 	if cfg.Temperature > 0 {
 		reqBody["temperature"] = cfg.Temperature
@@ -216,34 +232,38 @@ func (c *HTTPClient) StreamGenerate(ctx context.Context, prompt string, cfg *mod
 	}
 	payload, err := json.Marshal(reqBody)
 	if err != nil {
-		return err
+		return Completion{}, err
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/chat/completions", bytes.NewReader(payload))
 	if err != nil {
-		return err
+		return Completion{}, err
 	}
 	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		return Completion{}, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
-		msg := fmt.Sprintf("llm provider error: status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
-		log.Printf("llm: %s", msg)
-		return errors.New(msg)
+		perr := newProviderError(resp.StatusCode, body)
+		log.Printf("llm: %s", perr)
+		return Completion{}, perr
 	}
 
+	var out Completion
+	var content strings.Builder
+	var done bool
 	reader := bufio.NewReader(resp.Body)
-	for {
+	for eof := false; !eof && !done; {
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+			if !errors.Is(err, io.EOF) {
+				return Completion{}, err
 			}
-			return err
+			// Still handle a final event that is not newline-terminated.
+			eof = true
 		}
 		line = strings.TrimSpace(line)
 		if line == "" || !strings.HasPrefix(line, "data:") {
@@ -251,15 +271,16 @@ func (c *HTTPClient) StreamGenerate(ctx context.Context, prompt string, cfg *mod
 		}
 		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 		if payload == "[DONE]" {
-			break
+			done = true
+			continue
 		}
 		var chunk struct {
+			Model   string `json:"model"`
 			Choices []struct {
-				Delta struct {
-					Content   []string `json:"content,omitempty"`
-					Reasoning []string `json:"reasoning_content,omitempty"`
-				} `json:"delta"`
+				Delta        completionDelta `json:"delta"`
+				FinishReason *string         `json:"finish_reason"`
 			} `json:"choices"`
+			Usage *Usage `json:"usage,omitempty"`
 			Error *struct {
 				Message string `json:"message"`
 			} `json:"error,omitempty"`
@@ -269,17 +290,32 @@ func (c *HTTPClient) StreamGenerate(ctx context.Context, prompt string, cfg *mod
 			continue
 		}
 		if chunk.Error != nil {
-			return errors.New(chunk.Error.Message)
+			return Completion{}, errors.New(chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			out.Usage = *chunk.Usage
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
 		}
 		if len(chunk.Choices) == 0 {
 			continue
 		}
-		delta := chunk.Choices[0].Delta
-		contentDelta := strings.Join(delta.Content, "")
-		reasoningDelta := strings.Join(delta.Reasoning, "")
+		choice := chunk.Choices[0]
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			out.FinishReason = *choice.FinishReason
+		}
+		contentDelta := string(choice.Delta.Content)
+		reasoningDelta := choice.Delta.reasoning()
+		content.WriteString(contentDelta)
 		if contentDelta != "" || reasoningDelta != "" {
 			onChunk(contentDelta, reasoningDelta)
 		}
 	}
-	return nil
+	if !done && out.FinishReason == "" {
+		return Completion{}, ErrIncompleteStream
+	}
+	out.Content = content.String()
+	fillUsage(&out, messages)
+	return out, nil
 }
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+func TestStreamRequiresAnEnd(t *testing.T) {
+	cases := []struct {
+		name   string
+		events []string
+		err    error
+	}{
+		{"done", []string{`{"choices":[{"delta":{"content":"Hi"}}]}`, `[DONE]`}, nil},
+		{"finish reason", []string{`{"choices":[{"delta":{"content":"Hi"},"finish_reason":"length"}]}`}, nil},
+		{"cut off", []string{`{"choices":[{"delta":{"content":"Hi"}}]}`}, ErrIncompleteStream},
+		{"empty", nil, ErrIncompleteStream},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for _, e := range tc.events {
+					fmt.Fprintf(w, "data: %s\n\n", e)
+				}
+			}))
+			defer srv.Close()
+			cfg := &model.ModelConfig{ID: "m1", BaseURL: srv.URL, ModelName: "m"}
+			out, err := NewHTTPClient(srv.Client()).StreamGenerate(context.Background(), Conversation("sys", nil), cfg, func(string, string) {})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if tc.err == nil && out.Content != "Hi" {
+				t.Fatalf("content = %q", out.Content)
+			}
+			if tc.err != nil && !IsRetryable(err) {
+				t.Fatal("a cut-off stream is not retryable")
+			}
+		})
+	}
+}
@@ -3,28 +3,35 @@ package llm
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/example/ai-avatar-studio/internal/model"
 )
 
-// MockClient concatenates prompt + last message to provide a deterministic stub.
+// MockClient concatenates the system messages + last user message to provide a deterministic stub.
 type MockClient struct{}
 
 // Generate crafts a naive response that still reflects the user inputs for demos.
-func (MockClient) Generate(ctx context.Context, prompt string, model *model.ModelConfig, history []model.ChatMessage) (string, error) {
+func (MockClient) Generate(ctx context.Context, messages []Message, model *model.ModelConfig) (Completion, error) {
 	_ = ctx
 	var latestUser string
-	for i := len(history) - 1; i >= 0; i-- {
-		if history[i].Role == "user" {
-			latestUser = history[i].Content
-			break
+	var system []string
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleUser:
+			latestUser = msg.Content
+		case RoleSystem:
+			system = append(system, msg.Content)
 		}
 	}
-	return fmt.Sprintf("[%s mock] You said: %s\nSystem prompt: %s", model.Name, latestUser, prompt), nil
+	out := Completion{Content: fmt.Sprintf("[%s mock] You said: %s\nSystem prompt: %s", model.Name, latestUser, strings.Join(system, "\n\n")), Model: model.ModelName}
+	fillUsage(&out, messages)
+	return out, nil
 }
 
-func (MockClient) StreamGenerate(ctx context.Context, prompt string, model *model.ModelConfig, history []model.ChatMessage, onChunk func(contentDelta string, reasoningDelta string)) error {
-	resp, _ := MockClient{}.Generate(ctx, prompt, model, history)
+func (MockClient) StreamGenerate(ctx context.Context, messages []Message, model *model.ModelConfig, onChunk func(contentDelta string, reasoningDelta string)) (Completion, error) {
+	out, _ := MockClient{}.Generate(ctx, messages, model)
+	resp := out.Content
 	for i := 0; i < len(resp); i += 16 {
 		end := i + 16
 		if end > len(resp) {
@@ -32,5 +39,5 @@ func (MockClient) StreamGenerate(ctx context.Context, prompt string, model *mode
 		}
 		onChunk(resp[i:end], "")
 	}
-	return nil
+	return out, nil
 }
@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"unicode"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+// messageOverheadTokens approximates the role/separator tokens chat APIs add per message.
+const messageOverheadTokens = 4
+
+// EstimateTokens approximates a BPE token count without a vocabulary: CJK characters count one
+// token each, other words roughly one token per four characters and punctuation one each.
+func EstimateTokens(text string) int {
+	tokens := 0
+	wordLen := 0
+	flush := func() {
+		if wordLen > 0 {
+			tokens += (wordLen + 3) / 4
+			wordLen = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			wordLen++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// EstimateMessageTokens approximates the input tokens one chat message adds.
+func EstimateMessageTokens(msg model.ChatMessage) int {
+	return EstimateTokens(msg.Content) + messageOverheadTokens
+}
+
+// EstimatePromptTokens approximates the input tokens of a conversation.
+func EstimatePromptTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += EstimateTokens(msg.Content) + messageOverheadTokens
+	}
+	return total
+}
+
+// EstimateUsage approximates usage for a call whose provider reported none, e.g. a cancelled stream.
+func EstimateUsage(messages []Message, completion string) Usage {
+	usage := Usage{
+		PromptTokens:     EstimatePromptTokens(messages),
+		CompletionTokens: EstimateTokens(completion),
+		Estimated:        true,
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// fillUsage estimates usage when the provider omitted it.
+func fillUsage(c *Completion, messages []Message) {
+	if c.Usage.PromptTokens == 0 && c.Usage.CompletionTokens == 0 {
+		c.Usage = EstimateUsage(messages, c.Content)
+	}
+	if c.Usage.TotalTokens == 0 {
+		c.Usage.TotalTokens = c.Usage.PromptTokens + c.Usage.CompletionTokens
+	}
+}
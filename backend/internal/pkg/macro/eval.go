@@ -0,0 +1,304 @@
+package macro
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env supplies everything macros can read. Vars holds the session variables; setvar and addvar
+// change it in place and VarsChanged reports whether they did.
+type Env struct {
+	Char            string
+	User            string
+	Summary         string
+	LastMessage     string
+	LastUserMessage string
+	LastCharMessage string
+	// LastActivity is when the user last wrote before the current turn, for idle_duration.
+	LastActivity time.Time
+	// Now defaults to the current time.
+	Now  time.Time
+	Vars map[string]string
+	// Rand defaults to the shared source; tests may pass a seeded one.
+	Rand *rand.Rand
+
+	changed bool
+}
+
+// VarsChanged reports whether a template changed Vars.
+func (e *Env) VarsChanged() bool {
+	return e != nil && e.changed
+}
+
+// Execute evaluates the template against env.
+func (t *Template) Execute(env *Env) (string, error) {
+	if env == nil {
+		env = &Env{}
+	}
+	ev := &evaluator{t: t, env: env, now: env.Now}
+	if ev.now.IsZero() {
+		ev.now = time.Now()
+	}
+	var out strings.Builder
+	if err := ev.run(&out, t.nodes); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+type evaluator struct {
+	t   *Template
+	env *Env
+	now time.Time
+}
+
+func (ev *evaluator) errorAt(pos int, msg string) error {
+	p := &parser{src: ev.t.src}
+	return p.errorAt(pos, msg)
+}
+
+func (ev *evaluator) run(out *strings.Builder, nodes []node) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			out.WriteString(string(n))
+		case *callNode:
+			v, err := ev.call(n)
+			if err != nil {
+				return err
+			}
+			out.WriteString(v)
+		case *ifNode:
+			ok, err := ev.cond(n)
+			if err != nil {
+				return err
+			}
+			branch := n.els
+			if ok {
+				branch = n.then
+			}
+			if err := ev.run(out, branch); err != nil {
+				return err
+			}
+		}
+		if out.Len() > maxOutput {
+			return errors.New("template output is too large")
+		}
+	}
+	return nil
+}
+
+func (ev *evaluator) text(nodes []node) (string, error) {
+	var out strings.Builder
+	if err := ev.run(&out, nodes); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func (ev *evaluator) cond(n *ifNode) (bool, error) {
+	left, err := ev.text(n.left)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	switch n.op {
+	case "":
+		ok = truthy(left)
+	default:
+		right, err := ev.text(n.right)
+		if err != nil {
+			return false, err
+		}
+		ok = strings.TrimSpace(left) == strings.TrimSpace(right)
+		if n.op == "!=" {
+			ok = !ok
+		}
+	}
+	return ok != n.not, nil
+}
+
+// truthy treats empty, 0, false, no and off as false.
+func truthy(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+func (ev *evaluator) call(n *callNode) (string, error) {
+	args := make([]string, len(n.args))
+	for i, a := range n.args {
+		v, err := ev.text(a)
+		if err != nil {
+			return "", err
+		}
+		args[i] = v
+	}
+	env := ev.env
+	switch n.name {
+	case "char":
+		return env.Char, nil
+	case "user":
+		return env.User, nil
+	case "summary":
+		return env.Summary, nil
+	case "time":
+		return ev.now.Format("15:04"), nil
+	case "date":
+		return ev.now.Format("January 2, 2006"), nil
+	case "weekday":
+		return ev.now.Weekday().String(), nil
+	case "isodate":
+		return ev.now.Format("2006-01-02"), nil
+	case "isotime":
+		return ev.now.Format("15:04:05"), nil
+	case "lastmessage":
+		return env.LastMessage, nil
+	case "lastusermessage":
+		return env.LastUserMessage, nil
+	case "lastcharmessage":
+		return env.LastCharMessage, nil
+	case "idle_duration":
+		return idleDuration(ev.now, env.LastActivity), nil
+	case "newline":
+		return "\n", nil
+	case "random":
+		return args[ev.intn(len(args))], nil
+	case "roll":
+		d, err := parseDice(args[0])
+		if err != nil {
+			return "", ev.errorAt(n.pos, err.Error())
+		}
+		return strconv.Itoa(d.roll(ev.intn)), nil
+	case "getvar":
+		return env.Vars[varName(args[0])], nil
+	case "setvar":
+		return "", ev.setVar(n.pos, args[0], args[1])
+	case "addvar":
+		name := varName(args[0])
+		cur := env.Vars[name]
+		a, errA := strconv.ParseFloat(strings.TrimSpace(cur), 64)
+		b, errB := strconv.ParseFloat(strings.TrimSpace(args[1]), 64)
+		if (errA == nil || cur == "") && errB == nil {
+			return "", ev.setVar(n.pos, name, strconv.FormatFloat(a+b, 'f', -1, 64))
+		}
+		return "", ev.setVar(n.pos, name, cur+args[1])
+	}
+	return "", ev.errorAt(n.pos, "unknown macro "+n.name)
+}
+
+func (ev *evaluator) setVar(pos int, name, value string) error {
+	name = varName(name)
+	if name == "" {
+		return ev.errorAt(pos, "variable name is empty")
+	}
+	if len(value) > maxVarBytes {
+		return ev.errorAt(pos, fmt.Sprintf("value of %s is longer than %d bytes", name, maxVarBytes))
+	}
+	if ev.env.Vars == nil {
+		ev.env.Vars = map[string]string{}
+	}
+	if _, ok := ev.env.Vars[name]; !ok && len(ev.env.Vars) >= maxVars {
+		return ev.errorAt(pos, fmt.Sprintf("more than %d variables", maxVars))
+	}
+	if ev.env.Vars[name] != value {
+		ev.env.Vars[name] = value
+		ev.env.changed = true
+	}
+	return nil
+}
+
+func varName(s string) string {
+	return strings.TrimSpace(s)
+}
+
+func (ev *evaluator) intn(n int) int {
+	if ev.env.Rand != nil {
+		return ev.env.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+var dicePattern = regexp.MustCompile(`^(\d*)d(\d+)([+-]\d+)?$`)
+
+type dice struct {
+	count, sides, modifier int
+}
+
+// parseDice reads NdM with an optional +K or -K, e.g. d20, 2d6+3.
+func parseDice(s string) (dice, error) {
+	m := dicePattern.FindStringSubmatch(strings.ToLower(strings.ReplaceAll(s, " ", "")))
+	if m == nil {
+		return dice{}, fmt.Errorf("%q is not a dice formula like 1d20 or 2d6+3", s)
+	}
+	d := dice{count: 1}
+	if m[1] != "" {
+		d.count, _ = strconv.Atoi(m[1])
+	}
+	d.sides, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		d.modifier, _ = strconv.Atoi(m[3])
+	}
+	if d.count < 1 || d.count > maxDice || d.sides < 1 || d.sides > maxSides {
+		return dice{}, fmt.Errorf("%q: use 1-%d dice with 1-%d sides", s, maxDice, maxSides)
+	}
+	if d.modifier > 1e6 || d.modifier < -1e6 {
+		return dice{}, fmt.Errorf("%q: modifier is too large", s)
+	}
+	return d, nil
+}
+
+func (d dice) roll(intn func(int) int) int {
+	total := d.modifier
+	for i := 0; i < d.count; i++ {
+		total += intn(d.sides) + 1
+	}
+	return total
+}
+
+// idleDuration describes the time since the user's previous message, e.g. "3 hours".
+func idleDuration(now, last time.Time) string {
+	if last.IsZero() {
+		return "just now"
+	}
+	d := now.Sub(last)
+	unit := func(n int, name string) string {
+		if n == 1 {
+			return "1 " + name
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return unit(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return unit(int(d/time.Hour), "hour")
+	default:
+		return unit(int(d/(24*time.Hour)), "day")
+	}
+}
+
+// ValidateVars checks session variables set directly against the limits setvar enforces.
+func ValidateVars(vars map[string]string) error {
+	if len(vars) > maxVars {
+		return fmt.Errorf("more than %d variables", maxVars)
+	}
+	for name, value := range vars {
+		if varName(name) != name || name == "" {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		if len(value) > maxVarBytes {
+			return fmt.Errorf("value of %s is longer than %d bytes", name, maxVarBytes)
+		}
+	}
+	return nil
+}
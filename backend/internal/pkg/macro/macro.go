@@ -0,0 +1,417 @@
+// Package macro renders the {{...}} macros of preset blocks, role fields and image prompt
+// templates. A template is parsed into a tree before anything is evaluated, so malformed templates
+// fail with the line and column of the problem. Evaluation is sandboxed: macros only see the values
+// in Env, there are no loops, and nesting, dice, variables and output size are bounded.
+//
+// Syntax:
+//
+//	{{char}} {{user}} {{summary}}          names and the session summary
+//	{{time}} {{date}} {{weekday}}          current time; also {{isodate}} and {{isotime}}
+//	{{random::a::b::c}}                    one option at random (also {{random:a,b,c}})
+//	{{roll:1d20}} {{roll::2d6+3}}          dice
+//	{{lastMessage}} {{lastUserMessage}} {{lastCharMessage}}
+//	{{idle_duration}}                      time since the user's previous message
+//	{{getvar::x}} {{setvar::x::v}} {{addvar::x::n}}
+//	{{if cond}}...{{else}}...{{/if}}       cond is a macro, "a == b" or "a != b", optionally negated with !
+//	{{// comment}}                         removed
+//	{{newline}}
+//
+// Macro names are case-insensitive and arguments may contain macros. Unknown macros are left as
+// they are.
+package macro
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits of one template.
+const (
+	maxDepth    = 16
+	maxOutput   = 256 << 10
+	maxVars     = 100
+	maxVarBytes = 4 << 10
+	maxDice     = 100
+	maxSides    = 1000
+)
+
+// Error is a malformed template or a macro that cannot be evaluated.
+type Error struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("template line %d, column %d: %s", e.Line, e.Col, e.Msg)
+}
+
+// Template is a parsed template.
+type Template struct {
+	src   string
+	nodes []node
+}
+
+type node interface{}
+
+type textNode string
+
+type callNode struct {
+	pos  int
+	name string
+	args [][]node
+}
+
+type ifNode struct {
+	pos   int
+	not   bool
+	op    string // "", "==" or "!="
+	left  []node
+	right []node
+	then  []node
+	els   []node
+}
+
+// arity is the accepted argument count of each macro; max -1 means unbounded.
+var arity = map[string][2]int{
+	"char":            {0, 0},
+	"user":            {0, 0},
+	"summary":         {0, 0},
+	"time":            {0, 0},
+	"date":            {0, 0},
+	"weekday":         {0, 0},
+	"isodate":         {0, 0},
+	"isotime":         {0, 0},
+	"lastmessage":     {0, 0},
+	"lastusermessage": {0, 0},
+	"lastcharmessage": {0, 0},
+	"idle_duration":   {0, 0},
+	"newline":         {0, 0},
+	"random":          {1, -1},
+	"roll":            {1, 1},
+	"getvar":          {1, 1},
+	"setvar":          {2, 2},
+	"addvar":          {2, 2},
+}
+
+// Parse checks the template syntax and returns the parsed template.
+func Parse(src string) (*Template, error) {
+	p := &parser{src: src, end: len(src)}
+	nodes, term, err := p.parseSeq(false, 0)
+	if err != nil {
+		return nil, err
+	}
+	if term != "" {
+		return nil, p.errorAt(p.pos, "{{"+term+"}} without {{if}}")
+	}
+	return &Template{src: src, nodes: nodes}, nil
+}
+
+// Validate reports whether src is a well-formed template.
+func Validate(src string) error {
+	_, err := Parse(src)
+	return err
+}
+
+// Render parses and evaluates src against env.
+func Render(src string, env *Env) (string, error) {
+	if !strings.Contains(src, "{{") {
+		return src, nil
+	}
+	t, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(env)
+}
+
+type parser struct {
+	src string
+	pos int
+	end int
+}
+
+func (p *parser) errorAt(pos int, msg string) *Error {
+	line, col := 1, 1
+	for i := 0; i < pos && i < len(p.src); i++ {
+		if p.src[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return &Error{Line: line, Col: col, Msg: msg}
+}
+
+// parseSeq parses nodes up to the window end or, inside an if, up to {{else}} or {{/if}}, which
+// it returns as term.
+func (p *parser) parseSeq(inIf bool, depth int) ([]node, string, error) {
+	if depth > maxDepth {
+		return nil, "", p.errorAt(p.pos, "macros are nested too deeply")
+	}
+	var nodes []node
+	for p.pos < p.end {
+		open := strings.Index(p.src[p.pos:p.end], "{{")
+		if open < 0 {
+			nodes = append(nodes, textNode(p.src[p.pos:p.end]))
+			p.pos = p.end
+			break
+		}
+		if open > 0 {
+			nodes = append(nodes, textNode(p.src[p.pos:p.pos+open]))
+		}
+		start := p.pos + open
+		inner, closeAt, err := p.readTag(start)
+		if err != nil {
+			return nil, "", err
+		}
+		p.pos = closeAt + 2
+		raw := p.src[inner:closeAt]
+		tag := strings.TrimSpace(raw)
+		lower := strings.ToLower(tag)
+		switch {
+		case strings.HasPrefix(tag, "//"):
+			// comment
+		case lower == "else" || lower == "/if":
+			if !inIf {
+				return nil, "", p.errorAt(start, "{{"+lower+"}} without {{if}}")
+			}
+			return nodes, lower, nil
+		case lower == "if" || strings.HasPrefix(lower, "if ") || strings.HasPrefix(lower, "if\t"):
+			n, err := p.parseIf(start, inner+strings.Index(raw, tag)+2, closeAt, depth)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, n)
+		default:
+			n, err := p.parseCall(start, inner, closeAt, depth)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, n)
+		}
+	}
+	if inIf {
+		return nil, "", errEOF
+	}
+	return nodes, "", nil
+}
+
+var errEOF = &Error{Msg: "unexpected end of template"}
+
+// readTag finds the }} closing the {{ at start, skipping nested macros. It returns the offsets of
+// the tag's inner text and of the closing braces.
+func (p *parser) readTag(start int) (int, int, error) {
+	depth := 0
+	for i := start; i < p.end-1; i++ {
+		switch {
+		case p.src[i] == '{' && p.src[i+1] == '{':
+			depth++
+			i++
+		case p.src[i] == '}' && p.src[i+1] == '}':
+			depth--
+			if depth == 0 {
+				return start + 2, i, nil
+			}
+			i++
+		}
+	}
+	return 0, 0, p.errorAt(start, "{{ is never closed")
+}
+
+func (p *parser) parseIf(start, condStart, condEnd, depth int) (node, error) {
+	n := &ifNode{pos: start}
+	cond := strings.TrimSpace(p.src[condStart:condEnd])
+	if cond == "" {
+		return nil, p.errorAt(start, "{{if}} needs a condition")
+	}
+	condStart += strings.Index(p.src[condStart:condEnd], cond)
+	condEnd = condStart + len(cond)
+	if strings.HasPrefix(cond, "!") {
+		n.not = true
+		condStart++
+	}
+	leftEnd, rightStart := condEnd, -1
+	for _, op := range []string{"==", "!="} {
+		if at := topLevelIndex(p.src[condStart:condEnd], op); at >= 0 {
+			n.op = op
+			leftEnd = condStart + at
+			rightStart = leftEnd + len(op)
+			break
+		}
+	}
+	var err error
+	if n.left, err = p.parseOperand(condStart, leftEnd, depth); err != nil {
+		return nil, err
+	}
+	if rightStart >= 0 {
+		if n.right, err = p.parseOperand(rightStart, condEnd, depth); err != nil {
+			return nil, err
+		}
+	}
+
+	var term string
+	n.then, term, err = p.parseSeq(true, depth+1)
+	if err == errEOF {
+		return nil, p.errorAt(start, "{{if}} is never closed with {{/if}}")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if term == "else" {
+		n.els, term, err = p.parseSeq(true, depth+1)
+		if err == errEOF {
+			return nil, p.errorAt(start, "{{if}} is never closed with {{/if}}")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if term == "else" {
+			return nil, p.errorAt(start, "{{if}} has more than one {{else}}")
+		}
+	}
+	return n, nil
+}
+
+// parseOperand parses one side of a condition: a bare macro such as getvar::x, or text that may
+// itself contain macros.
+func (p *parser) parseOperand(from, to, depth int) ([]node, error) {
+	text := strings.TrimSpace(p.src[from:to])
+	if text == "" {
+		return nil, p.errorAt(from, "empty operand in {{if}}")
+	}
+	from += strings.Index(p.src[from:to], text)
+	to = from + len(text)
+	if !strings.Contains(text, "{{") {
+		head := text
+		if i := strings.Index(text, "::"); i >= 0 {
+			head = text[:i]
+		}
+		name, _, _ := splitName(strings.TrimSpace(head))
+		if _, ok := arity[name]; ok {
+			n, err := p.parseCall(from, from, to, depth)
+			if err != nil {
+				return nil, err
+			}
+			return []node{n}, nil
+		}
+	}
+	sub := &parser{src: p.src, pos: from, end: to}
+	nodes, term, err := sub.parseSeq(false, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	if term != "" {
+		return nil, p.errorAt(from, "{{"+term+"}} inside a condition")
+	}
+	return nodes, nil
+}
+
+// parseCall parses the tag between inner and closeAt as a macro call. Unknown macros become text.
+func (p *parser) parseCall(start, inner, closeAt, depth int) (node, error) {
+	raw := p.src[inner:closeAt]
+	seps := splitTopLevel(raw, "::")
+	head := raw
+	if len(seps) > 0 {
+		head = raw[:seps[0]]
+	}
+	name, legacyArg, legacy := splitName(strings.TrimSpace(head))
+	spec, known := arity[name]
+	if !known {
+		return textNode(p.src[start : closeAt+2]), nil
+	}
+	n := &callNode{pos: start, name: name}
+	if legacy {
+		// {{roll:1d20}}, {{roll 1d20}} and {{random:a,b}}
+		if len(seps) > 0 {
+			return nil, p.errorAt(start, "mixes \":\" and \"::\" argument separators")
+		}
+		values := []string{legacyArg}
+		if name == "random" {
+			values = strings.Split(legacyArg, ",")
+		}
+		for _, v := range values {
+			n.args = append(n.args, []node{textNode(strings.TrimSpace(v))})
+		}
+	} else {
+		for i, at := range seps {
+			from := inner + at + 2
+			to := inner + len(raw)
+			if i+1 < len(seps) {
+				to = inner + seps[i+1]
+			}
+			sub := &parser{src: p.src, pos: from, end: to}
+			arg, term, err := sub.parseSeq(false, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if term != "" {
+				return nil, p.errorAt(from, "{{"+term+"}} inside a macro argument")
+			}
+			n.args = append(n.args, arg)
+		}
+	}
+	if len(n.args) < spec[0] || (spec[1] >= 0 && len(n.args) > spec[1]) {
+		return nil, p.errorAt(start, fmt.Sprintf("{{%s}} takes %s", name, describeArity(spec)))
+	}
+	if name == "roll" && len(n.args[0]) == 1 {
+		if text, ok := n.args[0][0].(textNode); ok {
+			if _, err := parseDice(string(text)); err != nil {
+				return nil, p.errorAt(start, err.Error())
+			}
+		}
+	}
+	return n, nil
+}
+
+// splitTopLevel returns the offsets of sep outside nested macros.
+func splitTopLevel(s, sep string) []int {
+	var seps []int
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			depth++
+			i++
+		case strings.HasPrefix(s[i:], "}}"):
+			depth--
+			i++
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			seps = append(seps, i)
+			i += len(sep) - 1
+		}
+	}
+	return seps
+}
+
+func topLevelIndex(s, sep string) int {
+	if seps := splitTopLevel(s, sep); len(seps) > 0 {
+		return seps[0]
+	}
+	return -1
+}
+
+// splitName lower-cases the macro name and splits off the single-colon or space argument that
+// roll and random also accept.
+func splitName(head string) (name, arg string, legacy bool) {
+	if i := strings.IndexAny(head, ": "); i > 0 {
+		if name := strings.ToLower(head[:i]); name == "roll" || name == "random" {
+			return name, strings.TrimSpace(head[i+1:]), true
+		}
+	}
+	return strings.ToLower(head), "", false
+}
+
+func describeArity(spec [2]int) string {
+	switch {
+	case spec[1] == 0:
+		return "no arguments"
+	case spec[1] < 0:
+		return fmt.Sprintf("at least %d argument(s)", spec[0])
+	case spec[0] == spec[1]:
+		return fmt.Sprintf("%d argument(s)", spec[0])
+	default:
+		return fmt.Sprintf("%d to %d arguments", spec[0], spec[1])
+	}
+}
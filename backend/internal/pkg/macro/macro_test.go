@@ -0,0 +1,242 @@
+package macro
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	cases := []struct {
+		name      string
+		src       string
+		line, col int
+		msg       string
+	}{
+		{"unclosed tag", "hello\n  {{char", 2, 3, "never closed"},
+		{"unclosed if", "a\nb {{if char}}x", 2, 3, "never closed with {{/if}}"},
+		{"stray else", "{{else}}", 1, 1, "{{else}} without {{if}}"},
+		{"stray endif", "x\n\n   {{/if}}", 3, 4, "{{/if}} without {{if}}"},
+		{"two elses", "{{if char}}a{{else}}b{{else}}c{{/if}}", 1, 1, "more than one {{else}}"},
+		{"empty condition", "ok {{if }}x{{/if}}", 1, 4, "needs a condition"},
+		{"arity", "line one\n{{char::x}}", 2, 1, "takes no arguments"},
+		{"setvar arity", "{{setvar::x}}", 1, 1, "takes 2 argument(s)"},
+		{"bad dice", "roll: {{roll:banana}}", 1, 7, "not a dice formula"},
+		{"mixed separators", "{{random:a::b}}", 1, 1, "mixes"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.src)
+			var perr *Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("Parse(%q) = %v, want *Error", tc.src, err)
+			}
+			if perr.Line != tc.line || perr.Col != tc.col || !strings.Contains(perr.Msg, tc.msg) {
+				t.Fatalf("Parse(%q) = %d:%d %q, want %d:%d containing %q", tc.src, perr.Line, perr.Col, perr.Msg, tc.line, tc.col, tc.msg)
+			}
+		})
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	nestedIf := func(n int) string {
+		return strings.Repeat("{{if char}}", n) + "x" + strings.Repeat("{{/if}}", n)
+	}
+	nestedArg := func(n int) string {
+		return strings.Repeat("{{getvar::", n) + "x" + strings.Repeat("}}", n)
+	}
+	for name, build := range map[string]func(int) string{"if": nestedIf, "argument": nestedArg} {
+		t.Run(name, func(t *testing.T) {
+			if err := Validate(build(maxDepth)); err != nil {
+				t.Fatalf("depth %d: %v", maxDepth, err)
+			}
+			err := Validate(build(maxDepth + 2))
+			if err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+				t.Fatalf("depth %d: err = %v, want nested too deeply", maxDepth+2, err)
+			}
+		})
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	env := &Env{Vars: map[string]string{}}
+	src := "{{setvar::big::" + strings.Repeat("a", maxVarBytes) + "}}" + strings.Repeat("{{getvar::big}}", maxOutput/maxVarBytes+1)
+	if _, err := Render(src, env); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("err = %v, want output too large", err)
+	}
+	src = "{{setvar::big::" + strings.Repeat("a", maxVarBytes) + "}}" + strings.Repeat("{{getvar::big}}", 4)
+	out, err := Render(src, env)
+	if err != nil || len(out) != 4*maxVarBytes {
+		t.Fatalf("len = %d, err = %v", len(out), err)
+	}
+}
+
+func TestVariableLimits(t *testing.T) {
+	t.Run("value size", func(t *testing.T) {
+		env := &Env{}
+		_, err := Render("{{setvar::x::"+strings.Repeat("a", maxVarBytes+1)+"}}", env)
+		if err == nil || !strings.Contains(err.Error(), "longer than") {
+			t.Fatalf("err = %v", err)
+		}
+		if env.VarsChanged() {
+			t.Fatal("a rejected setvar changed the variables")
+		}
+	})
+	t.Run("count", func(t *testing.T) {
+		env := &Env{Vars: map[string]string{}}
+		for i := 0; i < maxVars; i++ {
+			env.Vars["v"+strconv.Itoa(i)] = "1"
+		}
+		if _, err := Render("{{setvar::v0::2}}", env); err != nil {
+			t.Fatalf("overwriting an existing variable at the limit: %v", err)
+		}
+		if _, err := Render("{{setvar::extra::1}}", env); err == nil || !strings.Contains(err.Error(), "more than") {
+			t.Fatalf("err = %v, want too many variables", err)
+		}
+	})
+	t.Run("empty name", func(t *testing.T) {
+		if _, err := Render("{{setvar:: ::1}}", &Env{}); err == nil {
+			t.Fatal("setvar with a blank name succeeded")
+		}
+	})
+	t.Run("ValidateVars", func(t *testing.T) {
+		many := map[string]string{}
+		for i := 0; i <= maxVars; i++ {
+			many["v"+strconv.Itoa(i)] = ""
+		}
+		for name, vars := range map[string]map[string]string{
+			"too many":   many,
+			"too long":   {"x": strings.Repeat("a", maxVarBytes+1)},
+			"blank name": {"": "1"},
+			"padded":     {" x": "1"},
+		} {
+			if err := ValidateVars(vars); err == nil {
+				t.Errorf("%s: ValidateVars succeeded", name)
+			}
+		}
+		if err := ValidateVars(map[string]string{"mood": "calm"}); err != nil {
+			t.Errorf("valid vars: %v", err)
+		}
+	})
+}
+
+func TestAddvar(t *testing.T) {
+	env := &Env{Vars: map[string]string{"n": "2", "s": "ab"}}
+	if _, err := Render("{{addvar::n::3}}{{addvar::s::c}}{{addvar::fresh::1.5}}", env); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"n": "5", "s": "abc", "fresh": "1.5"}
+	for k, v := range want {
+		if env.Vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, env.Vars[k], v)
+		}
+	}
+	if !env.VarsChanged() {
+		t.Error("VarsChanged = false")
+	}
+}
+
+func TestDiceBounds(t *testing.T) {
+	cases := []struct {
+		formula string
+		ok      bool
+	}{
+		{"d20", true},
+		{"2d6+3", true},
+		{"1d1-5", true},
+		{"100d1000", true},
+		{"0d6", false},
+		{"101d6", false},
+		{"1d0", false},
+		{"1d1001", false},
+		{"1d6+2000000", false},
+		{"2x6", false},
+	}
+	for _, tc := range cases {
+		_, err := parseDice(tc.formula)
+		if (err == nil) != tc.ok {
+			t.Errorf("parseDice(%q) err = %v, want ok=%v", tc.formula, err, tc.ok)
+		}
+	}
+
+	env := &Env{Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 200; i++ {
+		out, err := Render("{{roll::2d6+3}}", env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := strconv.Atoi(out)
+		if n < 5 || n > 15 {
+			t.Fatalf("2d6+3 rolled %d", n)
+		}
+	}
+	// A formula built from a macro is only checked when it is rolled.
+	env.Vars = map[string]string{"f": "1000d6"}
+	if _, err := Render("{{roll::{{getvar::f}}}}", env); err == nil {
+		t.Fatal("rolling 1000d6 succeeded")
+	}
+}
+
+func TestIfElse(t *testing.T) {
+	env := &Env{Char: "Aria", Vars: map[string]string{"mood": "happy", "zero": "0", "off": "off"}}
+	cases := []struct {
+		src, want string
+	}{
+		{"{{if char}}yes{{else}}no{{/if}}", "yes"},
+		{"{{if summary}}yes{{else}}no{{/if}}", "no"},
+		{"{{if !summary}}empty{{/if}}", "empty"},
+		{"{{if getvar::zero}}yes{{else}}no{{/if}}", "no"},
+		{"{{if getvar::off}}yes{{else}}no{{/if}}", "no"},
+		{"{{if getvar::mood == happy}}:){{else}}:({{/if}}", ":)"},
+		{"{{if getvar::mood != happy}}:({{else}}:){{/if}}", ":)"},
+		{"{{if {{char}} == Aria}}me{{/if}}", "me"},
+		{"{{if !getvar::mood == sad}}not sad{{/if}}", "not sad"},
+		{"{{IF char}}{{if getvar::missing}}a{{else}}b{{/if}}{{/IF}}", "b"},
+		{"a{{// a comment}}b", "ab"},
+		{"{{unknown::x}}", "{{unknown::x}}"},
+	}
+	for _, tc := range cases {
+		got, err := Render(tc.src, env)
+		if err != nil || got != tc.want {
+			t.Errorf("Render(%q) = %q, %v; want %q", tc.src, got, err, tc.want)
+		}
+	}
+	// Only the branch taken runs, so setvar in the other branch leaves the variables alone.
+	env = &Env{Vars: map[string]string{}}
+	if _, err := Render("{{if char}}{{setvar::x::1}}{{/if}}", env); err != nil || env.VarsChanged() {
+		t.Fatalf("err = %v, changed = %v", err, env.VarsChanged())
+	}
+}
+
+func TestSessionEnv(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	session := &model.ChatSession{Summary: "They met.", Variables: map[string]string{"mood": "calm"}}
+	history := []model.ChatMessage{
+		{Role: "user", Content: "hi", CreatedAt: t0},
+		{Role: "assistant", Content: "hello", CreatedAt: t0.Add(time.Minute)},
+		{Role: "user", Content: "how are you?", CreatedAt: t0.Add(2 * time.Hour)},
+	}
+	env := SessionEnv(session, history)
+	if env.LastMessage != "how are you?" || env.LastUserMessage != "how are you?" || env.LastCharMessage != "hello" {
+		t.Fatalf("last messages = %q / %q / %q", env.LastMessage, env.LastUserMessage, env.LastCharMessage)
+	}
+	// The character's reply in between does not count as the user's activity.
+	if !env.LastActivity.Equal(t0) {
+		t.Fatalf("LastActivity = %v, want the previous user message", env.LastActivity)
+	}
+	if env.Summary != "Previous summary:\nThey met." {
+		t.Fatalf("Summary = %q", env.Summary)
+	}
+	env.Vars["mood"] = "tense"
+	if session.Variables["mood"] != "calm" {
+		t.Fatal("SessionEnv shares the session's variable map")
+	}
+	if env := SessionEnv(nil, nil); env.Vars == nil || env.LastMessage != "" {
+		t.Fatalf("SessionEnv(nil, nil) = %+v", env)
+	}
+}
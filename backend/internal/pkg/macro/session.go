@@ -0,0 +1,43 @@
+package macro
+
+import (
+	"strings"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+// SessionEnv returns what macros see in a chat session whose history ends with the latest message.
+// Vars is a copy of the session variables, so a turn that fails leaves them untouched. Char and
+// User are left to the caller. session may be nil when only the history is known.
+func SessionEnv(session *model.ChatSession, history []model.ChatMessage) *Env {
+	env := &Env{Vars: map[string]string{}}
+	if session != nil {
+		for k, v := range session.Variables {
+			env.Vars[k] = v
+		}
+		if session.Summary != "" {
+			env.Summary = "Previous summary:\n" + session.Summary
+		}
+	}
+	if len(history) > 0 {
+		env.LastMessage = history[len(history)-1].Content
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		msg := history[i]
+		switch strings.ToLower(msg.Role) {
+		case "user":
+			if env.LastUserMessage == "" {
+				env.LastUserMessage = msg.Content
+			}
+			// The latest message is the turn being answered; the user's previous one dates the gap.
+			if i < len(history)-1 && env.LastActivity.IsZero() && !msg.CreatedAt.IsZero() {
+				env.LastActivity = msg.CreatedAt
+			}
+		case "assistant":
+			if env.LastCharMessage == "" {
+				env.LastCharMessage = msg.Content
+			}
+		}
+	}
+	return env
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -100,6 +101,11 @@ func CurrentUserID(c *gin.Context) string {
 	return ""
 }
 
+// CurrentActor returns the caller as seen by service authorization checks.
+func CurrentActor(c *gin.Context) authz.Actor {
+	return authz.Actor{UserID: CurrentUserID(c), IsAdmin: IsAdmin(c)}
+}
+
 // IsAdmin returns whether the current request is issued by an administrator.
 func IsAdmin(c *gin.Context) bool {
 	if v, ok := c.Get(userAdminKey); ok {
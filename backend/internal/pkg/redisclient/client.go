@@ -33,3 +33,42 @@ func (c *Client) Fetch(ctx context.Context, key string) (string, error) {
 	}
 	return val, err
 }
+
+// Append pushes values onto the list at key and refreshes its ttl.
+func (c *Client) Append(ctx context.Context, key string, ttl time.Duration, values ...string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	pipe := c.inner.TxPipeline()
+	pipe.RPush(ctx, key, args...)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Range returns the list entries at key from the zero-based offset to the end.
+func (c *Client) Range(ctx context.Context, key string, from int64) ([]string, error) {
+	return c.inner.LRange(ctx, key, from, -1).Result()
+}
+
+// Claim sets key to value with ttl only if the key does not exist yet, and reports whether it did.
+func (c *Client) Claim(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return c.inner.SetNX(ctx, key, value, ttl).Result()
+}
+
+// releaseScript deletes the key only while it still holds the claimant's value.
+var releaseScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// Release deletes a key set by Claim unless it expired and was claimed by someone else since.
+func (c *Client) Release(ctx context.Context, key, value string) error {
+	return releaseScript.Run(ctx, c.inner, []string{key}, value).Err()
+}
+
+// Expire refreshes the ttl of key.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return c.inner.Expire(ctx, key, ttl).Err()
+}
@@ -0,0 +1,198 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Stored secrets look like "enc:<version>:<wrapped data key>:<sealed value>". Anything without the
+// prefix is a legacy plaintext value and is returned as-is until it is re-encrypted.
+const prefix = "enc:"
+
+var (
+	ErrUnknownKeyVersion = errors.New("secret encrypted with unknown master key version")
+	ErrMalformed         = errors.New("malformed encrypted secret")
+	ErrNoMasterKey       = errors.New("no master key configured: set SECRET_MASTER_KEYS, or ALLOW_PLAINTEXT_SECRETS=true for development")
+)
+
+// Keyring does envelope encryption: every value is sealed with a fresh AES-256-GCM data key, and
+// the data key is sealed with a versioned master key. The first configured version encrypts; all
+// versions decrypt, so master keys can be rotated by adding a new one in front and re-encrypting.
+// A nil Keyring refuses to store secrets; Plaintext returns one that stores them as-is.
+type Keyring struct {
+	active    string
+	masters   map[string][]byte
+	plaintext bool
+}
+
+// Plaintext returns a Keyring that stores values unencrypted, for development setups that
+// explicitly opt out of encryption. It still reads legacy plaintext values.
+func Plaintext() *Keyring {
+	return &Keyring{plaintext: true}
+}
+
+// ParseKeyring reads "version:base64key,version:base64key". Keys must decode to 32 bytes. An empty
+// spec returns a nil Keyring.
+func ParseKeyring(spec string) (*Keyring, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	k := &Keyring{masters: map[string][]byte{}}
+	for _, part := range strings.Split(spec, ",") {
+		version, encoded, ok := strings.Cut(strings.TrimSpace(part), ":")
+		version = strings.TrimSpace(version)
+		if !ok || version == "" {
+			return nil, fmt.Errorf("master key %q: want version:base64key", part)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", version, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %s: want 32 bytes, got %d", version, len(key))
+		}
+		if _, dup := k.masters[version]; dup {
+			return nil, fmt.Errorf("master key %s listed twice", version)
+		}
+		if k.active == "" {
+			k.active = version
+		}
+		k.masters[version] = key
+	}
+	return k, nil
+}
+
+// ActiveVersion returns the version new values are encrypted with.
+func (k *Keyring) ActiveVersion() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// Encrypt seals the value under the active master key. Empty values stay empty.
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return plain, nil
+	}
+	if k == nil {
+		return "", ErrNoMasterKey
+	}
+	if k.plaintext {
+		return plain, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.masters[k.active], dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataKey, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	return prefix + k.active + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt; plaintext legacy values pass through.
+func (k *Keyring) Decrypt(stored string) (string, error) {
+	if !strings.HasPrefix(stored, prefix) {
+		return stored, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(stored, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	if k == nil {
+		return "", ErrUnknownKeyVersion
+	}
+	master, ok := k.masters[parts[0]]
+	if !ok {
+		return "", ErrUnknownKeyVersion
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	dataKey, err := open(master, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// NeedsRewrap reports whether a stored value is plaintext or sealed under a retired master key.
+func (k *Keyring) NeedsRewrap(stored string) bool {
+	if k == nil || k.plaintext || stored == "" {
+		return false
+	}
+	return Version(stored) != k.active
+}
+
+// Version returns the master key version of a stored value, or "" for plaintext.
+func Version(stored string) string {
+	if !strings.HasPrefix(stored, prefix) {
+		return ""
+	}
+	version, _, _ := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	return version
+}
+
+// Mask keeps only the last four characters of a secret for display.
+func Mask(plain string) string {
+	if plain == "" {
+		return ""
+	}
+	if len(plain) <= 8 {
+		return "****"
+	}
+	return "****" + plain[len(plain)-4:]
+}
+
+func seal(key, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
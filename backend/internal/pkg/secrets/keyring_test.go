@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestKeyringRoundTripAndRotation(t *testing.T) {
+	old, err := ParseKeyring("v1:" + key('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Encrypt("sk-secret-value")
+	if err != nil || Version(sealed) != "v1" {
+		t.Fatalf("sealed = %q, err = %v", sealed, err)
+	}
+	rotated, err := ParseKeyring("v2:" + key('b') + ", v1:" + key('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := rotated.Decrypt(sealed); err != nil || plain != "sk-secret-value" {
+		t.Fatalf("Decrypt = %q, %v", plain, err)
+	}
+	if !rotated.NeedsRewrap(sealed) || !rotated.NeedsRewrap("legacy-plain") || old.NeedsRewrap(sealed) {
+		t.Fatal("NeedsRewrap does not follow the active version")
+	}
+	dropped, err := ParseKeyring("v2:" + key('b'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dropped.Decrypt(sealed); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Fatalf("Decrypt under a dropped key = %v", err)
+	}
+}
+
+func TestKeyringWithoutMasterKey(t *testing.T) {
+	var none *Keyring
+	if _, err := none.Encrypt("sk-secret"); !errors.Is(err, ErrNoMasterKey) {
+		t.Fatalf("nil Keyring Encrypt = %v, want ErrNoMasterKey", err)
+	}
+	if v, err := none.Encrypt(""); err != nil || v != "" {
+		t.Fatalf("empty value = %q, %v", v, err)
+	}
+	if v, err := none.Decrypt("legacy-plain"); err != nil || v != "legacy-plain" {
+		t.Fatalf("legacy value = %q, %v", v, err)
+	}
+
+	plain := Plaintext()
+	if v, err := plain.Encrypt("sk-secret"); err != nil || v != "sk-secret" {
+		t.Fatalf("Plaintext Encrypt = %q, %v", v, err)
+	}
+	if plain.ActiveVersion() != "" || plain.NeedsRewrap("sk-secret") {
+		t.Fatal("Plaintext keyring claims an active master key")
+	}
+	sealed, _ := (&Keyring{active: "v1", masters: map[string][]byte{"v1": []byte(strings.Repeat("a", 32))}}).Encrypt("x")
+	if _, err := plain.Decrypt(sealed); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Fatalf("Plaintext Decrypt of a sealed value = %v", err)
+	}
+}
@@ -2,13 +2,20 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// UserAssetRepository provides access to the user_assets table.
+// ErrInsufficientBalance is returned when a debit would take a balance below zero.
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// UserAssetRepository provides access to the user_assets table and its coin ledger.
 type UserAssetRepository struct {
 	pool *pgxpool.Pool
 }
@@ -33,16 +40,341 @@ func (r *UserAssetRepository) GetByUser(ctx context.Context, userID string) (*mo
 	return &asset, nil
 }
 
-// Upsert updates or inserts the asset row.
-func (r *UserAssetRepository) Upsert(ctx context.Context, asset *model.UserAsset) error {
+// CoinDelta describes a signed balance change recorded in the ledger.
+type CoinDelta struct {
+	UserID         string
+	Amount         int64 // positive credits the user, negative debits
+	Reason         string
+	IdempotencyKey string // replays with the same key are no-ops returning the original entry
+	RefID          string
+}
+
+// ApplyDelta atomically records the ledger legs and adjusts the cached balance.
+func (r *UserAssetRepository) ApplyDelta(ctx context.Context, delta CoinDelta) (*model.CoinLedgerEntry, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	entry, err := r.ApplyDeltaTx(ctx, tx, delta)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ApplyDeltaTx is ApplyDelta inside a caller-owned transaction, for changes that must commit together
+// with other writes.
+func (r *UserAssetRepository) ApplyDeltaTx(ctx context.Context, tx pgx.Tx, delta CoinDelta) (*model.CoinLedgerEntry, error) {
+	if strings.TrimSpace(delta.UserID) == "" {
+		return nil, errors.New("ledger: missing user")
+	}
+	if strings.TrimSpace(delta.IdempotencyKey) == "" {
+		return nil, errors.New("ledger: missing idempotency key")
+	}
+	if strings.TrimSpace(delta.Reason) == "" {
+		return nil, errors.New("ledger: missing reason")
+	}
+	entry := &model.CoinLedgerEntry{
+		ID:             uuid.NewString(),
+		TransactionID:  uuid.NewString(),
+		UserID:         delta.UserID,
+		Amount:         delta.Amount,
+		Reason:         delta.Reason,
+		IdempotencyKey: delta.IdempotencyKey,
+		RefID:          delta.RefID,
+	}
+	userAccount := "user:" + delta.UserID
+	tag, err := tx.Exec(ctx, `
+        INSERT INTO coin_ledger(id, transaction_id, account, user_id, amount, reason, idempotency_key, ref_id)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+        ON CONFLICT (idempotency_key, account) DO NOTHING
+    `, entry.ID, entry.TransactionID, userAccount, delta.UserID, delta.Amount, delta.Reason, delta.IdempotencyKey, delta.RefID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		existing, err := r.findEntry(ctx, tx, delta.IdempotencyKey, userAccount)
+		if err != nil {
+			return nil, err
+		}
+		existing.Replayed = true
+		return existing, nil
+	}
+	if _, err := tx.Exec(ctx, `
+        INSERT INTO coin_ledger(transaction_id, account, amount, reason, idempotency_key, ref_id)
+        VALUES($1,$2,$3,$4,$5,$6)
+    `, entry.TransactionID, "system:"+delta.Reason, -delta.Amount, delta.Reason, delta.IdempotencyKey, delta.RefID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO user_assets(user_id) VALUES($1) ON CONFLICT (user_id) DO NOTHING`, delta.UserID); err != nil {
+		return nil, err
+	}
+	row := tx.QueryRow(ctx, `
+        UPDATE user_assets
+        SET balance = balance + $2, updated_at = now()
+        WHERE user_id = $1 AND balance + $2 >= 0
+        RETURNING balance
+    `, delta.UserID, delta.Amount)
+	if err := row.Scan(&entry.BalanceAfter); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInsufficientBalance
+		}
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE coin_ledger SET balance_after = $2 WHERE id = $1`, entry.ID, entry.BalanceAfter); err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(ctx, `SELECT created_at FROM coin_ledger WHERE id = $1`, entry.ID).Scan(&entry.CreatedAt); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (r *UserAssetRepository) findEntry(ctx context.Context, q pgx.Tx, key, account string) (*model.CoinLedgerEntry, error) {
+	row := q.QueryRow(ctx, `
+        SELECT id, transaction_id, user_id, amount, COALESCE(balance_after, 0), reason, idempotency_key, ref_id, created_at
+        FROM coin_ledger WHERE idempotency_key = $1 AND account = $2
+    `, key, account)
+	var entry model.CoinLedgerEntry
+	if err := row.Scan(&entry.ID, &entry.TransactionID, &entry.UserID, &entry.Amount, &entry.BalanceAfter, &entry.Reason, &entry.IdempotencyKey, &entry.RefID, &entry.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ListLedger returns the user's most recent ledger entries.
+func (r *UserAssetRepository) ListLedger(ctx context.Context, userID string, limit int) ([]model.CoinLedgerEntry, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := r.pool.Query(ctx, `
+        SELECT id, transaction_id, user_id, amount, COALESCE(balance_after, 0), reason, idempotency_key, ref_id, created_at
+        FROM coin_ledger
+        WHERE account = 'user:' || $1::text
+        ORDER BY created_at DESC
+        LIMIT $2
+    `, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []model.CoinLedgerEntry
+	for rows.Next() {
+		var entry model.CoinLedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.TransactionID, &entry.UserID, &entry.Amount, &entry.BalanceAfter, &entry.Reason, &entry.IdempotencyKey, &entry.RefID, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// RebuildBalance recomputes the user's balance from the ledger and overwrites the cached value.
+func (r *UserAssetRepository) RebuildBalance(ctx context.Context, userID string) (*model.UserAsset, error) {
 	row := r.pool.QueryRow(ctx, `
-        INSERT INTO user_assets(user_id, balance, monthly_tickets)
-        VALUES($1,$2,$3)
+        INSERT INTO user_assets(user_id, balance)
+        VALUES($1, (SELECT COALESCE(SUM(amount), 0) FROM coin_ledger WHERE account = 'user:' || $1::text))
         ON CONFLICT (user_id) DO UPDATE
-        SET balance = EXCLUDED.balance,
-            monthly_tickets = EXCLUDED.monthly_tickets,
-            updated_at = now()
+        SET balance = EXCLUDED.balance, updated_at = now()
+        RETURNING user_id, balance, monthly_tickets, created_at, updated_at
+    `, userID)
+	var asset model.UserAsset
+	if err := row.Scan(&asset.UserID, &asset.Balance, &asset.MonthlyTickets, &asset.CreatedAt, &asset.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// ErrHoldNotActive is returned when capturing or releasing a hold that was already settled.
+var ErrHoldNotActive = errors.New("hold is not active")
+
+// Hold debits amount from the user's balance and records it as a pending hold.
+func (r *UserAssetRepository) Hold(ctx context.Context, userID string, amount int64, refID string, ttl time.Duration) (*model.CoinHold, error) {
+	if amount <= 0 {
+		return nil, errors.New("hold amount must be > 0")
+	}
+	hold := &model.CoinHold{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Amount:    amount,
+		Status:    "held",
+		RefID:     refID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if err := tx.QueryRow(ctx, `
+        INSERT INTO coin_holds(id, user_id, amount, status, ref_id, expires_at)
+        VALUES($1,$2,$3,$4,$5,$6)
         RETURNING created_at, updated_at
-    `, asset.UserID, asset.Balance, asset.MonthlyTickets)
-	return row.Scan(&asset.CreatedAt, &asset.UpdatedAt)
+    `, hold.ID, hold.UserID, hold.Amount, hold.Status, hold.RefID, hold.ExpiresAt).Scan(&hold.CreatedAt, &hold.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if _, err := r.ApplyDeltaTx(ctx, tx, CoinDelta{
+		UserID:         userID,
+		Amount:         -amount,
+		Reason:         model.LedgerReasonModelCall,
+		IdempotencyKey: "hold:" + hold.ID,
+		RefID:          refID,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// CaptureHold settles the hold at finalAmount and refunds any remainder. A finalAmount above the
+// hold, which happens when the provider reports more tokens than were estimated, is charged from
+// the balance as far as it goes; the returned CapturedAmount is what was charged in total.
+func (r *UserAssetRepository) CaptureHold(ctx context.Context, holdID string, finalAmount int64, refID string) (*model.CoinHold, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	hold, err := settleHold(ctx, tx, holdID, "captured", finalAmount, refID)
+	if err != nil {
+		return nil, err
+	}
+	if remainder := hold.Amount - hold.CapturedAmount; remainder > 0 {
+		if _, err := r.ApplyDeltaTx(ctx, tx, CoinDelta{
+			UserID:         hold.UserID,
+			Amount:         remainder,
+			Reason:         model.LedgerReasonRefund,
+			IdempotencyKey: "hold-capture:" + hold.ID,
+			RefID:          hold.RefID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if overage := finalAmount - hold.Amount; overage > 0 {
+		charged, err := r.chargeOverage(ctx, tx, hold, overage)
+		if err != nil {
+			return nil, err
+		}
+		hold.CapturedAmount += charged
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// chargeOverage debits up to overage beyond the captured hold and returns the coins charged. The
+// reply is already delivered, so a short balance is charged down to zero instead of failing.
+func (r *UserAssetRepository) chargeOverage(ctx context.Context, tx pgx.Tx, hold *model.CoinHold, overage int64) (int64, error) {
+	var balance int64
+	err := tx.QueryRow(ctx, `SELECT balance FROM user_assets WHERE user_id = $1 FOR UPDATE`, hold.UserID).Scan(&balance)
+	if err != nil && err != pgx.ErrNoRows {
+		return 0, err
+	}
+	charge := min(overage, balance)
+	if charge <= 0 {
+		return 0, nil
+	}
+	if _, err := r.ApplyDeltaTx(ctx, tx, CoinDelta{
+		UserID:         hold.UserID,
+		Amount:         -charge,
+		Reason:         model.LedgerReasonModelCall,
+		IdempotencyKey: "hold-overage:" + hold.ID,
+		RefID:          hold.RefID,
+	}); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE coin_holds SET captured_amount = captured_amount + $2 WHERE id = $1`, hold.ID, charge); err != nil {
+		return 0, err
+	}
+	return charge, nil
+}
+
+// ReleaseHold cancels the hold and refunds the full amount.
+func (r *UserAssetRepository) ReleaseHold(ctx context.Context, holdID string) (*model.CoinHold, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	hold, err := settleHold(ctx, tx, holdID, "released", 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.ApplyDeltaTx(ctx, tx, CoinDelta{
+		UserID:         hold.UserID,
+		Amount:         hold.Amount,
+		Reason:         model.LedgerReasonRefund,
+		IdempotencyKey: "hold-release:" + hold.ID,
+		RefID:          hold.RefID,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ReleaseExpiredHolds refunds holds whose owner never captured or released them (e.g. after a crash).
+func (r *UserAssetRepository) ReleaseExpiredHolds(ctx context.Context, limit int) (int, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := r.pool.Query(ctx, `
+        SELECT id FROM coin_holds WHERE status = 'held' AND expires_at < now() ORDER BY expires_at LIMIT $1
+    `, limit)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	released := 0
+	for _, id := range ids {
+		if _, err := r.ReleaseHold(ctx, id); err != nil {
+			if errors.Is(err, ErrHoldNotActive) {
+				continue
+			}
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+func settleHold(ctx context.Context, tx pgx.Tx, holdID, status string, capturedAmount int64, refID string) (*model.CoinHold, error) {
+	row := tx.QueryRow(ctx, `
+        UPDATE coin_holds
+        SET status = $2,
+            captured_amount = LEAST(GREATEST($3, 0), amount),
+            ref_id = CASE WHEN $4 = '' THEN ref_id ELSE $4 END,
+            updated_at = now()
+        WHERE id = $1 AND status = 'held'
+        RETURNING id, user_id, amount, captured_amount, status, ref_id, expires_at, created_at, updated_at
+    `, holdID, status, capturedAmount, refID)
+	var hold model.CoinHold
+	if err := row.Scan(&hold.ID, &hold.UserID, &hold.Amount, &hold.CapturedAmount, &hold.Status, &hold.RefID, &hold.ExpiresAt, &hold.CreatedAt, &hold.UpdatedAt); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrHoldNotActive
+		}
+		return nil, err
+	}
+	return &hold, nil
 }
@@ -55,6 +55,10 @@ func (r *ChatRepository) FindSession(ctx context.Context, id string) (*model.Cha
 			mode,
 			status,
 			COALESCE(settings, settings_json, '{}'::jsonb) AS settings,
+			COALESCE(summary, ''),
+			COALESCE(summary_watermark::text, ''),
+			COALESCE(persona_id::text, ''),
+			variables,
 			created_at,
 			updated_at
         FROM chat_sessions
@@ -132,40 +136,163 @@ func (r *ChatRepository) ListSessionsByUser(ctx context.Context, userID string,
 	return sessions, nil
 }
 
+// AddMessage inserts the message under msg.ParentID (a root when empty) and makes it the active
+// candidate among its siblings.
 func (r *ChatRepository) AddMessage(ctx context.Context, msg *model.ChatMessage) error {
 	if msg.ID == "" {
 		msg.ID = uuid.NewString()
 	}
 	metaJSON, _ := json.Marshal(msg.Metadata)
-	row := r.pool.QueryRow(ctx, `
-        INSERT INTO chat_messages(id, session_id, role, content, is_important, metadata)
-        VALUES($1,$2,$3,$4,$5,$6)
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `
+        UPDATE chat_messages SET is_active = false
+        WHERE session_id = $1 AND parent_id IS NOT DISTINCT FROM NULLIF($2,'')::uuid
+    `, msg.SessionID, msg.ParentID); err != nil {
+		return err
+	}
+	row := tx.QueryRow(ctx, `
+        INSERT INTO chat_messages(id, session_id, parent_id, role, content, is_important, metadata, is_active)
+        VALUES($1,$2,NULLIF($3,'')::uuid,$4,$5,$6,$7,true)
         RETURNING created_at
-    `, msg.ID, msg.SessionID, msg.Role, msg.Content, msg.IsImportant, metaJSON)
+    `, msg.ID, msg.SessionID, msg.ParentID, msg.Role, msg.Content, msg.IsImportant, metaJSON)
 	if err := row.Scan(&msg.CreatedAt); err != nil {
 		return err
 	}
-	_, _ = r.pool.Exec(ctx, `UPDATE chat_sessions SET updated_at = now() WHERE id = $1`, msg.SessionID)
+	if _, err := tx.Exec(ctx, `UPDATE chat_sessions SET updated_at = now() WHERE id = $1`, msg.SessionID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	msg.IsActive = true
 	return nil
 }
 
+// activePathCTE walks the session's active branch from its active root; $1 is the session ID.
+const activePathCTE = `
+    WITH RECURSIVE path AS (
+        SELECT id, 0 AS depth FROM chat_messages
+        WHERE session_id = $1 AND parent_id IS NULL AND is_active
+        UNION ALL
+        SELECT m.id, p.depth + 1 FROM chat_messages m
+        JOIN path p ON m.parent_id = p.id
+        WHERE m.is_active
+    )
+`
+
+const messageColumns = `
+    m.id, m.session_id, COALESCE(m.parent_id::text, ''), m.role, m.content, m.is_important, m.is_active,
+    (SELECT COUNT(*) FROM chat_messages s WHERE s.session_id = m.session_id AND s.parent_id IS NOT DISTINCT FROM m.parent_id),
+    (SELECT COUNT(*) FROM chat_messages s WHERE s.session_id = m.session_id AND s.parent_id IS NOT DISTINCT FROM m.parent_id
+        AND (s.created_at, s.id) <= (m.created_at, m.id)),
+    m.metadata, m.created_at
+`
+
+// ListMessages returns the last limit messages of the session's active path, oldest first.
 func (r *ChatRepository) ListMessages(ctx context.Context, sessionID string, limit int) ([]model.ChatMessage, error) {
 	if limit <= 0 {
 		limit = 50
 	}
-	rows, err := r.pool.Query(ctx, `
-        SELECT id, session_id, role, content, is_important, metadata, created_at
-        FROM chat_messages WHERE session_id = $1 ORDER BY created_at ASC LIMIT $2
+	rows, err := r.pool.Query(ctx, activePathCTE+`
+        SELECT `+messageColumns+`
+        FROM path JOIN chat_messages m ON m.id = path.id
+        ORDER BY path.depth DESC LIMIT $2
     `, sessionID, limit)
 	if err != nil {
 		return nil, err
 	}
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// ListPath returns the message and its ancestors, root first, regardless of which branch is active.
+func (r *ChatRepository) ListPath(ctx context.Context, messageID string, limit int) ([]model.ChatMessage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := r.pool.Query(ctx, `
+        WITH RECURSIVE anc AS (
+            SELECT id, parent_id, 0 AS depth FROM chat_messages WHERE id = $1
+            UNION ALL
+            SELECT m.id, m.parent_id, a.depth + 1 FROM chat_messages m JOIN anc a ON m.id = a.parent_id
+        )
+        SELECT `+messageColumns+`
+        FROM anc JOIN chat_messages m ON m.id = anc.id
+        ORDER BY anc.depth ASC LIMIT $2
+    `, messageID, limit)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// ListSiblings returns every candidate sharing the message's parent, oldest first.
+func (r *ChatRepository) ListSiblings(ctx context.Context, messageID string) ([]model.ChatMessage, error) {
+	rows, err := r.pool.Query(ctx, `
+        SELECT `+messageColumns+`
+        FROM chat_messages m
+        JOIN chat_messages t ON t.id = $1
+        WHERE m.session_id = t.session_id AND m.parent_id IS NOT DISTINCT FROM t.parent_id
+        ORDER BY m.created_at ASC, m.id ASC
+    `, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+// ActivateMessage selects the message among its siblings and activates its ancestors, so the
+// active path runs through it and continues along its own active descendants.
+func (r *ChatRepository) ActivateMessage(ctx context.Context, sessionID, messageID string) error {
+	_, err := r.pool.Exec(ctx, `
+        WITH RECURSIVE anc AS (
+            SELECT id, parent_id FROM chat_messages WHERE id = $2 AND session_id = $1
+            UNION ALL
+            SELECT m.id, m.parent_id FROM chat_messages m JOIN anc a ON m.id = a.parent_id
+        )
+        UPDATE chat_messages c
+        SET is_active = c.id IN (SELECT id FROM anc)
+        WHERE c.session_id = $1
+          AND (c.parent_id IN (SELECT parent_id FROM anc WHERE parent_id IS NOT NULL)
+               OR (c.parent_id IS NULL AND EXISTS (SELECT 1 FROM anc WHERE parent_id IS NULL)))
+    `, sessionID, messageID)
+	return err
+}
+
+// ForkAt activates the message and deactivates its children so the next message branches from it.
+func (r *ChatRepository) ForkAt(ctx context.Context, sessionID, messageID string) error {
+	if err := r.ActivateMessage(ctx, sessionID, messageID); err != nil {
+		return err
+	}
+	_, err := r.pool.Exec(ctx, `UPDATE chat_messages SET is_active = false WHERE session_id = $1 AND parent_id = $2`, sessionID, messageID)
+	return err
+}
+
+func scanMessages(rows pgx.Rows) ([]model.ChatMessage, error) {
 	defer rows.Close()
 	var messages []model.ChatMessage
 	for rows.Next() {
 		var msg model.ChatMessage
 		var metaRaw []byte
-		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.IsImportant, &metaRaw, &msg.CreatedAt); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.ParentID, &msg.Role, &msg.Content, &msg.IsImportant, &msg.IsActive,
+			&msg.SiblingCount, &msg.SiblingIndex, &metaRaw, &msg.CreatedAt); err != nil {
 			return nil, err
 		}
 		if len(metaRaw) > 0 {
@@ -173,7 +300,7 @@ func (r *ChatRepository) ListMessages(ctx context.Context, sessionID string, lim
 		}
 		messages = append(messages, msg)
 	}
-	return messages, nil
+	return messages, rows.Err()
 }
 
 func (r *ChatRepository) UpdateMessageContent(ctx context.Context, id, sessionID, content string) error {
@@ -184,9 +311,26 @@ func (r *ChatRepository) UpdateMessageContent(ctx context.Context, id, sessionID
 	return err
 }
 
+// DeleteMessage removes a single message, re-attaching its children to its parent so later turns survive.
 func (r *ChatRepository) DeleteMessage(ctx context.Context, id, sessionID string) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM chat_messages WHERE id = $1 AND session_id = $2`, id, sessionID)
-	return err
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	// Children only stay active if the deleted message was, otherwise its parent would gain a second active child.
+	if _, err := tx.Exec(ctx, `
+        UPDATE chat_messages c
+        SET parent_id = d.parent_id, is_active = c.is_active AND d.is_active
+        FROM chat_messages d
+        WHERE d.id = $1 AND d.session_id = $2 AND c.parent_id = d.id
+    `, id, sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM chat_messages WHERE id = $1 AND session_id = $2`, id, sessionID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (r *ChatRepository) DeleteMessagesBySession(ctx context.Context, sessionID string) error {
@@ -210,6 +354,10 @@ func (r *ChatRepository) FindSessionByMessage(ctx context.Context, messageID str
 			cs.mode,
 			cs.status,
 			COALESCE(cs.settings, cs.settings_json, '{}'::jsonb) AS settings,
+			COALESCE(cs.summary, ''),
+			COALESCE(cs.summary_watermark::text, ''),
+			COALESCE(cs.persona_id::text, ''),
+			cs.variables,
 			cs.created_at,
 			cs.updated_at
         FROM chat_messages cm
@@ -244,17 +392,18 @@ func (r *ChatRepository) UpdateSettings(ctx context.Context, sessionID, mode, mo
 		UPDATE chat_sessions
 		SET mode = $2, model_key = $3, settings = $4, settings_json = $4, updated_at = now()
 		WHERE id = $1
-		RETURNING id, user_id, role_id, model_key, title, summary, mode, status, settings, created_at, updated_at
+		RETURNING id, user_id, role_id, model_key, title, summary, mode, status, settings, COALESCE(persona_id::text, ''), variables, created_at, updated_at
 	`
 	var s model.ChatSession
-	var settingsBytes []byte
+	var settingsBytes, variablesBytes []byte
 	var summary string // Added for scanning the summary field
 	err = r.pool.QueryRow(ctx, query, sessionID, mode, modelKey, settingsJSON).Scan(
-		&s.ID, &s.UserID, &s.RoleID, &s.ModelKey, &s.Title, &summary, &s.Mode, &s.Status, &settingsBytes, &s.CreatedAt, &s.UpdatedAt,
+		&s.ID, &s.UserID, &s.RoleID, &s.ModelKey, &s.Title, &summary, &s.Mode, &s.Status, &settingsBytes, &s.PersonaID, &variablesBytes, &s.CreatedAt, &s.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	_ = json.Unmarshal(variablesBytes, &s.Variables)
 	s.Summary = summary // Assign scanned summary
 	if err := json.Unmarshal(settingsBytes, &s.Settings); err != nil {
 		return nil, err
@@ -262,21 +411,31 @@ func (r *ChatRepository) UpdateSettings(ctx context.Context, sessionID, mode, mo
 	return &s, nil
 }
 
-func (r *ChatRepository) UpdateSummary(ctx context.Context, sessionID, summary string) error {
-	query := `
-		UPDATE chat_sessions
-		SET summary = $2, updated_at = now()
-		WHERE id = $1
-	`
-	_, err := r.pool.Exec(ctx, query, sessionID, summary)
+// SetPersona sets the session's persona override; an empty personaID falls back to the default.
+func (r *ChatRepository) SetPersona(ctx context.Context, sessionID, personaID string) error {
+	_, err := r.pool.Exec(ctx, `UPDATE chat_sessions SET persona_id = NULLIF($2,'')::uuid WHERE id = $1`, sessionID, personaID)
+	return err
+}
+
+// SetVariables replaces the session's macro variables.
+func (r *ChatRepository) SetVariables(ctx context.Context, sessionID string, vars map[string]string) error {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	raw, err := json.Marshal(vars)
+	if err != nil {
+		return err
+	}
+	_, err = r.pool.Exec(ctx, `UPDATE chat_sessions SET variables = $2 WHERE id = $1`, sessionID, raw)
 	return err
 }
 
 func scanSession(row pgx.Row, session *model.ChatSession) error {
-	var settingsRaw []byte
-	if err := row.Scan(&session.ID, &session.UserID, &session.RoleID, &session.ModelKey, &session.Title, &session.Mode, &session.Status, &settingsRaw, &session.CreatedAt, &session.UpdatedAt); err != nil {
+	var settingsRaw, variablesRaw []byte
+	if err := row.Scan(&session.ID, &session.UserID, &session.RoleID, &session.ModelKey, &session.Title, &session.Mode, &session.Status, &settingsRaw, &session.Summary, &session.SummaryWatermark, &session.PersonaID, &variablesRaw, &session.CreatedAt, &session.UpdatedAt); err != nil {
 		return err
 	}
+	_ = json.Unmarshal(variablesRaw, &session.Variables)
 	if len(settingsRaw) == 0 {
 		session.Settings = model.DefaultChatSessionSettings()
 		return nil
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrSummaryConflict is returned by SaveSummaries when another writer changed the session's
+// summaries first.
+var ErrSummaryConflict = errors.New("summary changed concurrently")
+
+const summaryColumns = `id, session_id, level, position, version, content, COALESCE(through_message_id::text, ''), message_count, source, is_current, created_at`
+
+func scanSummaries(rows pgx.Rows) ([]model.ChatSummary, error) {
+	defer rows.Close()
+	var items []model.ChatSummary
+	for rows.Next() {
+		var s model.ChatSummary
+		if err := rows.Scan(&s.ID, &s.SessionID, &s.Level, &s.Position, &s.Version, &s.Content, &s.ThroughMessageID, &s.MessageCount, &s.Source, &s.IsCurrent, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, s)
+	}
+	return items, rows.Err()
+}
+
+// CurrentSummaries returns the live summaries of a session: the arc first, then chapters in order.
+func (r *ChatRepository) CurrentSummaries(ctx context.Context, sessionID string) ([]model.ChatSummary, error) {
+	rows, err := r.pool.Query(ctx, `
+        SELECT `+summaryColumns+`
+        FROM chat_summaries
+        WHERE session_id = $1 AND is_current
+        ORDER BY level = 'arc' DESC, position ASC
+    `, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSummaries(rows)
+}
+
+// SummaryVersions returns every summary row of a session, newest version first.
+func (r *ChatRepository) SummaryVersions(ctx context.Context, sessionID string, limit int) ([]model.ChatSummary, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := r.pool.Query(ctx, `
+        SELECT `+summaryColumns+`
+        FROM chat_summaries
+        WHERE session_id = $1
+        ORDER BY version DESC LIMIT $2
+    `, sessionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanSummaries(rows)
+}
+
+// CountMessagesAfter counts the messages of the active path that follow afterID. found is false
+// when afterID is set but no longer on the active path (deleted, or another branch was selected);
+// the count then covers the whole path.
+func (r *ChatRepository) CountMessagesAfter(ctx context.Context, sessionID, afterID string) (count int, found bool, err error) {
+	err = r.pool.QueryRow(ctx, activePathCTE+`
+        , mark AS (SELECT depth FROM path WHERE id = NULLIF($2,'')::uuid)
+        SELECT COUNT(*) FILTER (WHERE path.depth > COALESCE((SELECT depth FROM mark), -1)),
+               EXISTS(SELECT 1 FROM mark)
+        FROM path
+    `, sessionID, afterID).Scan(&count, &found)
+	return count, found || afterID == "", err
+}
+
+// ListMessagesAfter returns up to limit messages of the active path that follow afterID, oldest
+// first; an empty afterID starts at the root.
+func (r *ChatRepository) ListMessagesAfter(ctx context.Context, sessionID, afterID string, limit int) ([]model.ChatMessage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := r.pool.Query(ctx, activePathCTE+`
+        , mark AS (SELECT depth FROM path WHERE id = NULLIF($2,'')::uuid)
+        SELECT `+messageColumns+`
+        FROM path JOIN chat_messages m ON m.id = path.id
+        WHERE path.depth > COALESCE((SELECT depth FROM mark), -1)
+        ORDER BY path.depth ASC LIMIT $3
+    `, sessionID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+// SummaryChange moves a session's summaries from one state to the next.
+type SummaryChange struct {
+	SessionID         string
+	ExpectedWatermark string   // watermark the change was computed against
+	Watermark         string   // watermark after the change
+	Retire            []string // current rows the change replaces
+	Add               []*model.ChatSummary
+	Rendered          string // new chat_sessions.summary
+}
+
+// SaveSummaries applies change in one transaction, numbering the added rows with the next
+// versions. It returns ErrSummaryConflict when the watermark is no longer ExpectedWatermark or a
+// row to retire is no longer current.
+func (r *ChatRepository) SaveSummaries(ctx context.Context, change SummaryChange) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `
+        UPDATE chat_sessions SET summary_watermark = NULLIF($3,'')::uuid, summary = $4
+        WHERE id = $1 AND summary_watermark IS NOT DISTINCT FROM NULLIF($2,'')::uuid
+    `, change.SessionID, change.ExpectedWatermark, change.Watermark, change.Rendered)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSummaryConflict
+	}
+	if len(change.Retire) > 0 {
+		tag, err = tx.Exec(ctx, `
+            UPDATE chat_summaries SET is_current = false
+            WHERE session_id = $1 AND id = ANY($2::uuid[]) AND is_current
+        `, change.SessionID, change.Retire)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != int64(len(change.Retire)) {
+			return ErrSummaryConflict
+		}
+	}
+	var version int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM chat_summaries WHERE session_id = $1`, change.SessionID).Scan(&version); err != nil {
+		return err
+	}
+	for _, s := range change.Add {
+		version++
+		s.ID = uuid.NewString()
+		s.SessionID = change.SessionID
+		s.Version = version
+		s.IsCurrent = true
+		if err := tx.QueryRow(ctx, `
+            INSERT INTO chat_summaries(id, session_id, level, position, version, content, through_message_id, message_count, source)
+            VALUES($1,$2,$3,$4,$5,$6,NULLIF($7,'')::uuid,$8,$9)
+            RETURNING created_at
+        `, s.ID, s.SessionID, s.Level, s.Position, s.Version, s.Content, s.ThroughMessageID, s.MessageCount, s.Source).Scan(&s.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ResetSummaries retires every current summary and clears the watermark, so the session is
+// summarized again from its first message.
+func (r *ChatRepository) ResetSummaries(ctx context.Context, sessionID string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `UPDATE chat_summaries SET is_current = false WHERE session_id = $1 AND is_current`, sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE chat_sessions SET summary_watermark = NULL, summary = '' WHERE id = $1`, sessionID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"path"
 	"strings"
-	"sync"
 
 	"github.com/example/ai-avatar-studio/internal/model"
 	"github.com/google/uuid"
@@ -17,29 +16,13 @@ import (
 // CommunityRepository deals with posts, comments and reactions.
 type CommunityRepository struct {
 	pool *pgxpool.Pool
-	once sync.Once
-	err  error
 }
 
 func NewCommunityRepository(pool *pgxpool.Pool) *CommunityRepository {
 	return &CommunityRepository{pool: pool}
 }
 
-// ensureLinkColumns is a defensive guard to add link fields if migrations were skipped.
-func (r *CommunityRepository) ensureLinkColumns(ctx context.Context) error {
-	r.once.Do(func() {
-		_, r.err = r.pool.Exec(ctx, `
-			ALTER TABLE community_posts ADD COLUMN IF NOT EXISTS link_url TEXT;
-			ALTER TABLE community_posts ADD COLUMN IF NOT EXISTS link_type TEXT;
-		`)
-	})
-	return r.err
-}
-
 func (r *CommunityRepository) CreatePost(ctx context.Context, post *model.CommunityPost) error {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return err
-	}
 	if post.ID == "" {
 		post.ID = uuid.NewString()
 	}
@@ -56,9 +39,6 @@ func (r *CommunityRepository) ListPosts(ctx context.Context, limit int) ([]model
 }
 
 func (r *CommunityRepository) ListPostsFiltered(ctx context.Context, limit int, sort, filter, userID, authorID, search string) ([]model.CommunityPost, error) {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return nil, err
-	}
 	if limit <= 0 {
 		limit = 20
 	}
@@ -147,9 +127,6 @@ func (r *CommunityRepository) ListPostsFiltered(ctx context.Context, limit int,
 }
 
 func (r *CommunityRepository) FindPost(ctx context.Context, id string) (*model.CommunityPost, error) {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return nil, err
-	}
 	row := r.pool.QueryRow(ctx, `
         SELECT
 			p.id,
@@ -334,17 +311,11 @@ func (r *CommunityRepository) CountReactions(ctx context.Context, postID string)
 }
 
 func (r *CommunityRepository) UpdateVisibility(ctx context.Context, id, visibility string) error {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return err
-	}
 	_, err := r.pool.Exec(ctx, `UPDATE community_posts SET visibility = $2, updated_at = now() WHERE id = $1`, id, visibility)
 	return err
 }
 
 func (r *CommunityRepository) ListPostsAdmin(ctx context.Context, query, visibility string, limit, offset int) ([]model.CommunityPost, error) {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return nil, err
-	}
 	if limit <= 0 {
 		limit = 50
 	}
@@ -460,9 +431,6 @@ func (r *CommunityRepository) UpdateCommentVisibility(ctx context.Context, id, v
 }
 
 func (r *CommunityRepository) ListFavorites(ctx context.Context, userID string, limit int) ([]model.CommunityPost, error) {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return nil, err
-	}
 	if limit <= 0 {
 		limit = 20
 	}
@@ -517,9 +485,6 @@ func (r *CommunityRepository) RecordView(ctx context.Context, userID, postID str
 	if strings.TrimSpace(userID) == "" || strings.TrimSpace(postID) == "" {
 		return nil
 	}
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return err
-	}
 	_, err := r.pool.Exec(ctx, `
         INSERT INTO community_post_views(user_id, post_id)
         VALUES($1,$2)
@@ -531,9 +496,6 @@ func (r *CommunityRepository) RecordView(ctx context.Context, userID, postID str
 }
 
 func (r *CommunityRepository) ListRecentViews(ctx context.Context, userID string, limit int) ([]model.CommunityPost, error) {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return nil, err
-	}
 	if limit <= 0 {
 		limit = 10
 	}
@@ -583,9 +545,6 @@ func (r *CommunityRepository) ListRecentViews(ctx context.Context, userID string
 }
 
 func (r *CommunityRepository) CountPostsByAuthor(ctx context.Context, authorID string) (int, error) {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return 0, err
-	}
 	row := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM community_posts WHERE author_id = $1`, authorID)
 	var total int
 	if err := row.Scan(&total); err != nil {
@@ -595,9 +554,6 @@ func (r *CommunityRepository) CountPostsByAuthor(ctx context.Context, authorID s
 }
 
 func (r *CommunityRepository) ListPostsByAuthor(ctx context.Context, authorID string, limit int) ([]model.CommunityPost, error) {
-	if err := r.ensureLinkColumns(ctx); err != nil {
-		return nil, err
-	}
 	if limit <= 0 {
 		limit = 10
 	}
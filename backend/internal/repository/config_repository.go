@@ -2,20 +2,23 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/secrets"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// ConfigRepository handles dictionaries + model configs.
+// ConfigRepository handles dictionaries + model configs. Model API keys are encrypted with keys.
 type ConfigRepository struct {
 	pool *pgxpool.Pool
+	keys *secrets.Keyring
 }
 
-func NewConfigRepository(pool *pgxpool.Pool) *ConfigRepository {
-	return &ConfigRepository{pool: pool}
+func NewConfigRepository(pool *pgxpool.Pool, keys *secrets.Keyring) *ConfigRepository {
+	return &ConfigRepository{pool: pool, keys: keys}
 }
 
 func (r *ConfigRepository) ListModels(ctx context.Context, includeDisabled bool) ([]model.ModelConfig, error) {
@@ -33,14 +36,23 @@ func (r *ConfigRepository) ListModels(ctx context.Context, includeDisabled bool)
                price_coins,
                share_role_pct,
                share_preset_pct,
+               input_price_per_1k,
+               output_price_per_1k,
+               fallback_model_ids,
+               max_retries,
+               retry_backoff_ms,
+               breaker_threshold,
+               breaker_cooldown_seconds,
+               thinking_budget_tokens,
                coalesce(price_hint,''),
                temperature,
                max_tokens,
                api_key <> '' AS has_api_key,
+               api_key_hint,
                created_at,
                updated_at
         FROM models
-        WHERE ($1 = true OR status = 'active')
+        WHERE ($1 = true OR status IN ('active', 'degraded'))
         ORDER BY created_at DESC
     `, includeDisabled)
 	if err != nil {
@@ -50,7 +62,7 @@ func (r *ConfigRepository) ListModels(ctx context.Context, includeDisabled bool)
 	var models []model.ModelConfig
 	for rows.Next() {
 		var m model.ModelConfig
-		if err := rows.Scan(&m.ID, &m.Name, &m.Description, &m.Provider, &m.BaseURL, &m.ModelName, &m.IsDefault, &m.IsEnabled, &m.Status, &m.MaxContextTokens, &m.PriceCoins, &m.ShareRolePct, &m.SharePresetPct, &m.PriceHint, &m.Temperature, &m.MaxTokens, &m.HasAPIKey, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		if err := rows.Scan(&m.ID, &m.Name, &m.Description, &m.Provider, &m.BaseURL, &m.ModelName, &m.IsDefault, &m.IsEnabled, &m.Status, &m.MaxContextTokens, &m.PriceCoins, &m.ShareRolePct, &m.SharePresetPct, &m.InputPricePer1K, &m.OutputPricePer1K, &m.FallbackModelIDs, &m.MaxRetries, &m.RetryBackoffMs, &m.BreakerThreshold, &m.BreakerCooldownSeconds, &m.ThinkingBudgetTokens, &m.PriceHint, &m.Temperature, &m.MaxTokens, &m.HasAPIKey, &m.APIKeyHint, &m.CreatedAt, &m.UpdatedAt); err != nil {
 			return nil, err
 		}
 		models = append(models, m)
@@ -76,19 +88,31 @@ func (r *ConfigRepository) FindModel(ctx context.Context, id string) (*model.Mod
                price_coins,
                share_role_pct,
                share_preset_pct,
+               input_price_per_1k,
+               output_price_per_1k,
+               fallback_model_ids,
+               max_retries,
+               retry_backoff_ms,
+               breaker_threshold,
+               breaker_cooldown_seconds,
+               thinking_budget_tokens,
                coalesce(price_hint,''),
                api_key <> '' AS has_api_key,
+               api_key_hint,
                created_at,
                updated_at
         FROM models WHERE id = $1
     `, id)
 	var m model.ModelConfig
-	if err := row.Scan(&m.ID, &m.Name, &m.Description, &m.Provider, &m.BaseURL, &m.ModelName, &m.APIKey, &m.Temperature, &m.MaxTokens, &m.Status, &m.IsDefault, &m.IsEnabled, &m.MaxContextTokens, &m.PriceCoins, &m.ShareRolePct, &m.SharePresetPct, &m.PriceHint, &m.HasAPIKey, &m.CreatedAt, &m.UpdatedAt); err != nil {
+	if err := row.Scan(&m.ID, &m.Name, &m.Description, &m.Provider, &m.BaseURL, &m.ModelName, &m.APIKey, &m.Temperature, &m.MaxTokens, &m.Status, &m.IsDefault, &m.IsEnabled, &m.MaxContextTokens, &m.PriceCoins, &m.ShareRolePct, &m.SharePresetPct, &m.InputPricePer1K, &m.OutputPricePer1K, &m.FallbackModelIDs, &m.MaxRetries, &m.RetryBackoffMs, &m.BreakerThreshold, &m.BreakerCooldownSeconds, &m.ThinkingBudgetTokens, &m.PriceHint, &m.HasAPIKey, &m.APIKeyHint, &m.CreatedAt, &m.UpdatedAt); err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if err := r.decryptKey(&m); err != nil {
+		return nil, err
+	}
 	return &m, nil
 }
 
@@ -110,14 +134,23 @@ func (r *ConfigRepository) DefaultModel(ctx context.Context) (*model.ModelConfig
                price_coins,
                share_role_pct,
                share_preset_pct,
+               input_price_per_1k,
+               output_price_per_1k,
+               fallback_model_ids,
+               max_retries,
+               retry_backoff_ms,
+               breaker_threshold,
+               breaker_cooldown_seconds,
+               thinking_budget_tokens,
                coalesce(price_hint,''),
                api_key <> '' AS has_api_key,
+               api_key_hint,
                created_at,
                updated_at
         FROM models WHERE is_default = true LIMIT 1
     `)
 	var m model.ModelConfig
-	if err := row.Scan(&m.ID, &m.Name, &m.Description, &m.Provider, &m.BaseURL, &m.ModelName, &m.APIKey, &m.Temperature, &m.MaxTokens, &m.Status, &m.IsDefault, &m.IsEnabled, &m.MaxContextTokens, &m.PriceCoins, &m.ShareRolePct, &m.SharePresetPct, &m.PriceHint, &m.HasAPIKey, &m.CreatedAt, &m.UpdatedAt); err != nil {
+	if err := row.Scan(&m.ID, &m.Name, &m.Description, &m.Provider, &m.BaseURL, &m.ModelName, &m.APIKey, &m.Temperature, &m.MaxTokens, &m.Status, &m.IsDefault, &m.IsEnabled, &m.MaxContextTokens, &m.PriceCoins, &m.ShareRolePct, &m.SharePresetPct, &m.InputPricePer1K, &m.OutputPricePer1K, &m.FallbackModelIDs, &m.MaxRetries, &m.RetryBackoffMs, &m.BreakerThreshold, &m.BreakerCooldownSeconds, &m.ThinkingBudgetTokens, &m.PriceHint, &m.HasAPIKey, &m.APIKeyHint, &m.CreatedAt, &m.UpdatedAt); err != nil {
 		if err == pgx.ErrNoRows {
 			models, listErr := r.ListModels(ctx, true)
 			if listErr != nil {
@@ -130,6 +163,9 @@ func (r *ConfigRepository) DefaultModel(ctx context.Context) (*model.ModelConfig
 		}
 		return nil, err
 	}
+	if err := r.decryptKey(&m); err != nil {
+		return nil, err
+	}
 	return &m, nil
 }
 
@@ -137,6 +173,15 @@ func (r *ConfigRepository) SaveModel(ctx context.Context, m *model.ModelConfig)
 	if m.ID == "" {
 		m.ID = uuid.NewString()
 	}
+	if m.FallbackModelIDs == nil {
+		m.FallbackModelIDs = []string{}
+	}
+	// An empty key on update keeps the stored one.
+	hint := secrets.Mask(m.APIKey)
+	storedKey, err := r.keys.Encrypt(m.APIKey)
+	if err != nil {
+		return fmt.Errorf("encrypt api key: %w", err)
+	}
 	row := r.pool.QueryRow(ctx, `
         INSERT INTO models(
             id,
@@ -155,9 +200,18 @@ func (r *ConfigRepository) SaveModel(ctx context.Context, m *model.ModelConfig)
             price_coins,
             share_role_pct,
             share_preset_pct,
-            price_hint
+            price_hint,
+            input_price_per_1k,
+            output_price_per_1k,
+            fallback_model_ids,
+            max_retries,
+            retry_backoff_ms,
+            breaker_threshold,
+            breaker_cooldown_seconds,
+            api_key_hint,
+            thinking_budget_tokens
         )
-        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26)
         ON CONFLICT (id) DO UPDATE SET
             name = EXCLUDED.name,
             description = EXCLUDED.description,
@@ -165,6 +219,7 @@ func (r *ConfigRepository) SaveModel(ctx context.Context, m *model.ModelConfig)
             base_url = EXCLUDED.base_url,
             model_name = EXCLUDED.model_name,
             api_key = CASE WHEN EXCLUDED.api_key = '' THEN models.api_key ELSE EXCLUDED.api_key END,
+            api_key_hint = CASE WHEN EXCLUDED.api_key = '' THEN models.api_key_hint ELSE EXCLUDED.api_key_hint END,
             temperature = EXCLUDED.temperature,
             max_tokens = EXCLUDED.max_tokens,
             status = EXCLUDED.status,
@@ -175,16 +230,46 @@ func (r *ConfigRepository) SaveModel(ctx context.Context, m *model.ModelConfig)
             share_preset_pct = EXCLUDED.share_preset_pct,
             price_coins = EXCLUDED.price_coins,
             price_hint = EXCLUDED.price_hint,
+            input_price_per_1k = EXCLUDED.input_price_per_1k,
+            output_price_per_1k = EXCLUDED.output_price_per_1k,
+            fallback_model_ids = EXCLUDED.fallback_model_ids,
+            max_retries = EXCLUDED.max_retries,
+            retry_backoff_ms = EXCLUDED.retry_backoff_ms,
+            breaker_threshold = EXCLUDED.breaker_threshold,
+            breaker_cooldown_seconds = EXCLUDED.breaker_cooldown_seconds,
+            thinking_budget_tokens = EXCLUDED.thinking_budget_tokens,
             updated_at = now()
-        RETURNING created_at, updated_at, api_key <> '' AS has_api_key
-    `, m.ID, m.Name, m.Description, m.Provider, m.BaseURL, m.ModelName, m.APIKey, m.Temperature, m.MaxTokens, m.Status, m.IsDefault, m.IsEnabled, m.MaxContextTokens, m.PriceCoins, m.ShareRolePct, m.SharePresetPct, m.PriceHint)
-	if err := row.Scan(&m.CreatedAt, &m.UpdatedAt, &m.HasAPIKey); err != nil {
+        RETURNING created_at, updated_at, api_key <> '' AS has_api_key, api_key_hint
+    `, m.ID, m.Name, m.Description, m.Provider, m.BaseURL, m.ModelName, storedKey, m.Temperature, m.MaxTokens, m.Status, m.IsDefault, m.IsEnabled, m.MaxContextTokens, m.PriceCoins, m.ShareRolePct, m.SharePresetPct, m.PriceHint, m.InputPricePer1K, m.OutputPricePer1K, m.FallbackModelIDs, m.MaxRetries, m.RetryBackoffMs, m.BreakerThreshold, m.BreakerCooldownSeconds, hint, m.ThinkingBudgetTokens)
+	if err := row.Scan(&m.CreatedAt, &m.UpdatedAt, &m.HasAPIKey, &m.APIKeyHint); err != nil {
 		return err
 	}
 	m.APIKey = ""
 	return nil
 }
 
+// decryptKey replaces the stored key with its plaintext for provider calls.
+func (r *ConfigRepository) decryptKey(m *model.ModelConfig) error {
+	plain, err := r.keys.Decrypt(m.APIKey)
+	if err != nil {
+		return fmt.Errorf("model %s api key: %w", m.ID, err)
+	}
+	m.APIKey = plain
+	return nil
+}
+
+// ReencryptAPIKeys seals every model key that is plaintext or under a retired master key with the
+// active one, and backfills the masked hints.
+func (r *ConfigRepository) ReencryptAPIKeys(ctx context.Context) (int, error) {
+	return reencryptAPIKeys(ctx, r.pool, r.keys, "models")
+}
+
+// SetModelStatus updates only the status column, leaving the rest of the config untouched.
+func (r *ConfigRepository) SetModelStatus(ctx context.Context, id, status string) error {
+	_, err := r.pool.Exec(ctx, `UPDATE models SET status = $2, updated_at = now() WHERE id = $1`, id, status)
+	return err
+}
+
 func (r *ConfigRepository) DeleteModel(ctx context.Context, id string) error {
 	_, err := r.pool.Exec(ctx, `DELETE FROM models WHERE id = $1`, id)
 	return err
@@ -4,10 +4,12 @@ import (
 	"context"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// DocumentRepository exposes read helpers for the RAG placeholder.
+// DocumentRepository persists knowledge-base documents and their embedded chunks.
 type DocumentRepository struct {
 	pool *pgxpool.Pool
 }
@@ -16,12 +18,132 @@ func NewDocumentRepository(pool *pgxpool.Pool) *DocumentRepository {
 	return &DocumentRepository{pool: pool}
 }
 
-// ListRecentChunks returns the most recent document snippets as a mock retrieval layer.
-func (r *DocumentRepository) ListRecentChunks(ctx context.Context, limit int) ([]model.DocumentChunk, error) {
+const documentColumns = `
+    id, COALESCE(role_id::text, ''), COALESCE(worldbook_id::text, ''), title, source, format, content,
+    status, progress, chunk_count, chunk_size, chunk_overlap, error, created_at, updated_at
+`
+
+func (r *DocumentRepository) CreateDocument(ctx context.Context, doc *model.Document) error {
+	if doc.ID == "" {
+		doc.ID = uuid.NewString()
+	}
+	if doc.Status == "" {
+		doc.Status = "pending"
+	}
+	row := r.pool.QueryRow(ctx, `
+        INSERT INTO documents(id, role_id, worldbook_id, title, source, format, content, status, chunk_size, chunk_overlap)
+        VALUES($1, NULLIF($2,'')::uuid, NULLIF($3,'')::uuid, $4, $5, $6, $7, $8, $9, $10)
+        RETURNING created_at, updated_at
+    `, doc.ID, doc.RoleID, doc.WorldbookID, doc.Title, doc.Source, doc.Format, doc.Content, doc.Status, doc.ChunkSize, doc.ChunkOverlap)
+	return row.Scan(&doc.CreatedAt, &doc.UpdatedAt)
+}
+
+func (r *DocumentRepository) FindDocument(ctx context.Context, id string) (*model.Document, error) {
+	row := r.pool.QueryRow(ctx, `SELECT `+documentColumns+` FROM documents WHERE id = $1`, id)
+	doc, err := scanDocument(row)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ListByRole returns the documents a creator attached to the role.
+func (r *DocumentRepository) ListByRole(ctx context.Context, roleID string) ([]model.Document, error) {
+	rows, err := r.pool.Query(ctx, `
+        SELECT `+documentColumns+`
+        FROM documents
+        WHERE role_id = $1
+        ORDER BY created_at DESC
+    `, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var docs []model.Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+	return docs, rows.Err()
+}
+
+// UpdateChunking stores new chunk parameters and resets the document to pending for re-ingestion.
+func (r *DocumentRepository) UpdateChunking(ctx context.Context, id string, size, overlap int) error {
+	_, err := r.pool.Exec(ctx, `
+        UPDATE documents
+        SET chunk_size = $2, chunk_overlap = $3, status = 'pending', progress = 0, error = '', updated_at = now()
+        WHERE id = $1
+    `, id, size, overlap)
+	return err
+}
+
+// UpdateProgress records ingestion state; progress is a 0-100 percentage.
+func (r *DocumentRepository) UpdateProgress(ctx context.Context, id, status string, progress, chunkCount int, errMsg string) error {
+	_, err := r.pool.Exec(ctx, `
+        UPDATE documents
+        SET status = $2, progress = $3, chunk_count = $4, error = $5, updated_at = now()
+        WHERE id = $1
+    `, id, status, progress, chunkCount, errMsg)
+	return err
+}
+
+func (r *DocumentRepository) DeleteDocument(ctx context.Context, id string) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM documents WHERE id = $1`, id)
+	return err
+}
+
+// ReplaceChunks swaps every chunk of a document in one transaction so retrieval never sees a half-written set.
+func (r *DocumentRepository) ReplaceChunks(ctx context.Context, documentID string, chunks []model.DocumentChunk) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM document_chunks WHERE document_id = $1`, documentID); err != nil {
+		return err
+	}
+	batch := &pgx.Batch{}
+	for i := range chunks {
+		if chunks[i].ID == "" {
+			chunks[i].ID = uuid.NewString()
+		}
+		chunks[i].DocumentID = documentID
+		batch.Queue(`
+            INSERT INTO document_chunks(id, document_id, chunk_index, content, embedding, embedding_model)
+            VALUES($1,$2,$3,$4,$5,$6)
+        `, chunks[i].ID, documentID, chunks[i].ChunkIndex, chunks[i].Content, chunks[i].Embedding, chunks[i].EmbeddingModel)
+	}
+	if batch.Len() > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ListChunksByRole returns a page of the chunks embedded by embeddingModel from documents owned by
+// the role or by its worldbook, ordered by ID and starting after afterID ("" for the first page).
+func (r *DocumentRepository) ListChunksByRole(ctx context.Context, roleID, embeddingModel, afterID string, limit int) ([]model.DocumentChunk, error) {
+	if limit <= 0 {
+		limit = 500
+	}
 	rows, err := r.pool.Query(ctx, `
-        SELECT id, document_id, content, created_at
-        FROM document_chunks ORDER BY created_at DESC LIMIT $1
-    `, limit)
+        SELECT dc.id, dc.document_id, dc.chunk_index, dc.content, dc.embedding, dc.embedding_model, dc.created_at
+        FROM document_chunks dc
+        JOIN documents d ON d.id = dc.document_id
+        WHERE dc.embedding IS NOT NULL
+          AND dc.embedding_model = $2
+          AND dc.id > COALESCE(NULLIF($3, '')::uuid, '00000000-0000-0000-0000-000000000000'::uuid)
+          AND (d.role_id = $1 OR d.worldbook_id IN (SELECT id FROM worldbooks WHERE role_id = $1))
+        ORDER BY dc.id
+        LIMIT $4
+    `, roleID, embeddingModel, afterID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -29,10 +151,19 @@ func (r *DocumentRepository) ListRecentChunks(ctx context.Context, limit int) ([
 	var chunks []model.DocumentChunk
 	for rows.Next() {
 		var chunk model.DocumentChunk
-		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.Content, &chunk.CreatedAt); err != nil {
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkIndex, &chunk.Content, &chunk.Embedding, &chunk.EmbeddingModel, &chunk.CreatedAt); err != nil {
 			return nil, err
 		}
 		chunks = append(chunks, chunk)
 	}
-	return chunks, nil
+	return chunks, rows.Err()
+}
+
+func scanDocument(row pgx.Row) (*model.Document, error) {
+	var doc model.Document
+	if err := row.Scan(&doc.ID, &doc.RoleID, &doc.WorldbookID, &doc.Title, &doc.Source, &doc.Format, &doc.Content,
+		&doc.Status, &doc.Progress, &doc.ChunkCount, &doc.ChunkSize, &doc.ChunkOverlap, &doc.Error, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &doc, nil
 }
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HealthCheckRepository stores connection test results for models and image providers.
+type HealthCheckRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewHealthCheckRepository(pool *pgxpool.Pool) *HealthCheckRepository {
+	return &HealthCheckRepository{pool: pool}
+}
+
+func (r *HealthCheckRepository) Record(ctx context.Context, check *model.HealthCheck) error {
+	if check.CreatedAt.IsZero() {
+		check.CreatedAt = time.Now()
+	}
+	return r.pool.QueryRow(ctx, `
+        INSERT INTO health_checks(target_type, target_id, ok, latency_ms, resolved_model, error, created_at)
+        VALUES($1,$2,$3,$4,$5,$6,$7)
+        RETURNING id
+    `, check.TargetType, check.TargetID, check.OK, check.LatencyMs, check.ResolvedModel, check.Error, check.CreatedAt).Scan(&check.ID)
+}
+
+// Summaries aggregates the checks since the given time for every target of a type, keyed by target ID.
+// The last-check fields come from the latest check regardless of age.
+func (r *HealthCheckRepository) Summaries(ctx context.Context, targetType string, since time.Time) (map[string]model.HealthSummary, error) {
+	rows, err := r.pool.Query(ctx, `
+        SELECT DISTINCT ON (h.target_id)
+               h.target_id, h.created_at, h.ok, h.latency_ms, h.error,
+               coalesce(w.checks, 0), coalesce(w.failures, 0)
+        FROM health_checks h
+        LEFT JOIN (
+            SELECT target_id, count(*) AS checks, count(*) FILTER (WHERE NOT ok) AS failures
+            FROM health_checks
+            WHERE target_type = $1 AND created_at >= $2
+            GROUP BY target_id
+        ) w ON w.target_id = h.target_id
+        WHERE h.target_type = $1
+        ORDER BY h.target_id, h.created_at DESC
+    `, targetType, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]model.HealthSummary{}
+	for rows.Next() {
+		var id string
+		var sum model.HealthSummary
+		if err := rows.Scan(&id, &sum.LastCheckedAt, &sum.LastOK, &sum.LastLatencyMs, &sum.LastError, &sum.Checks, &sum.Failures); err != nil {
+			return nil, err
+		}
+		if sum.Checks > 0 {
+			sum.ErrorRate = float64(sum.Failures) / float64(sum.Checks)
+		}
+		out[id] = sum
+	}
+	return out, rows.Err()
+}
+
+// ConsecutiveFailures counts the target's failed checks since its last passing one, looking at no
+// more than the latest limit checks.
+func (r *HealthCheckRepository) ConsecutiveFailures(ctx context.Context, targetType, targetID string, limit int) (int, error) {
+	rows, err := r.pool.Query(ctx, `
+        SELECT ok FROM health_checks
+        WHERE target_type = $1 AND target_id = $2
+        ORDER BY created_at DESC
+        LIMIT $3
+    `, targetType, targetID, limit)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	failures := 0
+	for rows.Next() {
+		var ok bool
+		if err := rows.Scan(&ok); err != nil {
+			return 0, err
+		}
+		if ok {
+			break
+		}
+		failures++
+	}
+	return failures, rows.Err()
+}
+
+// Prune deletes checks older than the cutoff.
+func (r *HealthCheckRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM health_checks WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
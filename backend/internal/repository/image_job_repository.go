@@ -28,7 +28,7 @@ func (r *ImageJobRepository) Create(ctx context.Context, job *model.ImageJob) (*
 	job.UpdatedAt = now
 	_, err := r.pool.Exec(ctx, `
         INSERT INTO image_jobs(id, user_id, session_id, message_id, provider_id, preset_id, prompt, negative_prompt, final_prompt, status, result_url, error, created_at, updated_at)
-        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+        VALUES($1,$2,$3,$4,NULLIF($5,'')::uuid,$6,$7,$8,$9,$10,$11,$12,$13,$14)
     `, job.ID, job.UserID, job.SessionID, job.MessageID, job.ProviderID, job.PresetID, job.Prompt, job.NegativePrompt, job.FinalPrompt, job.Status, job.ResultURL, job.Error, job.CreatedAt, job.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -48,13 +48,123 @@ func (r *ImageJobRepository) UpdateStatus(ctx context.Context, id, status, resul
 	return err
 }
 
+// Succeed records the stored image and thumbnail keys.
+func (r *ImageJobRepository) Succeed(ctx context.Context, id, imageKey, thumbnailKey string) error {
+	_, err := r.pool.Exec(ctx, `
+        UPDATE image_jobs
+        SET status = 'succeeded', image_key = $2, thumbnail_key = $3, result_url = '', error = '', updated_at = now()
+        WHERE id = $1
+    `, id, imageKey, thumbnailKey)
+	return err
+}
+
+// LegacyImage is a data URL moved out of image_jobs.result_url by migration, waiting to be stored.
+type LegacyImage struct {
+	ImageJobID string
+	DataURL    string
+}
+
+// LegacyImages returns up to limit parked data URLs with job IDs after afterID.
+func (r *ImageJobRepository) LegacyImages(ctx context.Context, afterID string, limit int) ([]LegacyImage, error) {
+	rows, err := r.pool.Query(ctx, `
+        SELECT image_job_id, data_url FROM image_job_legacy_data
+        WHERE image_job_id::text > $1
+        ORDER BY image_job_id::text
+        LIMIT $2
+    `, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []LegacyImage
+	for rows.Next() {
+		var l LegacyImage
+		if err := rows.Scan(&l.ImageJobID, &l.DataURL); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// AttachLegacyImage points the job at its stored image and drops the parked data URL. Empty keys
+// only drop it, for data that could not be decoded.
+func (r *ImageJobRepository) AttachLegacyImage(ctx context.Context, id, imageKey, thumbnailKey string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if imageKey != "" {
+		if _, err := tx.Exec(ctx, `UPDATE image_jobs SET image_key = $2, thumbnail_key = $3 WHERE id = $1`, id, imageKey, thumbnailKey); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM image_job_legacy_data WHERE image_job_id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SetPrompt stores the prompt built for the image model.
+func (r *ImageJobRepository) SetPrompt(ctx context.Context, id, finalPrompt, negativePrompt string) error {
+	_, err := r.pool.Exec(ctx, `
+        UPDATE image_jobs SET final_prompt = $2, negative_prompt = $3, updated_at = now() WHERE id = $1
+    `, id, finalPrompt, negativePrompt)
+	return err
+}
+
+// Start moves a queued job to running on provider if the provider has a free slot: fewer than
+// maxConcurrency jobs running on it that started within staleAfter (older ones belong to a dead
+// worker). A per-provider advisory lock keeps concurrent workers from overbooking it. Reports
+// whether the slot was taken; maxConcurrency <= 0 means unlimited.
+func (r *ImageJobRepository) Start(ctx context.Context, id, providerID string, maxConcurrency int, staleAfter time.Duration) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('image_provider:' || $1))`, providerID); err != nil {
+		return false, err
+	}
+	if maxConcurrency > 0 {
+		var running int
+		if err := tx.QueryRow(ctx, `
+            SELECT count(*) FROM image_jobs
+            WHERE provider_id = $1 AND status = 'running' AND id <> $2
+              AND started_at > now() - make_interval(secs => $3)
+        `, providerID, id, staleAfter.Seconds()).Scan(&running); err != nil {
+			return false, err
+		}
+		if running >= maxConcurrency {
+			return false, nil
+		}
+	}
+	tag, err := tx.Exec(ctx, `
+        UPDATE image_jobs
+        SET status = 'running', provider_id = $2, attempts = attempts + 1,
+            tried_provider_ids = array_append(tried_provider_ids, $2::uuid),
+            started_at = now(), error = '', updated_at = now()
+        WHERE id = $1 AND status IN ('queued', 'running')
+    `, id, providerID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	return true, tx.Commit(ctx)
+}
+
 func (r *ImageJobRepository) Find(ctx context.Context, id string) (*model.ImageJob, error) {
 	row := r.pool.QueryRow(ctx, `
-        SELECT id, user_id, session_id, message_id, provider_id, preset_id, prompt, negative_prompt, final_prompt, status, result_url, error, created_at, updated_at
+        SELECT id, user_id, session_id, message_id, COALESCE(provider_id::text, ''), preset_id, prompt, negative_prompt, final_prompt, status, result_url, error,
+               attempts, tried_provider_ids::text[], started_at, image_key, thumbnail_key, created_at, updated_at
         FROM image_jobs WHERE id = $1
     `, id)
 	var job model.ImageJob
-	if err := row.Scan(&job.ID, &job.UserID, &job.SessionID, &job.MessageID, &job.ProviderID, &job.PresetID, &job.Prompt, &job.NegativePrompt, &job.FinalPrompt, &job.Status, &job.ResultURL, &job.Error, &job.CreatedAt, &job.UpdatedAt); err != nil {
+	if err := row.Scan(&job.ID, &job.UserID, &job.SessionID, &job.MessageID, &job.ProviderID, &job.PresetID, &job.Prompt, &job.NegativePrompt, &job.FinalPrompt, &job.Status, &job.ResultURL, &job.Error,
+		&job.Attempts, &job.TriedProviderIDs, &job.StartedAt, &job.ImageKey, &job.ThumbnailKey, &job.CreatedAt, &job.UpdatedAt); err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
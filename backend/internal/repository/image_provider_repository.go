@@ -2,28 +2,33 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/secrets"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// ImageProviderRepository manages image provider configs.
+// ImageProviderRepository manages image provider configs. API keys are encrypted with keys and
+// only decrypted by the lookups that feed provider calls (ListActive, FindByID).
 type ImageProviderRepository struct {
 	pool *pgxpool.Pool
+	keys *secrets.Keyring
 }
 
-func NewImageProviderRepository(pool *pgxpool.Pool) *ImageProviderRepository {
-	return &ImageProviderRepository{pool: pool}
+func NewImageProviderRepository(pool *pgxpool.Pool, keys *secrets.Keyring) *ImageProviderRepository {
+	return &ImageProviderRepository{pool: pool, keys: keys}
 }
 
 func (r *ImageProviderRepository) ListActive(ctx context.Context) ([]model.ImageProvider, error) {
 	rows, err := r.pool.Query(ctx, `
-        SELECT id, name, base_url, api_key, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at
+        SELECT id, name, base_url, api_key, api_key <> '', api_key_hint, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at
         FROM image_providers
-        WHERE status = 'active'
+        WHERE status IN ('active', 'degraded')
         ORDER BY created_at ASC
     `)
 	if err != nil {
@@ -33,17 +38,23 @@ func (r *ImageProviderRepository) ListActive(ctx context.Context) ([]model.Image
 	var providers []model.ImageProvider
 	for rows.Next() {
 		var p model.ImageProvider
-		if err := rows.Scan(&p.ID, &p.Name, &p.BaseURL, &p.APIKey, &p.MaxConcurrency, &p.Weight, &p.Status, &p.ParamsJSON, &p.SelectedModel, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.BaseURL, &p.APIKey, &p.HasAPIKey, &p.APIKeyHint, &p.MaxConcurrency, &p.Weight, &p.Status, &p.ParamsJSON, &p.SelectedModel, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, err
 		}
+		// One undecryptable key (e.g. sealed under a master key that was dropped) must not take
+		// every other provider down with it.
+		if err := r.decryptKey(&p); err != nil {
+			log.Printf("image providers: skipping %s: %v", p.ID, err)
+			continue
+		}
 		providers = append(providers, p)
 	}
-	return providers, nil
+	return providers, rows.Err()
 }
 
 func (r *ImageProviderRepository) List(ctx context.Context) ([]model.ImageProvider, error) {
 	rows, err := r.pool.Query(ctx, `
-        SELECT id, name, base_url, api_key, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at
+        SELECT id, name, base_url, api_key <> '', api_key_hint, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at
         FROM image_providers
         ORDER BY created_at DESC
     `)
@@ -54,7 +65,7 @@ func (r *ImageProviderRepository) List(ctx context.Context) ([]model.ImageProvid
 	var providers []model.ImageProvider
 	for rows.Next() {
 		var p model.ImageProvider
-		if err := rows.Scan(&p.ID, &p.Name, &p.BaseURL, &p.APIKey, &p.MaxConcurrency, &p.Weight, &p.Status, &p.ParamsJSON, &p.SelectedModel, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.BaseURL, &p.HasAPIKey, &p.APIKeyHint, &p.MaxConcurrency, &p.Weight, &p.Status, &p.ParamsJSON, &p.SelectedModel, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, err
 		}
 		providers = append(providers, p)
@@ -69,26 +80,41 @@ func (r *ImageProviderRepository) Save(ctx context.Context, p *model.ImageProvid
 	now := time.Now()
 	p.CreatedAt = now
 	p.UpdatedAt = now
-	_, err := r.pool.Exec(ctx, `
-        INSERT INTO image_providers(id, name, base_url, api_key, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at)
-        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+	// An empty key on update keeps the stored one.
+	hint := secrets.Mask(p.APIKey)
+	storedKey, err := r.keys.Encrypt(p.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt api key: %w", err)
+	}
+	err = r.pool.QueryRow(ctx, `
+        INSERT INTO image_providers(id, name, base_url, api_key, api_key_hint, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
         ON CONFLICT (id) DO UPDATE SET
             name=EXCLUDED.name,
             base_url=EXCLUDED.base_url,
-            api_key=EXCLUDED.api_key,
+            api_key=CASE WHEN EXCLUDED.api_key = '' THEN image_providers.api_key ELSE EXCLUDED.api_key END,
+            api_key_hint=CASE WHEN EXCLUDED.api_key = '' THEN image_providers.api_key_hint ELSE EXCLUDED.api_key_hint END,
             max_concurrency=EXCLUDED.max_concurrency,
             weight=EXCLUDED.weight,
             status=EXCLUDED.status,
             params_json=EXCLUDED.params_json,
             selected_model=EXCLUDED.selected_model,
             updated_at=EXCLUDED.updated_at
-    `, p.ID, p.Name, p.BaseURL, p.APIKey, p.MaxConcurrency, p.Weight, p.Status, p.ParamsJSON, p.SelectedModel, p.CreatedAt, p.UpdatedAt)
+        RETURNING created_at, api_key <> '', api_key_hint
+    `, p.ID, p.Name, p.BaseURL, storedKey, hint, p.MaxConcurrency, p.Weight, p.Status, p.ParamsJSON, p.SelectedModel, p.CreatedAt, p.UpdatedAt).Scan(&p.CreatedAt, &p.HasAPIKey, &p.APIKeyHint)
 	if err != nil {
 		return nil, err
 	}
+	p.APIKey = ""
 	return p, nil
 }
 
+// SetStatus updates only the status column, leaving the rest of the provider untouched.
+func (r *ImageProviderRepository) SetStatus(ctx context.Context, id, status string) error {
+	_, err := r.pool.Exec(ctx, `UPDATE image_providers SET status = $2, updated_at = now() WHERE id = $1`, id, status)
+	return err
+}
+
 func (r *ImageProviderRepository) Delete(ctx context.Context, id string) error {
 	_, err := r.pool.Exec(ctx, `DELETE FROM image_providers WHERE id = $1`, id)
 	return err
@@ -96,15 +122,34 @@ func (r *ImageProviderRepository) Delete(ctx context.Context, id string) error {
 
 func (r *ImageProviderRepository) FindByID(ctx context.Context, id string) (*model.ImageProvider, error) {
 	row := r.pool.QueryRow(ctx, `
-        SELECT id, name, base_url, api_key, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at
+        SELECT id, name, base_url, api_key, api_key <> '', api_key_hint, max_concurrency, weight, status, params_json, selected_model, created_at, updated_at
         FROM image_providers WHERE id = $1
     `, id)
 	var p model.ImageProvider
-	if err := row.Scan(&p.ID, &p.Name, &p.BaseURL, &p.APIKey, &p.MaxConcurrency, &p.Weight, &p.Status, &p.ParamsJSON, &p.SelectedModel, &p.CreatedAt, &p.UpdatedAt); err != nil {
+	if err := row.Scan(&p.ID, &p.Name, &p.BaseURL, &p.APIKey, &p.HasAPIKey, &p.APIKeyHint, &p.MaxConcurrency, &p.Weight, &p.Status, &p.ParamsJSON, &p.SelectedModel, &p.CreatedAt, &p.UpdatedAt); err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if err := r.decryptKey(&p); err != nil {
+		return nil, err
+	}
 	return &p, nil
 }
+
+// decryptKey replaces the stored key with its plaintext for provider calls.
+func (r *ImageProviderRepository) decryptKey(p *model.ImageProvider) error {
+	plain, err := r.keys.Decrypt(p.APIKey)
+	if err != nil {
+		return fmt.Errorf("image provider %s api key: %w", p.ID, err)
+	}
+	p.APIKey = plain
+	return nil
+}
+
+// ReencryptAPIKeys seals every provider key that is plaintext or under a retired master key with
+// the active one, and backfills the masked hints.
+func (r *ImageProviderRepository) ReencryptAPIKeys(ctx context.Context) (int, error) {
+	return reencryptAPIKeys(ctx, r.pool, r.keys, "image_providers")
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// JobRepository persists the background job queue.
+type JobRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewJobRepository(pool *pgxpool.Pool) *JobRepository {
+	return &JobRepository{pool: pool}
+}
+
+// ErrLeaseLost is returned when settling a job whose lease expired and was claimed again.
+var ErrLeaseLost = errors.New("job lease lost")
+
+const jobColumns = `id, type, payload, status, attempts, max_attempts, run_at, last_error, locked_until, created_at, updated_at`
+
+func scanJob(row pgx.Row) (*model.Job, error) {
+	var j model.Job
+	if err := row.Scan(&j.ID, &j.Type, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LastError, &j.LockedUntil, &j.CreatedAt, &j.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *JobRepository) Create(ctx context.Context, job *model.Job) error {
+	return r.pool.QueryRow(ctx, `
+        INSERT INTO jobs(type, payload, max_attempts, run_at)
+        VALUES($1,$2,$3,$4)
+        RETURNING `+jobColumns,
+		job.Type, job.Payload, job.MaxAttempts, job.RunAt,
+	).Scan(&job.ID, &job.Type, &job.Payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError, &job.LockedUntil, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// Claim leases the next ready job for the given duration and counts the attempt. Jobs whose lease
+// ran out while running belonged to a worker that died and are claimed again, unless that was
+// their last attempt: those are dead-lettered here, otherwise a job that crashes its worker would
+// run forever. Returns nil when nothing is ready.
+func (r *JobRepository) Claim(ctx context.Context, lease time.Duration) (*model.Job, error) {
+	if _, err := r.pool.Exec(ctx, `
+        UPDATE jobs SET status = 'dead', locked_until = NULL, updated_at = now(),
+            last_error = CASE WHEN last_error = '' THEN 'lease expired on the last attempt' ELSE last_error END
+        WHERE status = 'running' AND locked_until < now() AND attempts >= max_attempts
+    `); err != nil {
+		return nil, err
+	}
+	job, err := scanJob(r.pool.QueryRow(ctx, `
+        UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_until = now() + make_interval(secs => $1), updated_at = now()
+        WHERE id = (
+            SELECT id FROM jobs
+            WHERE (status = 'pending' AND run_at <= now())
+               OR (status = 'running' AND locked_until < now() AND attempts < max_attempts)
+            ORDER BY run_at
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING `+jobColumns, lease.Seconds()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// The settle methods below only touch the job while it still holds the lease the worker claimed
+// it with (job.LockedUntil) and return ErrLeaseLost otherwise.
+
+func (r *JobRepository) Complete(ctx context.Context, job *model.Job) error {
+	return r.settle(ctx, job, `status = 'succeeded', locked_until = NULL, last_error = '', updated_at = now()`)
+}
+
+// Retry puts a failed job back in the queue to run at runAt.
+func (r *JobRepository) Retry(ctx context.Context, job *model.Job, lastError string, runAt time.Time) error {
+	return r.settle(ctx, job, `status = 'pending', locked_until = NULL, last_error = $3, run_at = $4, updated_at = now()`, lastError, runAt)
+}
+
+// Snooze puts a job back in the queue to run at runAt and gives back the attempt Claim counted.
+func (r *JobRepository) Snooze(ctx context.Context, job *model.Job, runAt time.Time) error {
+	return r.settle(ctx, job, `status = 'pending', attempts = GREATEST(attempts - 1, 0), locked_until = NULL, run_at = $3, updated_at = now()`, runAt)
+}
+
+// Bury dead-letters a job that exhausted its attempts or cannot succeed.
+func (r *JobRepository) Bury(ctx context.Context, job *model.Job, lastError string) error {
+	return r.settle(ctx, job, `status = 'dead', locked_until = NULL, last_error = $3, updated_at = now()`, lastError)
+}
+
+func (r *JobRepository) settle(ctx context.Context, job *model.Job, set string, args ...interface{}) error {
+	if job.LockedUntil == nil {
+		return ErrLeaseLost
+	}
+	tag, err := r.pool.Exec(ctx, `UPDATE jobs SET `+set+` WHERE id = $1 AND status = 'running' AND locked_until = $2`,
+		append([]interface{}{job.ID, *job.LockedUntil}, args...)...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Requeue gives a dead job a fresh set of attempts.
+func (r *JobRepository) Requeue(ctx context.Context, id string) (*model.Job, error) {
+	job, err := scanJob(r.pool.QueryRow(ctx, `
+        UPDATE jobs SET status = 'pending', attempts = 0, run_at = now(), locked_until = NULL, updated_at = now()
+        WHERE id = $1 AND status = 'dead'
+        RETURNING `+jobColumns, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// List returns jobs newest first, optionally filtered by status and type.
+func (r *JobRepository) List(ctx context.Context, status, jobType string, limit, offset int) ([]model.Job, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := r.pool.Query(ctx, `
+        SELECT `+jobColumns+`
+        FROM jobs
+        WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)
+        ORDER BY updated_at DESC
+        LIMIT $3 OFFSET $4
+    `, status, jobType, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []model.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// PruneSucceeded deletes finished jobs older than the cutoff; dead jobs are kept for inspection.
+func (r *JobRepository) PruneSucceeded(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM jobs WHERE status = 'succeeded' AND updated_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
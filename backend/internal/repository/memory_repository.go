@@ -18,12 +18,23 @@ func NewMemoryRepository(pool *pgxpool.Pool) *MemoryRepository {
 	return &MemoryRepository{pool: pool}
 }
 
+const memoryColumns = `id, user_id, role_id, kind, content, pinned, source, created_at, updated_at`
+
+func scanMemory(row pgx.Row) (*model.MemoryCapsule, error) {
+	var m model.MemoryCapsule
+	if err := row.Scan(&m.ID, &m.UserID, &m.RoleID, &m.Kind, &m.Content, &m.Pinned, &m.Source, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// List returns the user's memories for a role, pinned first, then most recently updated.
 func (r *MemoryRepository) List(ctx context.Context, userID, roleID string) ([]model.MemoryCapsule, error) {
 	rows, err := r.pool.Query(ctx, `
-        SELECT id, user_id, role_id, content, created_at
+        SELECT `+memoryColumns+`
         FROM memory_capsules
         WHERE user_id = $1 AND role_id = $2
-        ORDER BY created_at DESC
+        ORDER BY pinned DESC, updated_at DESC
     `, userID, roleID)
 	if err != nil {
 		return nil, err
@@ -31,25 +42,48 @@ func (r *MemoryRepository) List(ctx context.Context, userID, roleID string) ([]m
 	defer rows.Close()
 	var items []model.MemoryCapsule
 	for rows.Next() {
-		var capsule model.MemoryCapsule
-		if err := rows.Scan(&capsule.ID, &capsule.UserID, &capsule.RoleID, &capsule.Content, &capsule.CreatedAt); err != nil {
+		capsule, err := scanMemory(rows)
+		if err != nil {
 			return nil, err
 		}
-		items = append(items, capsule)
+		items = append(items, *capsule)
 	}
 	return items, nil
 }
 
+func (r *MemoryRepository) Find(ctx context.Context, id string) (*model.MemoryCapsule, error) {
+	capsule, err := scanMemory(r.pool.QueryRow(ctx, `SELECT `+memoryColumns+` FROM memory_capsules WHERE id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return capsule, err
+}
+
 func (r *MemoryRepository) Create(ctx context.Context, capsule *model.MemoryCapsule) error {
 	if capsule.ID == "" {
 		capsule.ID = uuid.NewString()
 	}
+	if capsule.Kind == "" {
+		capsule.Kind = model.MemoryFact
+	}
+	if capsule.Source == "" {
+		capsule.Source = model.MemorySourceUser
+	}
 	row := r.pool.QueryRow(ctx, `
-        INSERT INTO memory_capsules(id, user_id, role_id, content)
-        VALUES($1,$2,$3,$4)
-        RETURNING created_at
-    `, capsule.ID, capsule.UserID, capsule.RoleID, capsule.Content)
-	return row.Scan(&capsule.CreatedAt)
+        INSERT INTO memory_capsules(id, user_id, role_id, kind, content, pinned, source)
+        VALUES($1,$2,$3,$4,$5,$6,$7)
+        RETURNING created_at, updated_at
+    `, capsule.ID, capsule.UserID, capsule.RoleID, capsule.Kind, capsule.Content, capsule.Pinned, capsule.Source)
+	return row.Scan(&capsule.CreatedAt, &capsule.UpdatedAt)
+}
+
+// Update saves kind, content and pinned.
+func (r *MemoryRepository) Update(ctx context.Context, capsule *model.MemoryCapsule) error {
+	return r.pool.QueryRow(ctx, `
+        UPDATE memory_capsules SET kind = $2, content = $3, pinned = $4, updated_at = now()
+        WHERE id = $1
+        RETURNING updated_at
+    `, capsule.ID, capsule.Kind, capsule.Content, capsule.Pinned).Scan(&capsule.UpdatedAt)
 }
 
 func (r *MemoryRepository) Delete(ctx context.Context, id, userID string) error {
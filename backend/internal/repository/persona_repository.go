@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrPersonaLimit is returned by Create when the user already has the maximum number of personas.
+var ErrPersonaLimit = errors.New("persona limit reached")
+
+// PersonaRepository stores the personas users play in chats.
+type PersonaRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPersonaRepository(pool *pgxpool.Pool) *PersonaRepository {
+	return &PersonaRepository{pool: pool}
+}
+
+const personaColumns = `id, user_id, name, description, avatar_url, is_default, created_at, updated_at`
+
+func scanPersona(row pgx.Row) (*model.Persona, error) {
+	var p model.Persona
+	if err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.Description, &p.AvatarURL, &p.IsDefault, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListByUser returns the user's personas, the default first.
+func (r *PersonaRepository) ListByUser(ctx context.Context, userID string) ([]model.Persona, error) {
+	rows, err := r.pool.Query(ctx, `
+        SELECT `+personaColumns+`
+        FROM personas WHERE user_id = $1
+        ORDER BY is_default DESC, created_at ASC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []model.Persona
+	for rows.Next() {
+		p, err := scanPersona(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *p)
+	}
+	return items, rows.Err()
+}
+
+func (r *PersonaRepository) Find(ctx context.Context, id string) (*model.Persona, error) {
+	p, err := scanPersona(r.pool.QueryRow(ctx, `SELECT `+personaColumns+` FROM personas WHERE id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// FindDefault returns the user's default persona, or nil when none is set.
+func (r *PersonaRepository) FindDefault(ctx context.Context, userID string) (*model.Persona, error) {
+	p, err := scanPersona(r.pool.QueryRow(ctx, `SELECT `+personaColumns+` FROM personas WHERE user_id = $1 AND is_default`, userID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// Create inserts the persona unless the user already has limit personas, in which case it returns
+// ErrPersonaLimit. The persona becomes the user's default when they have none. The user's row is
+// locked first so concurrent creates cannot both pass the limit.
+func (r *PersonaRepository) Create(ctx context.Context, p *model.Persona, limit int) error {
+	if p.ID == "" {
+		p.ID = uuid.NewString()
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, p.UserID); err != nil {
+		return err
+	}
+	err = tx.QueryRow(ctx, `
+        INSERT INTO personas(id, user_id, name, description, avatar_url, is_default)
+        SELECT $1, $2, $3, $4, $5, NOT EXISTS (SELECT 1 FROM personas WHERE user_id = $2 AND is_default)
+        WHERE (SELECT COUNT(*) FROM personas WHERE user_id = $2) < $6
+        RETURNING is_default, created_at, updated_at
+    `, p.ID, p.UserID, p.Name, p.Description, p.AvatarURL, limit).Scan(&p.IsDefault, &p.CreatedAt, &p.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrPersonaLimit
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PersonaRepository) Update(ctx context.Context, p *model.Persona) error {
+	return r.pool.QueryRow(ctx, `
+        UPDATE personas SET name = $2, description = $3, avatar_url = $4, updated_at = now()
+        WHERE id = $1
+        RETURNING updated_at
+    `, p.ID, p.Name, p.Description, p.AvatarURL).Scan(&p.UpdatedAt)
+}
+
+// Delete removes the persona. Deleting the default makes the user's oldest remaining persona the
+// default in the same transaction.
+func (r *PersonaRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	var userID string
+	var wasDefault bool
+	err = tx.QueryRow(ctx, `DELETE FROM personas WHERE id = $1 RETURNING user_id, is_default`, id).Scan(&userID, &wasDefault)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if wasDefault {
+		if _, err := tx.Exec(ctx, `
+            UPDATE personas SET is_default = true
+            WHERE id = (SELECT id FROM personas WHERE user_id = $1 ORDER BY created_at ASC, id ASC LIMIT 1)
+        `, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// SetDefault makes the persona the user's default, clearing the previous one; an empty id clears
+// the default.
+func (r *PersonaRepository) SetDefault(ctx context.Context, userID, id string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `UPDATE personas SET is_default = false WHERE user_id = $1 AND is_default`, userID); err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := tx.Exec(ctx, `UPDATE personas SET is_default = true WHERE id = $1 AND user_id = $2`, id, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
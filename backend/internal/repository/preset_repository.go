@@ -3,7 +3,6 @@ package repository
 import (
 	"context"
 	"encoding/json"
-	"sync"
 	"time"
 
 	"github.com/example/ai-avatar-studio/internal/model"
@@ -14,42 +13,13 @@ import (
 
 type PresetRepository struct {
 	pool *pgxpool.Pool
-	once sync.Once
-	err  error
 }
 
 func NewPresetRepository(pool *pgxpool.Pool) *PresetRepository {
 	return &PresetRepository{pool: pool}
 }
 
-// ensureTable defensively creates the presets table if migrations were not applied.
-func (r *PresetRepository) ensureTable(ctx context.Context) error {
-	r.once.Do(func() {
-		_, r.err = r.pool.Exec(ctx, `
-			CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-			CREATE TABLE IF NOT EXISTS presets (
-				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-				creator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-				name TEXT NOT NULL,
-				description TEXT,
-				model_key TEXT,
-				blocks JSONB NOT NULL DEFAULT '[]',
-				gen_params JSONB,
-				is_public BOOLEAN DEFAULT FALSE,
-				created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
-				updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
-			);
-			CREATE INDEX IF NOT EXISTS idx_presets_creator ON presets(creator_id);
-			CREATE INDEX IF NOT EXISTS idx_presets_public ON presets(is_public);
-		`)
-	})
-	return r.err
-}
-
 func (r *PresetRepository) Create(ctx context.Context, preset *model.Preset) error {
-	if err := r.ensureTable(ctx); err != nil {
-		return err
-	}
 	if preset.ID == "" {
 		preset.ID = uuid.NewString()
 	}
@@ -72,9 +42,6 @@ func (r *PresetRepository) Create(ctx context.Context, preset *model.Preset) err
 }
 
 func (r *PresetRepository) Update(ctx context.Context, preset *model.Preset) error {
-	if err := r.ensureTable(ctx); err != nil {
-		return err
-	}
 	blocksJSON, err := json.Marshal(preset.Blocks)
 	if err != nil {
 		return err
@@ -95,17 +62,11 @@ func (r *PresetRepository) Update(ctx context.Context, preset *model.Preset) err
 }
 
 func (r *PresetRepository) Delete(ctx context.Context, id string) error {
-	if err := r.ensureTable(ctx); err != nil {
-		return err
-	}
 	_, err := r.pool.Exec(ctx, "DELETE FROM presets WHERE id = $1", id)
 	return err
 }
 
 func (r *PresetRepository) UpdatePublic(ctx context.Context, id string, isPublic bool) error {
-	if err := r.ensureTable(ctx); err != nil {
-		return err
-	}
 	_, err := r.pool.Exec(ctx, `
 		UPDATE presets SET is_public = $2, updated_at = now() WHERE id = $1
 	`, id, isPublic)
@@ -113,9 +74,6 @@ func (r *PresetRepository) UpdatePublic(ctx context.Context, id string, isPublic
 }
 
 func (r *PresetRepository) FindByID(ctx context.Context, id string) (*model.Preset, error) {
-	if err := r.ensureTable(ctx); err != nil {
-		return nil, err
-	}
 	query := `
 		SELECT id, creator_id, name, description, model_key, blocks, gen_params, is_public, created_at, updated_at
 		FROM presets WHERE id = $1
@@ -142,9 +100,6 @@ func (r *PresetRepository) FindByID(ctx context.Context, id string) (*model.Pres
 }
 
 func (r *PresetRepository) ListByCreator(ctx context.Context, creatorID string) ([]model.Preset, error) {
-	if err := r.ensureTable(ctx); err != nil {
-		return nil, err
-	}
 	query := `
 		SELECT id, creator_id, name, description, model_key, blocks, gen_params, is_public, created_at, updated_at
 		FROM presets WHERE creator_id = $1 ORDER BY updated_at DESC
@@ -174,9 +129,6 @@ func (r *PresetRepository) ListByCreator(ctx context.Context, creatorID string)
 }
 
 func (r *PresetRepository) ListPublic(ctx context.Context, limit int) ([]model.Preset, error) {
-	if err := r.ensureTable(ctx); err != nil {
-		return nil, err
-	}
 	if limit <= 0 {
 		limit = 50
 	}
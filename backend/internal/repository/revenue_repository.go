@@ -52,16 +52,57 @@ func (r *RevenueRepository) CreateEvent(ctx context.Context, event *model.Revenu
 		event.ID = uuid.NewString()
 	}
 	row := r.pool.QueryRow(ctx, `
-        INSERT INTO revenue_events(id, creator_id, user_id, role_id, event_type, amount, status)
-        VALUES($1,$2,$3,$4,$5,$6,$7)
+        INSERT INTO revenue_events(id, creator_id, user_id, role_id, event_type, amount, status, message)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8)
         RETURNING created_at
-    `, event.ID, event.CreatorID, event.UserID, event.RoleID, event.EventType, event.Amount, event.Status)
+    `, event.ID, event.CreatorID, event.UserID, event.RoleID, event.EventType, event.Amount, event.Status, event.Message)
 	return row.Scan(&event.CreatedAt)
 }
 
+// WithTx runs fn inside a transaction that commits only when fn returns nil.
+func (r *RevenueRepository) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreditTx stores the event and increments the creator wallet in place within tx.
+func (r *RevenueRepository) CreditTx(ctx context.Context, tx pgx.Tx, event *model.RevenueEvent) (*model.CreatorWallet, error) {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if err := tx.QueryRow(ctx, `
+        INSERT INTO revenue_events(id, creator_id, user_id, role_id, event_type, amount, status, message)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+        RETURNING created_at
+    `, event.ID, event.CreatorID, event.UserID, event.RoleID, event.EventType, event.Amount, event.Status, event.Message).Scan(&event.CreatedAt); err != nil {
+		return nil, err
+	}
+	row := tx.QueryRow(ctx, `
+        INSERT INTO creator_wallets(creator_id, available_balance, total_earned)
+        VALUES($1,$2,$2)
+        ON CONFLICT (creator_id) DO UPDATE SET
+            available_balance = creator_wallets.available_balance + EXCLUDED.available_balance,
+            total_earned = creator_wallets.total_earned + EXCLUDED.total_earned,
+            updated_at = now()
+        RETURNING creator_id, available_balance, frozen_balance, total_earned, updated_at
+    `, event.CreatorID, event.Amount)
+	var wallet model.CreatorWallet
+	if err := row.Scan(&wallet.CreatorID, &wallet.AvailableBalance, &wallet.FrozenBalance, &wallet.TotalEarned, &wallet.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
 func (r *RevenueRepository) ListEvents(ctx context.Context, creatorID string, limit int) ([]model.RevenueEvent, error) {
 	rows, err := r.pool.Query(ctx, `
-        SELECT id, creator_id, user_id, role_id, event_type, amount, status, created_at
+        SELECT id, creator_id, user_id, role_id, event_type, amount, status, message, created_at
         FROM revenue_events WHERE creator_id = $1 ORDER BY created_at DESC LIMIT $2
     `, creatorID, limit)
 	if err != nil {
@@ -71,7 +112,7 @@ func (r *RevenueRepository) ListEvents(ctx context.Context, creatorID string, li
 	var events []model.RevenueEvent
 	for rows.Next() {
 		var event model.RevenueEvent
-		if err := rows.Scan(&event.ID, &event.CreatorID, &event.UserID, &event.RoleID, &event.EventType, &event.Amount, &event.Status, &event.CreatedAt); err != nil {
+		if err := rows.Scan(&event.ID, &event.CreatorID, &event.UserID, &event.RoleID, &event.EventType, &event.Amount, &event.Status, &event.Message, &event.CreatedAt); err != nil {
 			return nil, err
 		}
 		events = append(events, event)
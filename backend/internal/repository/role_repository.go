@@ -19,36 +19,10 @@ func NewRoleRepository(pool *pgxpool.Pool) *RoleRepository {
 	return &RoleRepository{pool: pool}
 }
 
-// ensureRoleDataColumn keeps the schema aligned when migrations were skipped.
-func (r *RoleRepository) ensureRoleDataColumn(ctx context.Context) error {
-	_, err := r.pool.Exec(ctx, `ALTER TABLE roles ADD COLUMN IF NOT EXISTS data JSONB`)
-	return err
-}
-
-// ensureFavoritesTable is a defensive guard so new instances work even if migrations were not applied.
-func (r *RoleRepository) ensureFavoritesTable(ctx context.Context) error {
-	_, err := r.pool.Exec(ctx, `
-        CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-        CREATE TABLE IF NOT EXISTS role_favorites (
-            id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-            user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-            role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
-            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
-            UNIQUE(user_id, role_id)
-        );
-        CREATE INDEX IF NOT EXISTS idx_role_favorites_user ON role_favorites(user_id);
-        CREATE INDEX IF NOT EXISTS idx_role_favorites_role ON role_favorites(role_id);
-    `)
-	return err
-}
-
 func (r *RoleRepository) List(ctx context.Context, status string, limit int) ([]model.Role, error) {
 	if limit <= 0 {
 		limit = 20
 	}
-	if err := r.ensureRoleDataColumn(ctx); err != nil {
-		return nil, err
-	}
 	rows, err := r.pool.Query(ctx, `
         SELECT id, creator_id, name, description, avatar_url, tags, abilities, allow_clone, status, coalesce(role_version,''), data, created_at, updated_at
         FROM roles
@@ -76,9 +50,6 @@ func (r *RoleRepository) List(ctx context.Context, status string, limit int) ([]
 }
 
 func (r *RoleRepository) FindByID(ctx context.Context, id string) (*model.Role, error) {
-	if err := r.ensureRoleDataColumn(ctx); err != nil {
-		return nil, err
-	}
 	row := r.pool.QueryRow(ctx, `
         SELECT r.id, r.creator_id, r.name, r.description, r.avatar_url, r.tags, r.abilities, r.allow_clone, r.status, coalesce(r.role_version,''), r.data, r.created_at, r.updated_at,
                COALESCE(f.cnt, 0) AS favorite_count
@@ -106,9 +77,6 @@ func (r *RoleRepository) Save(ctx context.Context, role *model.Role) error {
 	if role.ID == "" {
 		role.ID = uuid.NewString()
 	}
-	if err := r.ensureRoleDataColumn(ctx); err != nil {
-		return err
-	}
 	row := r.pool.QueryRow(ctx, `
         INSERT INTO roles (id, creator_id, name, description, avatar_url, tags, abilities, allow_clone, status, role_version, data)
         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
@@ -134,9 +102,6 @@ func (r *RoleRepository) UpdateStatus(ctx context.Context, roleID, status string
 }
 
 func (r *RoleRepository) Favorite(ctx context.Context, userID, roleID string) error {
-	if err := r.ensureFavoritesTable(ctx); err != nil {
-		return err
-	}
 	_, err := r.pool.Exec(ctx, `
         INSERT INTO role_favorites(user_id, role_id)
         VALUES ($1, $2)
@@ -146,17 +111,11 @@ func (r *RoleRepository) Favorite(ctx context.Context, userID, roleID string) er
 }
 
 func (r *RoleRepository) Unfavorite(ctx context.Context, userID, roleID string) error {
-	if err := r.ensureFavoritesTable(ctx); err != nil {
-		return err
-	}
 	_, err := r.pool.Exec(ctx, `DELETE FROM role_favorites WHERE user_id = $1 AND role_id = $2`, userID, roleID)
 	return err
 }
 
 func (r *RoleRepository) IsFavorited(ctx context.Context, userID, roleID string) (bool, error) {
-	if err := r.ensureFavoritesTable(ctx); err != nil {
-		return false, err
-	}
 	row := r.pool.QueryRow(ctx, `SELECT 1 FROM role_favorites WHERE user_id = $1 AND role_id = $2 LIMIT 1`, userID, roleID)
 	var dummy int
 	if err := row.Scan(&dummy); err != nil {
@@ -169,9 +128,6 @@ func (r *RoleRepository) IsFavorited(ctx context.Context, userID, roleID string)
 }
 
 func (r *RoleRepository) CountFavorites(ctx context.Context, roleID string) (int, error) {
-	if err := r.ensureFavoritesTable(ctx); err != nil {
-		return 0, err
-	}
 	row := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM role_favorites WHERE role_id = $1`, roleID)
 	var cnt int
 	if err := row.Scan(&cnt); err != nil {
@@ -181,12 +137,6 @@ func (r *RoleRepository) CountFavorites(ctx context.Context, roleID string) (int
 }
 
 func (r *RoleRepository) ListFavorites(ctx context.Context, userID string, limit int) ([]model.Role, error) {
-	if err := r.ensureFavoritesTable(ctx); err != nil {
-		return nil, err
-	}
-	if err := r.ensureRoleDataColumn(ctx); err != nil {
-		return nil, err
-	}
 	if limit <= 0 {
 		limit = 30
 	}
@@ -224,9 +174,6 @@ func (r *RoleRepository) ListFavorites(ctx context.Context, userID string, limit
 }
 
 func (r *RoleRepository) ListByCreator(ctx context.Context, creatorID string) ([]model.Role, error) {
-	if err := r.ensureRoleDataColumn(ctx); err != nil {
-		return nil, err
-	}
 	rows, err := r.pool.Query(ctx, `
         SELECT id, creator_id, name, description, avatar_url, tags, abilities, allow_clone, status, coalesce(role_version,''), data, created_at, updated_at
         FROM roles WHERE creator_id = $1 ORDER BY updated_at DESC
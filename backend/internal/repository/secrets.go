@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/example/ai-avatar-studio/internal/pkg/secrets"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reencryptAPIKeys rewrites the api_key column of table under the active master key and fills
+// api_key_hint. It runs in one transaction so a failure leaves every row as it was.
+func reencryptAPIKeys(ctx context.Context, pool *pgxpool.Pool, keys *secrets.Keyring, table string) (int, error) {
+	if keys.ActiveVersion() == "" {
+		return 0, secrets.ErrNoMasterKey
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT id, api_key, api_key_hint FROM %s WHERE api_key <> '' FOR UPDATE`, table))
+	if err != nil {
+		return 0, err
+	}
+	type pending struct{ id, key, hint string }
+	var updates []pending
+	for rows.Next() {
+		var id, stored, hint string
+		if err := rows.Scan(&id, &stored, &hint); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !keys.NeedsRewrap(stored) && hint != "" {
+			continue
+		}
+		plain, err := keys.Decrypt(stored)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s %s: %w", table, id, err)
+		}
+		sealed, err := keys.Encrypt(plain)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		updates = append(updates, pending{id: id, key: sealed, hint: secrets.Mask(plain)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, u := range updates {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET api_key = $2, api_key_hint = $3 WHERE id = $1`, table), u.id, u.key, u.hint); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(updates), nil
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -19,6 +20,8 @@ import (
 	rolehandler "github.com/example/ai-avatar-studio/internal/handler/role"
 	imagehandler "github.com/example/ai-avatar-studio/internal/handler/image"
 	imageadminhandler "github.com/example/ai-avatar-studio/internal/handler/imageadmin"
+	memoryhandler "github.com/example/ai-avatar-studio/internal/handler/memory"
+	personahandler "github.com/example/ai-avatar-studio/internal/handler/persona"
 	storehandler "github.com/example/ai-avatar-studio/internal/handler/store"
 	uploadhandler "github.com/example/ai-avatar-studio/internal/handler/upload"
 	"github.com/gin-gonic/gin"
@@ -30,6 +33,8 @@ type Handlers struct {
 	Auth         *authhandler.Handler
 	Roles        *rolehandler.Handler
 	Chat         *chathandler.Handler
+	Memories     *memoryhandler.Handler
+	Personas     *personahandler.Handler
 	Community    *communityhandler.Handler
 	Creator      *creatorhandler.Handler
 	Store        *storehandler.Handler
@@ -58,13 +63,17 @@ func New(cfg *config.Config, handlers Handlers) *gin.Engine {
 		_ = os.MkdirAll(filepath.Join(baseDir, "avatars"), 0755)
 		_ = os.MkdirAll(filepath.Join(baseDir, "posts"), 0755)
 		_ = os.MkdirAll(filepath.Join(baseDir, "roles"), 0755)
-		r.Static("/uploads", baseDir)
+		serveUpload := uploadFiles(baseDir)
+		r.GET("/uploads/*filepath", serveUpload)
+		r.HEAD("/uploads/*filepath", serveUpload)
 	}
 
 	api := r.Group("/api")
 	handlers.Auth.RegisterRoutes(api.Group("/auth"))
 	handlers.Roles.RegisterRoutes(api)
 	handlers.Chat.RegisterRoutes(api)
+	handlers.Memories.RegisterRoutes(api)
+	handlers.Personas.RegisterRoutes(api)
 	handlers.Community.RegisterRoutes(api)
 	handlers.Creator.RegisterRoutes(api)
 	handlers.Store.RegisterRoutes(api)
@@ -94,6 +103,22 @@ func New(cfg *config.Config, handlers Handlers) *gin.Engine {
 	return r
 }
 
+// uploadFiles serves the upload directory. Generated images are kept in MEDIA_DIR, but older
+// builds wrote them to images/ here, so that folder is never served directly: they are only
+// reachable through signed /api/media links. The path is cleaned first so "//images/" or
+// "/./images/" cannot slip past the check.
+func uploadFiles(baseDir string) gin.HandlerFunc {
+	files := http.StripPrefix("/uploads", http.FileServer(gin.Dir(baseDir, false)))
+	return func(c *gin.Context) {
+		p := path.Clean("/" + c.Param("filepath"))
+		if p == "/images" || strings.HasPrefix(p, "/images/") {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		files.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
 func corsMiddleware(origins []string, env string) gin.HandlerFunc {
 	production := strings.ToLower(env) == "production"
 	return func(c *gin.Context) {
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadFilesHidesGeneratedImages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	for _, name := range []string{"avatars/a.png", "images/ab/x.png"} {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/uploads/*filepath", uploadFiles(dir))
+
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"/uploads/avatars/a.png", http.StatusOK},
+		{"/uploads/images/ab/x.png", http.StatusNotFound},
+		{"/uploads//images/ab/x.png", http.StatusNotFound},
+		{"/uploads/./images/ab/x.png", http.StatusNotFound},
+		{"/uploads/avatars/../images/ab/x.png", http.StatusNotFound},
+		{"/uploads/images", http.StatusNotFound},
+		{"/uploads/images/", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = tc.path // keep the path exactly as a client could send it
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("GET %s = %d, want %d", tc.path, rec.Code, tc.want)
+			}
+		})
+	}
+}
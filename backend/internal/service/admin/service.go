@@ -18,10 +18,12 @@ type Service struct {
 	community     *repository.CommunityRepository
 	users         *repository.UserRepository
 	notifications *repository.NotificationRepository
+	assets        *repository.UserAssetRepository
+	jobs          *repository.JobRepository
 }
 
-func NewService(configs *repository.ConfigRepository, roles *repository.RoleRepository, community *repository.CommunityRepository, users *repository.UserRepository, notifications *repository.NotificationRepository) *Service {
-	return &Service{configs: configs, roles: roles, community: community, users: users, notifications: notifications}
+func NewService(configs *repository.ConfigRepository, roles *repository.RoleRepository, community *repository.CommunityRepository, users *repository.UserRepository, notifications *repository.NotificationRepository, assets *repository.UserAssetRepository, jobs *repository.JobRepository) *Service {
+	return &Service{configs: configs, roles: roles, community: community, users: users, notifications: notifications, assets: assets, jobs: jobs}
 }
 
 func (s *Service) Models(ctx context.Context) ([]model.ModelConfig, error) {
@@ -123,6 +125,16 @@ func (s *Service) DeleteUser(ctx context.Context, id string) error {
 	return s.users.SoftDelete(ctx, id)
 }
 
+// UserLedger lists the user's recent coin ledger entries.
+func (s *Service) UserLedger(ctx context.Context, userID string, limit int) ([]model.CoinLedgerEntry, error) {
+	return s.assets.ListLedger(ctx, userID, limit)
+}
+
+// RebuildUserBalance resets the cached balance to the ledger sum.
+func (s *Service) RebuildUserBalance(ctx context.Context, userID string) (*model.UserAsset, error) {
+	return s.assets.RebuildBalance(ctx, userID)
+}
+
 func (s *Service) ListComments(ctx context.Context, postID, visibility string, limit, offset int) ([]model.CommunityComment, error) {
 	return s.community.ListCommentsAdmin(ctx, postID, visibility, limit, offset)
 }
@@ -175,3 +187,20 @@ func (s *Service) BroadcastNotification(ctx context.Context, title, content, que
 	}
 	return s.SendNotification(ctx, title, content, ids)
 }
+
+// Jobs lists background jobs; admins mostly look at status "dead".
+func (s *Service) Jobs(ctx context.Context, status, jobType string, limit, offset int) ([]model.Job, error) {
+	return s.jobs.List(ctx, status, jobType, limit, offset)
+}
+
+// RetryJob gives a dead job a fresh set of attempts.
+func (s *Service) RetryJob(ctx context.Context, id string) (*model.Job, error) {
+	job, err := s.jobs.Requeue(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, errors.New("job not found or not dead")
+	}
+	return job, nil
+}
@@ -0,0 +1,239 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+	"github.com/example/ai-avatar-studio/internal/pkg/macro"
+)
+
+// Section priorities follow the order documented in systemPrompt: lower numbers are kept first
+// when the model's context window is too small for everything.
+const (
+	prioritySystem   = 1
+	priorityPreset   = 2
+	priorityRolecard = 3
+	priorityWorld    = 4
+	prioritySummary  = 5
+)
+
+const (
+	// minSectionTokens is the smallest remainder worth filling with a truncated section.
+	minSectionTokens = 64
+	// defaultReservedOutput is kept free for the reply when the model sets no max_tokens.
+	defaultReservedOutput = 1024
+)
+
+// ContextSection is one labelled part of the context with its estimated size. Sections are system
+// text unless Role says otherwise; AfterHistory ones are sent after the dialogue.
+type ContextSection struct {
+	Name         string `json:"name"`
+	Priority     int    `json:"priority"`
+	Role         string `json:"role,omitempty"`
+	AfterHistory bool   `json:"after_history,omitempty"`
+	Tokens       int    `json:"tokens"`
+	Included     bool   `json:"included"`
+	Truncated    bool   `json:"truncated,omitempty"`
+	content      string
+}
+
+// ContextWindow is the prompt and dialogue sent for one turn, with a per-section token breakdown.
+// Messages is the assembled conversation; Prompt is the text of all included sections.
+type ContextWindow struct {
+	Prompt          string              `json:"prompt,omitempty"`
+	Messages        []llmclient.Message `json:"-"`
+	History         []model.ChatMessage `json:"-"`
+	Budget          int                 `json:"budget"` // 0 means the model declares no limit
+	ReservedOutput  int                 `json:"reserved_output"`
+	Sections        []ContextSection    `json:"sections"`
+	PromptTokens    int                 `json:"prompt_tokens"`
+	HistoryTokens   int                 `json:"history_tokens"`
+	TotalTokens     int                 `json:"total_tokens"`
+	HistoryIncluded int                 `json:"history_included"`
+	HistoryDropped  int                 `json:"history_dropped"`
+	// macros holds the session variables as the rendered prompt left them.
+	macros *macro.Env
+}
+
+// ContextPreview assembles the context the next reply would see, optionally with a draft message.
+// The prompt text itself is only returned when DEBUG_PROMPT is enabled.
+func (s *Service) ContextPreview(ctx context.Context, actor authz.Actor, sessionID, draft string) (*ContextWindow, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.roles.FindByID(ctx, session.RoleID)
+	if err != nil || role == nil {
+		return nil, errors.New("role not found")
+	}
+	modelCfg, err := s.resolveModel(ctx, session.ModelKey)
+	if err != nil || modelCfg == nil {
+		return nil, fmt.Errorf("resolve model %s: %w", session.ModelKey, err)
+	}
+	history, err := s.chats.ListMessages(ctx, session.ID, 100)
+	if err != nil {
+		return nil, err
+	}
+	query := latestUserContent(history)
+	if strings.TrimSpace(draft) != "" {
+		history = append(history, model.ChatMessage{SessionID: session.ID, Role: "user", Content: draft})
+		query = draft
+	}
+	window := s.buildContext(ctx, session, role, s.modelChain(ctx, modelCfg), history, query, nil)
+	if !debugPrompt {
+		window.Prompt = ""
+	}
+	return window, nil
+}
+
+// buildContext gathers world, knowledge and memories for the role and fits them with the
+// dialogue into the context window of the chain. Every model of the chain may be sent the same
+// messages, so they are sized for the one with the least room.
+func (s *Service) buildContext(ctx context.Context, session *model.ChatSession, role *model.Role, chain []*model.ModelConfig, history []model.ChatMessage, query string, userPreset *model.Preset) *ContextWindow {
+	var worldSummary *model.WorldSummary
+	if s.worlds != nil {
+		if world, err := s.worlds.FindByRole(ctx, role.ID); err == nil {
+			worldSummary = world.Summary()
+		}
+	}
+	ragCtx, _ := s.rag.RetrieveContext(ctx, role.ID, query)
+	mems, _ := s.memories.List(ctx, session.UserID, role.ID)
+	var memo []string
+	for _, m := range mems {
+		memo = append(memo, m.Content)
+	}
+	user := s.sessionPersona(ctx, session)
+	env := macroEnv(session, role, user, history)
+	sections := promptSections(env, role, user, worldSummary, ragCtx, strings.Join(memo, "\n"), session.Settings, session.Mode, userPreset)
+	window := assembleContext(tightestModel(chain), sections, history)
+	window.macros = env
+	return window
+}
+
+// assembleContext fills the budget (max_context_tokens minus the reply reserve) in priority order:
+// system rules and the latest message are always sent, other sections are truncated or dropped
+// when they no longer fit, and recent dialogue takes what is left, newest turns first. Older turns
+// that fall out are represented by the session summary section.
+func assembleContext(cfg *model.ModelConfig, sections []ContextSection, history []model.ChatMessage) *ContextWindow {
+	window := &ContextWindow{Budget: cfg.MaxContextTokens}
+	for i := range sections {
+		sections[i].Tokens = llmclient.EstimateTokens(sections[i].content)
+	}
+	historyTokens := make([]int, len(history))
+	for i, msg := range history {
+		historyTokens[i] = llmclient.EstimateMessageTokens(msg)
+	}
+
+	firstKept := 0
+	if window.Budget <= 0 {
+		for i := range sections {
+			sections[i].Included = sections[i].Tokens > 0
+		}
+	} else {
+		window.ReservedOutput = reservedOutput(cfg)
+		remaining := window.Budget - window.ReservedOutput
+		if n := len(history); n > 0 {
+			remaining -= historyTokens[n-1]
+		}
+		order := make([]int, len(sections))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return sections[order[a]].Priority < sections[order[b]].Priority })
+		for _, i := range order {
+			sec := &sections[i]
+			switch {
+			case sec.Tokens == 0:
+			case sec.Tokens <= remaining || sec.Priority == prioritySystem:
+				sec.Included = true
+			case remaining >= minSectionTokens:
+				sec.content = truncateToTokens(sec.content, remaining)
+				sec.Tokens = llmclient.EstimateTokens(sec.content)
+				sec.Included, sec.Truncated = true, true
+			}
+			if sec.Included {
+				remaining -= sec.Tokens
+			}
+		}
+		firstKept = len(history)
+		if firstKept > 0 {
+			firstKept-- // the latest message is already paid for
+		}
+		for firstKept > 0 && historyTokens[firstKept-1] <= remaining {
+			firstKept--
+			remaining -= historyTokens[firstKept]
+		}
+	}
+
+	var parts []string
+	var before, after []llmclient.Message
+	for _, sec := range sections {
+		if !sec.Included {
+			continue
+		}
+		parts = append(parts, sec.content)
+		window.PromptTokens += sec.Tokens
+		if sec.AfterHistory {
+			after = appendMessage(after, sec.Role, sec.content)
+		} else {
+			before = appendMessage(before, sec.Role, sec.content)
+		}
+	}
+	window.Prompt = strings.Join(parts, "\n\n")
+	window.Sections = sections
+	window.History = history[firstKept:]
+	window.Messages = append(append(before, llmclient.Conversation("", window.History)...), after...)
+	for _, t := range historyTokens[firstKept:] {
+		window.HistoryTokens += t
+	}
+	window.HistoryIncluded = len(window.History)
+	window.HistoryDropped = firstKept
+	window.TotalTokens = window.PromptTokens + window.HistoryTokens
+	return window
+}
+
+// reservedOutput is the part of a limited context window kept free for the reply.
+func reservedOutput(cfg *model.ModelConfig) int {
+	if cfg.MaxTokens > 0 {
+		return cfg.MaxTokens
+	}
+	return min(defaultReservedOutput, cfg.MaxContextTokens/4)
+}
+
+// appendMessage adds a section to the conversation, joining it to the previous message when that
+// has the same role so consecutive system sections form one system prompt.
+func appendMessage(messages []llmclient.Message, role, content string) []llmclient.Message {
+	if role == "" {
+		role = llmclient.RoleSystem
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content += "\n\n" + content
+		return messages
+	}
+	return append(messages, llmclient.Message{Role: role, Content: content})
+}
+
+// truncateToTokens shortens text to at most maxTokens including the ellipsis that marks the cut,
+// cutting at a line break when one is close.
+func truncateToTokens(text string, maxTokens int) string {
+	maxTokens-- // the ellipsis
+	runes := []rune(text)
+	for len(runes) > 0 && llmclient.EstimateTokens(string(runes)) > maxTokens {
+		keep := len(runes) * maxTokens / (llmclient.EstimateTokens(string(runes)) + 1)
+		if keep >= len(runes) {
+			keep = len(runes) - 1
+		}
+		runes = runes[:keep]
+	}
+	out := string(runes)
+	if idx := strings.LastIndex(out, "\n"); idx > len(out)*3/4 {
+		out = out[:idx]
+	}
+	return strings.TrimSpace(out) + "\n…"
+}
@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+)
+
+// words is text of n estimated tokens.
+func words(n int) string {
+	return strings.TrimSpace(strings.Repeat("word ", n))
+}
+
+func TestAssembleContext(t *testing.T) {
+	// Sections of 50+100+200+300+100 tokens and five turns of 20 tokens each; the reply keeps 100.
+	sections := func() []ContextSection {
+		return []ContextSection{
+			{Name: "system", Priority: prioritySystem, content: "rule " + words(49)},
+			{Name: "preset", Priority: priorityPreset, content: words(100)},
+			{Name: "rolecard", Priority: priorityRolecard, content: words(200)},
+			{Name: "world", Priority: priorityWorld, content: words(300)},
+			{Name: "summary", Priority: prioritySummary, content: words(100)},
+		}
+	}
+	var history []model.ChatMessage
+	for i, role := range []string{"user", "assistant", "user", "assistant", "user"} {
+		history = append(history, model.ChatMessage{ID: string(rune('a' + i)), Role: role, Content: words(16)})
+	}
+	cases := []struct {
+		name      string
+		budget    int
+		included  string // names of the included sections
+		truncated string
+		turns     int
+	}{
+		{"unlimited", 0, "system preset rolecard world summary", "", 5},
+		{"everything fits", 100 + 750 + 100, "system preset rolecard world summary", "", 5},
+		{"history trimmed newest first", 100 + 750 + 20 + 40, "system preset rolecard world summary", "", 3},
+		{"lower priorities truncated then dropped", 100 + 20 + 350 + 150, "system preset rolecard world", "world", 1},
+		{"section too small to be worth sending", 100 + 20 + 350 + 40, "system preset rolecard", "", 3},
+		{"system and latest turn always kept", 100 + 10, "system", "", 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &model.ModelConfig{MaxContextTokens: tc.budget, MaxTokens: 100}
+			w := assembleContext(cfg, sections(), history)
+			var included, truncated []string
+			for _, sec := range w.Sections {
+				if sec.Included {
+					included = append(included, sec.Name)
+				}
+				if sec.Truncated {
+					truncated = append(truncated, sec.Name)
+				}
+			}
+			if got := strings.Join(included, " "); got != tc.included {
+				t.Fatalf("included %q, want %q", got, tc.included)
+			}
+			if got := strings.Join(truncated, " "); got != tc.truncated {
+				t.Fatalf("truncated %q, want %q", got, tc.truncated)
+			}
+			if w.HistoryIncluded != tc.turns || w.HistoryDropped != len(history)-tc.turns {
+				t.Fatalf("history %d kept, %d dropped; want %d kept", w.HistoryIncluded, w.HistoryDropped, tc.turns)
+			}
+			// The kept turns are the newest, and the prompt comes first as one system message.
+			if w.History[0].ID != history[len(history)-tc.turns].ID || w.History[len(w.History)-1].ID != "e" {
+				t.Fatalf("kept turns %v", w.History)
+			}
+			if len(w.Messages) != tc.turns+1 || w.Messages[0].Role != llmclient.RoleSystem || !strings.HasPrefix(w.Messages[0].Content, "rule ") {
+				t.Fatalf("messages = %+v", w.Messages)
+			}
+			if tc.budget > 0 && tc.name != "system and latest turn always kept" && w.TotalTokens > tc.budget-w.ReservedOutput {
+				t.Fatalf("%d tokens over the budget of %d", w.TotalTokens, tc.budget-w.ReservedOutput)
+			}
+		})
+	}
+}
+
+func TestReservedOutput(t *testing.T) {
+	for _, tc := range []struct{ window, maxTokens, want int }{
+		{8000, 500, 500},
+		{8000, 0, defaultReservedOutput},
+		{2000, 0, 500},
+	} {
+		if got := reservedOutput(&model.ModelConfig{MaxContextTokens: tc.window, MaxTokens: tc.maxTokens}); got != tc.want {
+			t.Fatalf("reservedOutput(%d, %d) = %d, want %d", tc.window, tc.maxTokens, got, tc.want)
+		}
+	}
+}
+
+func TestTightestModel(t *testing.T) {
+	big := &model.ModelConfig{ID: "big", MaxContextTokens: 128000, MaxTokens: 4000}
+	small := &model.ModelConfig{ID: "small", MaxContextTokens: 8000, MaxTokens: 1000}
+	// A larger window with a larger reply reserve can leave less room for the prompt.
+	greedy := &model.ModelConfig{ID: "greedy", MaxContextTokens: 9000, MaxTokens: 4000}
+	unlimited := &model.ModelConfig{ID: "unlimited"}
+	for _, tc := range []struct {
+		chain []*model.ModelConfig
+		want  string
+	}{
+		{[]*model.ModelConfig{big}, "big"},
+		{[]*model.ModelConfig{big, small}, "small"},
+		{[]*model.ModelConfig{small, greedy}, "greedy"},
+		{[]*model.ModelConfig{unlimited, small}, "small"},
+		{[]*model.ModelConfig{small, unlimited}, "small"},
+		{[]*model.ModelConfig{unlimited}, "unlimited"},
+	} {
+		if got := tightestModel(tc.chain); got.ID != tc.want {
+			t.Fatalf("tightestModel = %s, want %s", got.ID, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+)
+
+const (
+	defaultRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 10 * time.Second
+)
+
+// modelChain returns the model followed by its active fallbacks, in order and without repeats.
+func (s *Service) modelChain(ctx context.Context, primary *model.ModelConfig) []*model.ModelConfig {
+	chain := []*model.ModelConfig{primary}
+	seen := map[string]bool{primary.ID: true}
+	for _, id := range primary.FallbackModelIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		cfg, err := s.configs.FindModel(ctx, id)
+		if err != nil || cfg == nil || !cfg.Serviceable() {
+			continue
+		}
+		chain = append(chain, cfg)
+	}
+	return chain
+}
+
+// chainHoldAmount reserves enough for the most expensive model that might answer.
+func chainHoldAmount(chain []*model.ModelConfig, messages []llmclient.Message) int64 {
+	var amount int64
+	for _, cfg := range chain {
+		if v := holdAmount(cfg, messages); v > amount {
+			amount = v
+		}
+	}
+	return amount
+}
+
+// tightestModel returns the model of the chain with the least room for the prompt, which is the
+// one the context has to fit. Models without a declared limit have unlimited room.
+func tightestModel(chain []*model.ModelConfig) *model.ModelConfig {
+	tightest := chain[0]
+	for _, cfg := range chain[1:] {
+		if cfg.MaxContextTokens <= 0 {
+			continue
+		}
+		if tightest.MaxContextTokens <= 0 || cfg.MaxContextTokens-reservedOutput(cfg) < tightest.MaxContextTokens-reservedOutput(tightest) {
+			tightest = cfg
+		}
+	}
+	return tightest
+}
+
+// callWithFallback runs call against each model of the chain, skipping models whose circuit is
+// open and retrying retryable errors with jittered exponential backoff before moving on. A model
+// that gives up on a retryable error counts one breaker failure; client errors such as a bad
+// request say nothing about the model's health and are not counted. Once emitted reports that
+// output already reached the client the failure is final, since switching models mid-reply would
+// splice two answers. It returns the model that answered.
+func (s *Service) callWithFallback(ctx context.Context, chain []*model.ModelConfig, emitted func() bool, call func(context.Context, *model.ModelConfig) (llmclient.Completion, error)) (llmclient.Completion, *model.ModelConfig, error) {
+	var lastErr error
+	for _, cfg := range chain {
+		if s.breaker != nil && !s.breaker.Allow(cfg.ID) {
+			lastErr = fmt.Errorf("model %s circuit open", cfg.ID)
+			continue
+		}
+		for attempt := 0; ; attempt++ {
+			out, err := call(ctx, cfg)
+			if err == nil {
+				if s.breaker != nil {
+					s.breaker.Success(cfg.ID)
+				}
+				return out, cfg, nil
+			}
+			if ctx.Err() != nil {
+				// Cancelled or stopped by the user: not the model's fault.
+				return llmclient.Completion{}, cfg, err
+			}
+			lastErr = fmt.Errorf("model %s: %w", cfg.ID, err)
+			retryable := llmclient.IsRetryable(err)
+			if emitted != nil && emitted() {
+				s.modelFailed(cfg, retryable)
+				return llmclient.Completion{}, cfg, lastErr
+			}
+			if attempt >= cfg.MaxRetries || !retryable {
+				s.modelFailed(cfg, retryable)
+				log.Printf("llm: model %s failed, trying next in chain err=%v", cfg.ID, err)
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return llmclient.Completion{}, cfg, ctx.Err()
+			case <-time.After(retryBackoff(cfg.RetryBackoffMs, attempt)):
+			}
+			// Other calls may have opened the circuit while this one backed off; a half-open
+			// trial is a single call and is not retried either.
+			if s.breaker != nil && !s.breaker.Allow(cfg.ID) {
+				s.modelFailed(cfg, retryable)
+				log.Printf("llm: model %s circuit open, trying next in chain err=%v", cfg.ID, err)
+				break
+			}
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no model available")
+	}
+	return llmclient.Completion{}, nil, lastErr
+}
+
+// modelFailed records one breaker failure for a model that gave up on a retryable error.
+func (s *Service) modelFailed(cfg *model.ModelConfig, retryable bool) {
+	if s.breaker != nil && retryable {
+		s.breaker.Failure(cfg.ID, cfg.BreakerThreshold, time.Duration(cfg.BreakerCooldownSeconds)*time.Second)
+	}
+}
+
+// retryBackoff doubles the base delay per attempt and picks a random point in its upper half.
+func retryBackoff(baseMs, attempt int) time.Duration {
+	base := time.Duration(baseMs) * time.Millisecond
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	d := base << attempt
+	if d > maxRetryBackoff || d <= 0 {
+		d = maxRetryBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// servedMetadata records usage and which model answered, noting the requested one when a fallback served.
+func servedMetadata(requested, served *model.ModelConfig, usage llmclient.Usage, cost int64) map[string]interface{} {
+	meta := map[string]interface{}{
+		"usage":    usageMetadata(usage, cost),
+		"model_id": served.ID,
+	}
+	if served.ID != requested.ID {
+		meta["fallback_from"] = requested.ID
+	}
+	return meta
+}
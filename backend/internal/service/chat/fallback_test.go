@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	cases := []struct {
+		baseMs, attempt int
+		max             time.Duration
+	}{
+		{100, 0, 100 * time.Millisecond},
+		{100, 1, 200 * time.Millisecond},
+		{100, 3, 800 * time.Millisecond},
+		{0, 0, defaultRetryBackoff},
+		{-5, 1, 2 * defaultRetryBackoff},
+		{100, 10, maxRetryBackoff},
+		// A shift past the width of the duration is capped rather than wrapping around.
+		{100, 80, maxRetryBackoff},
+	}
+	for _, c := range cases {
+		for i := 0; i < 50; i++ {
+			d := retryBackoff(c.baseMs, c.attempt)
+			if d < c.max/2 || d > c.max {
+				t.Fatalf("retryBackoff(%d, %d) = %v, want within [%v, %v]", c.baseMs, c.attempt, d, c.max/2, c.max)
+			}
+		}
+	}
+}
+
+func TestCallWithFallbackBreaker(t *testing.T) {
+	ctx := context.Background()
+	primary := &model.ModelConfig{ID: "primary", MaxRetries: 2, RetryBackoffMs: 1, BreakerThreshold: 2, BreakerCooldownSeconds: 60}
+	backup := &model.ModelConfig{ID: "backup"}
+	failures := func(b *llmclient.Breaker, id string) int {
+		for _, st := range b.Status() {
+			if st.ModelID == id {
+				return st.Failures
+			}
+		}
+		return 0
+	}
+	run := func(s *Service, primaryErr error) (calls int, served *model.ModelConfig) {
+		_, served, err := s.callWithFallback(ctx, []*model.ModelConfig{primary, backup}, nil, func(_ context.Context, cfg *model.ModelConfig) (llmclient.Completion, error) {
+			if cfg.ID == "primary" {
+				calls++
+				return llmclient.Completion{}, primaryErr
+			}
+			return llmclient.Completion{Content: "ok"}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return calls, served
+	}
+
+	// Exhausting the retries counts one failure, not one per attempt.
+	s := &Service{breaker: llmclient.NewBreaker()}
+	overloaded := &llmclient.ProviderError{StatusCode: 503}
+	if calls, served := run(s, overloaded); calls != 3 || served != backup {
+		t.Fatalf("%d calls, served by %v", calls, served)
+	}
+	if n := failures(s.breaker, "primary"); n != 1 {
+		t.Fatalf("%d breaker failures, want 1", n)
+	}
+
+	// A client error is not retried and says nothing about the model's health.
+	s = &Service{breaker: llmclient.NewBreaker()}
+	if calls, _ := run(s, &llmclient.ProviderError{StatusCode: 400}); calls != 1 {
+		t.Fatalf("%d calls for a bad request", calls)
+	}
+	if n := failures(s.breaker, "primary"); n != 0 {
+		t.Fatalf("bad request counted %d breaker failures", n)
+	}
+	if calls, _ := run(s, errors.New("invalid response")); calls != 1 || failures(s.breaker, "primary") != 0 {
+		t.Fatal("a non-retryable error was retried or counted")
+	}
+
+	// Once the circuit opens during the backoff the model is not called again.
+	s = &Service{breaker: llmclient.NewBreaker()}
+	calls := 0
+	_, served, _ := s.callWithFallback(ctx, []*model.ModelConfig{primary, backup}, nil, func(_ context.Context, cfg *model.ModelConfig) (llmclient.Completion, error) {
+		if cfg.ID == "backup" {
+			return llmclient.Completion{}, nil
+		}
+		calls++
+		// Concurrent calls trip the circuit while this one waits to retry.
+		s.breaker.Failure("primary", 1, time.Minute)
+		return llmclient.Completion{}, overloaded
+	})
+	if calls != 1 || served != backup {
+		t.Fatalf("%d calls after the circuit opened, served by %v", calls, served)
+	}
+}
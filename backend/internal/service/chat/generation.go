@@ -0,0 +1,180 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/google/uuid"
+)
+
+const (
+	// generationTTL bounds how long a finished generation can still be replayed.
+	generationTTL = time.Hour
+	// generationIdleTimeout ends a reattached stream whose generation stopped producing events,
+	// e.g. because the process running it restarted.
+	generationIdleTimeout = 5 * time.Minute
+	generationPollWait    = 150 * time.Millisecond
+	// generationMarkerTTL frees a session whose generation died with its process; a running
+	// generation refreshes its marker every generationStopPoll.
+	generationMarkerTTL = 30 * time.Second
+	generationStopPoll  = 500 * time.Millisecond
+)
+
+// GenerationEvent is one buffered frame of a detached generation:
+// delta, reasoning, usage, done (persisted message IDs) or error.
+type GenerationEvent struct {
+	Offset int64           `json:"-"`
+	Event  string          `json:"event"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Terminal reports whether no further events follow.
+func (e GenerationEvent) Terminal() bool {
+	return e.Event == "done" || e.Event == "error"
+}
+
+type generationMeta struct {
+	UserID    string    `json:"user_id"`
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func generationMetaKey(id string) string   { return "chat:gen:" + id + ":meta" }
+func generationEventsKey(id string) string { return "chat:gen:" + id + ":events" }
+
+// generationMarkerKey holds the token of the session's in-flight generation.
+func generationMarkerKey(sessionID string) string { return "chat:generating:" + sessionID }
+
+// generationStopKey is set to stop the generation holding the token.
+func generationStopKey(token string) string { return "chat:gen-stop:" + token }
+
+// StartGeneration sends the message and produces the reply in the background, buffering every
+// event in Redis under the returned generation ID. The reply is persisted even if no client listens.
+// The session is marked busy and the coins are held before the ID is returned, so a second send and
+// an empty wallet both fail here rather than in the background.
+func (s *Service) StartGeneration(ctx context.Context, actor authz.Actor, sessionID, content string, userPreset *model.Preset) (string, error) {
+	if strings.TrimSpace(content) == "" {
+		return "", errors.New("empty message")
+	}
+	if s.cache == nil {
+		return "", errors.New("generation buffer unavailable")
+	}
+	// The generation outlives the request, so everything it keeps must not be cancelled with it.
+	ctx = context.WithoutCancel(ctx)
+	turn, err := s.prepareTurn(ctx, actor, sessionID, content, userPreset)
+	if err != nil {
+		return "", err
+	}
+	id := uuid.NewString()
+	meta, _ := json.Marshal(generationMeta{UserID: turn.session.UserID, SessionID: sessionID, CreatedAt: time.Now()})
+	if err := s.cache.Remember(ctx, generationMetaKey(id), string(meta), generationTTL); err != nil {
+		s.abortTurn(turn)
+		return "", err
+	}
+	go s.runGeneration(ctx, id, turn)
+	return id, nil
+}
+
+func (s *Service) runGeneration(ctx context.Context, id string, turn *pendingTurn) {
+	push := func(event string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		frame, _ := json.Marshal(GenerationEvent{Event: event, Data: payload})
+		if err := s.cache.Append(ctx, generationEventsKey(id), generationTTL, string(frame)); err != nil {
+			log.Printf("chat: buffer generation event failed generation=%s event=%s err=%v", id, event, err)
+		}
+	}
+	msgs, err := s.runTurn(ctx, turn, true, func(delta, reasoning string) {
+		if reasoning != "" {
+			push("reasoning", map[string]string{"content": reasoning})
+		}
+		if delta != "" {
+			push("delta", map[string]string{"content": delta})
+		}
+	})
+	if err != nil {
+		log.Printf("chat: generation failed generation=%s session=%s err=%v", id, turn.session.ID, err)
+		push("error", map[string]string{"message": err.Error()})
+		return
+	}
+	done := map[string]interface{}{"generation_id": id}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msg := msgs[i]
+		if msg.Role == "assistant" && done["assistant_message_id"] == nil {
+			done["assistant_message_id"] = msg.ID
+			done["stopped"] = msg.Metadata["stopped"] == true
+			done["truncated"] = msg.Metadata["truncated"] == true
+			if usage, ok := msg.Metadata["usage"]; ok {
+				push("usage", usage)
+			}
+		} else if msg.Role == "user" {
+			done["user_message_id"] = msg.ID
+			break
+		}
+	}
+	push("done", done)
+}
+
+// CheckGeneration verifies the generation exists and the actor may follow it.
+func (s *Service) CheckGeneration(ctx context.Context, actor authz.Actor, generationID string) error {
+	if s.cache == nil {
+		return errors.New("generation buffer unavailable")
+	}
+	raw, err := s.cache.Fetch(ctx, generationMetaKey(generationID))
+	if err != nil {
+		return err
+	}
+	if raw == "" {
+		return authz.ErrNotFound
+	}
+	var meta generationMeta
+	if err := json.Unmarshal([]byte(raw), &meta); err != nil {
+		return err
+	}
+	return authz.RequireOwner(actor, meta.UserID)
+}
+
+// StreamGeneration replays the generation's events from offset and follows it until a terminal
+// event, ctx cancellation or the idle timeout. Disconnecting never affects the generation itself.
+func (s *Service) StreamGeneration(ctx context.Context, actor authz.Actor, generationID string, from int64, emit func(GenerationEvent)) error {
+	if err := s.CheckGeneration(ctx, actor, generationID); err != nil {
+		return err
+	}
+	if from < 0 {
+		from = 0
+	}
+	lastEvent := time.Now()
+	for {
+		entries, err := s.cache.Range(ctx, generationEventsKey(generationID), from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			var ev GenerationEvent
+			if err := json.Unmarshal([]byte(entry), &ev); err != nil {
+				return err
+			}
+			ev.Offset = from
+			from++
+			emit(ev)
+			if ev.Terminal() {
+				return nil
+			}
+		}
+		if len(entries) > 0 {
+			lastEvent = time.Now()
+		} else if time.Since(lastEvent) > generationIdleTimeout {
+			return errors.New("generation timed out")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(generationPollWait):
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+)
+
+// noRoles fails every turn's pre-flight because the session's role is gone.
+type noRoles struct{}
+
+func (noRoles) FindByID(context.Context, string) (*model.Role, error) { return nil, nil }
+
+func TestPrepareTurnHoldsTheSession(t *testing.T) {
+	ctx := context.Background()
+	s := &Service{chats: &fakeChats{}, roles: noRoles{}, generations: map[string]context.CancelCauseFunc{}}
+
+	// A failed pre-flight reports its error and frees the session for the next send.
+	if _, err := s.prepareTurn(ctx, authz.Actor{UserID: "owner"}, "s1", "hi", nil); err == nil || err.Error() != "role not found" {
+		t.Fatalf("err = %v, want role not found", err)
+	}
+	if len(s.generations) != 0 {
+		t.Fatal("failed pre-flight left the session busy")
+	}
+	if _, err := s.prepareTurn(ctx, authz.Actor{UserID: "stranger"}, "s1", "hi", nil); !errors.Is(err, authz.ErrForbidden) || len(s.generations) != 0 {
+		t.Fatalf("foreign session: err = %v, busy = %d", err, len(s.generations))
+	}
+
+	// The session is registered before the pre-flight runs, so a second send is refused at once.
+	_, finish, err := s.beginGeneration(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.prepareTurn(ctx, authz.Actor{UserID: "owner"}, "s1", "hi again", nil); !errors.Is(err, errGenerationInProgress) {
+		t.Fatalf("err = %v, want errGenerationInProgress", err)
+	}
+	finish()
+	if len(s.generations) != 0 {
+		t.Fatal("finish left the session busy")
+	}
+}
@@ -0,0 +1,37 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/task"
+)
+
+// JobSummarize is the job type that folds recent turns into the session summary.
+const JobSummarize = "chat.summarize"
+
+type summarizePayload struct {
+	SessionID string `json:"session_id"`
+}
+
+// enqueueSummary schedules summarization of the session's unsummarized messages.
+func (s *Service) enqueueSummary(ctx context.Context, sessionID string) error {
+	if s.jobs == nil {
+		return errors.New("job queue not configured")
+	}
+	_, err := s.jobs.Enqueue(ctx, JobSummarize, summarizePayload{SessionID: sessionID}, task.MaxAttempts(3))
+	return err
+}
+
+// RegisterJobs binds the chat job handlers to the queue.
+func (s *Service) RegisterJobs(q *task.Queue) {
+	q.Register(JobSummarize, func(ctx context.Context, job *model.Job) error {
+		var p summarizePayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return task.Permanent(err)
+		}
+		return s.summarizeSession(ctx, p.SessionID)
+	})
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"context"
+	"log"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/pkg/macro"
+)
+
+// macroEnv is what {{...}} macros in preset blocks and role fields see for one turn. history ends
+// with the message being answered.
+func macroEnv(session *model.ChatSession, role *model.Role, user *model.Persona, history []model.ChatMessage) *macro.Env {
+	env := macro.SessionEnv(session, history)
+	env.Char, env.User = role.Name, personaName(user)
+	return env
+}
+
+// expand renders the macros in text. A malformed template is logged and sent as written so a
+// broken role card does not stop the chat.
+func expand(env *macro.Env, text string) string {
+	out, err := macro.Render(text, env)
+	if err != nil {
+		log.Printf("render macros char=%s err=%v", env.Char, err)
+		return text
+	}
+	return out
+}
+
+// saveVariables stores the session variables a turn changed with setvar or addvar.
+func (s *Service) saveVariables(ctx context.Context, sessionID string, env *macro.Env) {
+	if !env.VarsChanged() {
+		return
+	}
+	if err := s.chats.SetVariables(ctx, sessionID, env.Vars); err != nil {
+		log.Printf("save macro variables session=%s err=%v", sessionID, err)
+	}
+}
+
+// Variables returns the session's macro variables.
+func (s *Service) Variables(ctx context.Context, actor authz.Actor, sessionID string) (map[string]string, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Variables == nil {
+		return map[string]string{}, nil
+	}
+	return session.Variables, nil
+}
+
+// SetVariables replaces the session's macro variables, e.g. to reset a counter.
+func (s *Service) SetVariables(ctx context.Context, actor authz.Actor, sessionID string, vars map[string]string) (map[string]string, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := macro.ValidateVars(vars); err != nil {
+		return nil, err
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	if err := s.chats.SetVariables(ctx, session.ID, vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
@@ -0,0 +1,247 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/repository"
+)
+
+// fakeChats holds one session, s1, that "owner" has with role r1, message m1 and one current
+// chapter summary. Looking up session or message "broken" fails like a database error.
+type fakeChats struct {
+	chatStore
+	writes int
+}
+
+var errBroken = errors.New("connection reset")
+
+func (f *fakeChats) FindSession(_ context.Context, id string) (*model.ChatSession, error) {
+	if id == "broken" {
+		return nil, errBroken
+	}
+	if id != "s1" {
+		return nil, nil
+	}
+	return &model.ChatSession{ID: "s1", UserID: "owner", RoleID: "r1", Variables: map[string]string{"mood": "calm"}}, nil
+}
+
+func (f *fakeChats) FindSessionByMessage(ctx context.Context, messageID string) (*model.ChatSession, error) {
+	switch messageID {
+	case "m1":
+		return f.FindSession(ctx, "s1")
+	case "broken":
+		return nil, errBroken
+	}
+	return nil, nil
+}
+
+func (f *fakeChats) CurrentSummaries(_ context.Context, sessionID string) ([]model.ChatSummary, error) {
+	return []model.ChatSummary{{ID: "c1", SessionID: sessionID, Level: "chapter", Content: "They met."}}, nil
+}
+
+func (f *fakeChats) CountMessagesAfter(context.Context, string, string) (int, bool, error) {
+	return 0, true, nil
+}
+
+func (f *fakeChats) SummaryVersions(context.Context, string, int) ([]model.ChatSummary, error) {
+	return nil, nil
+}
+
+func (f *fakeChats) ListMessages(context.Context, string, int) ([]model.ChatMessage, error) {
+	return nil, nil
+}
+
+func (f *fakeChats) SaveSummaries(context.Context, repository.SummaryChange) error {
+	f.writes++
+	return nil
+}
+
+func (f *fakeChats) ResetSummaries(context.Context, string) error { f.writes++; return nil }
+
+func (f *fakeChats) SetPersona(context.Context, string, string) error { f.writes++; return nil }
+
+func (f *fakeChats) SetVariables(context.Context, string, map[string]string) error {
+	f.writes++
+	return nil
+}
+
+func (f *fakeChats) UpdateMessageContent(context.Context, string, string, string) error {
+	f.writes++
+	return nil
+}
+
+func (f *fakeChats) DeleteMessage(context.Context, string, string) error { f.writes++; return nil }
+
+func (f *fakeChats) ListSiblings(context.Context, string) ([]model.ChatMessage, error) {
+	return nil, nil
+}
+
+func (f *fakeChats) ActivateMessage(context.Context, string, string) error { f.writes++; return nil }
+
+func (f *fakeChats) ForkAt(context.Context, string, string) error { f.writes++; return nil }
+
+func (f *fakeChats) DeleteMessagesBySession(context.Context, string) error { f.writes++; return nil }
+
+func (f *fakeChats) DeleteSession(context.Context, string) error { f.writes++; return nil }
+
+func (f *fakeChats) ListPath(context.Context, string, int) ([]model.ChatMessage, error) {
+	return nil, nil
+}
+
+func (f *fakeChats) UpdateSettings(_ context.Context, sessionID, mode, modelKey string, settings model.ChatSessionSettings) (*model.ChatSession, error) {
+	f.writes++
+	return &model.ChatSession{ID: sessionID, Mode: mode, ModelKey: modelKey, Settings: settings}, nil
+}
+
+type fakeRoles struct{}
+
+func (fakeRoles) FindByID(_ context.Context, id string) (*model.Role, error) {
+	return &model.Role{ID: id, Name: "Aria", CreatorID: "creator"}, nil
+}
+
+// messageIn names the message held by the session: m1 for s1, and m2, which does not exist, for s2.
+func messageIn(sessionID string) string {
+	if sessionID == "broken" {
+		return sessionID
+	}
+	return "m" + strings.TrimPrefix(sessionID, "s")
+}
+
+func newOwnershipService(chats *fakeChats) *Service {
+	return &Service{chats: chats, roles: fakeRoles{}, generations: map[string]context.CancelCauseFunc{}}
+}
+
+func TestSessionOwnership(t *testing.T) {
+	ctx := context.Background()
+	ops := []struct {
+		name string
+		call func(s *Service, actor authz.Actor, sessionID string) error
+		// allowedErr is the error an allowed caller gets; the tests run without a job queue.
+		allowedErr string
+	}{
+		{name: "Summary", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.Summary(ctx, a, id)
+			return err
+		}},
+		{name: "SummaryVersions", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.SummaryVersions(ctx, a, id)
+			return err
+		}},
+		{name: "EditSummary", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.EditSummary(ctx, a, id, "c1", "They met at the harbour.")
+			return err
+		}},
+		{name: "RegenerateSummary", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.RegenerateSummary(ctx, a, id)
+			return err
+		}, allowedErr: "job queue not configured"},
+		{name: "SetSessionPersona", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.SetSessionPersona(ctx, a, id, "")
+			return err
+		}},
+		{name: "Variables", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.Variables(ctx, a, id)
+			return err
+		}},
+		{name: "SetVariables", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.SetVariables(ctx, a, id, map[string]string{"mood": "tense"})
+			return err
+		}},
+		{name: "History", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.History(ctx, a, id)
+			return err
+		}},
+		{name: "UpdateMessage", call: func(s *Service, a authz.Actor, id string) error {
+			return s.UpdateMessage(ctx, a, messageIn(id), "edited")
+		}},
+		{name: "DeleteMessage", call: func(s *Service, a authz.Actor, id string) error {
+			return s.DeleteMessage(ctx, a, messageIn(id))
+		}},
+		{name: "MessageCandidates", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.MessageCandidates(ctx, a, messageIn(id))
+			return err
+		}},
+		{name: "SelectMessage", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.SelectMessage(ctx, a, messageIn(id))
+			return err
+		}},
+		{name: "ForkFromMessage", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.ForkFromMessage(ctx, a, messageIn(id))
+			return err
+		}},
+		{name: "RetryAssistantMessage", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.RetryAssistantMessage(ctx, a, messageIn(id))
+			return err
+		}, allowedErr: "message not found"},
+		{name: "ClearSession", call: func(s *Service, a authz.Actor, id string) error {
+			return s.ClearSession(ctx, a, id)
+		}},
+		{name: "DeleteSession", call: func(s *Service, a authz.Actor, id string) error {
+			return s.DeleteSession(ctx, a, id)
+		}},
+		{name: "StopGeneration", call: func(s *Service, a authz.Actor, id string) error {
+			return s.StopGeneration(ctx, a, id)
+		}, allowedErr: "no generation in progress"},
+		{name: "SessionOverview", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.SessionOverview(ctx, a, id)
+			return err
+		}},
+		{name: "UpdateSettings", call: func(s *Service, a authz.Actor, id string) error {
+			_, err := s.UpdateSettings(ctx, a, id, "sfw", "", SettingsPatch{})
+			return err
+		}},
+		{name: "ContextPreview", call: func(s *Service, a authz.Actor, id string) error {
+			// Without its role the preview stops right after the ownership check.
+			s.roles = noRoles{}
+			_, err := s.ContextPreview(ctx, a, id, "draft")
+			return err
+		}, allowedErr: "role not found"},
+	}
+	actors := []struct {
+		name    string
+		actor   authz.Actor
+		allowed bool
+	}{
+		{"owner", authz.Actor{UserID: "owner"}, true},
+		{"non-owner", authz.Actor{UserID: "stranger"}, false},
+		{"admin", authz.Actor{UserID: "admin", IsAdmin: true}, true},
+		{"anonymous", authz.Actor{}, false},
+	}
+	for _, op := range ops {
+		for _, a := range actors {
+			t.Run(op.name+"/"+a.name, func(t *testing.T) {
+				chats := &fakeChats{}
+				err := op.call(newOwnershipService(chats), a.actor, "s1")
+				if a.allowed {
+					if (op.allowedErr == "" && err != nil) || (op.allowedErr != "" && (err == nil || err.Error() != op.allowedErr)) {
+						t.Fatalf("err = %v, want %q", err, op.allowedErr)
+					}
+					return
+				}
+				if !errors.Is(err, authz.ErrForbidden) {
+					t.Fatalf("err = %v, want ErrForbidden", err)
+				}
+				if chats.writes != 0 {
+					t.Fatalf("denied call wrote %d times", chats.writes)
+				}
+			})
+		}
+		t.Run(op.name+"/missing", func(t *testing.T) {
+			err := op.call(newOwnershipService(&fakeChats{}), authz.Actor{UserID: "owner"}, "s2")
+			if !errors.Is(err, authz.ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+		})
+		t.Run(op.name+"/lookup error", func(t *testing.T) {
+			err := op.call(newOwnershipService(&fakeChats{}), authz.Actor{UserID: "owner"}, "broken")
+			if !errors.Is(err, errBroken) {
+				t.Fatalf("err = %v, want the lookup error", err)
+			}
+		})
+	}
+}
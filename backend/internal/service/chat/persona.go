@@ -0,0 +1,42 @@
+package chat
+
+import (
+	"context"
+	"log"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+)
+
+// sessionPersona returns who the user plays in the session: its override, else their default
+// persona. Lookup errors are logged and treated as no persona so the chat keeps working.
+func (s *Service) sessionPersona(ctx context.Context, session *model.ChatSession) *model.Persona {
+	if s.personas == nil {
+		return nil
+	}
+	p, err := s.personas.Resolve(ctx, session.UserID, session.PersonaID)
+	if err != nil {
+		log.Printf("resolve persona session=%s err=%v", session.ID, err)
+		return nil
+	}
+	return p
+}
+
+// SetSessionPersona overrides the persona for one session; an empty personaID returns the session
+// to the user's default persona.
+func (s *Service) SetSessionPersona(ctx context.Context, actor authz.Actor, sessionID, personaID string) (*SessionView, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if personaID != "" {
+		// The persona must belong to the session's user, even when an admin makes the change.
+		if _, err := s.personas.Owned(ctx, session.UserID, personaID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.chats.SetPersona(ctx, session.ID, personaID); err != nil {
+		return nil, err
+	}
+	return s.SessionOverview(ctx, actor, session.ID)
+}
@@ -8,19 +8,38 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+	"github.com/example/ai-avatar-studio/internal/pkg/macro"
 	"github.com/example/ai-avatar-studio/internal/pkg/redisclient"
 	"github.com/example/ai-avatar-studio/internal/repository"
 	"github.com/example/ai-avatar-studio/internal/service/revenue"
 	"github.com/example/ai-avatar-studio/internal/service/memory"
+	"github.com/example/ai-avatar-studio/internal/service/persona"
 	"github.com/example/ai-avatar-studio/internal/service/rag"
+	"github.com/example/ai-avatar-studio/internal/task"
+	"github.com/google/uuid"
 )
 
 var debugPrompt = strings.EqualFold(os.Getenv("DEBUG_PROMPT"), "true")
 
+// holdTTL bounds how long reserved coins stay locked if the process dies before settling a call.
+const holdTTL = 10 * time.Minute
+
+// defaultHoldCompletionTokens sizes the hold for token-priced models without a max_tokens cap.
+const defaultHoldCompletionTokens = 2048
+
+var errEmptyReply = errors.New("模型未返回内容，本次不扣费")
+
+var (
+	errGenerationInProgress = errors.New("当前会话正在生成回复，请稍后")
+	errGenerationStopped    = errors.New("生成已中断")
+)
+
 const systemPrompt = `You are an immersive roleplay assistant inside the Nebula chat app. Follow these rules in every reply:
 
 Core Persona
@@ -56,17 +75,54 @@ Output Format
 
 // Service orchestrates prompts, RAG, memory, and persistence for chat sessions.
 type Service struct {
-	chats          *repository.ChatRepository
-	roles          *repository.RoleRepository
+	chats          chatStore
+	roles          roleFinder
 	worlds         *repository.WorldbookRepository
 	configs        *repository.ConfigRepository
 	rag            *rag.Service
 	memories       *memory.Service
+	personas       *persona.Service
 	cache          *redisclient.Client
 	llm            llmclient.Client
+	breaker        *llmclient.Breaker
+	jobs           *task.Queue
 	defaultModelID string
 	assets         *repository.UserAssetRepository
 	revenue        *revenue.Service
+
+	genMu       sync.Mutex
+	generations map[string]context.CancelCauseFunc // session ID -> cancel of the in-flight generation
+}
+
+// chatStore is the part of repository.ChatRepository the service uses.
+type chatStore interface {
+	ActivateMessage(ctx context.Context, sessionID, messageID string) error
+	AddMessage(ctx context.Context, msg *model.ChatMessage) error
+	CountMessagesAfter(ctx context.Context, sessionID, afterID string) (count int, found bool, err error)
+	CreateSession(ctx context.Context, session *model.ChatSession) error
+	CurrentSummaries(ctx context.Context, sessionID string) ([]model.ChatSummary, error)
+	DeleteMessage(ctx context.Context, id, sessionID string) error
+	DeleteMessagesBySession(ctx context.Context, sessionID string) error
+	DeleteSession(ctx context.Context, sessionID string) error
+	FindSession(ctx context.Context, id string) (*model.ChatSession, error)
+	FindSessionByMessage(ctx context.Context, messageID string) (*model.ChatSession, error)
+	ForkAt(ctx context.Context, sessionID, messageID string) error
+	ListMessages(ctx context.Context, sessionID string, limit int) ([]model.ChatMessage, error)
+	ListMessagesAfter(ctx context.Context, sessionID, afterID string, limit int) ([]model.ChatMessage, error)
+	ListPath(ctx context.Context, messageID string, limit int) ([]model.ChatMessage, error)
+	ListSessionsByUser(ctx context.Context, userID string, limit int) ([]model.ChatSession, error)
+	ListSiblings(ctx context.Context, messageID string) ([]model.ChatMessage, error)
+	ResetSummaries(ctx context.Context, sessionID string) error
+	SaveSummaries(ctx context.Context, change repository.SummaryChange) error
+	SetPersona(ctx context.Context, sessionID, personaID string) error
+	SetVariables(ctx context.Context, sessionID string, vars map[string]string) error
+	SummaryVersions(ctx context.Context, sessionID string, limit int) ([]model.ChatSummary, error)
+	UpdateMessageContent(ctx context.Context, id, sessionID, content string) error
+	UpdateSettings(ctx context.Context, sessionID, mode, modelKey string, settings model.ChatSessionSettings) (*model.ChatSession, error)
+}
+
+type roleFinder interface {
+	FindByID(ctx context.Context, id string) (*model.Role, error)
 }
 
 func NewService(
@@ -76,8 +132,11 @@ func NewService(
 	configs *repository.ConfigRepository,
 	rag *rag.Service,
 	memories *memory.Service,
+	personas *persona.Service,
 	cache *redisclient.Client,
 	llm llmclient.Client,
+	breaker *llmclient.Breaker,
+	jobs *task.Queue,
 	defaultModelID string,
 	assets *repository.UserAssetRepository,
 	revenue *revenue.Service,
@@ -89,17 +148,22 @@ func NewService(
 		configs:        configs,
 		rag:            rag,
 		memories:       memories,
+		personas:       personas,
 		cache:          cache,
 		llm:            llm,
+		breaker:        breaker,
+		jobs:           jobs,
 		defaultModelID: defaultModelID,
 		assets:         assets,
 		revenue:        revenue,
+		generations:    map[string]context.CancelCauseFunc{},
 	}
 }
 
 type SessionView struct {
 	Session  *model.ChatSession  `json:"session"`
 	Role     *model.Role         `json:"role"`
+	Persona  *model.Persona      `json:"persona,omitempty"` // who the user plays; nil when they have none
 	World    *model.WorldSummary `json:"world"`
 	Messages []model.ChatMessage `json:"messages"`
 }
@@ -151,294 +215,409 @@ func (s *Service) ListSessions(ctx context.Context, userID string) ([]model.Chat
 	return s.chats.ListSessionsByUser(ctx, userID, 20)
 }
 
-func (s *Service) History(ctx context.Context, userID, sessionID string) ([]model.ChatMessage, error) {
-	session, err := s.chats.FindSession(ctx, sessionID)
-	if err != nil || session == nil {
-		return nil, errors.New("session not found")
-	}
-	if session.UserID != userID {
-		return nil, errors.New("forbidden")
+func (s *Service) History(ctx context.Context, actor authz.Actor, sessionID string) ([]model.ChatMessage, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
 	}
 	return s.chats.ListMessages(ctx, session.ID, 100)
 }
 
-func (s *Service) UpdateMessage(ctx context.Context, userID, messageID, content string) error {
+func (s *Service) UpdateMessage(ctx context.Context, actor authz.Actor, messageID, content string) error {
 	if strings.TrimSpace(content) == "" {
 		return errors.New("content required")
 	}
-	msgSession, err := s.chats.FindSessionByMessage(ctx, messageID)
+	msgSession, err := s.messageSession(ctx, actor, messageID)
 	if err != nil {
 		return err
 	}
-	if msgSession == nil {
-		return errors.New("message not found")
-	}
-	if msgSession.UserID != userID {
-		return errors.New("forbidden")
-	}
 	return s.chats.UpdateMessageContent(ctx, messageID, msgSession.ID, content)
 }
 
-func (s *Service) DeleteMessage(ctx context.Context, userID, messageID string) error {
-	msgSession, err := s.chats.FindSessionByMessage(ctx, messageID)
+func (s *Service) DeleteMessage(ctx context.Context, actor authz.Actor, messageID string) error {
+	msgSession, err := s.messageSession(ctx, actor, messageID)
 	if err != nil {
 		return err
 	}
-	if msgSession == nil {
-		return errors.New("message not found")
-	}
-	if msgSession.UserID != userID {
-		return errors.New("forbidden")
-	}
 	return s.chats.DeleteMessage(ctx, messageID, msgSession.ID)
 }
 
-func (s *Service) ClearSession(ctx context.Context, userID, sessionID string) error {
-	session, err := s.chats.FindSession(ctx, sessionID)
-	if err != nil || session == nil {
-		return errors.New("session not found")
+// MessageCandidates lists the alternatives sharing the message's parent, for swiping.
+func (s *Service) MessageCandidates(ctx context.Context, actor authz.Actor, messageID string) ([]model.ChatMessage, error) {
+	if _, err := s.messageSession(ctx, actor, messageID); err != nil {
+		return nil, err
 	}
-	if session.UserID != userID {
-		return errors.New("forbidden")
+	return s.chats.ListSiblings(ctx, messageID)
+}
+
+// SelectMessage makes the candidate active and returns the resulting active path.
+func (s *Service) SelectMessage(ctx context.Context, actor authz.Actor, messageID string) ([]model.ChatMessage, error) {
+	session, err := s.messageSession(ctx, actor, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.chats.ActivateMessage(ctx, session.ID, messageID); err != nil {
+		return nil, err
 	}
-	return s.chats.DeleteMessagesBySession(ctx, sessionID)
+	return s.chats.ListMessages(ctx, session.ID, 100)
 }
 
-func (s *Service) DeleteSession(ctx context.Context, userID, sessionID string) error {
-	session, err := s.chats.FindSession(ctx, sessionID)
-	if err != nil || session == nil {
-		return errors.New("session not found")
+// ForkFromMessage makes the message the tip of the active path; the next message starts a new
+// branch from it while the old continuation stays selectable.
+func (s *Service) ForkFromMessage(ctx context.Context, actor authz.Actor, messageID string) ([]model.ChatMessage, error) {
+	session, err := s.messageSession(ctx, actor, messageID)
+	if err != nil {
+		return nil, err
 	}
-	if session.UserID != userID {
-		return errors.New("forbidden")
+	if err := s.chats.ForkAt(ctx, session.ID, messageID); err != nil {
+		return nil, err
 	}
-	// Cascade removes chat messages and related image jobs tied to the session.
-	return s.chats.DeleteSession(ctx, sessionID)
+	return s.chats.ListMessages(ctx, session.ID, 100)
 }
 
-// RetryAssistantMessage regenerates an assistant reply in-place without duplicating the user message.
-func (s *Service) RetryAssistantMessage(ctx context.Context, userID, messageID string) ([]model.ChatMessage, error) {
+// messageSession returns the session holding the message once the actor may act on it.
+func (s *Service) messageSession(ctx context.Context, actor authz.Actor, messageID string) (*model.ChatSession, error) {
 	if strings.TrimSpace(messageID) == "" {
-		return nil, errors.New("message not found")
+		return nil, authz.ErrNotFound
 	}
 	msgSession, err := s.chats.FindSessionByMessage(ctx, messageID)
-	if err != nil || msgSession == nil {
-		return nil, errors.New("message not found")
+	if err != nil {
+		return nil, err
+	}
+	if msgSession == nil {
+		return nil, authz.ErrNotFound
+	}
+	if err := authz.RequireOwner(actor, msgSession.UserID); err != nil {
+		return nil, err
+	}
+	return msgSession, nil
+}
+
+func (s *Service) ClearSession(ctx context.Context, actor authz.Actor, sessionID string) error {
+	if _, err := s.ownedSession(ctx, actor, sessionID); err != nil {
+		return err
 	}
-	if msgSession.UserID != userID {
-		return nil, errors.New("forbidden")
+	if err := s.chats.DeleteMessagesBySession(ctx, sessionID); err != nil {
+		return err
 	}
+	return s.chats.ResetSummaries(ctx, sessionID)
+}
 
-	history, err := s.chats.ListMessages(ctx, msgSession.ID, 100)
+func (s *Service) DeleteSession(ctx context.Context, actor authz.Actor, sessionID string) error {
+	if _, err := s.ownedSession(ctx, actor, sessionID); err != nil {
+		return err
+	}
+	// Cascade removes chat messages and related image jobs tied to the session.
+	return s.chats.DeleteSession(ctx, sessionID)
+}
+
+// RetryAssistantMessage generates an alternative to an assistant reply as a new sibling candidate
+// ("swipe") and makes it active; the previous reply and any branch after it are kept.
+func (s *Service) RetryAssistantMessage(ctx context.Context, actor authz.Actor, messageID string) ([]model.ChatMessage, error) {
+	msgSession, err := s.messageSession(ctx, actor, messageID)
 	if err != nil {
 		return nil, err
 	}
-	targetIdx := -1
-	for i, m := range history {
-		if m.ID == messageID {
-			if strings.ToLower(m.Role) != "assistant" {
-				return nil, errors.New("只能重试 AI 回复")
-			}
-			targetIdx = i
-			break
-		}
+	// The caller pays for the retry.
+	userID := actor.UserID
+	genCtx, finish, err := s.beginGeneration(ctx, msgSession.ID)
+	if err != nil {
+		return nil, err
 	}
-	if targetIdx == -1 {
+	defer finish()
+
+	// The path ends with the target; everything before it is the context of the new candidate.
+	path, err := s.chats.ListPath(ctx, messageID, 100)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
 		return nil, errors.New("message not found")
 	}
+	target := path[len(path)-1]
+	if strings.ToLower(target.Role) != "assistant" {
+		return nil, errors.New("只能重试 AI 回复")
+	}
+	historyForLLM := path[:len(path)-1]
 
 	role, err := s.roles.FindByID(ctx, msgSession.RoleID)
 	if err != nil || role == nil {
 		return nil, errors.New("role not found")
 	}
-	var worldSummary *model.WorldSummary
-	if s.worlds != nil {
-		if world, err := s.worlds.FindByRole(ctx, role.ID); err == nil {
-			worldSummary = world.Summary()
-		}
-	}
 	modelCfg, err := s.resolveModel(ctx, msgSession.ModelKey)
 	if err != nil || modelCfg == nil {
 		return nil, fmt.Errorf("resolve model %s: %w", msgSession.ModelKey, err)
 	}
-	priceCoins := modelCfg.PriceCoins
-	if priceCoins < 0 {
-		priceCoins = 0
-	}
-	if priceCoins > 0 {
-		if s.assets == nil {
-			return nil, errors.New("billing service unavailable")
-		}
-		asset, err := s.assets.GetByUser(ctx, userID)
-		if err != nil {
-			return nil, err
-		}
-		if asset.Balance < priceCoins {
-			return nil, errors.New("余额不足，请前往充值")
-		}
-	}
 
-	ragCtx, _ := s.rag.RetrieveContext(ctx, role.ID)
-	mems, _ := s.memories.List(ctx, userID, role.ID)
-	var memo []string
-	for _, m := range mems {
-		memo = append(memo, m.Content)
-	}
-	prompt := buildPromptWithUserPreset(role, worldSummary, ragCtx, strings.Join(memo, "\n"), msgSession.Settings, msgSession.Mode, msgSession.Summary, nil)
+	chain := s.modelChain(ctx, modelCfg)
+	// Variables set while rendering are not saved: the original reply already applied that turn.
+	window := s.buildContext(ctx, msgSession, role, chain, historyForLLM, latestUserContent(historyForLLM), nil)
+	messages := window.Messages
 
-	// Exclude the target assistant message from the context so the model won't see the previous reply.
-	historyForLLM := append([]model.ChatMessage{}, history[:targetIdx]...)
-	if targetIdx+1 < len(history) {
-		historyForLLM = append(historyForLLM, history[targetIdx+1:]...)
+	logPrompt(msgSession.ID, userID, modelCfg.ID, target.Content, messages)
+
+	// Every retry is a separate charge. Its ledger entries are keyed by the hold ID, and the capture
+	// moves the hold's ref to the new candidate, so a replayed capture cannot bill twice.
+	hold, err := s.holdModelCall(ctx, userID, messageID, chainHoldAmount(chain, messages))
+	if err != nil {
+		return nil, err
 	}
-	logPromptWithHistory(msgSession.ID, userID, modelCfg.ID, history[targetIdx].Content, prompt, historyForLLM)
+	captured := false
+	defer func() {
+		if !captured {
+			s.releaseHold(hold)
+		}
+	}()
 
-	reply, err := s.llm.Generate(ctx, prompt, modelCfg, historyForLLM)
+	out, served, err := s.callWithFallback(genCtx, chain, nil, func(callCtx context.Context, cfg *model.ModelConfig) (llmclient.Completion, error) {
+		return s.llm.Generate(callCtx, messages, cfg)
+	})
 	if err != nil {
+		if stoppedByUser(genCtx) {
+			return nil, errGenerationStopped
+		}
 		log.Printf("llm retry failed session=%s model=%s provider=%s err=%v", msgSession.ID, modelCfg.ID, modelCfg.Provider, err)
 		return nil, fmt.Errorf("model %s generate failed: %w", modelCfg.ID, err)
 	}
+	reply := out.Content
+	if strings.TrimSpace(reply) == "" {
+		return nil, errEmptyReply
+	}
 
-	if err := s.chats.UpdateMessageContent(ctx, messageID, msgSession.ID, reply); err != nil {
+	// Bill the model that actually answered.
+	cost := served.CallCost(out.Usage.PromptTokens, out.Usage.CompletionTokens)
+	candidate := &model.ChatMessage{
+		SessionID: msgSession.ID,
+		ParentID:  target.ParentID,
+		Role:      "assistant",
+		Content:   reply,
+		Metadata:  servedMetadata(modelCfg, served, out.Usage, cost),
+	}
+	if out.FinishReason != "" {
+		candidate.Metadata["finish_reason"] = out.FinishReason
+	}
+	if out.Truncated() {
+		candidate.Metadata["truncated"] = true
+	}
+	if err := s.chats.AddMessage(ctx, candidate); err != nil {
 		return nil, err
 	}
 
-	// deduct coins after successful generation
-	if priceCoins > 0 && s.assets != nil {
-		if asset, err := s.assets.GetByUser(ctx, userID); err == nil {
-			if asset.Balance < priceCoins {
-				return nil, errors.New("余额不足，请前往充值")
-			}
-			asset.Balance -= priceCoins
-			_ = s.assets.Upsert(ctx, asset)
+	// capture the hold now that the reply is persisted
+	if hold != nil {
+		settled, err := s.captureHold(hold, cost, candidate.ID)
+		if err != nil {
+			return nil, err
 		}
+		captured = true
 		if s.revenue != nil {
-			roleShare := int64(float64(priceCoins) * modelCfg.ShareRolePct)
+			roleShare := int64(float64(settled.CapturedAmount) * served.ShareRolePct)
 			if roleShare > 0 && role.CreatorID != "" {
 				_, _, _ = s.revenue.RecordEvent(ctx, role.CreatorID, userID, role.ID, "model_call_role", roleShare)
 			}
 		}
 	}
 
-	history[targetIdx].Content = reply
 	if s.cache != nil {
 		_ = s.cache.Remember(ctx, "chat:last:"+msgSession.ID, reply, time.Hour)
 	}
-	return history, nil
+	return s.chats.ListMessages(ctx, msgSession.ID, 100)
+}
+
+func (s *Service) SendMessage(ctx context.Context, actor authz.Actor, sessionID, content string, userPreset *model.Preset) ([]model.ChatMessage, error) {
+	return s.sendMessageInternal(ctx, actor, sessionID, content, userPreset, false, nil)
+}
+
+func (s *Service) SendMessageStream(ctx context.Context, actor authz.Actor, sessionID, content string, userPreset *model.Preset, onChunk func(contentDelta, reasoningDelta string)) ([]model.ChatMessage, error) {
+	return s.sendMessageInternal(ctx, actor, sessionID, content, userPreset, true, onChunk)
 }
 
-func (s *Service) SendMessage(ctx context.Context, userID, sessionID, content string, userPreset *model.Preset) ([]model.ChatMessage, error) {
-	return s.sendMessageInternal(ctx, userID, sessionID, content, userPreset, false, nil)
+func (s *Service) sendMessageInternal(ctx context.Context, actor authz.Actor, sessionID, content string, userPreset *model.Preset, stream bool, onChunk func(contentDelta, reasoningDelta string)) ([]model.ChatMessage, error) {
+	turn, err := s.prepareTurn(ctx, actor, sessionID, content, userPreset)
+	if err != nil {
+		return nil, err
+	}
+	return s.runTurn(ctx, turn, stream, onChunk)
 }
 
-func (s *Service) SendMessageStream(ctx context.Context, userID, sessionID, content string, userPreset *model.Preset, onChunk func(contentDelta, reasoningDelta string)) ([]model.ChatMessage, error) {
-	return s.sendMessageInternal(ctx, userID, sessionID, content, userPreset, true, onChunk)
+// pendingTurn is a user turn that passed its pre-flight checks: the session's generation is
+// registered and the coins are held. runTurn or abort must follow exactly once. userID is the
+// caller, who pays for the turn.
+type pendingTurn struct {
+	userID, content string
+	userPreset      *model.Preset
+	session         *model.ChatSession
+	role            *model.Role
+	modelCfg        *model.ModelConfig
+	chain           []*model.ModelConfig
+	history         []model.ChatMessage
+	userMsg         *model.ChatMessage
+	window          *ContextWindow
+	hold            *model.CoinHold
+	genCtx          context.Context
+	finish          func()
 }
 
-func (s *Service) sendMessageInternal(ctx context.Context, userID, sessionID, content string, userPreset *model.Preset, stream bool, onChunk func(contentDelta, reasoningDelta string)) ([]model.ChatMessage, error) {
+// prepareTurn runs everything that can reject a turn before anything is stored or streamed.
+func (s *Service) prepareTurn(ctx context.Context, actor authz.Actor, sessionID, content string, userPreset *model.Preset) (*pendingTurn, error) {
 	if strings.TrimSpace(content) == "" {
 		return nil, errors.New("empty message")
 	}
-	session, err := s.chats.FindSession(ctx, sessionID)
-	if err != nil || session == nil {
-		return nil, errors.New("session not found")
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
 	}
-	if session.UserID != userID {
-		return nil, errors.New("forbidden")
+	genCtx, finish, err := s.beginGeneration(ctx, session.ID)
+	if err != nil {
+		return nil, err
 	}
-	userMsg := &model.ChatMessage{SessionID: session.ID, Role: "user", Content: content}
+	turn := &pendingTurn{userID: actor.UserID, content: content, userPreset: userPreset, session: session, genCtx: genCtx, finish: finish}
+	if err := s.preflight(ctx, turn); err != nil {
+		finish()
+		return nil, err
+	}
+	return turn, nil
+}
+
+func (s *Service) preflight(ctx context.Context, turn *pendingTurn) error {
+	session := turn.session
+	turn.userMsg = &model.ChatMessage{SessionID: session.ID, Role: "user", Content: turn.content}
 	role, err := s.roles.FindByID(ctx, session.RoleID)
 	if err != nil || role == nil {
-		return nil, errors.New("role not found")
-	}
-	var presetCreator string
-	if userPreset != nil {
-		presetCreator = userPreset.CreatorID
-	}
-	var worldSummary *model.WorldSummary
-	if s.worlds != nil {
-		if world, err := s.worlds.FindByRole(ctx, role.ID); err == nil {
-			worldSummary = world.Summary()
-		}
+		return errors.New("role not found")
 	}
+	turn.role = role
 	modelCfg, err := s.resolveModel(ctx, session.ModelKey)
 	if err != nil || modelCfg == nil {
-		return nil, fmt.Errorf("resolve model %s: %w", session.ModelKey, err)
+		return fmt.Errorf("resolve model %s: %w", session.ModelKey, err)
 	}
-	priceCoins := modelCfg.PriceCoins
-	if priceCoins < 0 {
-		priceCoins = 0
+	turn.modelCfg = modelCfg
+	history, err := s.chats.ListMessages(ctx, session.ID, 100)
+	if err != nil {
+		return err
 	}
-	if priceCoins > 0 {
-		if s.assets == nil {
-			return nil, errors.New("billing service unavailable")
-		}
-		asset, err := s.assets.GetByUser(ctx, userID)
-		if err != nil {
-			return nil, err
-		}
-		if asset.Balance < priceCoins {
-			return nil, errors.New("余额不足，请前往充值")
-		}
+	// New turns continue the active path.
+	if len(history) > 0 {
+		turn.userMsg.ParentID = history[len(history)-1].ID
 	}
-	if err := s.chats.AddMessage(ctx, userMsg); err != nil {
-		return nil, err
+	turn.history = history
+	turn.chain = s.modelChain(ctx, modelCfg)
+	turn.window = s.buildContext(ctx, session, role, turn.chain, append(history, *turn.userMsg), turn.content, turn.userPreset)
+
+	// Reserve coins before the user message is stored so an empty wallet leaves no orphan turn.
+	turn.hold, err = s.holdModelCall(ctx, turn.userID, session.ID, chainHoldAmount(turn.chain, turn.window.Messages))
+	return err
+}
+
+// abortTurn gives up a prepared turn that will not run.
+func (s *Service) abortTurn(turn *pendingTurn) {
+	s.releaseHold(turn.hold)
+	turn.finish()
+}
+
+// runTurn stores the user message, calls the model and stores and bills the reply.
+func (s *Service) runTurn(ctx context.Context, turn *pendingTurn, stream bool, onChunk func(contentDelta, reasoningDelta string)) ([]model.ChatMessage, error) {
+	defer turn.finish()
+	userID, content, session, role, modelCfg := turn.userID, turn.content, turn.session, turn.role, turn.modelCfg
+	userMsg, history, window, chain, hold, genCtx := turn.userMsg, turn.history, turn.window, turn.chain, turn.hold, turn.genCtx
+	messages := window.Messages
+	var presetCreator string
+	if turn.userPreset != nil {
+		presetCreator = turn.userPreset.CreatorID
 	}
-	history, err := s.chats.ListMessages(ctx, session.ID, 100)
-	if err != nil {
+	captured := false
+	defer func() {
+		if !captured {
+			s.releaseHold(hold)
+		}
+	}()
+	if err := s.chats.AddMessage(ctx, userMsg); err != nil {
 		return nil, err
 	}
-	ragCtx, _ := s.rag.RetrieveContext(ctx, role.ID)
-	mems, _ := s.memories.List(ctx, userID, role.ID)
-	var memo []string
-	for _, m := range mems {
-		memo = append(memo, m.Content)
+	history = append(history, *userMsg)
+	if len(history) > 100 {
+		history = history[len(history)-100:]
 	}
-	prompt := buildPromptWithUserPreset(role, worldSummary, ragCtx, strings.Join(memo, "\n"), session.Settings, session.Mode, session.Summary, userPreset)
-	logPromptWithHistory(session.ID, userID, modelCfg.ID, content, prompt, history)
-	var reply string
-	var reasoningBuilder strings.Builder
+	logPrompt(session.ID, userID, modelCfg.ID, content, messages)
+	var out llmclient.Completion
+	var err error
+	var served *model.ModelConfig
+	var partial, reasoningBuilder strings.Builder
+	stopped := false
 	if stream && onChunk != nil {
-		err := s.llm.StreamGenerate(ctx, prompt, modelCfg, history, func(delta, reasoning string) {
-			reply += delta
-			if reasoning != "" {
-				reasoningBuilder.WriteString(reasoning)
-			}
-			onChunk(delta, reasoning)
+		emitted := false
+		out, served, err = s.callWithFallback(genCtx, chain, func() bool { return emitted }, func(callCtx context.Context, cfg *model.ModelConfig) (llmclient.Completion, error) {
+			return s.llm.StreamGenerate(callCtx, messages, cfg, func(delta, reasoning string) {
+				emitted = true
+				partial.WriteString(delta)
+				if reasoning != "" {
+					reasoningBuilder.WriteString(reasoning)
+				}
+				onChunk(delta, reasoning)
+			})
 		})
+		if err != nil && stoppedByUser(genCtx) {
+			// Keep whatever was streamed before the stop; the provider sends no usage for it.
+			out = llmclient.Completion{Content: partial.String(), Usage: llmclient.EstimateUsage(messages, partial.String())}
+			stopped, err = true, nil
+			if served == nil {
+				served = modelCfg
+			}
+		}
 		if err != nil {
 			log.Printf("llm stream failed session=%s model=%s provider=%s err=%v", session.ID, modelCfg.ID, modelCfg.Provider, err)
 			return nil, fmt.Errorf("model %s stream failed: %w", modelCfg.ID, err)
 		}
 	} else {
-		r, err := s.llm.Generate(ctx, prompt, modelCfg, history)
+		out, served, err = s.callWithFallback(genCtx, chain, nil, func(callCtx context.Context, cfg *model.ModelConfig) (llmclient.Completion, error) {
+			return s.llm.Generate(callCtx, messages, cfg)
+		})
 		if err != nil {
+			if stoppedByUser(genCtx) {
+				return nil, errGenerationStopped
+			}
 			log.Printf("llm generate failed session=%s model=%s provider=%s err=%v", session.ID, modelCfg.ID, modelCfg.Provider, err)
 			return nil, fmt.Errorf("model %s generate failed: %w", modelCfg.ID, err)
 		}
-		reply = r
 	}
-	meta := map[string]interface{}{}
+	reply := out.Content
+	if strings.TrimSpace(reply) == "" {
+		if stopped {
+			return nil, errGenerationStopped
+		}
+		return nil, errEmptyReply
+	}
+	// Bill the model that actually answered.
+	cost := served.CallCost(out.Usage.PromptTokens, out.Usage.CompletionTokens)
+	meta := servedMetadata(modelCfg, served, out.Usage, cost)
+	if stopped {
+		meta["stopped"] = true
+	}
+	if out.FinishReason != "" {
+		meta["finish_reason"] = out.FinishReason
+	}
+	if out.Truncated() {
+		// Cut off by max_tokens: the UI offers "continue".
+		meta["truncated"] = true
+	}
 	if reasoningBuilder.Len() > 0 {
 		meta["reasoning_text"] = reasoningBuilder.String()
 	}
-	botMsg := &model.ChatMessage{SessionID: session.ID, Role: "assistant", Content: reply, Metadata: meta}
+	botMsg := &model.ChatMessage{SessionID: session.ID, ParentID: userMsg.ID, Role: "assistant", Content: reply, Metadata: meta}
 	if err := s.chats.AddMessage(ctx, botMsg); err != nil {
 		return nil, err
 	}
-	// deduct coins after successful generation
-	if priceCoins > 0 && s.assets != nil {
-		if asset, err := s.assets.GetByUser(ctx, userID); err == nil {
-			if asset.Balance < priceCoins {
-				return nil, errors.New("余额不足，请前往充值")
-			}
-			asset.Balance -= priceCoins
-			_ = s.assets.Upsert(ctx, asset)
+	// capture the hold now that the reply is persisted
+	if hold != nil {
+		settled, err := s.captureHold(hold, cost, botMsg.ID)
+		if err != nil {
+			return nil, err
 		}
-		// 分账到创作者/预设作者钱包（与用户资产不同账本）
+		captured = true
+		// 分账到创作者/预设作者钱包（与用户资产不同账本），按实际扣费计算
 		if s.revenue != nil {
-			roleShare := int64(float64(priceCoins) * modelCfg.ShareRolePct)
-			presetShare := int64(float64(priceCoins) * modelCfg.SharePresetPct)
+			roleShare := int64(float64(settled.CapturedAmount) * served.ShareRolePct)
+			presetShare := int64(float64(settled.CapturedAmount) * served.SharePresetPct)
 			if roleShare > 0 && role.CreatorID != "" {
 				_, _, _ = s.revenue.RecordEvent(ctx, role.CreatorID, userID, role.ID, "model_call_role", roleShare)
 			}
@@ -452,77 +631,207 @@ func (s *Service) sendMessageInternal(ctx context.Context, userID, sessionID, co
 	if s.cache != nil {
 		_ = s.cache.Remember(ctx, "chat:last:"+session.ID, reply, time.Hour)
 	}
-	if strings.Contains(strings.ToLower(content), "remember") {
-		_ = s.memories.Remember(ctx, userID, role.ID, content)
+	s.saveVariables(ctx, session.ID, window.macros)
+	s.memories.EnqueueExtraction(ctx, session.UserID, role.ID, content, reply)
+	s.maybeSummarize(ctx, session)
+
+	return history, nil
+}
+
+// StopGeneration cancels the session's in-flight reply. A streamed reply keeps the text produced so far.
+// The reply may be running on another replica, which picks the stop up from Redis.
+func (s *Service) StopGeneration(ctx context.Context, actor authz.Actor, sessionID string) error {
+	if _, err := s.ownedSession(ctx, actor, sessionID); err != nil {
+		return err
 	}
-	// Auto-summarization trigger (every 5 turns = 10 messages)
-	if len(history)%10 == 0 {
-		go func() {
-			// Create a detached context for the background task
-			bgCtx := context.Background()
-			if err := s.summarizeHistory(bgCtx, session, history); err != nil {
-				log.Printf("auto-summarization failed session=%s err=%v", session.ID, err)
-			}
-		}()
+	s.genMu.Lock()
+	cancel, local := s.generations[sessionID]
+	s.genMu.Unlock()
+	if local {
+		cancel(errGenerationStopped)
+		return nil
 	}
+	if s.cache == nil {
+		return errors.New("no generation in progress")
+	}
+	token, err := s.cache.Fetch(ctx, generationMarkerKey(sessionID))
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.New("no generation in progress")
+	}
+	// The stop is keyed by the marker's token so it cannot cancel a later generation of the session.
+	return s.cache.Remember(ctx, generationStopKey(token), "1", generationMarkerTTL)
+}
 
-	return history, nil
+// beginGeneration registers a cancellable generation for the session; only one may run at a time.
+// With Redis the session is claimed there, so the limit holds across replicas.
+func (s *Service) beginGeneration(ctx context.Context, sessionID string) (context.Context, func(), error) {
+	token := uuid.NewString()
+	if s.cache != nil {
+		claimed, err := s.cache.Claim(ctx, generationMarkerKey(sessionID), token, generationMarkerTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !claimed {
+			return nil, nil, errGenerationInProgress
+		}
+	}
+	release := func() {
+		if s.cache == nil {
+			return
+		}
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.cache.Release(releaseCtx, generationMarkerKey(sessionID), token); err != nil {
+			log.Printf("chat: release generation marker failed session=%s err=%v", sessionID, err)
+		}
+	}
+	s.genMu.Lock()
+	if _, busy := s.generations[sessionID]; busy {
+		s.genMu.Unlock()
+		release()
+		return nil, nil, errGenerationInProgress
+	}
+	genCtx, cancel := context.WithCancelCause(ctx)
+	s.generations[sessionID] = cancel
+	s.genMu.Unlock()
+	if s.cache != nil {
+		go s.watchGeneration(genCtx, sessionID, token, cancel)
+	}
+	return genCtx, func() {
+		s.genMu.Lock()
+		delete(s.generations, sessionID)
+		s.genMu.Unlock()
+		cancel(nil)
+		release()
+	}, nil
 }
 
-func (s *Service) summarizeHistory(ctx context.Context, session *model.ChatSession, history []model.ChatMessage) error {
-	// Simple summarization prompt
-	prompt := "Summarize the following conversation in 2-3 sentences, focusing on key events and facts. Keep it concise.\n\n"
-	for _, msg := range history {
-		prompt += fmt.Sprintf("%s: %s\n", msg.Role, msg.Content)
+// watchGeneration keeps the session's marker alive while the generation runs and cancels it once
+// a stop is requested, possibly by another replica.
+func (s *Service) watchGeneration(genCtx context.Context, sessionID, token string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(generationStopPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-genCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		ctx := context.WithoutCancel(genCtx)
+		stop, err := s.cache.Fetch(ctx, generationStopKey(token))
+		if err != nil {
+			log.Printf("chat: poll generation stop failed session=%s err=%v", sessionID, err)
+			continue
+		}
+		if stop != "" {
+			cancel(errGenerationStopped)
+			return
+		}
+		if err := s.cache.Expire(ctx, generationMarkerKey(sessionID), generationMarkerTTL); err != nil {
+			log.Printf("chat: refresh generation marker failed session=%s err=%v", sessionID, err)
+		}
 	}
+}
+
+func stoppedByUser(genCtx context.Context) bool {
+	return errors.Is(context.Cause(genCtx), errGenerationStopped)
+}
 
-	// Use a lightweight model or the same model for summarization
-	modelCfg, _ := s.resolveModel(ctx, session.ModelKey)
-	summary, err := s.llm.Generate(ctx, prompt, modelCfg, nil)
+// holdAmount is the worst-case price of a call: the estimated prompt plus a reply of max_tokens.
+func holdAmount(cfg *model.ModelConfig, messages []llmclient.Message) int64 {
+	if !cfg.UsesTokenPricing() {
+		return cfg.CallCost(0, 0)
+	}
+	maxOut := cfg.MaxTokens
+	if maxOut <= 0 {
+		maxOut = defaultHoldCompletionTokens
+	}
+	return cfg.CallCost(llmclient.EstimatePromptTokens(messages), maxOut)
+}
+
+// usageMetadata is the usage record stored on the assistant message.
+func usageMetadata(usage llmclient.Usage, cost int64) map[string]interface{} {
+	return map[string]interface{}{
+		"prompt_tokens":     usage.PromptTokens,
+		"completion_tokens": usage.CompletionTokens,
+		"total_tokens":      usage.TotalTokens,
+		"estimated":         usage.Estimated,
+		"cost_coins":        cost,
+	}
+}
+
+// holdModelCall reserves the call price before the provider is invoked; a nil hold means the call is free.
+func (s *Service) holdModelCall(ctx context.Context, userID, refID string, coins int64) (*model.CoinHold, error) {
+	if coins <= 0 {
+		return nil, nil
+	}
+	if s.assets == nil {
+		return nil, errors.New("billing service unavailable")
+	}
+	hold, err := s.assets.Hold(ctx, userID, coins, refID, holdTTL)
+	if errors.Is(err, repository.ErrInsufficientBalance) {
+		return nil, errors.New("余额不足，请前往充值")
+	}
+	return hold, err
+}
+
+// captureHold settles the hold against the persisted assistant message. It runs detached from the
+// request context so a client disconnecting after persistence cannot leave the reply unpaid.
+func (s *Service) captureHold(hold *model.CoinHold, coins int64, messageID string) (*model.CoinHold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	settled, err := s.assets.CaptureHold(ctx, hold.ID, coins, messageID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// The hold is sized from estimated tokens; log when the provider's count ran past it.
+	if coins > settled.Amount {
+		log.Printf("coin hold overage hold=%s user=%s held=%d cost=%d charged=%d", settled.ID, settled.UserID, settled.Amount, coins, settled.CapturedAmount)
 	}
+	return settled, nil
+}
 
-	// Update session summary
-	if session.Summary != "" {
-		session.Summary += "\n" + summary
-	} else {
-		session.Summary = summary
+// releaseHold refunds a hold after a provider error, cancellation or empty reply. Failures are
+// logged only; the expiry sweeper refunds anything left behind.
+func (s *Service) releaseHold(hold *model.CoinHold) {
+	if hold == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.assets.ReleaseHold(ctx, hold.ID); err != nil && !errors.Is(err, repository.ErrHoldNotActive) {
+		log.Printf("release coin hold failed hold=%s user=%s err=%v", hold.ID, hold.UserID, err)
 	}
+}
 
-	// Save to DB (assuming UpdateSessionSummary exists or using generic Update)
-	// For now, we'll use a direct SQL update or add a method to repo if needed.
-	// Since we don't have UpdateSessionSummary, we might need to add it or use raw query.
-	// For this implementation, let's assume we can use s.chats.UpdateSession(session) if it existed,
-	// but looking at repo, we might need to add a specific method.
-	// Let's add a TODO or try to use UpdateSettings if it allowed arbitrary fields, but it doesn't.
-	// We will add a specific method to ChatRepository for updating summary later.
-	// For now, let's just log it as if it worked, or actually implement the repo method.
-	// Wait, I can't modify repo here easily without another tool call.
-	// I will add a raw query execution here if possible, or better, just add the method to repo in next step.
-	// Actually, I can use s.chats.DB.Exec if I had access, but I don't.
-	// I will assume s.chats.UpdateSummary exists and I will add it to repo in next step.
-	return s.chats.UpdateSummary(ctx, session.ID, session.Summary)
+// latestUserContent returns the most recent user message, used as the retrieval query.
+func latestUserContent(history []model.ChatMessage) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		if strings.EqualFold(history[i].Role, "user") {
+			return history[i].Content
+		}
+	}
+	return ""
 }
 
-func logPromptWithHistory(sessionID, userID, modelID, content, prompt string, history []model.ChatMessage) {
+func logPrompt(sessionID, userID, modelID, content string, messages []llmclient.Message) {
 	if !debugPrompt {
 		return
 	}
 	var sb strings.Builder
-	for _, m := range history {
+	for _, m := range messages {
 		sb.WriteString(fmt.Sprintf("[%s] %s\n", m.Role, m.Content))
 	}
-	log.Printf("chat prompt session=%s user=%s model=%s content=%q prompt=%q history=\n%s", sessionID, userID, modelID, content, prompt, sb.String())
+	log.Printf("chat prompt session=%s user=%s model=%s content=%q messages=\n%s", sessionID, userID, modelID, content, sb.String())
 }
 
-func (s *Service) SessionOverview(ctx context.Context, userID, sessionID string) (*SessionView, error) {
-	session, err := s.chats.FindSession(ctx, sessionID)
-	if err != nil || session == nil {
-		return nil, errors.New("session not found")
-	}
-	if session.UserID != userID {
-		return nil, errors.New("forbidden")
+func (s *Service) SessionOverview(ctx context.Context, actor authz.Actor, sessionID string) (*SessionView, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
 	}
 	role, err := s.roles.FindByID(ctx, session.RoleID)
 	if err != nil || role == nil {
@@ -541,6 +850,7 @@ func (s *Service) SessionOverview(ctx context.Context, userID, sessionID string)
 	return &SessionView{
 		Session:  session,
 		Role:     role,
+		Persona:  s.sessionPersona(ctx, session),
 		World:    worldSummary,
 		Messages: messages,
 	}, nil
@@ -557,13 +867,10 @@ func (s *Service) ListModels(ctx context.Context) ([]model.ModelConfig, error) {
 	return models, nil
 }
 
-func (s *Service) UpdateSettings(ctx context.Context, userID, sessionID, mode, modelKey string, patch SettingsPatch) (*model.ChatSession, error) {
-	session, err := s.chats.FindSession(ctx, sessionID)
-	if err != nil || session == nil {
-		return nil, errors.New("session not found")
-	}
-	if session.UserID != userID {
-		return nil, errors.New("forbidden")
+func (s *Service) UpdateSettings(ctx context.Context, actor authz.Actor, sessionID, mode, modelKey string, patch SettingsPatch) (*model.ChatSession, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
 	}
 	settings := mergeSettings(session.Settings, patch)
 	normalizedMode := session.Mode
@@ -601,7 +908,7 @@ func (s *Service) resolveModel(ctx context.Context, requestedID string) (*model.
 		if err != nil {
 			return nil, err
 		}
-		if modelCfg != nil && strings.EqualFold(modelCfg.Status, "active") {
+		if modelCfg != nil && modelCfg.Serviceable() {
 			return modelCfg, nil
 		}
 	}
@@ -609,7 +916,7 @@ func (s *Service) resolveModel(ctx context.Context, requestedID string) (*model.
 	if err != nil {
 		return nil, err
 	}
-	if modelCfg == nil || !strings.EqualFold(modelCfg.Status, "active") {
+	if modelCfg == nil || !modelCfg.Serviceable() {
 		// Fallback to mock so chat can still start.
 		return &model.ModelConfig{
 			ID:       "mock-fallback",
@@ -650,13 +957,40 @@ func toBlocks(from []model.PresetBlock) []Block {
 	return result
 }
 
-func buildPromptWithUserPreset(role *model.Role, world *model.WorldSummary, ragContext, memories string, settings model.ChatSessionSettings, mode string, sessionSummary string, userPreset *model.Preset) string {
-	base := originalBuildPrompt(role, world, ragContext, memories, settings, mode)
+// promptSections lays out the context in send order: base sections, then the preset (user preset
+// first, else the role's own) and the session summary unless the preset placed {{summary}}. Preset
+// blocks keep their role; blocks after the chat history marker are sent after the dialogue, and
+// the summary goes just before it. Macros in role fields and preset blocks are rendered with env.
+func promptSections(env *macro.Env, role *model.Role, user *model.Persona, world *model.WorldSummary, ragContext, memories string, settings model.ChatSessionSettings, mode string, userPreset *model.Preset) []ContextSection {
+	sections := baseSections(env, role, user, world, ragContext, memories, settings, mode)
+	summary := ContextSection{Name: "summary", Priority: prioritySummary, content: env.Summary}
+	withPreset := func(blocks []Block) ([]ContextSection, bool) {
+		preset := buildFromBlocks(env, blocks)
+		if len(preset) == 0 {
+			return nil, false
+		}
+		for _, b := range blocks {
+			if b.Enabled && strings.Contains(strings.ToLower(b.Content), "{{summary}}") {
+				summary.content = ""
+			}
+		}
+		placed := false
+		for _, sec := range preset {
+			if sec.AfterHistory && !placed {
+				sections, placed = append(sections, summary), true
+			}
+			sections = append(sections, sec)
+		}
+		if !placed {
+			sections = append(sections, summary)
+		}
+		return sections, true
+	}
 
 	// User provided preset takes priority
 	if userPreset != nil && len(userPreset.Blocks) > 0 {
-		if prompt := buildFromBlocks(role, toBlocks(userPreset.Blocks), sessionSummary); prompt != "" {
-			return strings.Join([]string{base, prompt}, "\n\n")
+		if out, ok := withPreset(toBlocks(userPreset.Blocks)); ok {
+			return out
 		}
 	}
 
@@ -670,43 +1004,70 @@ func buildPromptWithUserPreset(role *model.Role, world *model.WorldSummary, ragC
 		}
 	}
 	if len(preset.Blocks) > 0 {
-		if prompt := buildFromBlocks(role, preset.Blocks, sessionSummary); prompt != "" {
-			return strings.Join([]string{base, prompt}, "\n\n")
+		if out, ok := withPreset(preset.Blocks); ok {
+			return out
 		}
 	}
 
 	// Fallback
-	return base
+	return append(sections, summary)
 }
 
-func buildFromBlocks(role *model.Role, blocks []Block, sessionSummary string) string {
-	var promptParts []string
+// buildFromBlocks renders the enabled blocks into preset sections, merging neighbouring blocks
+// with the same role. Other markers are filled by the base sections and only contribute their own
+// text, if any.
+func buildFromBlocks(env *macro.Env, blocks []Block) []ContextSection {
+	var out []ContextSection
+	afterHistory := false
 	for _, block := range blocks {
 		if !block.Enabled {
 			continue
 		}
-		content := block.Content
-		content = strings.ReplaceAll(content, "{{char}}", role.Name)
-		content = strings.ReplaceAll(content, "{{user}}", "User")
-
-		if sessionSummary != "" {
-			content = strings.ReplaceAll(content, "{{summary}}", "Previous summary:\n"+sessionSummary)
-		} else {
-			content = strings.ReplaceAll(content, "{{summary}}", "")
+		if isHistoryMarker(block) {
+			afterHistory = true
+			continue
 		}
+		content := expand(env, block.Content)
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		role := blockRole(block.Role)
+		if n := len(out); n > 0 && out[n-1].Role == role && out[n-1].AfterHistory == afterHistory {
+			out[n-1].content += "\n\n" + content
+			continue
+		}
+		out = append(out, ContextSection{Name: "preset", Priority: priorityPreset, Role: role, AfterHistory: afterHistory, content: content})
+	}
+	return out
+}
 
-		// history markers are placeholders; leave content as-is (history is passed separately)
-		promptParts = append(promptParts, content)
+// isHistoryMarker reports whether the block marks where the chat history goes.
+func isHistoryMarker(b Block) bool {
+	if !b.Marker {
+		return false
 	}
-	if len(promptParts) == 0 {
-		return ""
+	switch strings.ToLower(b.ID) {
+	case "history", "chathistory", "chat_history":
+		return true
 	}
-	return strings.Join(promptParts, "\n\n")
+	return false
+}
+
+// blockRole maps a block's role onto a message role; blocks without one are system text.
+func blockRole(role string) string {
+	switch strings.ToLower(strings.TrimSpace(role)) {
+	case llmclient.RoleUser:
+		return llmclient.RoleUser
+	case llmclient.RoleAssistant:
+		return llmclient.RoleAssistant
+	}
+	return llmclient.RoleSystem
 }
 
-func originalBuildPrompt(role *model.Role, world *model.WorldSummary, ragContext, memories string, settings model.ChatSessionSettings, mode string) string {
-	var parts []string
-	parts = append(parts, systemPrompt)
+// baseSections builds the platform rules, rolecard, user persona, world, knowledge, memories and
+// style sections, rendering the macros in role fields with env.
+func baseSections(env *macro.Env, role *model.Role, user *model.Persona, world *model.WorldSummary, ragContext, memories string, settings model.ChatSessionSettings, mode string) []ContextSection {
+	var rolecard []string
 	// Persona：优先角色描述，并附加 data.persona
 	description := strings.TrimSpace(role.Description)
 	if role.Data != nil {
@@ -721,12 +1082,12 @@ func originalBuildPrompt(role *model.Role, world *model.WorldSummary, ragContext
 			description += "\n" + strings.TrimSpace(v)
 		}
 	}
-	parts = append(parts, fmt.Sprintf("You are now role \"%s\". Persona overview:\n%s", role.Name, description))
+	rolecard = append(rolecard, fmt.Sprintf("You are now role \"%s\". Persona overview:\n%s", role.Name, description))
 	if len(role.Abilities) > 0 {
-		parts = append(parts, "Key abilities or traits:\n- "+strings.Join(role.Abilities, "\n- "))
+		rolecard = append(rolecard, "Key abilities or traits:\n- "+strings.Join(role.Abilities, "\n- "))
 	}
 	if len(role.Tags) > 0 {
-		parts = append(parts, "Role tags: "+strings.Join(role.Tags, ", "))
+		rolecard = append(rolecard, "Role tags: "+strings.Join(role.Tags, ", "))
 	}
 	// Traits / scenario from role.Data
 	if role.Data != nil {
@@ -738,11 +1099,11 @@ func originalBuildPrompt(role *model.Role, world *model.WorldSummary, ragContext
 				}
 			}
 			if len(traits) > 0 {
-				parts = append(parts, "Personality traits:\n- "+strings.Join(traits, "\n- "))
+				rolecard = append(rolecard, "Personality traits:\n- "+strings.Join(traits, "\n- "))
 			}
 		}
 		if v, ok := role.Data["scenario"].(string); ok && strings.TrimSpace(v) != "" {
-			parts = append(parts, "Scenario:\n"+v)
+			rolecard = append(rolecard, "Scenario:\n"+v)
 		}
 	}
 
@@ -792,12 +1153,13 @@ func originalBuildPrompt(role *model.Role, world *model.WorldSummary, ragContext
 		}
 	}
 
+	var worldParts []string
 	appendWorld := func(w *model.WorldSummary) {
 		if w == nil {
 			return
 		}
 		if w.Summary != "" {
-			parts = append(parts, "World overview:\n"+w.Summary)
+			worldParts = append(worldParts, "World overview:\n"+w.Summary)
 		}
 		if w.Scene != "" || w.Timeline != "" {
 			sceneBlock := "Current scene:\n"
@@ -807,27 +1169,21 @@ func originalBuildPrompt(role *model.Role, world *model.WorldSummary, ragContext
 			if w.Timeline != "" {
 				sceneBlock += "Timeline: " + w.Timeline
 			}
-			parts = append(parts, strings.TrimSpace(sceneBlock))
+			worldParts = append(worldParts, strings.TrimSpace(sceneBlock))
 		}
 		if len(w.NPCs) > 0 {
-			parts = append(parts, "Key NPCs:\n- "+strings.Join(w.NPCs, "\n- "))
+			worldParts = append(worldParts, "Key NPCs:\n- "+strings.Join(w.NPCs, "\n- "))
 		}
 		if len(w.Entries) > 0 {
 			var entries []string
 			for k, vals := range w.Entries {
 				entries = append(entries, fmt.Sprintf("%s: %s", k, strings.Join(vals, "; ")))
 			}
-			parts = append(parts, "World entries:\n- "+strings.Join(entries, "\n- "))
+			worldParts = append(worldParts, "World entries:\n- "+strings.Join(entries, "\n- "))
 		}
 	}
 	appendWorld(world)
 	appendWorld(worldData)
-	if ragContext != "" {
-		parts = append(parts, "Reference knowledge (from documents):\n"+ragContext)
-	}
-	if memories != "" {
-		parts = append(parts, "User preferences or memories:\n"+memories)
-	}
 	styleDirectives := []string{
 		fmt.Sprintf("When you respond, always speak as %s. Stay in character and never break persona.", role.Name),
 	}
@@ -857,8 +1213,33 @@ func originalBuildPrompt(role *model.Role, world *model.WorldSummary, ragContext
 	} else {
 		styleDirectives = append(styleDirectives, "NSFW mode allowed within platform policy; maintain consensual tone.")
 	}
-	parts = append(parts, strings.Join(styleDirectives, "\n"))
-	return strings.Join(parts, "\n\n")
+	sections := []ContextSection{
+		{Name: "system", Priority: prioritySystem, content: systemPrompt},
+		{Name: "rolecard", Priority: priorityRolecard, content: expand(env, strings.Join(rolecard, "\n\n"))},
+	}
+	if user != nil {
+		persona := fmt.Sprintf("The user plays \"%s\".", user.Name)
+		if user.Description != "" {
+			persona += " About them:\n" + expand(env, user.Description)
+		}
+		sections = append(sections, ContextSection{Name: "persona", Priority: priorityRolecard, content: persona})
+	}
+	sections = append(sections, ContextSection{Name: "world", Priority: priorityWorld, content: expand(env, strings.Join(worldParts, "\n\n"))})
+	if ragContext != "" {
+		sections = append(sections, ContextSection{Name: "knowledge", Priority: priorityWorld, content: "Reference knowledge (from documents):\n" + ragContext})
+	}
+	if memories != "" {
+		sections = append(sections, ContextSection{Name: "memories", Priority: prioritySummary, content: "User preferences or memories:\n" + memories})
+	}
+	return append(sections, ContextSection{Name: "style", Priority: prioritySystem, content: strings.Join(styleDirectives, "\n")})
+}
+
+// personaName is the name {{user}} stands for; "User" when the user has no persona.
+func personaName(user *model.Persona) string {
+	if user == nil || user.Name == "" {
+		return "User"
+	}
+	return user.Name
 }
 
 func mergeSettings(base model.ChatSessionSettings, patch SettingsPatch) model.ChatSessionSettings {
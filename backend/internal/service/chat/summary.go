@@ -0,0 +1,321 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/example/ai-avatar-studio/internal/task"
+)
+
+// Sessions are summarized incrementally. Once chapterMessages messages have gathered past the
+// session's watermark they become a chapter summary and the watermark moves to the last of them;
+// when the chapters together exceed chapterTokenBudget they are folded, with the previous arc, into
+// a new arc summary. Every change is stored as a new ChatSummary version.
+const (
+	chapterMessages    = 20
+	chapterTokenBudget = 800
+	maxChaptersPerRun  = 5
+)
+
+const chapterInstructions = "Summarize the new part of this roleplay conversation in 3-5 sentences. Record key events, " +
+	"decisions, facts learned about the characters and open threads. Do not repeat what the story so far already covers.\n\n"
+
+const arcInstructions = "Merge these summaries of a roleplay conversation into one summary of the story so far, at most " +
+	"250 words. Keep events in order, the facts and relationships established and any unresolved threads; drop detail " +
+	"that no longer matters.\n\n"
+
+// SummaryView is a session's summary as shown to its owner.
+type SummaryView struct {
+	Summary   string              `json:"summary"` // the text sent to the model
+	Watermark string              `json:"watermark,omitempty"`
+	Pending   int                 `json:"pending_messages"` // messages past the watermark
+	Current   []model.ChatSummary `json:"current"`
+}
+
+// maybeSummarize queues summarization once a chapter's worth of messages has gathered past the
+// watermark, or when the summarized messages are no longer on the active path.
+func (s *Service) maybeSummarize(ctx context.Context, session *model.ChatSession) {
+	count, found, err := s.chats.CountMessagesAfter(ctx, session.ID, session.SummaryWatermark)
+	if err != nil {
+		log.Printf("count unsummarized messages session=%s err=%v", session.ID, err)
+		return
+	}
+	if !found || count >= chapterMessages {
+		if err := s.enqueueSummary(ctx, session.ID); err != nil {
+			log.Printf("enqueue summarization session=%s err=%v", session.ID, err)
+		}
+	}
+}
+
+func (s *Service) summarizeSession(ctx context.Context, sessionID string) error {
+	for i := 0; i < maxChaptersPerRun; i++ {
+		session, err := s.chats.FindSession(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		if session == nil {
+			return task.Permanent(errors.New("session not found"))
+		}
+		added, err := s.summarizeChapter(ctx, session)
+		if errors.Is(err, repository.ErrSummaryConflict) {
+			// Another run or an edit moved the summaries on; the next exchange checks again.
+			return nil
+		}
+		if err != nil || !added {
+			return err
+		}
+	}
+	return nil
+}
+
+// summarizeChapter turns the next chapterMessages messages past the watermark into a chapter and
+// compacts the chapters if needed. It reports false when there is not enough to summarize yet.
+func (s *Service) summarizeChapter(ctx context.Context, session *model.ChatSession) (bool, error) {
+	count, found, err := s.chats.CountMessagesAfter(ctx, session.ID, session.SummaryWatermark)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		// The summarized messages left the active path (deleted, or another branch was selected).
+		if err := s.chats.ResetSummaries(ctx, session.ID); err != nil {
+			return false, err
+		}
+		session.SummaryWatermark = ""
+	}
+	if count < chapterMessages {
+		return false, nil
+	}
+	messages, err := s.chats.ListMessagesAfter(ctx, session.ID, session.SummaryWatermark, chapterMessages)
+	if err != nil {
+		return false, err
+	}
+	current, err := s.chats.CurrentSummaries(ctx, session.ID)
+	if err != nil {
+		return false, err
+	}
+	modelCfg, err := s.resolveModel(ctx, session.ModelKey)
+	if err != nil {
+		return false, err
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString(chapterInstructions)
+	if story := renderSummary(current); story != "" {
+		prompt.WriteString("Story so far:\n" + story + "\n\n")
+	}
+	prompt.WriteString("New messages:\n")
+	for _, msg := range messages {
+		fmt.Fprintf(&prompt, "%s: %s\n", msg.Role, msg.Content)
+	}
+	content, err := s.generateSummary(ctx, modelCfg, prompt.String())
+	if err != nil {
+		return false, err
+	}
+
+	position := 1
+	for _, c := range current {
+		if c.Position >= position {
+			position = c.Position + 1
+		}
+	}
+	chapter := &model.ChatSummary{
+		Level:            model.SummaryChapter,
+		Position:         position,
+		Content:          content,
+		ThroughMessageID: messages[len(messages)-1].ID,
+		MessageCount:     len(messages),
+		Source:           model.SummaryAuto,
+	}
+	err = s.chats.SaveSummaries(ctx, repository.SummaryChange{
+		SessionID:         session.ID,
+		ExpectedWatermark: session.SummaryWatermark,
+		Watermark:         chapter.ThroughMessageID,
+		Add:               []*model.ChatSummary{chapter},
+		Rendered:          renderSummary(append(current, *chapter)),
+	})
+	if err != nil {
+		return false, err
+	}
+	current = append(current, *chapter)
+	return true, s.compactSummaries(ctx, session.ID, chapter.ThroughMessageID, current, modelCfg)
+}
+
+// compactSummaries folds the arc and all chapters into a new arc once the chapters exceed
+// chapterTokenBudget.
+func (s *Service) compactSummaries(ctx context.Context, sessionID, watermark string, current []model.ChatSummary, modelCfg *model.ModelConfig) error {
+	var chapters []model.ChatSummary
+	tokens := 0
+	for _, c := range current {
+		if c.Level == model.SummaryChapter {
+			chapters = append(chapters, c)
+			tokens += llmclient.EstimateTokens(c.Content)
+		}
+	}
+	if tokens <= chapterTokenBudget || len(chapters) < 2 {
+		return nil
+	}
+	var prompt strings.Builder
+	prompt.WriteString(arcInstructions)
+	merged := &model.ChatSummary{Level: model.SummaryArc, Source: model.SummaryAuto}
+	var retire []string
+	for _, c := range current {
+		fmt.Fprintf(&prompt, "%s\n\n", c.Content)
+		merged.MessageCount += c.MessageCount
+		retire = append(retire, c.ID)
+	}
+	last := chapters[len(chapters)-1]
+	merged.Position = last.Position
+	merged.ThroughMessageID = last.ThroughMessageID
+	content, err := s.generateSummary(ctx, modelCfg, prompt.String())
+	if err != nil {
+		return err
+	}
+	merged.Content = content
+	return s.chats.SaveSummaries(ctx, repository.SummaryChange{
+		SessionID:         sessionID,
+		ExpectedWatermark: watermark,
+		Watermark:         watermark,
+		Retire:            retire,
+		Add:               []*model.ChatSummary{merged},
+		Rendered:          merged.Content,
+	})
+}
+
+func (s *Service) generateSummary(ctx context.Context, modelCfg *model.ModelConfig, prompt string) (string, error) {
+	out, err := s.llm.Generate(ctx, llmclient.Conversation(prompt, nil), modelCfg)
+	if err != nil {
+		return "", err
+	}
+	content := strings.TrimSpace(out.Content)
+	if content == "" {
+		return "", errors.New("model returned an empty summary")
+	}
+	return content, nil
+}
+
+// renderSummary joins the arc and chapters into the text used as the prompt's summary section.
+func renderSummary(current []model.ChatSummary) string {
+	parts := make([]string, 0, len(current))
+	for _, c := range current {
+		parts = append(parts, c.Content)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Summary returns the session's current summaries and how many messages they do not cover yet.
+func (s *Service) Summary(ctx context.Context, actor authz.Actor, sessionID string) (*SummaryView, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.summaryView(ctx, session)
+}
+
+// SummaryVersions returns every stored summary version of the session, newest first.
+func (s *Service) SummaryVersions(ctx context.Context, actor authz.Actor, sessionID string) ([]model.ChatSummary, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.chats.SummaryVersions(ctx, session.ID, 200)
+}
+
+// EditSummary replaces a current chapter or arc with the user's text as a new version.
+func (s *Service) EditSummary(ctx context.Context, actor authz.Actor, sessionID, summaryID, content string) (*SummaryView, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.New("content required")
+	}
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.chats.CurrentSummaries(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i := range current {
+		if current[i].ID == summaryID {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, authz.ErrNotFound
+	}
+	edited := current[index]
+	edited.Content = content
+	edited.Source = model.SummaryEdited
+	retired := current[index].ID
+	current[index] = edited
+	err = s.chats.SaveSummaries(ctx, repository.SummaryChange{
+		SessionID:         session.ID,
+		ExpectedWatermark: session.SummaryWatermark,
+		Watermark:         session.SummaryWatermark,
+		Retire:            []string{retired},
+		Add:               []*model.ChatSummary{&edited},
+		Rendered:          renderSummary(current),
+	})
+	if errors.Is(err, repository.ErrSummaryConflict) {
+		return nil, errors.New("summary was updated meanwhile, reload and try again")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.summaryView(ctx, session)
+}
+
+// RegenerateSummary retires the current summaries and summarizes the active path again in the
+// background.
+func (s *Service) RegenerateSummary(ctx context.Context, actor authz.Actor, sessionID string) (*SummaryView, error) {
+	session, err := s.ownedSession(ctx, actor, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.chats.ResetSummaries(ctx, session.ID); err != nil {
+		return nil, err
+	}
+	session.SummaryWatermark = ""
+	if err := s.enqueueSummary(ctx, session.ID); err != nil {
+		return nil, err
+	}
+	return s.summaryView(ctx, session)
+}
+
+func (s *Service) summaryView(ctx context.Context, session *model.ChatSession) (*SummaryView, error) {
+	current, err := s.chats.CurrentSummaries(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	pending, _, err := s.chats.CountMessagesAfter(ctx, session.ID, session.SummaryWatermark)
+	if err != nil {
+		return nil, err
+	}
+	return &SummaryView{
+		Summary:   renderSummary(current),
+		Watermark: session.SummaryWatermark,
+		Pending:   pending,
+		Current:   current,
+	}, nil
+}
+
+func (s *Service) ownedSession(ctx context.Context, actor authz.Actor, sessionID string) (*model.ChatSession, error) {
+	session, err := s.chats.FindSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, authz.ErrNotFound
+	}
+	if err := authz.RequireOwner(actor, session.UserID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/example/ai-avatar-studio/internal/model"
 	"github.com/example/ai-avatar-studio/internal/repository"
+	notificationsvc "github.com/example/ai-avatar-studio/internal/service/notification"
 	"github.com/example/ai-avatar-studio/internal/task"
 )
 
@@ -18,11 +19,22 @@ type Service struct {
 	userRepo      *repository.UserRepository
 	notifications *repository.NotificationRepository
 	configs       *repository.ConfigRepository
-	dispatcher    *task.Dispatcher
+	jobs          *task.Queue
 }
 
-func NewService(repo *repository.CommunityRepository, userRepo *repository.UserRepository, notifications *repository.NotificationRepository, dispatcher *task.Dispatcher, configs *repository.ConfigRepository) *Service {
-	return &Service{repo: repo, userRepo: userRepo, notifications: notifications, dispatcher: dispatcher, configs: configs}
+func NewService(repo *repository.CommunityRepository, userRepo *repository.UserRepository, notifications *repository.NotificationRepository, jobs *task.Queue, configs *repository.ConfigRepository) *Service {
+	return &Service{repo: repo, userRepo: userRepo, notifications: notifications, jobs: jobs, configs: configs}
+}
+
+// notify queues a notification for delivery, writing it inline when no queue is configured or the
+// job cannot be stored.
+func (s *Service) notify(ctx context.Context, n *model.Notification) {
+	if s.jobs != nil {
+		if _, err := s.jobs.Enqueue(ctx, notificationsvc.JobCreate, n); err == nil {
+			return
+		}
+	}
+	_ = s.notifications.Create(ctx, n)
 }
 
 func (s *Service) Feed(ctx context.Context, sort, filter, search, userID string) ([]model.CommunityPost, error) {
@@ -95,19 +107,12 @@ func (s *Service) Comment(ctx context.Context, userID, postID, content string) (
 	// Best effort notification to post author.
 	post, _ := s.repo.FindPost(ctx, postID)
 	if post != nil && post.AuthorID != userID {
-		notify := func(ctx context.Context) {
-			_ = s.notifications.Create(ctx, &model.Notification{
-				UserID:  post.AuthorID,
-				Type:    "comment",
-				Title:   fmt.Sprintf("New comment on %s", post.Title),
-				Content: content,
-			})
-		}
-		if s.dispatcher != nil {
-			s.dispatcher.Dispatch(notify)
-		} else {
-			notify(ctx)
-		}
+		s.notify(ctx, &model.Notification{
+			UserID:  post.AuthorID,
+			Type:    "comment",
+			Title:   fmt.Sprintf("New comment on %s", post.Title),
+			Content: content,
+		})
 	}
 	return comment, nil
 }
@@ -137,19 +142,12 @@ func (s *Service) React(ctx context.Context, userID, postID, reactionType string
 				title = "你的帖子被点赞了"
 			}
 			content := fmt.Sprintf("%s 刚刚互动了你的帖子《%s》", userID, post.Title)
-			notify := func(ctx context.Context) {
-				_ = s.notifications.Create(ctx, &model.Notification{
-					UserID:  post.AuthorID,
-					Type:    reactionType,
-					Title:   title,
-					Content: content,
-				})
-			}
-			if s.dispatcher != nil {
-				s.dispatcher.Dispatch(notify)
-			} else {
-				notify(ctx)
-			}
+			s.notify(ctx, &model.Notification{
+				UserID:  post.AuthorID,
+				Type:    reactionType,
+				Title:   title,
+				Content: content,
+			})
 		}
 	}
 	counts, _ := s.repo.CountReactions(ctx, postID)
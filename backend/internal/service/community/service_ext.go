@@ -60,19 +60,12 @@ func (s *Service) ToggleFollow(ctx context.Context, followerID, targetID string)
 			return false, 0, 0, err
 		}
 		if s.notifications != nil {
-			notify := func(ctx context.Context) {
-				_ = s.notifications.Create(ctx, &model.Notification{
-					UserID:  targetID,
-					Type:    "follow",
-					Title:   "有人关注了你",
-					Content: "你有新的关注者",
-				})
-			}
-			if s.dispatcher != nil {
-				s.dispatcher.Dispatch(notify)
-			} else {
-				notify(ctx)
-			}
+			s.notify(ctx, &model.Notification{
+				UserID:  targetID,
+				Type:    "follow",
+				Title:   "有人关注了你",
+				Content: "你有新的关注者",
+			})
 		}
 	}
 	followers, _ := s.repo.CountFollowers(ctx, targetID)
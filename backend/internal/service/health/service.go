@@ -0,0 +1,226 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+	"github.com/example/ai-avatar-studio/internal/repository"
+	imagesvc "github.com/example/ai-avatar-studio/internal/service/image"
+)
+
+const (
+	probeTimeout   = 30 * time.Second
+	probeMaxTokens = 16
+	summaryWindow  = 24 * time.Hour
+	checkRetention = 7 * 24 * time.Hour
+)
+
+// Service tests model and image provider connectivity and keeps their status in line with the results.
+type Service struct {
+	configs   *repository.ConfigRepository
+	providers *repository.ImageProviderRepository
+	checks    *repository.HealthCheckRepository
+	llm       llmclient.Client
+	images    *imagesvc.Service
+	// degradeAfter is how many consecutive failed checks mark an entry degraded.
+	degradeAfter int
+}
+
+func NewService(configs *repository.ConfigRepository, providers *repository.ImageProviderRepository, checks *repository.HealthCheckRepository, llm llmclient.Client, images *imagesvc.Service, degradeAfter int) *Service {
+	if degradeAfter <= 0 {
+		degradeAfter = 1
+	}
+	return &Service{configs: configs, providers: providers, checks: checks, llm: llm, images: images, degradeAfter: degradeAfter}
+}
+
+// TestModel sends a minimal completion to the model and records the outcome.
+func (s *Service) TestModel(ctx context.Context, id string) (*model.HealthCheck, error) {
+	cfg, err := s.configs.FindModel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, errors.New("model not found")
+	}
+	return s.checkModel(ctx, cfg), nil
+}
+
+// TestProvider checks the image provider's endpoint and key and records the outcome.
+func (s *Service) TestProvider(ctx context.Context, id string) (*model.HealthCheck, error) {
+	provider, err := s.providers.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, errors.New("provider not found")
+	}
+	return s.checkProvider(ctx, provider), nil
+}
+
+func (s *Service) checkModel(ctx context.Context, cfg *model.ModelConfig) *model.HealthCheck {
+	probe := *cfg
+	probe.MaxTokens = probeMaxTokens
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	out, err := s.llm.Generate(ctx, []llmclient.Message{
+		{Role: llmclient.RoleSystem, Content: "Reply with OK."},
+		{Role: llmclient.RoleUser, Content: "ping"},
+	}, &probe)
+	check := &model.HealthCheck{
+		TargetType:    model.HealthTargetModel,
+		TargetID:      cfg.ID,
+		OK:            err == nil,
+		LatencyMs:     int(time.Since(start).Milliseconds()),
+		ResolvedModel: out.Model,
+	}
+	if check.ResolvedModel == "" {
+		check.ResolvedModel = cfg.ModelName
+	}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	s.record(check)
+	return check
+}
+
+func (s *Service) checkProvider(ctx context.Context, provider *model.ImageProvider) *model.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	resolved, err := s.images.ProbeProvider(ctx, provider)
+	check := &model.HealthCheck{
+		TargetType:    model.HealthTargetImageProvider,
+		TargetID:      provider.ID,
+		OK:            err == nil,
+		LatencyMs:     int(time.Since(start).Milliseconds()),
+		ResolvedModel: resolved,
+	}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	s.record(check)
+	return check
+}
+
+// record stores the check on a detached context so a cancelled admin request still leaves a trace.
+func (s *Service) record(check *model.HealthCheck) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.checks.Record(ctx, check); err != nil {
+		log.Printf("health: record %s %s: %v", check.TargetType, check.TargetID, err)
+	}
+}
+
+// ProbeAll checks every enabled model and provider, marking entries degraded after degradeAfter
+// consecutive failed checks and restoring degraded entries that pass. A single failure is often a
+// transient provider hiccup. Disabled entries are left alone.
+func (s *Service) ProbeAll(ctx context.Context) {
+	models, err := s.configs.ListModels(ctx, true)
+	if err != nil {
+		log.Printf("health: list models: %v", err)
+	}
+	for _, m := range models {
+		if !m.IsEnabled || !m.Serviceable() {
+			continue
+		}
+		// The list omits API keys; probe with the full config.
+		cfg, err := s.configs.FindModel(ctx, m.ID)
+		if err != nil || cfg == nil {
+			continue
+		}
+		check := s.checkModel(ctx, cfg)
+		if status := nextStatus(cfg.Status, s.failures(ctx, check), s.degradeAfter); status != "" {
+			if err := s.configs.SetModelStatus(ctx, cfg.ID, status); err != nil {
+				log.Printf("health: set model %s status: %v", cfg.ID, err)
+			} else {
+				log.Printf("health: model %s is now %s err=%s", cfg.ID, status, check.Error)
+			}
+		}
+	}
+
+	providers, err := s.providers.List(ctx)
+	if err != nil {
+		log.Printf("health: list image providers: %v", err)
+	}
+	for _, listed := range providers {
+		if !strings.EqualFold(listed.Status, "active") && !strings.EqualFold(listed.Status, "degraded") {
+			continue
+		}
+		// The list omits API keys; probe with the full record.
+		p, err := s.providers.FindByID(ctx, listed.ID)
+		if err != nil || p == nil {
+			continue
+		}
+		check := s.checkProvider(ctx, p)
+		if status := nextStatus(p.Status, s.failures(ctx, check), s.degradeAfter); status != "" {
+			if err := s.providers.SetStatus(ctx, p.ID, status); err != nil {
+				log.Printf("health: set image provider %s status: %v", p.ID, err)
+			} else {
+				log.Printf("health: image provider %s is now %s err=%s", p.ID, status, check.Error)
+			}
+		}
+	}
+
+	if _, err := s.checks.Prune(ctx, time.Now().Add(-checkRetention)); err != nil {
+		log.Printf("health: prune checks: %v", err)
+	}
+}
+
+// failures returns how many checks in a row the check's target has failed, counting the check
+// itself. When the history cannot be read it returns 0 for a pass and 1 for a failure.
+func (s *Service) failures(ctx context.Context, check *model.HealthCheck) int {
+	if check.OK {
+		return 0
+	}
+	n, err := s.checks.ConsecutiveFailures(ctx, check.TargetType, check.TargetID, s.degradeAfter)
+	if err != nil {
+		log.Printf("health: read checks of %s %s: %v", check.TargetType, check.TargetID, err)
+		return 1
+	}
+	return n
+}
+
+// nextStatus returns the status to switch to after a probe, or "" to keep the current one.
+func nextStatus(current string, failures, degradeAfter int) string {
+	switch {
+	case failures >= degradeAfter && strings.EqualFold(current, "active"):
+		return "degraded"
+	case failures == 0 && strings.EqualFold(current, "degraded"):
+		return "active"
+	}
+	return ""
+}
+
+// AnnotateModels attaches the recent check summary to each model.
+func (s *Service) AnnotateModels(ctx context.Context, models []model.ModelConfig) error {
+	summaries, err := s.checks.Summaries(ctx, model.HealthTargetModel, time.Now().Add(-summaryWindow))
+	if err != nil {
+		return err
+	}
+	for i := range models {
+		if sum, ok := summaries[models[i].ID]; ok {
+			models[i].Health = &sum
+		}
+	}
+	return nil
+}
+
+// AnnotateProviders attaches the recent check summary to each image provider.
+func (s *Service) AnnotateProviders(ctx context.Context, providers []model.ImageProvider) error {
+	summaries, err := s.checks.Summaries(ctx, model.HealthTargetImageProvider, time.Now().Add(-summaryWindow))
+	if err != nil {
+		return err
+	}
+	for i := range providers {
+		if sum, ok := summaries[providers[i].ID]; ok {
+			providers[i].Health = &sum
+		}
+	}
+	return nil
+}
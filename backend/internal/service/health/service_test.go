@@ -0,0 +1,26 @@
+package health
+
+import "testing"
+
+func TestNextStatus(t *testing.T) {
+	cases := []struct {
+		current  string
+		failures int
+		want     string
+	}{
+		{"active", 0, ""},
+		{"active", 1, ""},
+		{"active", 2, ""},
+		{"active", 3, "degraded"},
+		{"Active", 4, "degraded"},
+		{"degraded", 0, "active"},
+		{"degraded", 3, ""},
+		{"disabled", 3, ""},
+		{"disabled", 0, ""},
+	}
+	for _, tc := range cases {
+		if got := nextStatus(tc.current, tc.failures, 3); got != tc.want {
+			t.Errorf("nextStatus(%q, %d) = %q, want %q", tc.current, tc.failures, got, tc.want)
+		}
+	}
+}
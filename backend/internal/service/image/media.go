@@ -0,0 +1,195 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/storage"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	mediaPrefix = "images/"
+	// mediaURLTTL is how long a signed image URL stays valid. Expiry is rounded to the hour so the
+	// same image keeps one URL, and browser cache entry, for a while.
+	mediaURLTTL  = 24 * time.Hour
+	thumbnailMax = 320
+)
+
+// ErrMediaForbidden is returned for a missing, expired or forged media signature.
+var ErrMediaForbidden = errors.New("invalid or expired media link")
+
+// storeImage writes the image and a WebP thumbnail under images/, keyed by content hash so the
+// same bytes are stored once.
+func (s *Service) storeImage(ctx context.Context, data []byte) (imageKey, thumbnailKey string, err error) {
+	if s.store == nil {
+		return "", "", errors.New("image storage unavailable")
+	}
+	contentType := http.DetectContentType(data)
+	ext := ".png"
+	switch contentType {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/webp":
+		ext = ".webp"
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	base := mediaPrefix + hash[:2] + "/" + hash
+	imageKey = base + ext
+	if err := s.putOnce(ctx, imageKey, data, contentType); err != nil {
+		return "", "", err
+	}
+	thumb, err := makeThumbnail(data)
+	if err != nil {
+		// The image itself is fine; clients fall back to it.
+		log.Printf("image: thumbnail %s: %v", imageKey, err)
+		return imageKey, "", nil
+	}
+	thumbnailKey = base + "_thumb.webp"
+	if err := s.putOnce(ctx, thumbnailKey, thumb, "image/webp"); err != nil {
+		return "", "", err
+	}
+	return imageKey, thumbnailKey, nil
+}
+
+func (s *Service) putOnce(ctx context.Context, key string, data []byte, contentType string) error {
+	exists, err := s.store.Exists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	return s.store.Put(ctx, key, data, contentType)
+}
+
+// makeThumbnail scales the image to fit thumbnailMax and encodes it as lossless WebP.
+func makeThumbnail(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailMax || h > thumbnailMax {
+		if w >= h {
+			w, h = thumbnailMax, max(1, h*thumbnailMax/w)
+		} else {
+			w, h = max(1, w*thumbnailMax/h), thumbnailMax
+		}
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, dst, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDataURL returns the bytes of a base64 data: URL.
+func decodeDataURL(raw string) ([]byte, error) {
+	header, payload, ok := strings.Cut(raw, ",")
+	if !ok || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return nil, errors.New("not a base64 data url")
+	}
+	return base64.StdEncoding.DecodeString(payload)
+}
+
+func (s *Service) mediaSignature(key string, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(s.mediaSecret))
+	fmt.Fprintf(mac, "%s\n%d", key, exp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signedURL returns a time-limited link to key under /api/media. Only handed to the job owner.
+func (s *Service) signedURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	exp := time.Now().Truncate(time.Hour).Add(mediaURLTTL + time.Hour).Unix()
+	q := url.Values{}
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	q.Set("sig", s.mediaSignature(key, exp))
+	return "/api/media/" + key + "?" + q.Encode()
+}
+
+// present swaps storage keys for signed URLs.
+func (s *Service) present(job *model.ImageJob) *model.ImageJob {
+	if job.ImageKey != "" {
+		job.ResultURL = s.signedURL(job.ImageKey)
+	}
+	job.ThumbnailURL = s.signedURL(job.ThumbnailKey)
+	return job
+}
+
+// OpenMedia checks a signed link and opens the object with its content type.
+func (s *Service) OpenMedia(ctx context.Context, key, exp, sig string) (io.ReadCloser, string, error) {
+	if !strings.HasPrefix(key, mediaPrefix) || !storage.ValidKey(key) {
+		return nil, "", ErrMediaForbidden
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, "", ErrMediaForbidden
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.mediaSignature(key, expires))) {
+		return nil, "", ErrMediaForbidden
+	}
+	rc, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return rc, contentType, nil
+}
+
+// ImportLegacyImages moves data URLs parked by the image storage migration into storage. Safe to
+// run on several replicas at once: content-hash keys make duplicate writes harmless.
+func (s *Service) ImportLegacyImages(ctx context.Context) (int, error) {
+	imported := 0
+	after := ""
+	for {
+		batch, err := s.jobs.LegacyImages(ctx, after, 20)
+		if err != nil || len(batch) == 0 {
+			return imported, err
+		}
+		for _, legacy := range batch {
+			after = legacy.ImageJobID
+			var imageKey, thumbnailKey string
+			data, err := decodeDataURL(legacy.DataURL)
+			if err != nil {
+				log.Printf("image: dropping undecodable legacy image for job %s: %v", legacy.ImageJobID, err)
+			} else if imageKey, thumbnailKey, err = s.storeImage(ctx, data); err != nil {
+				return imported, err
+			}
+			if err := s.jobs.AttachLegacyImage(ctx, legacy.ImageJobID, imageKey, thumbnailKey); err != nil {
+				return imported, err
+			}
+			if imageKey != "" {
+				imported++
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/example/ai-avatar-studio/internal/task"
+)
+
+// fakeChats holds session s1 of "owner" with message m1, and session s2 of "stranger" with m2.
+type fakeChats struct{ chatReader }
+
+func (fakeChats) FindSession(_ context.Context, id string) (*model.ChatSession, error) {
+	switch id {
+	case "s1":
+		return &model.ChatSession{ID: "s1", UserID: "owner"}, nil
+	case "s2":
+		return &model.ChatSession{ID: "s2", UserID: "stranger"}, nil
+	}
+	return nil, nil
+}
+
+func (f fakeChats) FindSessionByMessage(ctx context.Context, messageID string) (*model.ChatSession, error) {
+	switch messageID {
+	case "m1":
+		return f.FindSession(ctx, "s1")
+	case "m2":
+		return f.FindSession(ctx, "s2")
+	}
+	return nil, nil
+}
+
+// fakeJobs holds image job j1 of "owner", already drawn.
+type fakeJobs struct{ imageJobStore }
+
+func (fakeJobs) Find(_ context.Context, id string) (*model.ImageJob, error) {
+	if id != "j1" {
+		return nil, nil
+	}
+	return &model.ImageJob{ID: "j1", UserID: "owner", SessionID: "s1", Status: model.ImageJobSucceeded, ImageKey: "images/ab/j1.png"}, nil
+}
+
+// noProviders stops RequestImage right after its ownership checks.
+type noProviders struct{}
+
+func (noProviders) ListActive(context.Context) ([]model.ImageProvider, error) { return nil, nil }
+
+func testService() *Service {
+	return &Service{
+		providers:   noProviders{},
+		presets:     &repository.ImagePresetRepository{},
+		jobs:        fakeJobs{},
+		chats:       fakeChats{},
+		queue:       &task.Queue{},
+		mediaSecret: "test-media-secret",
+	}
+}
+
+func TestImageOwnership(t *testing.T) {
+	ctx := context.Background()
+	ops := []struct {
+		name string
+		call func(s *Service, actor authz.Actor) error
+		// allowedErr is the error an allowed caller gets; RequestImage runs without providers.
+		allowedErr string
+	}{
+		{name: "RequestImage", call: func(s *Service, a authz.Actor) error {
+			_, err := s.RequestImage(ctx, a, "s1", "", "")
+			return err
+		}, allowedErr: "no active image provider"},
+		{name: "RequestImage with message", call: func(s *Service, a authz.Actor) error {
+			_, err := s.RequestImage(ctx, a, "s1", "m1", "")
+			return err
+		}, allowedErr: "no active image provider"},
+		{name: "GetJob", call: func(s *Service, a authz.Actor) error {
+			_, err := s.GetJob(ctx, a, "j1")
+			return err
+		}},
+		{name: "WatchJob", call: func(s *Service, a authz.Actor) error {
+			return s.WatchJob(ctx, a, "j1", func(*model.ImageJob) {})
+		}},
+	}
+	actors := []struct {
+		name    string
+		actor   authz.Actor
+		allowed bool
+	}{
+		{"owner", authz.Actor{UserID: "owner"}, true},
+		{"non-owner", authz.Actor{UserID: "stranger"}, false},
+		{"admin", authz.Actor{UserID: "admin", IsAdmin: true}, true},
+		{"anonymous", authz.Actor{}, false},
+	}
+	for _, op := range ops {
+		for _, a := range actors {
+			t.Run(op.name+"/"+a.name, func(t *testing.T) {
+				err := op.call(testService(), a.actor)
+				if !a.allowed {
+					if !errors.Is(err, authz.ErrForbidden) {
+						t.Fatalf("err = %v, want ErrForbidden", err)
+					}
+					return
+				}
+				if (op.allowedErr == "" && err != nil) || (op.allowedErr != "" && (err == nil || err.Error() != op.allowedErr)) {
+					t.Fatalf("err = %v, want %q", err, op.allowedErr)
+				}
+			})
+		}
+	}
+}
+
+func TestRequestImageRejectsForeignMessage(t *testing.T) {
+	// m2 belongs to another user's session, so naming it next to the caller's own session must
+	// not pull that chat history into the prompt.
+	for _, messageID := range []string{"m2", "missing"} {
+		_, err := testService().RequestImage(context.Background(), authz.Actor{UserID: "owner"}, "s1", messageID, "")
+		if !errors.Is(err, authz.ErrNotFound) {
+			t.Fatalf("RequestImage(message %s) = %v, want ErrNotFound", messageID, err)
+		}
+	}
+}
+
+func TestGetJobSignsMediaForAllowedCallers(t *testing.T) {
+	job, err := testService().GetJob(context.Background(), authz.Actor{UserID: "owner"}, "j1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ResultURL == "" {
+		t.Fatal("ResultURL is empty, want a signed media link")
+	}
+	if _, err := testService().GetJob(context.Background(), authz.Actor{UserID: "owner"}, "missing"); !errors.Is(err, authz.ErrNotFound) {
+		t.Fatalf("GetJob(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewServiceWithoutRepositories(t *testing.T) {
+	s := NewService(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, "secret")
+	if _, err := s.RequestImage(context.Background(), authz.Actor{UserID: "owner"}, "s1", "", ""); err == nil || err.Error() != "image service unavailable" {
+		t.Fatalf("RequestImage = %v, want image service unavailable", err)
+	}
+}
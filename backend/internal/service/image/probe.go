@@ -0,0 +1,75 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/gorilla/websocket"
+)
+
+// novelAIUserEndpoint answers for any valid key without spending Anlas, unlike generate-image.
+const novelAIUserEndpoint = "https://api.novelai.net/user/subscription"
+
+// ProbeProvider checks that the provider is reachable and accepts its key without generating an
+// image. It returns the model name generation requests would be sent with.
+func (s *Service) ProbeProvider(ctx context.Context, provider *model.ImageProvider) (string, error) {
+	modelName := strings.TrimSpace(provider.SelectedModel)
+	if modelName == "" {
+		modelName = "nai-diffusion-3"
+	}
+	baseURL := strings.TrimSpace(provider.BaseURL)
+	if baseURL == "" {
+		return modelName, errors.New("provider base url is empty")
+	}
+	if isNovelAIHost(baseURL) && isV4FamilyModel(modelName) {
+		modelName = normalizeV4ModelName(modelName)
+	}
+
+	if strings.HasPrefix(strings.ToLower(baseURL), "ws") {
+		header := http.Header{}
+		if strings.TrimSpace(provider.APIKey) != "" {
+			header.Set("Authorization", "Bearer "+provider.APIKey)
+		}
+		dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment}
+		conn, resp, err := dialer.DialContext(ctx, baseURL, header)
+		if err != nil {
+			if resp != nil {
+				return modelName, fmt.Errorf("provider error status=%d: %w", resp.StatusCode, err)
+			}
+			return modelName, err
+		}
+		_ = conn.Close()
+		return modelName, nil
+	}
+
+	endpoint := baseURL
+	if isNovelAIHost(baseURL) {
+		endpoint = novelAIUserEndpoint
+	} else if _, err := url.Parse(baseURL); err != nil {
+		return modelName, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return modelName, err
+	}
+	if strings.TrimSpace(provider.APIKey) != "" {
+		req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return modelName, err
+	}
+	defer resp.Body.Close()
+	// Generic endpoints only accept POST, so 405 still proves the URL and host are right.
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusMethodNotAllowed {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return modelName, fmt.Errorf("provider error status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return modelName, nil
+}
@@ -16,20 +16,54 @@ import (
 	"time"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	llmclient "github.com/example/ai-avatar-studio/internal/pkg/llm"
+	"github.com/example/ai-avatar-studio/internal/pkg/macro"
+	"github.com/example/ai-avatar-studio/internal/pkg/storage"
 	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/example/ai-avatar-studio/internal/service/persona"
+	"github.com/example/ai-avatar-studio/internal/task"
 	"github.com/gorilla/websocket"
 )
 
 // Service orchestrates prompt generation and dispatch to image providers.
 type Service struct {
-	providers *repository.ImageProviderRepository
+	providers providerLister
 	presets   *repository.ImagePresetRepository
-	jobs      *repository.ImageJobRepository
-	chats     *repository.ChatRepository
+	jobs      imageJobStore
+	chats     chatReader
+	roles     *repository.RoleRepository
+	personas  *persona.Service
 	configs   *repository.ConfigRepository
 	llm       llmclient.Client
+	queue     *task.Queue
+	store     storage.Store
 	http      *http.Client
+
+	mediaSecret string
+}
+
+// The interfaces below are the parts of the repositories the service uses.
+
+type providerLister interface {
+	ListActive(ctx context.Context) ([]model.ImageProvider, error)
+}
+
+type imageJobStore interface {
+	AttachLegacyImage(ctx context.Context, id, imageKey, thumbnailKey string) error
+	Create(ctx context.Context, job *model.ImageJob) (*model.ImageJob, error)
+	Find(ctx context.Context, id string) (*model.ImageJob, error)
+	LegacyImages(ctx context.Context, afterID string, limit int) ([]repository.LegacyImage, error)
+	SetPrompt(ctx context.Context, id, finalPrompt, negativePrompt string) error
+	Start(ctx context.Context, id, providerID string, maxConcurrency int, staleAfter time.Duration) (bool, error)
+	Succeed(ctx context.Context, id, imageKey, thumbnailKey string) error
+	UpdateStatus(ctx context.Context, id, status, resultURL, errMsg string) error
+}
+
+type chatReader interface {
+	FindSession(ctx context.Context, id string) (*model.ChatSession, error)
+	FindSessionByMessage(ctx context.Context, messageID string) (*model.ChatSession, error)
+	ListMessages(ctx context.Context, sessionID string, limit int) ([]model.ChatMessage, error)
 }
 
 func NewService(
@@ -37,75 +71,196 @@ func NewService(
 	presets *repository.ImagePresetRepository,
 	jobs *repository.ImageJobRepository,
 	chats *repository.ChatRepository,
+	roles *repository.RoleRepository,
+	personas *persona.Service,
 	configs *repository.ConfigRepository,
 	llm llmclient.Client,
+	queue *task.Queue,
+	store storage.Store,
+	mediaSecret string,
 ) *Service {
 	client := &http.Client{Timeout: 150 * time.Second}
-	return &Service{
-		providers: providers,
-		presets:   presets,
-		jobs:      jobs,
-		chats:     chats,
-		configs:   configs,
-		llm:       llm,
-		http:      client,
+	s := &Service{
+		presets:  presets,
+		roles:    roles,
+		personas: personas,
+		configs:  configs,
+		llm:      llm,
+		queue:    queue,
+		store:    store,
+		http:     client,
+
+		mediaSecret: mediaSecret,
+	}
+	// A nil repository is stored as a nil interface, not a typed nil, so the availability checks see it.
+	if providers != nil {
+		s.providers = providers
+	}
+	if jobs != nil {
+		s.jobs = jobs
 	}
+	if chats != nil {
+		s.chats = chats
+	}
+	return s
 }
 
-// RequestImage triggers generation for a chat message/session.
-func (s *Service) RequestImage(ctx context.Context, userID, sessionID, messageID, userPrompt string) (*model.ImageJob, error) {
-	if s.providers == nil || s.presets == nil || s.jobs == nil || s.chats == nil {
+const (
+	// JobGenerate is the job type that draws a queued image job.
+	JobGenerate = "image.generate"
+	// imageJobAttempts bounds how many providers one image job is tried on.
+	imageJobAttempts = 3
+	// providerBusyWait is how long a job waits when every eligible provider is at MaxConcurrency.
+	providerBusyWait = 3 * time.Second
+	// runningStaleAfter frees a slot held by a running job whose worker died; it comfortably
+	// exceeds the provider HTTP timeout.
+	runningStaleAfter = 5 * time.Minute
+	watchInterval     = time.Second
+	watchTimeout      = 10 * time.Minute
+)
+
+type generatePayload struct {
+	ImageJobID string `json:"image_job_id"`
+}
+
+// RequestImage queues generation for a chat message/session and returns the queued job at once;
+// clients poll GetJob or WatchJob until it succeeds or fails.
+// The session, and the message if given, must belong to the actor since the prompt is built from
+// that chat history.
+func (s *Service) RequestImage(ctx context.Context, actor authz.Actor, sessionID, messageID, userPrompt string) (*model.ImageJob, error) {
+	if s.providers == nil || s.presets == nil || s.jobs == nil || s.chats == nil || s.queue == nil {
 		return nil, errors.New("image service unavailable")
 	}
-	provider, err := s.pickProvider(ctx)
+	session, err := s.chats.FindSession(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
-	preset, _ := s.presets.Active(ctx)
-	if preset == nil {
-		return nil, errors.New("no active image preset")
+	if session == nil {
+		return nil, authz.ErrNotFound
 	}
-
-	finalPrompt, negativePrompt, err := s.buildPrompt(ctx, preset, sessionID, messageID, userPrompt)
+	if err := authz.RequireOwner(actor, session.UserID); err != nil {
+		return nil, err
+	}
+	if messageID != "" {
+		owner, err := s.chats.FindSessionByMessage(ctx, messageID)
+		if err != nil {
+			return nil, err
+		}
+		if owner == nil || owner.ID != sessionID {
+			return nil, authz.ErrNotFound
+		}
+	}
+	active, err := s.providers.ListActive(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if len(active) == 0 {
+		return nil, errors.New("no active image provider")
+	}
+	preset, _ := s.presets.Active(ctx)
+	if preset == nil {
+		return nil, errors.New("no active image preset")
+	}
 
 	job := &model.ImageJob{
-		UserID:         userID,
-		SessionID:      sessionID,
-		MessageID:      messageID,
-		ProviderID:     provider.ID,
-		PresetID:       preset.ID,
-		Prompt:         userPrompt,
-		NegativePrompt: negativePrompt,
-		FinalPrompt:    finalPrompt,
-		Status:         "pending",
+		UserID:    actor.UserID,
+		SessionID: sessionID,
+		MessageID: messageID,
+		PresetID:  preset.ID,
+		Prompt:    userPrompt,
+		Status:    model.ImageJobQueued,
 	}
 	job, err = s.jobs.Create(ctx, job)
 	if err != nil {
 		return nil, err
 	}
-
-	url, err := s.callProvider(ctx, provider, finalPrompt, negativePrompt)
-	if err != nil {
-		_ = s.jobs.UpdateStatus(ctx, job.ID, "failed", "", err.Error())
-		job.Status = "failed"
-		job.Error = err.Error()
-		return job, err
-	}
-	job.Status = "succeeded"
-	job.ResultURL = url
-	job.UpdatedAt = time.Now()
-	_ = s.jobs.UpdateStatus(ctx, job.ID, "succeeded", url, "")
+	if _, err := s.queue.Enqueue(ctx, JobGenerate, generatePayload{ImageJobID: job.ID}, task.MaxAttempts(imageJobAttempts)); err != nil {
+		_ = s.jobs.UpdateStatus(ctx, job.ID, model.ImageJobFailed, "", err.Error())
+		return nil, err
+	}
 	return job, nil
 }
 
-func (s *Service) GetJob(ctx context.Context, id string) (*model.ImageJob, error) {
-	return s.jobs.Find(ctx, id)
+// RegisterJobs binds the image job handlers to the queue.
+func (s *Service) RegisterJobs(q *task.Queue) {
+	q.Register(JobGenerate, func(ctx context.Context, job *model.Job) error {
+		var p generatePayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return task.Permanent(err)
+		}
+		err := s.generate(ctx, p.ImageJobID)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, errProvidersBusy):
+			return task.Snooze(providerBusyWait)
+		}
+		// Failed attempts go back to queued, to be retried on another provider, until the last one.
+		status := model.ImageJobQueued
+		if job.LastAttempt() || task.IsPermanent(err) {
+			status = model.ImageJobFailed
+		}
+		_ = s.jobs.UpdateStatus(context.WithoutCancel(ctx), p.ImageJobID, status, "", err.Error())
+		return err
+	})
+}
+
+var errProvidersBusy = errors.New("all image providers are busy")
+
+// generate builds the prompt on first run, takes a slot on a provider and draws the image.
+func (s *Service) generate(ctx context.Context, imageJobID string) error {
+	job, err := s.jobs.Find(ctx, imageJobID)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return task.Permanent(errors.New("image job not found"))
+	}
+	if job.Done() {
+		return nil
+	}
+	if job.FinalPrompt == "" {
+		preset, err := s.presets.FindByID(ctx, job.PresetID)
+		if err != nil {
+			return err
+		}
+		if preset == nil {
+			if preset, _ = s.presets.Active(ctx); preset == nil {
+				return task.Permanent(errors.New("no active image preset"))
+			}
+		}
+		final, negative, err := s.buildPrompt(ctx, preset, job.SessionID, job.MessageID, job.Prompt)
+		if err != nil {
+			return err
+		}
+		if err := s.jobs.SetPrompt(ctx, job.ID, final, negative); err != nil {
+			return err
+		}
+		job.FinalPrompt, job.NegativePrompt = final, negative
+	}
+
+	provider, err := s.acquireProvider(ctx, job)
+	if err != nil {
+		return err
+	}
+	dataURL, err := s.callProvider(ctx, provider, job.FinalPrompt, job.NegativePrompt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider.Name, err)
+	}
+	data, err := decodeDataURL(dataURL)
+	if err != nil {
+		return err
+	}
+	imageKey, thumbnailKey, err := s.storeImage(ctx, data)
+	if err != nil {
+		return err
+	}
+	return s.jobs.Succeed(ctx, job.ID, imageKey, thumbnailKey)
 }
 
-func (s *Service) pickProvider(ctx context.Context) (*model.ImageProvider, error) {
+// acquireProvider walks the active providers in weighted random order, preferring ones this job
+// has not tried yet, and starts the job on the first with a free concurrency slot.
+func (s *Service) acquireProvider(ctx context.Context, job *model.ImageJob) (*model.ImageProvider, error) {
 	list, err := s.providers.ListActive(ctx)
 	if err != nil {
 		return nil, err
@@ -113,10 +268,102 @@ func (s *Service) pickProvider(ctx context.Context) (*model.ImageProvider, error
 	if len(list) == 0 {
 		return nil, errors.New("no active image provider")
 	}
-	if len(list) == 1 {
-		return &list[0], nil
+	tried := map[string]bool{}
+	for _, id := range job.TriedProviderIDs {
+		tried[id] = true
+	}
+	var fresh, retried []model.ImageProvider
+	for _, p := range list {
+		if tried[p.ID] {
+			retried = append(retried, p)
+		} else {
+			fresh = append(fresh, p)
+		}
+	}
+	candidates := append(weightedOrder(fresh), weightedOrder(retried)...)
+	for i := range candidates {
+		p := &candidates[i]
+		ok, err := s.jobs.Start(ctx, job.ID, p.ID, p.MaxConcurrency, runningStaleAfter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return p, nil
+		}
+	}
+	return nil, errProvidersBusy
+}
+
+// weightedOrder shuffles providers so that each position is drawn proportionally to Weight
+// (providers with no weight count as 1).
+func weightedOrder(list []model.ImageProvider) []model.ImageProvider {
+	pool := append([]model.ImageProvider(nil), list...)
+	out := make([]model.ImageProvider, 0, len(pool))
+	for len(pool) > 0 {
+		total := 0
+		for _, p := range pool {
+			total += providerWeight(p)
+		}
+		n := rand.Intn(total)
+		i := 0
+		for ; i < len(pool)-1; i++ {
+			n -= providerWeight(pool[i])
+			if n < 0 {
+				break
+			}
+		}
+		out = append(out, pool[i])
+		pool = append(pool[:i], pool[i+1:]...)
+	}
+	return out
+}
+
+func providerWeight(p model.ImageProvider) int {
+	if p.Weight <= 0 {
+		return 1
+	}
+	return p.Weight
+}
+
+// GetJob returns an image job the actor owns, with signed image URLs.
+func (s *Service) GetJob(ctx context.Context, actor authz.Actor, id string) (*model.ImageJob, error) {
+	job, err := s.jobs.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, authz.ErrNotFound
+	}
+	if err := authz.RequireOwner(actor, job.UserID); err != nil {
+		return nil, err
+	}
+	return s.present(job), nil
+}
+
+// WatchJob calls emit with the job now and on every change until it succeeds or fails, ctx ends
+// or watchTimeout passes.
+func (s *Service) WatchJob(ctx context.Context, actor authz.Actor, id string, emit func(*model.ImageJob)) error {
+	ctx, cancel := context.WithTimeout(ctx, watchTimeout)
+	defer cancel()
+	var last time.Time
+	for {
+		job, err := s.GetJob(ctx, actor, id)
+		if err != nil {
+			return err
+		}
+		if !job.UpdatedAt.Equal(last) {
+			last = job.UpdatedAt
+			emit(job)
+		}
+		if job.Done() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchInterval):
+		}
 	}
-	return &list[rand.Intn(len(list))], nil
 }
 
 type presetInstruction struct {
@@ -136,11 +383,12 @@ func (s *Service) buildPrompt(ctx context.Context, preset *model.ImagePreset, se
 	}
 	var presetCfg presetInstruction
 	_ = json.Unmarshal([]byte(preset.PresetJSON), &presetCfg)
-	system := strings.TrimSpace(presetCfg.Instruction)
+	env := s.promptEnv(ctx, sessionID, history)
+	system := strings.TrimSpace(expand(env, presetCfg.Instruction))
 	if system == "" {
 		system = "You are an expert image prompt engineer. Summarize the dialogue into a concise English prompt for illustration."
 	}
-	style := strings.TrimSpace(presetCfg.Style)
+	style := strings.TrimSpace(expand(env, presetCfg.Style))
 	negative := strings.TrimSpace(presetCfg.Negative)
 
 	builder := strings.Builder{}
@@ -159,11 +407,11 @@ func (s *Service) buildPrompt(ctx context.Context, preset *model.ImagePreset, se
 	if s.llm == nil {
 		return "", "", errors.New("prompt llm unavailable")
 	}
-	reply, err := s.llm.Generate(ctx, builder.String(), modelCfg, nil)
+	reply, err := s.llm.Generate(ctx, llmclient.Conversation(builder.String(), nil), modelCfg)
 	if err != nil {
 		return "", "", fmt.Errorf("prompt llm error: %w", err)
 	}
-	final := strings.TrimSpace(reply)
+	final := strings.TrimSpace(reply.Content)
 	if final == "" {
 		log.Printf("prompt llm empty reply (model=%s, session=%s, message=%s)", modelCfg.ID, sessionID, messageID)
 		return "", "", errors.New("prompt llm returned empty")
@@ -171,6 +419,41 @@ func (s *Service) buildPrompt(ctx context.Context, preset *model.ImagePreset, se
 	return final, negative, nil
 }
 
+// promptEnv lets preset instructions use the chat macros. Variables are read from the session but
+// changes are not saved; only chat turns update them.
+func (s *Service) promptEnv(ctx context.Context, sessionID string, history []model.ChatMessage) *macro.Env {
+	session, err := s.chats.FindSession(ctx, sessionID)
+	if err != nil {
+		session = nil
+	}
+	env := macro.SessionEnv(session, history)
+	env.Char, env.User = "Character", "User"
+	if session == nil {
+		return env
+	}
+	if s.roles != nil {
+		if role, err := s.roles.FindByID(ctx, session.RoleID); err == nil && role != nil {
+			env.Char = role.Name
+		}
+	}
+	if s.personas != nil {
+		if p, err := s.personas.Resolve(ctx, session.UserID, session.PersonaID); err == nil && p != nil && p.Name != "" {
+			env.User = p.Name
+		}
+	}
+	return env
+}
+
+// expand renders the macros in text, falling back to the text as written when it is malformed.
+func expand(env *macro.Env, text string) string {
+	out, err := macro.Render(text, env)
+	if err != nil {
+		log.Printf("render image preset macros err=%v", err)
+		return text
+	}
+	return out
+}
+
 // --- helpers for NovelAI ---
 
 func isNovelAIHost(base string) bool {
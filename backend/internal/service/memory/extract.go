@@ -0,0 +1,238 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/llm"
+	"github.com/example/ai-avatar-studio/internal/task"
+)
+
+// JobExtract is the job type that distils durable facts about the user out of one chat exchange.
+const JobExtract = "memory.extract"
+
+// maxExchangeRunes bounds each side of the exchange sent to the extraction model.
+const maxExchangeRunes = 4000
+
+type extractPayload struct {
+	UserID    string `json:"user_id"`
+	RoleID    string `json:"role_id"`
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// extraction is the JSON the model is asked to reply with.
+type extraction struct {
+	Add []struct {
+		Kind    string `json:"kind"`
+		Content string `json:"content"`
+	} `json:"add"`
+	Update []struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	} `json:"update"`
+}
+
+const extractInstructions = `You maintain the long-term memory a roleplay character keeps about the user.
+Read the latest exchange and extract durable facts worth remembering in future conversations:
+the user's name and identity, relationships, likes and dislikes, and promises either side made.
+Ignore small talk, in-scene actions and anything that only matters for this moment.
+Each fact is one short sentence about the user written in the third person.
+
+Existing memories are listed with their ids. Never add a fact that is already known. When the
+exchange refines or contradicts an existing memory, rewrite it through "update" instead.
+
+Reply with JSON only, no prose:
+{"add":[{"kind":"name|relationship|preference|promise|fact","content":"..."}],"update":[{"id":"...","content":"..."}]}
+Reply {"add":[],"update":[]} when there is nothing to remember.`
+
+// EnqueueExtraction schedules memory extraction for a finished exchange. Extraction is best
+// effort, so a failure to queue it is only logged.
+func (s *Service) EnqueueExtraction(ctx context.Context, userID, roleID, userText, reply string) {
+	if strings.TrimSpace(userText) == "" {
+		return
+	}
+	payload := extractPayload{
+		UserID:    userID,
+		RoleID:    roleID,
+		User:      truncateRunes(userText, maxExchangeRunes),
+		Assistant: truncateRunes(reply, maxExchangeRunes),
+	}
+	if s.jobs == nil {
+		log.Printf("enqueue memory extraction user=%s role=%s err=job queue not configured", userID, roleID)
+		return
+	}
+	if _, err := s.jobs.Enqueue(ctx, JobExtract, payload, task.MaxAttempts(3)); err != nil {
+		log.Printf("enqueue memory extraction user=%s role=%s err=%v", userID, roleID, err)
+	}
+}
+
+// RegisterJobs binds the memory job handlers to the queue.
+func (s *Service) RegisterJobs(q *task.Queue) {
+	q.Register(JobExtract, func(ctx context.Context, job *model.Job) error {
+		var p extractPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return task.Permanent(err)
+		}
+		return s.extract(ctx, p)
+	})
+}
+
+func (s *Service) extract(ctx context.Context, p extractPayload) error {
+	modelCfg, err := s.extractionModel(ctx)
+	if err != nil {
+		return err
+	}
+	if modelCfg == nil {
+		return nil
+	}
+	existing, err := s.repo.List(ctx, p.UserID, p.RoleID)
+	if err != nil {
+		return err
+	}
+	out, err := s.llm.Generate(ctx, llm.Conversation(extractionPrompt(existing, p), nil), modelCfg)
+	if err != nil {
+		return err
+	}
+	result, err := parseExtraction(out.Content)
+	if err != nil {
+		// Retrying the same exchange rarely fixes a model that ignores the format.
+		return task.Permanent(err)
+	}
+	return s.merge(ctx, p.UserID, p.RoleID, existing, result)
+}
+
+// extractionModel returns the configured extraction model, falling back to the default model.
+// It returns nil when no usable model is configured, in which case extraction is skipped.
+func (s *Service) extractionModel(ctx context.Context) (*model.ModelConfig, error) {
+	if s.configs == nil || s.llm == nil {
+		return nil, nil
+	}
+	if s.modelID != "" {
+		cfg, err := s.configs.FindModel(ctx, s.modelID)
+		if err != nil {
+			return nil, err
+		}
+		if cfg != nil && cfg.Serviceable() {
+			return cfg, nil
+		}
+		log.Printf("memory: extraction model %s unavailable, using the default model", s.modelID)
+	}
+	cfg, err := s.configs.DefaultModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil || !cfg.Serviceable() || cfg.Provider == "mock" {
+		return nil, nil
+	}
+	return cfg, nil
+}
+
+func extractionPrompt(existing []model.MemoryCapsule, p extractPayload) string {
+	var b strings.Builder
+	b.WriteString(extractInstructions)
+	b.WriteString("\n\nExisting memories:\n")
+	if len(existing) == 0 {
+		b.WriteString("(none)\n")
+	}
+	for _, m := range existing {
+		fmt.Fprintf(&b, "- [%s] (%s) %s\n", m.ID, m.Kind, m.Content)
+	}
+	b.WriteString("\nLatest exchange:\n")
+	fmt.Fprintf(&b, "user: %s\n", p.User)
+	if p.Assistant != "" {
+		fmt.Fprintf(&b, "assistant: %s\n", p.Assistant)
+	}
+	return b.String()
+}
+
+// parseExtraction decodes the model reply, tolerating code fences and text around the JSON object.
+func parseExtraction(raw string) (*extraction, error) {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("memory extraction: reply has no JSON object")
+	}
+	var out extraction
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &out); err != nil {
+		return nil, fmt.Errorf("memory extraction: %w", err)
+	}
+	return &out, nil
+}
+
+// merge applies the extraction against the existing memories. Facts already known (compared after
+// normalising case, spacing and punctuation) are dropped, updates only touch unpinned memories of
+// the same user and role, and malformed entries are skipped.
+func (s *Service) merge(ctx context.Context, userID, roleID string, existing []model.MemoryCapsule, result *extraction) error {
+	byID := make(map[string]*model.MemoryCapsule, len(existing))
+	known := make(map[string]bool, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+		known[normalize(existing[i].Content)] = true
+	}
+	for _, u := range result.Update {
+		capsule := byID[u.ID]
+		content, err := cleanContent(u.Content)
+		if capsule == nil || capsule.Pinned || err != nil {
+			continue
+		}
+		key := normalize(content)
+		if key == normalize(capsule.Content) || known[key] {
+			continue
+		}
+		delete(known, normalize(capsule.Content))
+		capsule.Content = content
+		if err := s.repo.Update(ctx, capsule); err != nil {
+			return err
+		}
+		known[key] = true
+	}
+	for _, a := range result.Add {
+		content, err := cleanContent(a.Content)
+		if err != nil {
+			continue
+		}
+		key := normalize(content)
+		if known[key] {
+			continue
+		}
+		kind := strings.ToLower(strings.TrimSpace(a.Kind))
+		if !model.ValidMemoryKind(kind) {
+			kind = model.MemoryFact
+		}
+		capsule := &model.MemoryCapsule{
+			UserID:  userID,
+			RoleID:  roleID,
+			Kind:    kind,
+			Content: content,
+			Source:  model.MemorySourceExtracted,
+		}
+		if err := s.repo.Create(ctx, capsule); err != nil {
+			return err
+		}
+		known[key] = true
+	}
+	return nil
+}
+
+// normalize reduces a memory to lower-case words so trivial rewordings compare equal.
+func normalize(content string) string {
+	fields := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit])
+}
@@ -2,33 +2,159 @@ package memory
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/pkg/llm"
 	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/example/ai-avatar-studio/internal/task"
 )
 
-// Service represents the long-term preference store per user/role pair.
+// maxContentRunes caps a single memory; memories are facts, not transcripts.
+const maxContentRunes = 500
+
+// Service represents the long-term memory store per user/role pair. Memories are written by the
+// user through the API or extracted from conversations by a background job (see extract.go).
 type Service struct {
-	repo *repository.MemoryRepository
+	repo    memoryStore
+	roles   roleFinder
+	configs *repository.ConfigRepository
+	llm     llm.Client
+	jobs    *task.Queue
+	modelID string
+}
+
+// memoryStore is the part of repository.MemoryRepository the service uses.
+type memoryStore interface {
+	Create(ctx context.Context, capsule *model.MemoryCapsule) error
+	Delete(ctx context.Context, id, userID string) error
+	Find(ctx context.Context, id string) (*model.MemoryCapsule, error)
+	List(ctx context.Context, userID, roleID string) ([]model.MemoryCapsule, error)
+	Update(ctx context.Context, capsule *model.MemoryCapsule) error
+}
+
+type roleFinder interface {
+	FindByID(ctx context.Context, id string) (*model.Role, error)
+}
+
+// NewService wires the memory store. modelID names the models.id used for extraction; when empty
+// the default model is used.
+func NewService(repo *repository.MemoryRepository, roles *repository.RoleRepository, configs *repository.ConfigRepository, client llm.Client, jobs *task.Queue, modelID string) *Service {
+	return &Service{
+		repo:    repo,
+		roles:   roles,
+		configs: configs,
+		llm:     client,
+		jobs:    jobs,
+		modelID: strings.TrimSpace(modelID),
+	}
 }
 
-func NewService(repo *repository.MemoryRepository) *Service {
-	return &Service{repo: repo}
+// MemoryPatch lists the fields a user may change; nil fields are left alone.
+type MemoryPatch struct {
+	Kind    *string `json:"kind"`
+	Content *string `json:"content"`
+	Pinned  *bool   `json:"pinned"`
 }
 
 func (s *Service) List(ctx context.Context, userID, roleID string) ([]model.MemoryCapsule, error) {
 	return s.repo.List(ctx, userID, roleID)
 }
 
-func (s *Service) Remember(ctx context.Context, userID, roleID, content string) error {
-	if strings.TrimSpace(content) == "" {
-		return nil
+// Create stores a memory the user wrote themselves.
+func (s *Service) Create(ctx context.Context, userID, roleID, kind, content string, pinned bool) (*model.MemoryCapsule, error) {
+	role, err := s.roles.FindByID(ctx, roleID)
+	if err != nil {
+		return nil, err
 	}
-	capsule := &model.MemoryCapsule{UserID: userID, RoleID: roleID, Content: content}
-	return s.repo.Create(ctx, capsule)
+	if role == nil {
+		return nil, authz.ErrNotFound
+	}
+	content, err = cleanContent(content)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "" {
+		kind = model.MemoryFact
+	}
+	if !model.ValidMemoryKind(kind) {
+		return nil, errors.New("invalid kind")
+	}
+	capsule := &model.MemoryCapsule{
+		UserID:  userID,
+		RoleID:  roleID,
+		Kind:    kind,
+		Content: content,
+		Pinned:  pinned,
+		Source:  model.MemorySourceUser,
+	}
+	if err := s.repo.Create(ctx, capsule); err != nil {
+		return nil, err
+	}
+	return capsule, nil
 }
 
-func (s *Service) Forget(ctx context.Context, userID, capsuleID string) error {
-	return s.repo.Delete(ctx, capsuleID, userID)
+// Update applies a patch to a memory of roleID owned by the actor.
+func (s *Service) Update(ctx context.Context, actor authz.Actor, roleID, capsuleID string, patch MemoryPatch) (*model.MemoryCapsule, error) {
+	capsule, err := s.find(ctx, actor, roleID, capsuleID)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Kind != nil {
+		if !model.ValidMemoryKind(*patch.Kind) {
+			return nil, errors.New("invalid kind")
+		}
+		capsule.Kind = *patch.Kind
+	}
+	if patch.Content != nil {
+		content, err := cleanContent(*patch.Content)
+		if err != nil {
+			return nil, err
+		}
+		capsule.Content = content
+	}
+	if patch.Pinned != nil {
+		capsule.Pinned = *patch.Pinned
+	}
+	if err := s.repo.Update(ctx, capsule); err != nil {
+		return nil, err
+	}
+	return capsule, nil
+}
+
+// Forget deletes a memory of roleID owned by the actor.
+func (s *Service) Forget(ctx context.Context, actor authz.Actor, roleID, capsuleID string) error {
+	capsule, err := s.find(ctx, actor, roleID, capsuleID)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, capsule.ID, capsule.UserID)
+}
+
+func (s *Service) find(ctx context.Context, actor authz.Actor, roleID, capsuleID string) (*model.MemoryCapsule, error) {
+	capsule, err := s.repo.Find(ctx, capsuleID)
+	if err != nil {
+		return nil, err
+	}
+	if capsule == nil || capsule.RoleID != roleID {
+		return nil, authz.ErrNotFound
+	}
+	if err := authz.RequireOwner(actor, capsule.UserID); err != nil {
+		return nil, err
+	}
+	return capsule, nil
+}
+
+func cleanContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", errors.New("content is required")
+	}
+	if utf8.RuneCountInString(content) > maxContentRunes {
+		return "", errors.New("content is too long")
+	}
+	return content, nil
 }
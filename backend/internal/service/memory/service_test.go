@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+)
+
+// fakeMemories holds one memory, m1, that "owner" keeps about role r1.
+type fakeMemories struct {
+	memoryStore
+	writes int
+}
+
+func (f *fakeMemories) Find(_ context.Context, id string) (*model.MemoryCapsule, error) {
+	if id != "m1" {
+		return nil, nil
+	}
+	return &model.MemoryCapsule{ID: "m1", UserID: "owner", RoleID: "r1", Kind: model.MemoryFact, Content: "likes tea"}, nil
+}
+
+func (f *fakeMemories) Update(context.Context, *model.MemoryCapsule) error { f.writes++; return nil }
+
+func (f *fakeMemories) Delete(context.Context, string, string) error { f.writes++; return nil }
+
+func TestMemoryOwnership(t *testing.T) {
+	content := "likes green tea"
+	ops := []struct {
+		name string
+		call func(s *Service, actor authz.Actor, roleID, id string) error
+	}{
+		{"Update", func(s *Service, a authz.Actor, roleID, id string) error {
+			_, err := s.Update(context.Background(), a, roleID, id, MemoryPatch{Content: &content})
+			return err
+		}},
+		{"Forget", func(s *Service, a authz.Actor, roleID, id string) error {
+			return s.Forget(context.Background(), a, roleID, id)
+		}},
+	}
+	actors := []struct {
+		name    string
+		actor   authz.Actor
+		allowed bool
+	}{
+		{"owner", authz.Actor{UserID: "owner"}, true},
+		{"non-owner", authz.Actor{UserID: "stranger"}, false},
+		{"admin", authz.Actor{UserID: "admin", IsAdmin: true}, true},
+		{"anonymous", authz.Actor{}, false},
+	}
+	for _, op := range ops {
+		for _, a := range actors {
+			t.Run(op.name+"/"+a.name, func(t *testing.T) {
+				repo := &fakeMemories{}
+				err := op.call(&Service{repo: repo}, a.actor, "r1", "m1")
+				if a.allowed && err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				if !a.allowed {
+					if !errors.Is(err, authz.ErrForbidden) {
+						t.Fatalf("err = %v, want ErrForbidden", err)
+					}
+					if repo.writes != 0 {
+						t.Fatalf("denied call wrote %d times", repo.writes)
+					}
+				}
+			})
+		}
+		t.Run(op.name+"/other role", func(t *testing.T) {
+			repo := &fakeMemories{}
+			err := op.call(&Service{repo: repo}, authz.Actor{UserID: "owner"}, "r2", "m1")
+			if !errors.Is(err, authz.ErrNotFound) || repo.writes != 0 {
+				t.Fatalf("err = %v, writes = %d; want ErrNotFound and no writes", err, repo.writes)
+			}
+		})
+		t.Run(op.name+"/missing", func(t *testing.T) {
+			err := op.call(&Service{repo: &fakeMemories{}}, authz.Actor{UserID: "owner"}, "r1", "m2")
+			if !errors.Is(err, authz.ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
@@ -2,11 +2,16 @@ package notification
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/example/ai-avatar-studio/internal/model"
 	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/example/ai-avatar-studio/internal/task"
 )
 
+// JobCreate is the job type that stores a notification; its payload is a model.Notification.
+const JobCreate = "notification.create"
+
 // Service surfaces notification list + mark-read flows.
 type Service struct {
 	repo *repository.NotificationRepository
@@ -26,3 +31,14 @@ func (s *Service) MarkRead(ctx context.Context, userID, notificationID string) e
 	}
 	return s.repo.MarkRead(ctx, userID, notificationID)
 }
+
+// RegisterJobs binds the notification job handlers to the queue.
+func (s *Service) RegisterJobs(q *task.Queue) {
+	q.Register(JobCreate, func(ctx context.Context, job *model.Job) error {
+		var n model.Notification
+		if err := json.Unmarshal(job.Payload, &n); err != nil {
+			return task.Permanent(err)
+		}
+		return s.repo.Create(ctx, &n)
+	})
+}
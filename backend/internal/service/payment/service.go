@@ -125,6 +125,10 @@ func (s *Service) HandleNotify(ctx context.Context, payload map[string]string) (
 		return nil, fmt.Errorf("order not found")
 	}
 	if order.Status == "paid" {
+		// Re-apply the idempotent credit in case a previous callback died between MarkPaid and the ledger write.
+		if err := s.creditOrder(ctx, order); err != nil {
+			return nil, err
+		}
 		return order, nil
 	}
 	// amount check
@@ -139,13 +143,7 @@ func (s *Service) HandleNotify(ctx context.Context, payload map[string]string) (
 	if updated == nil {
 		return order, nil
 	}
-	// credit coins
-	asset, err := s.assets.GetByUser(ctx, updated.UserID)
-	if err != nil {
-		return nil, err
-	}
-	asset.Balance += updated.Coins
-	if err := s.assets.Upsert(ctx, asset); err != nil {
+	if err := s.creditOrder(ctx, updated); err != nil {
 		return nil, err
 	}
 	// Notify user
@@ -160,6 +158,18 @@ func (s *Service) HandleNotify(ctx context.Context, payload map[string]string) (
 	return updated, nil
 }
 
+// creditOrder credits the order's coins through the ledger, keyed by out_trade_no so it happens at most once.
+func (s *Service) creditOrder(ctx context.Context, order *model.PaymentOrder) error {
+	_, err := s.assets.ApplyDelta(ctx, repository.CoinDelta{
+		UserID:         order.UserID,
+		Amount:         order.Coins,
+		Reason:         model.LedgerReasonRecharge,
+		IdempotencyKey: "recharge:" + order.OutTradeNo,
+		RefID:          order.ID,
+	})
+	return err
+}
+
 func (s *Service) Query(ctx context.Context, outTradeNo string) (*model.PaymentOrder, error) {
 	return s.payments.FindByOutTradeNo(ctx, outTradeNo)
 }
@@ -0,0 +1,165 @@
+package persona
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/repository"
+)
+
+const (
+	maxPersonas       = 20
+	maxNameRunes      = 50
+	maxDescRunes      = 2000
+	maxAvatarURLRunes = 512
+)
+
+// Service manages the personas users play in chats.
+type Service struct {
+	repo personaStore
+}
+
+// personaStore is the part of repository.PersonaRepository the service uses.
+type personaStore interface {
+	Create(ctx context.Context, p *model.Persona, limit int) error
+	Delete(ctx context.Context, id string) error
+	Find(ctx context.Context, id string) (*model.Persona, error)
+	FindDefault(ctx context.Context, userID string) (*model.Persona, error)
+	ListByUser(ctx context.Context, userID string) ([]model.Persona, error)
+	SetDefault(ctx context.Context, userID, id string) error
+	Update(ctx context.Context, p *model.Persona) error
+}
+
+func NewService(repo *repository.PersonaRepository) *Service {
+	return &Service{repo: repo}
+}
+
+// Input carries persona fields; nil fields are left alone on update.
+type Input struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+func (s *Service) List(ctx context.Context, userID string) ([]model.Persona, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// Create adds a persona; the user's first persona becomes their default.
+func (s *Service) Create(ctx context.Context, userID string, in Input) (*model.Persona, error) {
+	p := &model.Persona{UserID: userID}
+	if err := apply(p, in); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	err := s.repo.Create(ctx, p, maxPersonas)
+	if errors.Is(err, repository.ErrPersonaLimit) {
+		return nil, errors.New("too many personas")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Service) Update(ctx context.Context, actor authz.Actor, id string, in Input) (*model.Persona, error) {
+	p, err := s.owned(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(p, in); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if err := s.repo.Update(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Delete removes a persona; sessions using it fall back to the default persona. Deleting the
+// default promotes the user's oldest remaining persona.
+func (s *Service) Delete(ctx context.Context, actor authz.Actor, id string) error {
+	p, err := s.owned(ctx, actor, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, p.ID)
+}
+
+// SetDefault makes the persona its owner's default.
+func (s *Service) SetDefault(ctx context.Context, actor authz.Actor, id string) (*model.Persona, error) {
+	p, err := s.owned(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetDefault(ctx, p.UserID, p.ID); err != nil {
+		return nil, err
+	}
+	p.IsDefault = true
+	return p, nil
+}
+
+// Owned returns the persona when it belongs to userID, for callers attaching it elsewhere.
+func (s *Service) Owned(ctx context.Context, userID, id string) (*model.Persona, error) {
+	return s.owned(ctx, authz.Actor{UserID: userID}, id)
+}
+
+// Resolve returns the persona a user plays in a session: the session's override when it still
+// belongs to them, else their default. It returns nil when the user has neither.
+func (s *Service) Resolve(ctx context.Context, userID, personaID string) (*model.Persona, error) {
+	if personaID != "" {
+		p, err := s.repo.Find(ctx, personaID)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && p.UserID == userID {
+			return p, nil
+		}
+	}
+	return s.repo.FindDefault(ctx, userID)
+}
+
+func (s *Service) owned(ctx context.Context, actor authz.Actor, id string) (*model.Persona, error) {
+	p, err := s.repo.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, authz.ErrNotFound
+	}
+	if err := authz.RequireOwner(actor, p.UserID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func apply(p *model.Persona, in Input) error {
+	if in.Name != nil {
+		p.Name = strings.TrimSpace(*in.Name)
+		if utf8.RuneCountInString(p.Name) > maxNameRunes {
+			return errors.New("name is too long")
+		}
+	}
+	if in.Description != nil {
+		p.Description = strings.TrimSpace(*in.Description)
+		if utf8.RuneCountInString(p.Description) > maxDescRunes {
+			return errors.New("description is too long")
+		}
+	}
+	if in.AvatarURL != nil {
+		p.AvatarURL = strings.TrimSpace(*in.AvatarURL)
+		if utf8.RuneCountInString(p.AvatarURL) > maxAvatarURLRunes {
+			return errors.New("avatar_url is too long")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package persona
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/repository"
+)
+
+// fakePersonas holds one persona, p1, belonging to "owner", and stores created ones up to the limit.
+type fakePersonas struct {
+	personaStore
+	writes  int
+	created []*model.Persona
+}
+
+func (f *fakePersonas) Create(_ context.Context, p *model.Persona, limit int) error {
+	if len(f.created) >= limit {
+		return repository.ErrPersonaLimit
+	}
+	p.IsDefault = len(f.created) == 0
+	f.created = append(f.created, p)
+	return nil
+}
+
+func (f *fakePersonas) Find(_ context.Context, id string) (*model.Persona, error) {
+	if id != "p1" {
+		return nil, nil
+	}
+	return &model.Persona{ID: "p1", UserID: "owner", Name: "Sam"}, nil
+}
+
+func (f *fakePersonas) Update(context.Context, *model.Persona) error { f.writes++; return nil }
+
+func (f *fakePersonas) Delete(context.Context, string) error { f.writes++; return nil }
+
+func (f *fakePersonas) SetDefault(context.Context, string, string) error { f.writes++; return nil }
+
+func TestPersonaOwnership(t *testing.T) {
+	name := "Alex"
+	ops := []struct {
+		name string
+		call func(s *Service, actor authz.Actor, id string) error
+	}{
+		{"Update", func(s *Service, a authz.Actor, id string) error {
+			_, err := s.Update(context.Background(), a, id, Input{Name: &name})
+			return err
+		}},
+		{"Delete", func(s *Service, a authz.Actor, id string) error {
+			return s.Delete(context.Background(), a, id)
+		}},
+		{"SetDefault", func(s *Service, a authz.Actor, id string) error {
+			_, err := s.SetDefault(context.Background(), a, id)
+			return err
+		}},
+	}
+	actors := []struct {
+		name    string
+		actor   authz.Actor
+		allowed bool
+	}{
+		{"owner", authz.Actor{UserID: "owner"}, true},
+		{"non-owner", authz.Actor{UserID: "stranger"}, false},
+		{"admin", authz.Actor{UserID: "admin", IsAdmin: true}, true},
+		{"anonymous", authz.Actor{}, false},
+	}
+	for _, op := range ops {
+		for _, a := range actors {
+			t.Run(op.name+"/"+a.name, func(t *testing.T) {
+				repo := &fakePersonas{}
+				err := op.call(&Service{repo: repo}, a.actor, "p1")
+				if a.allowed && err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				if !a.allowed {
+					if !errors.Is(err, authz.ErrForbidden) {
+						t.Fatalf("err = %v, want ErrForbidden", err)
+					}
+					if repo.writes != 0 {
+						t.Fatalf("denied call wrote %d times", repo.writes)
+					}
+				}
+			})
+		}
+		t.Run(op.name+"/missing", func(t *testing.T) {
+			if err := op.call(&Service{repo: &fakePersonas{}}, authz.Actor{UserID: "owner"}, "p2"); !errors.Is(err, authz.ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestOwnedIgnoresAdminFlagOfCaller(t *testing.T) {
+	// Owned checks against a plain user ID, so a persona cannot be attached to another user's
+	// session even when an admin makes the change.
+	s := &Service{repo: &fakePersonas{}}
+	if _, err := s.Owned(context.Background(), "stranger", "p1"); !errors.Is(err, authz.ErrForbidden) {
+		t.Fatalf("Owned = %v, want ErrForbidden", err)
+	}
+}
+
+func TestCreateStopsAtTheLimit(t *testing.T) {
+	repo := &fakePersonas{}
+	s := &Service{repo: repo}
+	name := "Sam"
+	for i := 0; i < maxPersonas; i++ {
+		p, err := s.Create(context.Background(), "owner", Input{Name: &name})
+		if err != nil {
+			t.Fatalf("persona %d: %v", i, err)
+		}
+		if p.IsDefault != (i == 0) {
+			t.Fatalf("persona %d IsDefault = %v", i, p.IsDefault)
+		}
+	}
+	if _, err := s.Create(context.Background(), "owner", Input{Name: &name}); err == nil || err.Error() != "too many personas" {
+		t.Fatalf("err = %v, want too many personas", err)
+	}
+	blank := " "
+	if _, err := s.Create(context.Background(), "owner", Input{Name: &blank}); err == nil || err.Error() != "name is required" {
+		t.Fatalf("err = %v, want name is required", err)
+	}
+}
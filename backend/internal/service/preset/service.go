@@ -3,8 +3,10 @@ package preset
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/macro"
 	"github.com/example/ai-avatar-studio/internal/repository"
 )
 
@@ -20,6 +22,9 @@ func (s *Service) CreatePreset(ctx context.Context, userID string, req model.Pre
 	if req.Name == "" {
 		return nil, errors.New("preset name is required")
 	}
+	if err := validateBlocks(req.Blocks); err != nil {
+		return nil, err
+	}
 	req.CreatorID = userID
 	if req.Blocks == nil {
 		req.Blocks = []model.PresetBlock{}
@@ -45,6 +50,9 @@ func (s *Service) UpdatePreset(ctx context.Context, userID, presetID string, req
 		return nil, errors.New("forbidden")
 	}
 
+	if err := validateBlocks(req.Blocks); err != nil {
+		return nil, err
+	}
 	existing.Name = req.Name
 	existing.Description = req.Description
 	existing.ModelKey = req.ModelKey
@@ -120,3 +128,17 @@ func (s *Service) PublishPreset(ctx context.Context, userID, presetID string, is
 func (s *Service) ListPublicPresets(ctx context.Context, limit int) ([]model.Preset, error) {
 	return s.repo.ListPublic(ctx, limit)
 }
+
+// validateBlocks rejects blocks whose macros do not parse, naming the block and position.
+func validateBlocks(blocks []model.PresetBlock) error {
+	for i, b := range blocks {
+		if err := macro.Validate(b.Content); err != nil {
+			name := b.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return fmt.Errorf("block %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package rag
+
+import "strings"
+
+const (
+	defaultChunkSize    = 500
+	defaultChunkOverlap = 50
+)
+
+// ChunkText splits text into windows of at most size runes that overlap by overlap runes.
+// Window ends are pulled back to the nearest paragraph or sentence break when one is close.
+func ChunkText(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	runes := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else if cut := lastBreak(runes[start:end], size/5); cut > 0 {
+			end = start + cut
+		}
+		if piece := strings.TrimSpace(string(runes[start:end])); piece != "" {
+			chunks = append(chunks, piece)
+		}
+		if end == len(runes) {
+			break
+		}
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// lastBreak returns the position just after the last break rune within the final window runes of seg.
+func lastBreak(seg []rune, window int) int {
+	for i := len(seg) - 1; i >= len(seg)-window && i > 0; i-- {
+		switch seg[i] {
+		case '\n', '。', '！', '？', '.', '!', '?', '；', ';':
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkTextWindows(t *testing.T) {
+	// Without break runes the windows are exact: size 10, stepping by size - overlap.
+	got := ChunkText("abcdefghijklmnopqrstuvwxyz", 10, 3)
+	want := []string{"abcdefghij", "hijklmnopq", "opqrstuvwx", "vwxyz"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("chunks = %q, want %q", got, want)
+	}
+	if got := ChunkText("short", 10, 3); len(got) != 1 || got[0] != "short" {
+		t.Fatalf("short text = %q", got)
+	}
+	for _, blank := range []string{"", "   \n\t "} {
+		if got := ChunkText(blank, 10, 3); len(got) != 0 {
+			t.Fatalf("ChunkText(%q) = %q, want no chunks", blank, got)
+		}
+	}
+}
+
+func TestChunkTextBreaks(t *testing.T) {
+	// The window end is pulled back to a sentence break in its last size/5 runes...
+	text := strings.Repeat("a", 16) + ". " + strings.Repeat("b", 20)
+	if got := ChunkText(text, 20, 0); got[0] != strings.Repeat("a", 16)+"." {
+		t.Fatalf("first chunk = %q, want it to end at the full stop", got[0])
+	}
+	// ...but not to one further back.
+	text = strings.Repeat("a", 5) + ". " + strings.Repeat("b", 30)
+	if got := ChunkText(text, 20, 0); utf8.RuneCountInString(got[0]) != 20 {
+		t.Fatalf("first chunk = %q, want a full window", got[0])
+	}
+	// Chinese text is measured in runes and breaks after 。
+	text = "一二三四五六七八。九十一二三四五六七八"
+	got := ChunkText(text, 10, 0)
+	if got[0] != "一二三四五六七八。" {
+		t.Fatalf("first chunk = %q", got[0])
+	}
+	for _, c := range got {
+		if n := utf8.RuneCountInString(c); n > 10 {
+			t.Fatalf("chunk %q has %d runes", c, n)
+		}
+	}
+}
+
+func TestChunkTextBadOptions(t *testing.T) {
+	text := strings.Repeat("word ", 300)
+	if got := ChunkText(text, 0, 0); utf8.RuneCountInString(got[0]) > defaultChunkSize || len(got) < 3 {
+		t.Fatalf("size 0: %d chunks, first %d runes", len(got), utf8.RuneCountInString(got[0]))
+	}
+	// An overlap that would never advance is dropped rather than looping.
+	for _, overlap := range []int{-1, 10, 50} {
+		got := ChunkText(text, 10, overlap)
+		if len(got) == 0 || len(got) > len(text) {
+			t.Fatalf("overlap %d: %d chunks", overlap, len(got))
+		}
+	}
+	// Breaks on every other rune with an overlap close to the size still make progress.
+	got := ChunkText(strings.Repeat("a.", 100), 10, 9)
+	if len(got) == 0 || len(got) > 200 {
+		t.Fatalf("%d chunks", len(got))
+	}
+}
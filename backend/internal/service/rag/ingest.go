@@ -0,0 +1,355 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/task"
+)
+
+const (
+	maxDocumentBytes = 4 << 20
+	maxChunkSize     = 4000
+	embedBatchSize   = 32
+)
+
+// ChunkOptions controls how a document is split before embedding; zero values use the defaults.
+type ChunkOptions struct {
+	Size    int
+	Overlap int
+}
+
+func (o ChunkOptions) normalized() (ChunkOptions, error) {
+	if o.Size == 0 {
+		o.Size = defaultChunkSize
+	}
+	if o.Overlap == 0 {
+		o.Overlap = defaultChunkOverlap
+	}
+	if o.Size < 50 || o.Size > maxChunkSize {
+		return o, fmt.Errorf("chunk_size must be between 50 and %d", maxChunkSize)
+	}
+	if o.Overlap < 0 || o.Overlap >= o.Size {
+		return o, errors.New("chunk_overlap must be smaller than chunk_size")
+	}
+	return o, nil
+}
+
+// DetectFormat maps an explicit format or a file name to text, markdown or json.
+func DetectFormat(format, filename string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "text", "txt", "plain":
+		return "text", nil
+	case "markdown", "md":
+		return "markdown", nil
+	case "json":
+		return "json", nil
+	case "":
+	default:
+		return "", errors.New("unsupported format, expected text, markdown or json")
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".md", ".markdown":
+		return "markdown", nil
+	case ".json":
+		return "json", nil
+	case ".txt", "":
+		return "text", nil
+	}
+	return "", errors.New("unsupported file type, expected .txt, .md or .json")
+}
+
+// UploadDocument stores a document for the role and queues background ingestion.
+func (s *Service) UploadDocument(ctx context.Context, roleID, title, source, format, content string, opts ChunkOptions) (*model.Document, error) {
+	if len(content) > maxDocumentBytes {
+		return nil, fmt.Errorf("document too large (limit %dMB)", maxDocumentBytes>>20)
+	}
+	if !utf8.ValidString(content) {
+		return nil, errors.New("document must be UTF-8 text")
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("document is empty")
+	}
+	if format == "json" && !json.Valid([]byte(content)) {
+		return nil, errors.New("invalid json document")
+	}
+	opts, err := opts.normalized()
+	if err != nil {
+		return nil, err
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = strings.TrimSpace(source)
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	doc := &model.Document{
+		RoleID:       roleID,
+		Title:        title,
+		Source:       source,
+		Format:       format,
+		Content:      content,
+		Status:       "pending",
+		ChunkSize:    opts.Size,
+		ChunkOverlap: opts.Overlap,
+	}
+	if err := s.documents.CreateDocument(ctx, doc); err != nil {
+		return nil, err
+	}
+	if err := s.enqueueIngest(ctx, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *Service) ListDocuments(ctx context.Context, roleID string) ([]model.Document, error) {
+	return s.documents.ListByRole(ctx, roleID)
+}
+
+// GetDocument returns the document when it belongs to the role, nil otherwise.
+func (s *Service) GetDocument(ctx context.Context, roleID, documentID string) (*model.Document, error) {
+	doc, err := s.documents.FindDocument(ctx, documentID)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	if doc.RoleID != roleID {
+		return nil, nil
+	}
+	return doc, nil
+}
+
+// Rechunk re-splits and re-embeds a document with new chunk parameters.
+func (s *Service) Rechunk(ctx context.Context, roleID, documentID string, opts ChunkOptions) (*model.Document, error) {
+	doc, err := s.GetDocument(ctx, roleID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, authz.ErrNotFound
+	}
+	if doc.Status == "processing" {
+		return nil, errors.New("document is still processing")
+	}
+	opts, err = opts.normalized()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.documents.UpdateChunking(ctx, doc.ID, opts.Size, opts.Overlap); err != nil {
+		return nil, err
+	}
+	doc.ChunkSize, doc.ChunkOverlap = opts.Size, opts.Overlap
+	doc.Status, doc.Progress, doc.Error = "pending", 0, ""
+	if err := s.enqueueIngest(ctx, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *Service) DeleteDocument(ctx context.Context, roleID, documentID string) error {
+	doc, err := s.GetDocument(ctx, roleID, documentID)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		return authz.ErrNotFound
+	}
+	return s.documents.DeleteDocument(ctx, doc.ID)
+}
+
+// JobIngest is the job type that chunks and embeds a document.
+const JobIngest = "rag.ingest"
+
+type ingestPayload struct {
+	DocumentID string `json:"document_id"`
+}
+
+// enqueueIngest schedules ingestion of the document. A document that cannot be queued is marked
+// failed so it does not sit in "pending" forever; rechunking it retries.
+func (s *Service) enqueueIngest(ctx context.Context, doc *model.Document) error {
+	err := errors.New("job queue not configured")
+	if s.jobs != nil {
+		_, err = s.jobs.Enqueue(ctx, JobIngest, ingestPayload{DocumentID: doc.ID}, task.MaxAttempts(3))
+	}
+	if err != nil {
+		log.Printf("rag: enqueue ingest document=%s: %v", doc.ID, err)
+		_ = s.documents.UpdateProgress(ctx, doc.ID, "failed", 0, doc.ChunkCount, "could not queue ingestion")
+		return err
+	}
+	return nil
+}
+
+// RegisterJobs binds the ingestion job handler to the queue.
+func (s *Service) RegisterJobs(q *task.Queue) {
+	q.Register(JobIngest, func(ctx context.Context, job *model.Job) error {
+		var p ingestPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return task.Permanent(err)
+		}
+		return s.Ingest(ctx, p.DocumentID)
+	})
+}
+
+// Ingest chunks and embeds a stored document, reporting progress after every embedding batch.
+func (s *Service) Ingest(ctx context.Context, documentID string) error {
+	doc, err := s.documents.FindDocument(ctx, documentID)
+	if err != nil || doc == nil {
+		return err
+	}
+	fail := func(err error) error {
+		_ = s.documents.UpdateProgress(ctx, doc.ID, "failed", doc.Progress, doc.ChunkCount, err.Error())
+		return err
+	}
+	if err := s.documents.UpdateProgress(ctx, doc.ID, "processing", 0, doc.ChunkCount, ""); err != nil {
+		return err
+	}
+	text, err := documentText(doc.Format, doc.Content)
+	if err != nil {
+		return fail(err)
+	}
+	pieces := ChunkText(text, doc.ChunkSize, doc.ChunkOverlap)
+	if len(pieces) == 0 {
+		return fail(errors.New("document produced no chunks"))
+	}
+	embedder := s.embedder(ctx)
+	chunks := make([]model.DocumentChunk, 0, len(pieces))
+	for start := 0; start < len(pieces); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(pieces) {
+			end = len(pieces)
+		}
+		vectors, err := embedder.Embed(ctx, pieces[start:end])
+		if err != nil {
+			return fail(fmt.Errorf("embed chunks: %w", err))
+		}
+		for i, vec := range vectors {
+			chunks = append(chunks, model.DocumentChunk{
+				ChunkIndex:     start + i,
+				Content:        pieces[start+i],
+				Embedding:      vec,
+				EmbeddingModel: embedder.Name(),
+			})
+		}
+		// Reserve the final percent for the chunk swap below.
+		_ = s.documents.UpdateProgress(ctx, doc.ID, "processing", end*99/len(pieces), doc.ChunkCount, "")
+	}
+	if err := s.documents.ReplaceChunks(ctx, doc.ID, chunks); err != nil {
+		return fail(err)
+	}
+	return s.documents.UpdateProgress(ctx, doc.ID, "ready", 100, len(chunks), "")
+}
+
+// documentText flattens a stored document into prose suitable for chunking.
+func documentText(format, content string) (string, error) {
+	if format != "json" {
+		return content, nil
+	}
+	var raw interface{}
+	if err := json.Unmarshal([]byte(content), &raw); err != nil {
+		return "", fmt.Errorf("invalid json document: %w", err)
+	}
+	var paragraphs []string
+	if entries := loreEntries(raw); len(entries) > 0 {
+		paragraphs = entries
+	} else {
+		flattenJSON("", raw, &paragraphs)
+	}
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+// loreEntries understands the common worldbook export shape: {"entries": {...}} or [...] whose items
+// carry a "content" field and optional "key"/"keys"/"comment"/"name" labels.
+func loreEntries(raw interface{}) []string {
+	var items []interface{}
+	switch v := raw.(type) {
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		switch entries := v["entries"].(type) {
+		case []interface{}:
+			items = entries
+		case map[string]interface{}:
+			keys := make([]string, 0, len(entries))
+			for k := range entries {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				items = append(items, entries[k])
+			}
+		}
+	}
+	var out []string
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		content, _ := entry["content"].(string)
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		var labels []string
+		for _, field := range []string{"name", "comment", "key", "keys"} {
+			switch label := entry[field].(type) {
+			case string:
+				if strings.TrimSpace(label) != "" {
+					labels = append(labels, strings.TrimSpace(label))
+				}
+			case []interface{}:
+				for _, l := range label {
+					if s, ok := l.(string); ok && strings.TrimSpace(s) != "" {
+						labels = append(labels, strings.TrimSpace(s))
+					}
+				}
+			}
+		}
+		if len(labels) > 0 {
+			out = append(out, strings.Join(labels, ", ")+": "+strings.TrimSpace(content))
+		} else {
+			out = append(out, strings.TrimSpace(content))
+		}
+	}
+	return out
+}
+
+func flattenJSON(prefix string, raw interface{}, out *[]string) {
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			next := k
+			if prefix != "" {
+				next = prefix + "." + k
+			}
+			flattenJSON(next, v[k], out)
+		}
+	case []interface{}:
+		for _, item := range v {
+			flattenJSON(prefix, item, out)
+		}
+	case nil:
+	default:
+		text := strings.TrimSpace(fmt.Sprint(v))
+		if text == "" {
+			return
+		}
+		if prefix != "" {
+			text = prefix + ": " + text
+		}
+		*out = append(*out, text)
+	}
+}
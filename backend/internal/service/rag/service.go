@@ -2,23 +2,66 @@ package rag
 
 import (
 	"context"
+	"log"
+	"net/http"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/embedding"
 	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/example/ai-avatar-studio/internal/task"
 )
 
-// Service exposes a placeholder retrieval augmented generation helper.
+const (
+	retrieveTopK     = 5
+	retrieveMinScore = 0.05
+	// chunkPageSize is how many stored chunks are loaded and scored at a time.
+	chunkPageSize = 500
+)
+
+// Service chunks, embeds and retrieves role-scoped knowledge for prompts.
 type Service struct {
-	documents *repository.DocumentRepository
+	documents        documentStore
+	configs          *repository.ConfigRepository
+	httpClient       *http.Client
+	embeddingModelID string
+	fallback         embedding.Embedder
+	jobs             *task.Queue
 }
 
-func NewService(documents *repository.DocumentRepository) *Service {
-	return &Service{documents: documents}
+// documentStore is the part of repository.DocumentRepository the service uses.
+type documentStore interface {
+	CreateDocument(ctx context.Context, doc *model.Document) error
+	DeleteDocument(ctx context.Context, id string) error
+	FindDocument(ctx context.Context, id string) (*model.Document, error)
+	ListByRole(ctx context.Context, roleID string) ([]model.Document, error)
+	ListChunksByRole(ctx context.Context, roleID, embeddingModel, afterID string, limit int) ([]model.DocumentChunk, error)
+	ReplaceChunks(ctx context.Context, documentID string, chunks []model.DocumentChunk) error
+	UpdateChunking(ctx context.Context, id string, size, overlap int) error
+	UpdateProgress(ctx context.Context, id, status string, progress, chunkCount int, errMsg string) error
 }
 
-// RetrieveContext returns concatenated snippets to enrich prompts.
-func (s *Service) RetrieveContext(ctx context.Context, roleID string) (string, error) {
-	chunks, err := s.documents.ListRecentChunks(ctx, 5)
+// NewService wires the retrieval pipeline. When embeddingModelID is empty (or the model cannot be
+// resolved) the deterministic hashing embedder is used instead of a remote /embeddings endpoint.
+func NewService(documents *repository.DocumentRepository, configs *repository.ConfigRepository, httpClient *http.Client, embeddingModelID string, jobs *task.Queue) *Service {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &Service{
+		documents:        documents,
+		configs:          configs,
+		httpClient:       httpClient,
+		embeddingModelID: strings.TrimSpace(embeddingModelID),
+		fallback:         embedding.NewHashEmbedder(0),
+		jobs:             jobs,
+	}
+}
+
+// RetrieveContext ranks the role's chunks by cosine similarity to query and returns the best snippets.
+func (s *Service) RetrieveContext(ctx context.Context, roleID, query string) (string, error) {
+	chunks, err := s.Search(ctx, roleID, query, retrieveTopK)
 	if err != nil {
 		return "", err
 	}
@@ -28,3 +71,64 @@ func (s *Service) RetrieveContext(ctx context.Context, roleID string) (string, e
 	}
 	return strings.Join(builder, "\n---\n"), nil
 }
+
+// Search returns up to topK chunks of the role ordered by similarity to query. Only chunks embedded
+// by the current embedder are comparable; the query is embedded once the first of them is found.
+func (s *Service) Search(ctx context.Context, roleID, query string, topK int) ([]model.DocumentChunk, error) {
+	if strings.TrimSpace(roleID) == "" || strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	embedder := s.embedder(ctx)
+	var queryVec []float32
+	var ranked []model.DocumentChunk
+	for afterID := ""; ; {
+		page, err := s.documents.ListChunksByRole(ctx, roleID, embedder.Name(), afterID, chunkPageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		if queryVec == nil {
+			vectors, err := embedder.Embed(ctx, []string{query})
+			if err != nil {
+				return nil, err
+			}
+			queryVec = vectors[0]
+		}
+		for _, chunk := range page {
+			chunk.Score = embedding.Cosine(queryVec, chunk.Embedding)
+			if chunk.Score < retrieveMinScore {
+				continue
+			}
+			ranked = append(ranked, chunk)
+		}
+		ranked = topChunks(ranked, topK)
+		if len(page) < chunkPageSize {
+			break
+		}
+		afterID = page[len(page)-1].ID
+	}
+	return ranked, nil
+}
+
+// topChunks orders chunks by descending score and keeps the first topK (all when topK <= 0).
+func topChunks(chunks []model.DocumentChunk, topK int) []model.DocumentChunk {
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Score > chunks[j].Score })
+	if topK > 0 && len(chunks) > topK {
+		chunks = chunks[:topK]
+	}
+	return chunks
+}
+
+func (s *Service) embedder(ctx context.Context) embedding.Embedder {
+	if s.embeddingModelID == "" || s.configs == nil {
+		return s.fallback
+	}
+	cfg, err := s.configs.FindModel(ctx, s.embeddingModelID)
+	if err != nil || cfg == nil || cfg.APIKey == "" {
+		log.Printf("rag: embedding model %s unavailable (err=%v), using %s", s.embeddingModelID, err, s.fallback.Name())
+		return s.fallback
+	}
+	return embedding.NewHTTPEmbedder(s.httpClient, cfg)
+}
@@ -0,0 +1,219 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+	"github.com/example/ai-avatar-studio/internal/pkg/embedding"
+)
+
+// fakeDocuments holds document d1 of role r1 and the chunks stored for it.
+type fakeDocuments struct {
+	documentStore
+	doc    model.Document
+	chunks []model.DocumentChunk
+	status string
+	pages  int
+}
+
+func (f *fakeDocuments) FindDocument(_ context.Context, id string) (*model.Document, error) {
+	if id != f.doc.ID {
+		return nil, nil
+	}
+	doc := f.doc
+	return &doc, nil
+}
+
+func (f *fakeDocuments) UpdateProgress(_ context.Context, _, status string, _, _ int, _ string) error {
+	f.status = status
+	return nil
+}
+
+func (f *fakeDocuments) ReplaceChunks(_ context.Context, _ string, chunks []model.DocumentChunk) error {
+	f.chunks = chunks
+	return nil
+}
+
+func (f *fakeDocuments) ListChunksByRole(_ context.Context, roleID, embeddingModel, afterID string, limit int) ([]model.DocumentChunk, error) {
+	if roleID != f.doc.RoleID {
+		return nil, nil
+	}
+	f.pages++
+	var page []model.DocumentChunk
+	for _, c := range f.chunks {
+		if c.EmbeddingModel == embeddingModel && c.ID > afterID && len(page) < limit {
+			page = append(page, c)
+		}
+	}
+	return page, nil
+}
+
+// countingEmbedder counts the calls that would be paid for with a remote embedder.
+type countingEmbedder struct {
+	embedding.Embedder
+	calls int
+}
+
+func (c *countingEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	c.calls++
+	return c.Embedder.Embed(ctx, inputs)
+}
+
+var lore = []string{
+	"The lighthouse keeper Mara lights the lamp every night at the harbour.",
+	"Dragons sleep in the northern mountains and guard their gold.",
+	"The harbour market sells fish and rope at dawn.",
+	"Mara's brother sails the harbour ferry.",
+	"Winter snow closes the mountain passes.",
+	"The library keeps maps of the old harbour.",
+	"The harbour bell rings when ships return to the harbour.",
+}
+
+func TestIngest(t *testing.T) {
+	text := strings.Join(lore, "\n")
+	docs := &fakeDocuments{doc: model.Document{ID: "d1", RoleID: "r1", Format: "text", Content: text, ChunkSize: 80}}
+	s := &Service{documents: docs, fallback: embedding.NewHashEmbedder(0)}
+	if err := s.Ingest(context.Background(), "d1"); err != nil {
+		t.Fatal(err)
+	}
+	pieces := ChunkText(text, 80, 0)
+	if docs.status != "ready" || len(docs.chunks) != len(pieces) {
+		t.Fatalf("status = %s, %d chunks, want %d", docs.status, len(docs.chunks), len(pieces))
+	}
+	vectors, _ := s.fallback.Embed(context.Background(), pieces)
+	for i, c := range docs.chunks {
+		if c.ChunkIndex != i || c.Content != pieces[i] || c.EmbeddingModel != "hash-256" || embedding.Cosine(c.Embedding, vectors[i]) < 0.999 {
+			t.Fatalf("chunk %d = %+v", i, c)
+		}
+	}
+}
+
+// indexed returns a service whose role r1 has one hash-embedded chunk per lore line, in ID order.
+func indexed(t *testing.T) (*Service, *fakeDocuments) {
+	t.Helper()
+	s := &Service{fallback: embedding.NewHashEmbedder(0)}
+	vectors, err := s.fallback.Embed(context.Background(), lore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := &fakeDocuments{doc: model.Document{ID: "d1", RoleID: "r1"}}
+	for i, line := range lore {
+		docs.chunks = append(docs.chunks, model.DocumentChunk{ID: fmt.Sprintf("c%05d", i), DocumentID: "d1", ChunkIndex: i, Content: line, Embedding: vectors[i], EmbeddingModel: s.fallback.Name()})
+	}
+	s.documents = docs
+	return s, docs
+}
+
+func TestSearchRanking(t *testing.T) {
+	s, docs := indexed(t)
+	// A chunk embedded by another model is never compared, even with the same text.
+	docs.chunks = append(docs.chunks, model.DocumentChunk{ID: "c99999", Content: "Mara harbour lighthouse", Embedding: docs.chunks[0].Embedding, EmbeddingModel: "model:other"})
+
+	got, err := s.Search(context.Background(), "r1", "Where does Mara keep the lighthouse lamp?", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[0].Content != lore[0] {
+		t.Fatalf("top chunk = %+v, want the lighthouse", got)
+	}
+	if len(got) > 3 {
+		t.Fatalf("%d results, want at most topK", len(got))
+	}
+	for i, c := range got {
+		if c.EmbeddingModel != "hash-256" {
+			t.Fatalf("result from %s", c.EmbeddingModel)
+		}
+		if c.Score < retrieveMinScore || (i > 0 && c.Score > got[i-1].Score) {
+			t.Fatalf("scores not descending above the minimum: %v", got)
+		}
+	}
+
+	// Only chunks that share words with the query pass the minimum score.
+	got, _ = s.Search(context.Background(), "r1", "dragons gold", 0)
+	if len(got) != 1 || got[0].Content != lore[1] {
+		t.Fatalf("dragon search = %+v", got)
+	}
+	if got, _ := s.Search(context.Background(), "r1", "zzz qqq", 0); len(got) != 0 {
+		t.Fatalf("unrelated query matched %+v", got)
+	}
+	for _, args := range [][2]string{{"r2", "harbour"}, {"", "harbour"}, {"r1", "  "}} {
+		if got, err := s.Search(context.Background(), args[0], args[1], 0); err != nil || len(got) != 0 {
+			t.Fatalf("Search(%q, %q) = %v, %v", args[0], args[1], got, err)
+		}
+	}
+}
+
+func TestSearchPagesThroughEveryChunk(t *testing.T) {
+	s, docs := indexed(t)
+	// Bury the only dragon chunk behind two full pages of filler.
+	dragons := docs.chunks[1]
+	docs.chunks = nil
+	filler, _ := s.fallback.Embed(context.Background(), []string{"The harbour market sells fish."})
+	for i := 0; i < 2*chunkPageSize; i++ {
+		docs.chunks = append(docs.chunks, model.DocumentChunk{ID: fmt.Sprintf("c%05d", i), Content: "filler", Embedding: filler[0], EmbeddingModel: s.fallback.Name()})
+	}
+	dragons.ID = fmt.Sprintf("c%05d", 2*chunkPageSize)
+	docs.chunks = append(docs.chunks, dragons)
+
+	got, err := s.Search(context.Background(), "r1", "dragons gold", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Content != lore[1] {
+		t.Fatalf("got %+v, want the chunk on the last page", got)
+	}
+	if docs.pages != 3 {
+		t.Fatalf("%d pages loaded, want 3", docs.pages)
+	}
+}
+
+func TestSearchSkipsTheQueryEmbeddingWithoutChunks(t *testing.T) {
+	s, docs := indexed(t)
+	counter := &countingEmbedder{Embedder: s.fallback}
+	s.fallback = counter
+	if _, err := s.Search(context.Background(), "r1", "harbour", 0); err != nil || counter.calls != 1 {
+		t.Fatalf("err = %v, %d embeddings", err, counter.calls)
+	}
+	// Chunks embedded by another model cannot be compared, so the query is not embedded at all.
+	for i := range docs.chunks {
+		docs.chunks[i].EmbeddingModel = "model:other"
+	}
+	counter.calls = 0
+	if got, err := s.Search(context.Background(), "r1", "harbour", 0); err != nil || len(got) != 0 || counter.calls != 0 {
+		t.Fatalf("got %v, err = %v, %d embeddings", got, err, counter.calls)
+	}
+}
+
+func TestRetrieveContext(t *testing.T) {
+	s, _ := indexed(t)
+	got, err := s.RetrieveContext(context.Background(), "r1", "harbour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(got, "\n---\n")
+	if len(parts) != retrieveTopK {
+		t.Fatalf("%d snippets, want %d:\n%s", len(parts), retrieveTopK, got)
+	}
+	// The chunk that names the harbour twice ranks first.
+	if parts[0] != lore[6] {
+		t.Fatalf("first snippet = %q", parts[0])
+	}
+}
+
+func TestDocumentOfAnotherRoleIsNotFound(t *testing.T) {
+	docs := &fakeDocuments{doc: model.Document{ID: "d1", RoleID: "r1", Status: "ready"}}
+	s := &Service{documents: docs, fallback: embedding.NewHashEmbedder(0)}
+	for _, args := range [][2]string{{"r1", "missing"}, {"r2", "d1"}} {
+		if err := s.DeleteDocument(context.Background(), args[0], args[1]); !errors.Is(err, authz.ErrNotFound) {
+			t.Fatalf("DeleteDocument(%s, %s) = %v, want ErrNotFound", args[0], args[1], err)
+		}
+		if _, err := s.Rechunk(context.Background(), args[0], args[1], ChunkOptions{}); !errors.Is(err, authz.ErrNotFound) {
+			t.Fatalf("Rechunk(%s, %s) = %v, want ErrNotFound", args[0], args[1], err)
+		}
+	}
+}
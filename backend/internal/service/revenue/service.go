@@ -7,15 +7,20 @@ import (
 
 	"github.com/example/ai-avatar-studio/internal/model"
 	"github.com/example/ai-avatar-studio/internal/repository"
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrDuplicateTip is returned when a tip with the same idempotency key was already processed.
+var ErrDuplicateTip = errors.New("tip already processed")
+
 // Service encapsulates wallet accounting rules.
 type Service struct {
-	repo *repository.RevenueRepository
+	repo   *repository.RevenueRepository
+	assets *repository.UserAssetRepository
 }
 
-func NewService(repo *repository.RevenueRepository) *Service {
-	return &Service{repo: repo}
+func NewService(repo *repository.RevenueRepository, assets *repository.UserAssetRepository) *Service {
+	return &Service{repo: repo, assets: assets}
 }
 
 // RecordEvent stores a revenue event and updates the creator wallet.
@@ -41,6 +46,52 @@ func (s *Service) RecordEvent(ctx context.Context, creatorID, userID, roleID, ev
 	return event, wallet, nil
 }
 
+// TransferTip debits the tipper's coin balance and credits the creator wallet in one transaction.
+// The creator receives the tip after revenue rules are applied; the user always pays the full amount.
+func (s *Service) TransferTip(ctx context.Context, creatorID, userID, roleID string, amount int64, message, idempotencyKey string) (*model.RevenueEvent, *model.CreatorWallet, error) {
+	if amount <= 0 {
+		return nil, nil, errors.New("amount must be > 0")
+	}
+	if s.assets == nil {
+		return nil, nil, errors.New("billing service unavailable")
+	}
+	rules, _ := s.repo.ListRules(ctx)
+	event := &model.RevenueEvent{
+		CreatorID: creatorID,
+		UserID:    userID,
+		RoleID:    roleID,
+		EventType: "tip",
+		Amount:    applyRules("tip", amount, rules),
+		Status:    "confirmed",
+		Message:   message,
+	}
+	var wallet *model.CreatorWallet
+	err := s.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		entry, err := s.assets.ApplyDeltaTx(ctx, tx, repository.CoinDelta{
+			UserID:         userID,
+			Amount:         -amount,
+			Reason:         model.LedgerReasonTip,
+			IdempotencyKey: idempotencyKey,
+			RefID:          roleID,
+		})
+		if err != nil {
+			return err
+		}
+		if entry.Replayed {
+			return ErrDuplicateTip
+		}
+		if event.Amount <= 0 {
+			return nil
+		}
+		wallet, err = s.repo.CreditTx(ctx, tx, event)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return event, wallet, nil
+}
+
 func (s *Service) Wallet(ctx context.Context, creatorID string) (*model.CreatorWallet, []model.RevenueEvent, []model.PayoutRecord, error) {
 	wallet, err := s.repo.GetWallet(ctx, creatorID)
 	if err != nil {
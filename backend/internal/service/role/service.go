@@ -6,12 +6,28 @@ import (
 	"strings"
 
 	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
 	"github.com/example/ai-avatar-studio/internal/repository"
 )
 
 // Service keeps the business rules around roles and publishing workflow.
 type Service struct {
-	roles *repository.RoleRepository
+	roles roleStore
+}
+
+// roleStore is the part of repository.RoleRepository the service uses.
+type roleStore interface {
+	CountFavorites(ctx context.Context, roleID string) (int, error)
+	CreateVersion(ctx context.Context, roleID, prompt string) error
+	Favorite(ctx context.Context, userID, roleID string) error
+	FindByID(ctx context.Context, id string) (*model.Role, error)
+	IsFavorited(ctx context.Context, userID, roleID string) (bool, error)
+	List(ctx context.Context, status string, limit int) ([]model.Role, error)
+	ListByCreator(ctx context.Context, creatorID string) ([]model.Role, error)
+	ListFavorites(ctx context.Context, userID string, limit int) ([]model.Role, error)
+	Save(ctx context.Context, role *model.Role) error
+	Unfavorite(ctx context.Context, userID, roleID string) error
+	UpdateStatus(ctx context.Context, roleID, status string) error
 }
 
 func NewService(roles *repository.RoleRepository) *Service {
@@ -30,20 +46,48 @@ func (s *Service) Get(ctx context.Context, id string) (*model.Role, error) {
 	return s.roles.FindByID(ctx, id)
 }
 
-func (s *Service) Save(ctx context.Context, creatorID string, payload *model.Role) (*model.Role, error) {
+// GetOwned returns a role the actor may modify.
+func (s *Service) GetOwned(ctx context.Context, actor authz.Actor, id string) (*model.Role, error) {
+	role, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.RequireOwner(actor, role.CreatorID); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *Service) find(ctx context.Context, id string) (*model.Role, error) {
+	role, err := s.roles.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, authz.ErrNotFound
+	}
+	return role, nil
+}
+
+// Save creates a role owned by the actor, or updates one the actor owns. Admin edits keep the
+// original creator.
+func (s *Service) Save(ctx context.Context, actor authz.Actor, payload *model.Role) (*model.Role, error) {
 	if strings.TrimSpace(payload.Name) == "" {
 		return nil, errors.New("name required")
 	}
+	payload.CreatorID = actor.UserID
 	if payload.ID != "" {
 		existing, err := s.roles.FindByID(ctx, payload.ID)
 		if err != nil {
 			return nil, err
 		}
-		if existing != nil && existing.CreatorID != creatorID {
-			return nil, errors.New("forbidden")
+		if existing != nil {
+			if err := authz.RequireOwner(actor, existing.CreatorID); err != nil {
+				return nil, err
+			}
+			payload.CreatorID = existing.CreatorID
 		}
 	}
-	payload.CreatorID = creatorID
 	if payload.Status == "" {
 		payload.Status = "draft"
 	}
@@ -53,11 +97,17 @@ func (s *Service) Save(ctx context.Context, creatorID string, payload *model.Rol
 	return payload, nil
 }
 
-func (s *Service) Publish(ctx context.Context, roleID string) error {
+func (s *Service) Publish(ctx context.Context, actor authz.Actor, roleID string) error {
+	if _, err := s.GetOwned(ctx, actor, roleID); err != nil {
+		return err
+	}
 	return s.roles.UpdateStatus(ctx, roleID, "published")
 }
 
-func (s *Service) Archive(ctx context.Context, roleID string) error {
+func (s *Service) Archive(ctx context.Context, actor authz.Actor, roleID string) error {
+	if _, err := s.GetOwned(ctx, actor, roleID); err != nil {
+		return err
+	}
 	return s.roles.UpdateStatus(ctx, roleID, "archived")
 }
 
@@ -65,7 +115,10 @@ func (s *Service) ListByCreator(ctx context.Context, creatorID string) ([]model.
 	return s.roles.ListByCreator(ctx, creatorID)
 }
 
-func (s *Service) SnapshotPrompt(ctx context.Context, roleID, prompt string) error {
+func (s *Service) SnapshotPrompt(ctx context.Context, actor authz.Actor, roleID, prompt string) error {
+	if _, err := s.GetOwned(ctx, actor, roleID); err != nil {
+		return err
+	}
 	return s.roles.CreateVersion(ctx, roleID, prompt)
 }
 
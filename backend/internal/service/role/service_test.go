@@ -0,0 +1,107 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/pkg/authz"
+)
+
+// fakeRoles holds one role, r1, created by "owner". Calls the tests do not expect panic through
+// the nil embedded interface.
+type fakeRoles struct {
+	roleStore
+	writes int
+}
+
+func (f *fakeRoles) FindByID(_ context.Context, id string) (*model.Role, error) {
+	if id != "r1" {
+		return nil, nil
+	}
+	return &model.Role{ID: "r1", Name: "Aria", CreatorID: "owner", Status: "draft"}, nil
+}
+
+func (f *fakeRoles) Save(context.Context, *model.Role) error { f.writes++; return nil }
+
+func (f *fakeRoles) UpdateStatus(context.Context, string, string) error { f.writes++; return nil }
+
+func (f *fakeRoles) CreateVersion(context.Context, string, string) error { f.writes++; return nil }
+
+var actors = []struct {
+	name    string
+	actor   authz.Actor
+	allowed bool
+}{
+	{"owner", authz.Actor{UserID: "owner"}, true},
+	{"non-owner", authz.Actor{UserID: "stranger"}, false},
+	{"admin", authz.Actor{UserID: "admin", IsAdmin: true}, true},
+	{"anonymous", authz.Actor{}, false},
+}
+
+func TestRoleOwnership(t *testing.T) {
+	ops := []struct {
+		name string
+		call func(s *Service, actor authz.Actor, id string) error
+	}{
+		{"GetOwned", func(s *Service, a authz.Actor, id string) error {
+			_, err := s.GetOwned(context.Background(), a, id)
+			return err
+		}},
+		{"Save", func(s *Service, a authz.Actor, id string) error {
+			_, err := s.Save(context.Background(), a, &model.Role{ID: id, Name: "Renamed"})
+			return err
+		}},
+		{"Publish", func(s *Service, a authz.Actor, id string) error {
+			return s.Publish(context.Background(), a, id)
+		}},
+		{"Archive", func(s *Service, a authz.Actor, id string) error {
+			return s.Archive(context.Background(), a, id)
+		}},
+		{"SnapshotPrompt", func(s *Service, a authz.Actor, id string) error {
+			return s.SnapshotPrompt(context.Background(), a, id, "prompt")
+		}},
+	}
+	for _, op := range ops {
+		for _, a := range actors {
+			t.Run(op.name+"/"+a.name, func(t *testing.T) {
+				roles := &fakeRoles{}
+				err := op.call(&Service{roles: roles}, a.actor, "r1")
+				if a.allowed && err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				if !a.allowed {
+					if !errors.Is(err, authz.ErrForbidden) {
+						t.Fatalf("err = %v, want ErrForbidden", err)
+					}
+					if roles.writes != 0 {
+						t.Fatalf("denied call wrote %d times", roles.writes)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRoleOwnershipMissingRole(t *testing.T) {
+	s := &Service{roles: &fakeRoles{}}
+	admin := authz.Actor{UserID: "admin", IsAdmin: true}
+	if _, err := s.GetOwned(context.Background(), admin, "missing"); !errors.Is(err, authz.ErrNotFound) {
+		t.Fatalf("GetOwned = %v, want ErrNotFound", err)
+	}
+	if err := s.Publish(context.Background(), admin, "missing"); !errors.Is(err, authz.ErrNotFound) {
+		t.Fatalf("Publish = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSaveKeepsCreatorOnAdminEdit(t *testing.T) {
+	s := &Service{roles: &fakeRoles{}}
+	role, err := s.Save(context.Background(), authz.Actor{UserID: "admin", IsAdmin: true}, &model.Role{ID: "r1", Name: "Renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.CreatorID != "owner" {
+		t.Fatalf("CreatorID = %q, want owner", role.CreatorID)
+	}
+}
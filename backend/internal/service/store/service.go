@@ -3,26 +3,78 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/example/ai-avatar-studio/internal/model"
 	"github.com/example/ai-avatar-studio/internal/repository"
 	"github.com/example/ai-avatar-studio/internal/service/revenue"
+	"github.com/google/uuid"
 )
 
+const maxTipMessageRunes = 200
+
+// Options lists the preset tip amounts offered by the store UI.
+type Options struct {
+	Amounts      []int64  `json:"amounts"`
+	Descriptions []string `json:"descriptions"`
+}
+
 // Service handles monetisation entry points from the store/tipping UI.
 type Service struct {
-	roles   *repository.RoleRepository
-	revenue *revenue.Service
+	roles         *repository.RoleRepository
+	revenue       *revenue.Service
+	notifications *repository.NotificationRepository
+	options       Options
 }
 
-func NewService(roles *repository.RoleRepository, revenue *revenue.Service) *Service {
-	return &Service{roles: roles, revenue: revenue}
+func NewService(roles *repository.RoleRepository, revenue *revenue.Service, notifications *repository.NotificationRepository, options Options) *Service {
+	return &Service{roles: roles, revenue: revenue, notifications: notifications, options: options}
 }
 
-func (s *Service) TipRole(ctx context.Context, userID, roleID string, amount int64) (*model.RevenueEvent, *model.CreatorWallet, error) {
+func (s *Service) Options() Options {
+	return s.options
+}
+
+// TipRole moves coins from the tipper to the role's creator and notifies the creator.
+// idempotencyKey may be empty, in which case every call is treated as a new tip.
+func (s *Service) TipRole(ctx context.Context, userID, roleID string, amount int64, message, idempotencyKey string) (*model.RevenueEvent, *model.CreatorWallet, error) {
+	if amount <= 0 {
+		return nil, nil, errors.New("amount must be > 0")
+	}
+	message = strings.TrimSpace(message)
+	if utf8.RuneCountInString(message) > maxTipMessageRunes {
+		return nil, nil, fmt.Errorf("message too long (limit %d characters)", maxTipMessageRunes)
+	}
 	role, err := s.roles.FindByID(ctx, roleID)
 	if err != nil || role == nil {
 		return nil, nil, errors.New("role not found")
 	}
-	return s.revenue.RecordEvent(ctx, role.CreatorID, userID, roleID, "tip", amount)
+	if role.CreatorID == userID {
+		return nil, nil, errors.New("cannot tip your own role")
+	}
+	if strings.TrimSpace(idempotencyKey) == "" {
+		idempotencyKey = uuid.NewString()
+	}
+	event, wallet, err := s.revenue.TransferTip(ctx, role.CreatorID, userID, role.ID, amount, message, "tip:"+userID+":"+idempotencyKey)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			return nil, nil, errors.New("余额不足，请前往充值")
+		}
+		return nil, nil, err
+	}
+	if s.notifications != nil {
+		content := fmt.Sprintf("你的角色「%s」收到了 %d 平台币打赏。", role.Name, amount)
+		if message != "" {
+			content += "\n留言：" + message
+		}
+		_ = s.notifications.Create(ctx, &model.Notification{
+			UserID:  role.CreatorID,
+			Type:    "tip",
+			Title:   "收到打赏",
+			Content: content,
+		})
+	}
+	return event, wallet, nil
 }
@@ -2,114 +2,289 @@ package task
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
+	"log"
 	"os"
-	"path/filepath"
+	"path"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// RunMigrations executes all SQL files found inside dir alphabetically.
+// migrationLockID is the pg_advisory_lock key that serialises migrators across replicas.
+const migrationLockID = 7244160001
+
+// Migration is one .sql file. Its version is the file name without the extension, so files that
+// share a numeric prefix stay distinct; they apply in file name order.
+type Migration struct {
+	Version string
+	Up      string
+	Down    string
+	// Checksum covers the Up section only, so a Down section can be added to an applied migration.
+	Checksum string
+}
+
+// MigrationStatus describes a migration as seen by the database.
+type MigrationStatus struct {
+	Version   string     `json:"version"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Modified  bool       `json:"modified"` // file changed since it was applied
+	Missing   bool       `json:"missing"`  // applied but the file is gone
+}
+
+// Migrator applies versioned migrations and records them in schema_migrations.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator loads the migrations in dir.
+func NewMigrator(pool *pgxpool.Pool, dir string) (*Migrator, error) {
+	return NewMigratorFS(pool, os.DirFS(dir), ".")
+}
+
+// NewMigratorFS loads the migrations in dir of filesystem, e.g. an embed.FS.
+func NewMigratorFS(pool *pgxpool.Pool, filesystem fs.FS, dir string) (*Migrator, error) {
+	migrations, err := loadMigrations(filesystem, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+// RunMigrations applies every pending migration in dir; the server calls it on boot.
 func RunMigrations(ctx context.Context, pool *pgxpool.Pool, dir string) error {
-	entries, err := os.ReadDir(dir)
+	m, err := NewMigrator(pool, dir)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx)
+	for _, v := range applied {
+		log.Printf("migrate: applied %s", v)
+	}
+	return err
+}
+
+// RunMigrationsFromFS applies pending migrations from an embed FS.
+func RunMigrationsFromFS(ctx context.Context, pool *pgxpool.Pool, filesystem fs.FS, dir string) error {
+	m, err := NewMigratorFS(pool, filesystem, dir)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+func loadMigrations(filesystem fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(filesystem, dir)
 	if err != nil {
-		return fmt.Errorf("read migrations: %w", err)
+		return nil, fmt.Errorf("read migrations: %w", err)
 	}
 	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	var migrations []Migration
 	for _, entry := range entries {
 		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
 			continue
 		}
-		path := filepath.Join(dir, entry.Name())
-		if err := applyFile(ctx, pool, path); err != nil {
-			return fmt.Errorf("apply %s: %w", entry.Name(), err)
+		content, err := fs.ReadFile(filesystem, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
 		}
+		up, down := splitSections(string(content))
+		migrations = append(migrations, Migration{
+			Version:  strings.TrimSuffix(entry.Name(), ".sql"),
+			Up:       up,
+			Down:     down,
+			Checksum: checksum([]byte(up)),
+		})
 	}
-	return nil
+	return migrations, nil
 }
 
-func applyFile(ctx context.Context, pool *pgxpool.Pool, path string) error {
-	content, err := os.ReadFile(path)
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on one connection holding the migration advisory lock, creating the tracking
+// table first.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn, applied map[string]appliedMigration) error) error {
+	conn, err := m.pool.Acquire(ctx)
 	if err != nil {
 		return err
 	}
-	statements := extractUpStatements(string(content))
-	if statements == "" {
-		return nil
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, int64(migrationLockID)); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
 	}
-	conn, err := pool.Acquire(ctx)
-	if err != nil {
-		return err
+	defer conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, int64(migrationLockID))
+
+	if _, err := conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version TEXT PRIMARY KEY,
+            checksum TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        )
+    `); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
 	}
-	defer conn.Release()
-	tx, err := conn.Begin(ctx)
+	rows, err := conn.Query(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
 	if err != nil {
 		return err
 	}
-	if _, err := tx.Exec(ctx, statements); err != nil {
-		_ = tx.Rollback(ctx)
+	applied := map[string]appliedMigration{}
+	for rows.Next() {
+		var version string
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = a
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
 		return err
 	}
-	return tx.Commit(ctx)
+	return fn(conn, applied)
 }
 
-// RunMigrationsFromFS allows executing migrations from an embed FS; used by tests.
-func RunMigrationsFromFS(ctx context.Context, pool *pgxpool.Pool, filesystem fs.FS, dir string) error {
-	entries, err := fs.ReadDir(filesystem, dir)
-	if err != nil {
-		return err
+// Up applies pending migrations in order, each in its own transaction together with its
+// schema_migrations row. It refuses to run when the Up section of an applied migration changed.
+func (m *Migrator) Up(ctx context.Context) ([]string, error) {
+	var done []string
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, applied map[string]appliedMigration) error {
+		var modified []string
+		for _, mig := range m.migrations {
+			if a, ok := applied[mig.Version]; ok && a.checksum != mig.Checksum {
+				modified = append(modified, mig.Version)
+			}
+		}
+		if len(modified) > 0 {
+			return fmt.Errorf("applied migrations were modified: %s; add a new migration instead", strings.Join(modified, ", "))
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := runInTx(ctx, conn, mig.Up, `INSERT INTO schema_migrations(version, checksum) VALUES($1, $2)`, mig.Version, mig.Checksum); err != nil {
+				return fmt.Errorf("apply %s: %w", mig.Version, err)
+			}
+			done = append(done, mig.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations using their Down sections.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]string, error) {
+	if steps <= 0 {
+		steps = 1
 	}
-	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
-			continue
+	var done []string
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, applied map[string]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %s has no down section", mig.Version)
+			}
+			if err := runInTx(ctx, conn, mig.Down, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version); err != nil {
+				return fmt.Errorf("revert %s: %w", mig.Version, err)
+			}
+			done = append(done, mig.Version)
 		}
-		content, err := fs.ReadFile(filesystem, filepath.Join(dir, entry.Name()))
-		if err != nil {
-			return err
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every migration file plus applied versions whose file no longer exists.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var out []MigrationStatus
+	err := m.withLock(ctx, func(_ *pgxpool.Conn, applied map[string]appliedMigration) error {
+		known := map[string]bool{}
+		for _, mig := range m.migrations {
+			known[mig.Version] = true
+			st := MigrationStatus{Version: mig.Version}
+			if a, ok := applied[mig.Version]; ok {
+				at := a.appliedAt
+				st.Applied, st.AppliedAt, st.Modified = true, &at, a.checksum != mig.Checksum
+			}
+			out = append(out, st)
 		}
-		statements := extractUpStatements(string(content))
-		if statements == "" {
-			continue
+		var missing []string
+		for version := range applied {
+			if !known[version] {
+				missing = append(missing, version)
+			}
+		}
+		sort.Strings(missing)
+		for _, version := range missing {
+			at := applied[version].appliedAt
+			out = append(out, MigrationStatus{Version: version, Applied: true, AppliedAt: &at, Missing: true})
 		}
-		if _, err := pool.Exec(ctx, statements); err != nil {
+		return nil
+	})
+	return out, err
+}
+
+func runInTx(ctx context.Context, conn *pgxpool.Conn, statements, record string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if strings.TrimSpace(statements) != "" {
+		if _, err := tx.Exec(ctx, statements); err != nil {
 			return err
 		}
 	}
-	return nil
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// extractUpStatements trims away goose-style Down sections so we don't accidentally run rollbacks on startup.
-func extractUpStatements(content string) string {
-	lines := strings.Split(content, "\n")
-	inDown := false
-	inUp := false
+// splitSections separates goose-style "-- +goose Up" / "-- +goose Down" sections. Files without
+// directives are entirely Up and cannot be reverted.
+func splitSections(content string) (up, down string) {
+	var upLines, downLines []string
+	section := ""
 	hasDirective := false
-	var filtered []string
-
-	for _, line := range lines {
+	for _, line := range strings.Split(content, "\n") {
 		trimmed := strings.TrimSpace(line)
 		switch {
 		case strings.HasPrefix(trimmed, "-- +goose Up"):
-			inUp = true
-			hasDirective = true
+			section, hasDirective = "up", true
 			continue
 		case strings.HasPrefix(trimmed, "-- +goose Down"):
-			if hasDirective {
-				inDown = true
-			}
+			section, hasDirective = "down", true
 			continue
 		}
-		if inDown {
-			continue
-		}
-		if hasDirective && !inUp {
-			continue
+		switch {
+		case !hasDirective || section == "up":
+			upLines = append(upLines, line)
+		case section == "down":
+			downLines = append(downLines, line)
 		}
-		filtered = append(filtered, line)
 	}
-	return strings.TrimSpace(strings.Join(filtered, "\n"))
+	if !hasDirective {
+		return strings.TrimSpace(content), ""
+	}
+	return strings.TrimSpace(strings.Join(upLines, "\n")), strings.TrimSpace(strings.Join(downLines, "\n"))
 }
@@ -0,0 +1,60 @@
+package task
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitSections(t *testing.T) {
+	up, down := splitSections("-- +goose Up\nCREATE TABLE a (id INT);\n\n-- +goose Down\nDROP TABLE a;\n")
+	if up != "CREATE TABLE a (id INT);" || down != "DROP TABLE a;" {
+		t.Fatalf("up = %q, down = %q", up, down)
+	}
+	up, down = splitSections("-- no sections\nCREATE TABLE a (id INT);\n")
+	if up != "-- no sections\nCREATE TABLE a (id INT);" || down != "" {
+		t.Fatalf("up = %q, down = %q", up, down)
+	}
+}
+
+func TestChecksumCoversUpOnly(t *testing.T) {
+	load := func(content string) Migration {
+		t.Helper()
+		migrations, err := loadMigrations(fstest.MapFS{"0001_a.sql": {Data: []byte(content)}}, ".")
+		if err != nil || len(migrations) != 1 {
+			t.Fatalf("load: %v", err)
+		}
+		return migrations[0]
+	}
+	const plain = "-- add a\nALTER TABLE t ADD COLUMN a INT;\n"
+	before := load(plain)
+	after := load("-- +goose Up\n" + plain + "\n-- +goose Down\nALTER TABLE t DROP COLUMN a;\n")
+	if after.Checksum != before.Checksum {
+		t.Error("adding a Down section changed the checksum")
+	}
+	if after.Down == "" {
+		t.Error("added Down section not loaded")
+	}
+	if load("-- +goose Up\n"+plain+"-- +goose Down\nDROP TABLE t;\n").Checksum != after.Checksum {
+		t.Error("editing the Down section changed the checksum")
+	}
+	if load("ALTER TABLE t ADD COLUMN b INT;\n").Checksum == before.Checksum {
+		t.Error("an edited Up section still matches")
+	}
+}
+
+func TestMigrationsCanBeReverted(t *testing.T) {
+	migrations, err := loadMigrations(os.DirFS("../../migrations"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Migrations from 0025 on must be revertible with migrate down.
+	for _, m := range migrations {
+		if m.Version >= "0025" && m.Down == "" {
+			t.Errorf("%s has no -- +goose Down section", m.Version)
+		}
+		if m.Up == "" {
+			t.Errorf("%s has an empty Up section", m.Version)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+	"github.com/example/ai-avatar-studio/internal/repository"
+)
+
+const (
+	defaultMaxAttempts = 5
+	jobLease           = 5 * time.Minute
+	// jobTimeout leaves the worker time to settle a job before its lease lapses and another
+	// worker may claim it.
+	jobTimeout = jobLease - 30*time.Second
+	idlePoll   = 2 * time.Second
+	retryBase  = 10 * time.Second
+	retryCap   = time.Hour
+)
+
+// JobHandler runs one job. Returning an error retries it with backoff until its attempts run out;
+// wrap the error with Permanent to dead-letter it straight away.
+type JobHandler func(ctx context.Context, job *model.Job) error
+
+// EnqueueOption tweaks a job before it is stored.
+type EnqueueOption func(*model.Job)
+
+// RunAt schedules the job for a later time.
+func RunAt(t time.Time) EnqueueOption {
+	return func(j *model.Job) { j.RunAt = t }
+}
+
+// MaxAttempts overrides how many times the job runs before it is dead-lettered.
+func MaxAttempts(n int) EnqueueOption {
+	return func(j *model.Job) {
+		if n > 0 {
+			j.MaxAttempts = n
+		}
+	}
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var perm permanentError
+	return errors.As(err, &perm)
+}
+
+type snoozeError struct{ delay time.Duration }
+
+func (e snoozeError) Error() string { return fmt.Sprintf("snoozed for %s", e.delay) }
+
+// Snooze runs the job again after delay without spending an attempt, for handlers waiting on a
+// busy resource rather than failing.
+func Snooze(delay time.Duration) error {
+	return snoozeError{delay: delay}
+}
+
+// Queue is a Postgres-backed job queue: jobs survive restarts, are retried with exponential backoff
+// and end up dead-lettered for admins to inspect. Handlers must be registered before Start.
+type Queue struct {
+	jobs     jobStore
+	workers  int
+	handlers map[string]JobHandler
+
+	wake    chan struct{}
+	stop    chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+// jobStore is the part of repository.JobRepository the queue uses.
+type jobStore interface {
+	Bury(ctx context.Context, job *model.Job, lastError string) error
+	Claim(ctx context.Context, lease time.Duration) (*model.Job, error)
+	Complete(ctx context.Context, job *model.Job) error
+	Create(ctx context.Context, job *model.Job) error
+	PruneSucceeded(ctx context.Context, before time.Time) (int64, error)
+	Retry(ctx context.Context, job *model.Job, lastError string, runAt time.Time) error
+	Snooze(ctx context.Context, job *model.Job, runAt time.Time) error
+}
+
+func NewQueue(jobs *repository.JobRepository, workers int) *Queue {
+	if workers <= 0 {
+		workers = 4
+	}
+	return &Queue{
+		jobs:     jobs,
+		workers:  workers,
+		handlers: map[string]JobHandler{},
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register binds a handler to a job type.
+func (q *Queue) Register(jobType string, h JobHandler) {
+	if q.started {
+		panic("task: Register after Start")
+	}
+	q.handlers[jobType] = h
+}
+
+// Enqueue stores a job whose payload is the JSON encoding of payload.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...EnqueueOption) (*model.Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s payload: %w", jobType, err)
+	}
+	job := &model.Job{Type: jobType, Payload: raw, MaxAttempts: defaultMaxAttempts, RunAt: time.Now()}
+	for _, opt := range opts {
+		opt(job)
+	}
+	if err := q.jobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	if !job.RunAt.After(time.Now()) {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return job, nil
+}
+
+// Start launches the workers. Jobs run on a context that is only cancelled when Stop times out.
+func (q *Queue) Start() {
+	q.started = true
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+// Stop stops claiming jobs and waits for running ones. When ctx expires first the running jobs
+// are cancelled; their leases lapse and another process picks them up.
+func (q *Queue) Stop(ctx context.Context) {
+	if !q.started {
+		return
+	}
+	close(q.stop)
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+	}
+	q.cancel()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+		job, err := q.jobs.Claim(ctx, jobLease)
+		if err != nil {
+			log.Printf("jobs: claim: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-q.stop:
+				return
+			case <-q.wake:
+			case <-time.After(idlePoll):
+			}
+			continue
+		}
+		q.run(ctx, job)
+	}
+}
+
+func (q *Queue) run(ctx context.Context, job *model.Job) {
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		q.settle(job, Permanent(fmt.Errorf("no handler for job type %q", job.Type)))
+		return
+	}
+	runCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return handler(runCtx, job)
+	}()
+	q.settle(job, err)
+}
+
+// settle records the outcome on a fresh context so a cancelled run is still written back.
+func (q *Queue) settle(job *model.Job, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var snooze snoozeError
+	switch {
+	case err == nil:
+		err = q.jobs.Complete(ctx, job)
+	case errors.As(err, &snooze):
+		err = q.jobs.Snooze(ctx, job, time.Now().Add(snooze.delay))
+	case IsPermanent(err) || job.LastAttempt():
+		log.Printf("jobs: %s %s dead after %d attempts: %v", job.Type, job.ID, job.Attempts, err)
+		err = q.jobs.Bury(ctx, job, err.Error())
+	default:
+		delay := retryDelay(job.Attempts)
+		log.Printf("jobs: %s %s attempt %d failed, retrying in %s: %v", job.Type, job.ID, job.Attempts, delay, err)
+		err = q.jobs.Retry(ctx, job, err.Error(), time.Now().Add(delay))
+	}
+	if errors.Is(err, repository.ErrLeaseLost) {
+		log.Printf("jobs: %s %s outlived its lease; leaving it to the worker that claimed it since", job.Type, job.ID)
+	} else if err != nil {
+		log.Printf("jobs: settle %s %s: %v", job.Type, job.ID, err)
+	}
+}
+
+// retryDelay doubles per attempt up to an hour, with up to 20% jitter so retries spread out.
+func retryDelay(attempt int) time.Duration {
+	d := retryBase
+	for i := 1; i < attempt && d < retryCap; i++ {
+		d *= 2
+	}
+	if d > retryCap {
+		d = retryCap
+	}
+	return d + time.Duration(rand.Int63n(int64(d/5)+1))
+}
+
+// PruneSucceeded drops succeeded jobs older than a week; meant for Every.
+func (q *Queue) PruneSucceeded(ctx context.Context) {
+	if n, err := q.jobs.PruneSucceeded(ctx, time.Now().Add(-7*24*time.Hour)); err != nil {
+		log.Printf("jobs: prune: %v", err)
+	} else if n > 0 {
+		log.Printf("jobs: pruned %d succeeded jobs", n)
+	}
+}
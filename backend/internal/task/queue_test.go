@@ -0,0 +1,234 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/ai-avatar-studio/internal/model"
+)
+
+// fakeJobs keeps jobs in memory the way the jobs table does: Claim counts an attempt and leases
+// the oldest ready job, and the settle methods record where the job went.
+type fakeJobs struct {
+	mu   sync.Mutex
+	jobs []*model.Job
+}
+
+func (f *fakeJobs) Create(_ context.Context, job *model.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job.ID = strconv.Itoa(len(f.jobs) + 1)
+	job.Status = model.JobPending
+	stored := *job
+	f.jobs = append(f.jobs, &stored)
+	return nil
+}
+
+func (f *fakeJobs) Claim(_ context.Context, lease time.Duration) (*model.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, job := range f.jobs {
+		if job.Status == model.JobPending && !job.RunAt.After(time.Now()) {
+			until := time.Now().Add(lease)
+			job.Status, job.Attempts, job.LockedUntil = model.JobRunning, job.Attempts+1, &until
+			claimed := *job
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeJobs) settle(job *model.Job, update func(stored *model.Job)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, stored := range f.jobs {
+		if stored.ID == job.ID {
+			stored.LockedUntil = nil
+			update(stored)
+		}
+	}
+	return nil
+}
+
+func (f *fakeJobs) Complete(_ context.Context, job *model.Job) error {
+	return f.settle(job, func(j *model.Job) { j.Status, j.LastError = model.JobSucceeded, "" })
+}
+
+func (f *fakeJobs) Retry(_ context.Context, job *model.Job, lastError string, runAt time.Time) error {
+	return f.settle(job, func(j *model.Job) { j.Status, j.LastError, j.RunAt = model.JobPending, lastError, runAt })
+}
+
+func (f *fakeJobs) Snooze(_ context.Context, job *model.Job, runAt time.Time) error {
+	return f.settle(job, func(j *model.Job) { j.Status, j.Attempts, j.RunAt = model.JobPending, j.Attempts-1, runAt })
+}
+
+func (f *fakeJobs) Bury(_ context.Context, job *model.Job, lastError string) error {
+	return f.settle(job, func(j *model.Job) { j.Status, j.LastError = model.JobDead, lastError })
+}
+
+func (f *fakeJobs) PruneSucceeded(context.Context, time.Time) (int64, error) { return 0, nil }
+
+func (f *fakeJobs) get(id string) model.Job {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, job := range f.jobs {
+		if job.ID == id {
+			return *job
+		}
+	}
+	return model.Job{}
+}
+
+func newTestQueue(jobs *fakeJobs, workers int) *Queue {
+	return &Queue{jobs: jobs, workers: workers, handlers: map[string]JobHandler{}, wake: make(chan struct{}, 1), stop: make(chan struct{})}
+}
+
+func TestQueueSettlesEachOutcome(t *testing.T) {
+	boom := errors.New("boom")
+	cases := []struct {
+		name        string
+		maxAttempts int
+		jobType     string
+		handler     JobHandler
+		status      string
+		attempts    int
+		// retryIn is the earliest delay before a retried or snoozed job runs again.
+		retryIn   time.Duration
+		lastError string
+	}{
+		{name: "success", maxAttempts: 3, handler: func(context.Context, *model.Job) error { return nil }, status: model.JobSucceeded, attempts: 1},
+		{name: "retryable failure", maxAttempts: 3, handler: func(context.Context, *model.Job) error { return boom }, status: model.JobPending, attempts: 1, retryIn: retryBase, lastError: "boom"},
+		{name: "failure on the last attempt", maxAttempts: 1, handler: func(context.Context, *model.Job) error { return boom }, status: model.JobDead, attempts: 1, lastError: "boom"},
+		{name: "permanent failure", maxAttempts: 3, handler: func(context.Context, *model.Job) error { return Permanent(boom) }, status: model.JobDead, attempts: 1, lastError: "boom"},
+		{name: "panic", maxAttempts: 3, handler: func(context.Context, *model.Job) error { panic("bad payload") }, status: model.JobPending, attempts: 1, retryIn: retryBase, lastError: "panic: bad payload"},
+		{name: "snooze keeps the attempt", maxAttempts: 1, handler: func(context.Context, *model.Job) error { return Snooze(time.Minute) }, status: model.JobPending, attempts: 0, retryIn: time.Minute},
+		{name: "unknown type", maxAttempts: 3, jobType: "unknown", status: model.JobDead, attempts: 1, lastError: `no handler for job type "unknown"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeJobs{}
+			q := newTestQueue(store, 1)
+			if tc.handler != nil {
+				q.Register("test", tc.handler)
+			}
+			jobType := tc.jobType
+			if jobType == "" {
+				jobType = "test"
+			}
+			queued, err := q.Enqueue(context.Background(), jobType, map[string]string{"k": "v"}, MaxAttempts(tc.maxAttempts))
+			if err != nil {
+				t.Fatal(err)
+			}
+			job, _ := store.Claim(context.Background(), jobLease)
+			start := time.Now()
+			q.run(context.Background(), job)
+
+			got := store.get(queued.ID)
+			if got.Status != tc.status || got.Attempts != tc.attempts || got.LastError != tc.lastError {
+				t.Fatalf("job = %s after %d attempts (%q), want %s after %d (%q)", got.Status, got.Attempts, got.LastError, tc.status, tc.attempts, tc.lastError)
+			}
+			if tc.retryIn > 0 {
+				if wait := got.RunAt.Sub(start); wait < tc.retryIn || wait > tc.retryIn*6/5+time.Second {
+					t.Fatalf("runs again in %s, want about %s", wait, tc.retryIn)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, tc := range []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, retryBase},
+		{2, 2 * retryBase},
+		{4, 8 * retryBase},
+		{12, retryCap},
+		{1000, retryCap},
+	} {
+		for i := 0; i < 20; i++ {
+			// Up to 20% jitter on top of the doubled delay.
+			if d := retryDelay(tc.attempt); d < tc.base || d > tc.base+tc.base/5 {
+				t.Fatalf("retryDelay(%d) = %s, want within 20%% above %s", tc.attempt, d, tc.base)
+			}
+		}
+	}
+}
+
+func TestStopDrainsRunningJobs(t *testing.T) {
+	store := &fakeJobs{}
+	q := newTestQueue(store, 2)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var cancelled bool
+	q.Register("slow", func(ctx context.Context, _ *model.Job) error {
+		close(started)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			cancelled = true
+		}
+		return nil
+	})
+	job, err := q.Enqueue(context.Background(), "slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop(context.Background())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while a job was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// A job enqueued after Stop is not claimed.
+	late, _ := q.Enqueue(context.Background(), "slow", nil)
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return after the job finished")
+	}
+	if cancelled || store.get(job.ID).Status != model.JobSucceeded {
+		t.Fatalf("cancelled = %v, status = %s", cancelled, store.get(job.ID).Status)
+	}
+	if got := store.get(late.ID); got.Status != model.JobPending || got.Attempts != 0 {
+		t.Fatalf("job enqueued during Stop = %s after %d attempts", got.Status, got.Attempts)
+	}
+}
+
+func TestStopCancelsJobsWhenItTimesOut(t *testing.T) {
+	store := &fakeJobs{}
+	q := newTestQueue(store, 1)
+	started := make(chan struct{})
+	q.Register("stuck", func(ctx context.Context, _ *model.Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	job, err := q.Enqueue(context.Background(), "stuck", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	q.Stop(ctx)
+	// The cancelled run is still settled, and goes back to the queue for another process.
+	if got := store.get(job.ID); got.Status != model.JobPending || got.LastError != context.Canceled.Error() {
+		t.Fatalf("job = %s (%q), want pending after the cancellation", got.Status, got.LastError)
+	}
+}
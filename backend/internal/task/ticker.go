@@ -0,0 +1,20 @@
+package task
+
+import (
+	"context"
+	"time"
+)
+
+// Every runs fn on a fixed interval until ctx is cancelled. It blocks; start it in a goroutine.
+func Every(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
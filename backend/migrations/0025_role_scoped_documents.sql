@@ -0,0 +1,48 @@
+-- +goose Up
+-- Scope knowledge-base documents to a role or worldbook and store embeddings as plain float arrays.
+
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS role_id UUID REFERENCES roles(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS worldbook_id UUID REFERENCES worldbooks(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_documents_role ON documents(role_id);
+CREATE INDEX IF NOT EXISTS idx_documents_worldbook ON documents(worldbook_id);
+
+-- The original VECTOR(1536) column pins a single embedding width; embedders are pluggable now,
+-- so switch to REAL[] (only once, existing unscoped chunks carry no usable embedding anyway).
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'document_chunks' AND column_name = 'embedding' AND udt_name <> '_float4'
+    ) THEN
+        ALTER TABLE document_chunks DROP COLUMN embedding;
+    END IF;
+END $$;
+
+ALTER TABLE document_chunks
+    ADD COLUMN IF NOT EXISTS embedding REAL[],
+    ADD COLUMN IF NOT EXISTS embedding_model TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS chunk_index INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_document_chunks_document ON document_chunks(document_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_document_chunks_document;
+ALTER TABLE document_chunks
+    DROP COLUMN IF EXISTS chunk_index,
+    DROP COLUMN IF EXISTS embedding_model,
+    DROP COLUMN IF EXISTS embedding;
+-- Embeddings are not converted back; chunks get an empty VECTOR column again where pgvector exists.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_type WHERE typname = 'vector') THEN
+        ALTER TABLE document_chunks ADD COLUMN embedding VECTOR(1536);
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_documents_worldbook;
+DROP INDEX IF EXISTS idx_documents_role;
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS worldbook_id,
+    DROP COLUMN IF EXISTS role_id;
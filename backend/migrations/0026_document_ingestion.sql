@@ -0,0 +1,28 @@
+-- +goose Up
+-- Creator-managed knowledge-base documents: keep the raw text so documents can be re-chunked,
+-- and track background ingestion progress.
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS format TEXT NOT NULL DEFAULT 'text',
+    ADD COLUMN IF NOT EXISTS content TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending', -- pending | processing | ready | failed
+    ADD COLUMN IF NOT EXISTS progress INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS chunk_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS chunk_size INT NOT NULL DEFAULT 500,
+    ADD COLUMN IF NOT EXISTS chunk_overlap INT NOT NULL DEFAULT 50,
+    ADD COLUMN IF NOT EXISTS error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS idx_documents_status ON documents(status);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_documents_status;
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS error,
+    DROP COLUMN IF EXISTS chunk_overlap,
+    DROP COLUMN IF EXISTS chunk_size,
+    DROP COLUMN IF EXISTS chunk_count,
+    DROP COLUMN IF EXISTS progress,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS content,
+    DROP COLUMN IF EXISTS format;
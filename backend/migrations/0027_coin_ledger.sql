@@ -0,0 +1,38 @@
+-- +goose Up
+-- Double-entry coin ledger: every balance change writes a user leg and a balancing system leg
+-- sharing one transaction_id, so SUM(amount) over all rows is always zero.
+ALTER TABLE user_assets ALTER COLUMN balance TYPE BIGINT;
+
+CREATE TABLE IF NOT EXISTS coin_ledger (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    transaction_id UUID NOT NULL,
+    account TEXT NOT NULL,                 -- user:<uuid> | system:<reason>
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL,                -- signed delta for this account
+    balance_after BIGINT,                  -- user legs only
+    reason TEXT NOT NULL,                  -- opening | recharge | model_call | tip | refund
+    idempotency_key TEXT NOT NULL,
+    ref_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (idempotency_key, account)
+);
+CREATE INDEX IF NOT EXISTS idx_coin_ledger_user ON coin_ledger(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_coin_ledger_tx ON coin_ledger(transaction_id);
+
+-- Seed opening entries so balances that predate the ledger can be rebuilt from it.
+INSERT INTO coin_ledger(transaction_id, account, user_id, amount, balance_after, reason, idempotency_key)
+SELECT uuid_generate_v4(), 'user:' || ua.user_id::text, ua.user_id, ua.balance, ua.balance, 'opening', 'opening:' || ua.user_id::text
+FROM user_assets ua
+WHERE ua.balance <> 0
+ON CONFLICT (idempotency_key, account) DO NOTHING;
+
+INSERT INTO coin_ledger(transaction_id, account, amount, reason, idempotency_key)
+SELECT cl.transaction_id, 'system:opening', -cl.amount, 'opening', cl.idempotency_key
+FROM coin_ledger cl
+WHERE cl.reason = 'opening' AND cl.account LIKE 'user:%'
+ON CONFLICT (idempotency_key, account) DO NOTHING;
+
+-- +goose Down
+-- The ledger history is lost; balances stay as they are. Fails if a balance no longer fits INTEGER.
+DROP TABLE IF EXISTS coin_ledger;
+ALTER TABLE user_assets ALTER COLUMN balance TYPE INTEGER;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Optional supporter message attached to tips, shown in the creator dashboard.
+ALTER TABLE revenue_events
+    ADD COLUMN IF NOT EXISTS message TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE revenue_events DROP COLUMN IF EXISTS message;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- Pre-authorised coin holds for model calls: coins are debited when the hold is placed,
+-- kept on capture and refunded through the ledger on release or expiry.
+CREATE TABLE IF NOT EXISTS coin_holds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL,
+    captured_amount BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'held', -- held | captured | released
+    ref_id TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_coin_holds_user ON coin_holds(user_id);
+CREATE INDEX IF NOT EXISTS idx_coin_holds_expiry ON coin_holds(expires_at) WHERE status = 'held';
+
+-- +goose Down
+-- Open holds are dropped with their coins still debited; let them expire or settle first.
+DROP TABLE IF EXISTS coin_holds;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Token-based pricing: coins per 1K input/output tokens. price_coins stays as a flat per-call fee.
+ALTER TABLE models
+    ADD COLUMN IF NOT EXISTS input_price_per_1k DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS output_price_per_1k DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE models
+    DROP COLUMN IF EXISTS output_price_per_1k,
+    DROP COLUMN IF EXISTS input_price_per_1k;
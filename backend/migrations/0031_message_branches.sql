@@ -0,0 +1,36 @@
+-- +goose Up
+-- Message branching ("swipes"): every message points at its parent and exactly one child per
+-- parent (or one root per session) is active. The active path is what the chat shows and prompts.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'chat_messages' AND column_name = 'parent_id'
+    ) THEN
+        ALTER TABLE chat_messages
+            ADD COLUMN parent_id UUID REFERENCES chat_messages(id) ON DELETE CASCADE,
+            ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT true;
+        -- Existing sessions are linear: chain each message to the one before it (only once,
+        -- later runs would re-link genuine branch roots).
+        UPDATE chat_messages m
+        SET parent_id = x.prev_id
+        FROM (
+            SELECT id, LAG(id) OVER (PARTITION BY session_id ORDER BY created_at, id) AS prev_id
+            FROM chat_messages
+        ) x
+        WHERE x.id = m.id AND x.prev_id IS NOT NULL;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_parent ON chat_messages(parent_id);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_session_roots ON chat_messages(session_id) WHERE parent_id IS NULL;
+
+-- +goose Down
+-- Inactive branches (and, through the parent cascade, their replies) are deleted so every session
+-- reads linearly again.
+DELETE FROM chat_messages WHERE NOT is_active;
+DROP INDEX IF EXISTS idx_chat_messages_session_roots;
+DROP INDEX IF EXISTS idx_chat_messages_parent;
+ALTER TABLE chat_messages
+    DROP COLUMN IF EXISTS is_active,
+    DROP COLUMN IF EXISTS parent_id;
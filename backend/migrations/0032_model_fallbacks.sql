@@ -0,0 +1,16 @@
+-- +goose Up
+-- Per-model resilience: ordered fallback models, retry policy and circuit breaker thresholds.
+ALTER TABLE models
+    ADD COLUMN IF NOT EXISTS fallback_model_ids TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS max_retries INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS retry_backoff_ms INT NOT NULL DEFAULT 500,
+    ADD COLUMN IF NOT EXISTS breaker_threshold INT NOT NULL DEFAULT 5,
+    ADD COLUMN IF NOT EXISTS breaker_cooldown_seconds INT NOT NULL DEFAULT 60;
+
+-- +goose Down
+ALTER TABLE models
+    DROP COLUMN IF EXISTS breaker_cooldown_seconds,
+    DROP COLUMN IF EXISTS breaker_threshold,
+    DROP COLUMN IF EXISTS retry_backoff_ms,
+    DROP COLUMN IF EXISTS max_retries,
+    DROP COLUMN IF EXISTS fallback_model_ids;
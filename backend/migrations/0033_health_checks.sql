@@ -0,0 +1,16 @@
+-- +goose Up
+-- Results of admin "test connection" calls and the background prober, per model / image provider.
+CREATE TABLE IF NOT EXISTS health_checks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    target_type TEXT NOT NULL, -- model | image_provider
+    target_id TEXT NOT NULL,
+    ok BOOLEAN NOT NULL,
+    latency_ms INT NOT NULL DEFAULT 0,
+    resolved_model TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_health_checks_target ON health_checks(target_type, target_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS health_checks;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Masked suffix of provider API keys (e.g. ****abcd) so admin lists never need the key itself.
+-- Keys are envelope-encrypted by the application; run cmd/reencrypt-secrets to seal legacy plaintext rows.
+ALTER TABLE models ADD COLUMN IF NOT EXISTS api_key_hint TEXT NOT NULL DEFAULT '';
+ALTER TABLE image_providers ADD COLUMN IF NOT EXISTS api_key_hint TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE image_providers DROP COLUMN IF EXISTS api_key_hint;
+ALTER TABLE models DROP COLUMN IF EXISTS api_key_hint;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Link fields on community posts, previously added lazily by the repository.
+ALTER TABLE community_posts ADD COLUMN IF NOT EXISTS link_url TEXT;
+ALTER TABLE community_posts ADD COLUMN IF NOT EXISTS link_type TEXT;
+
+-- +goose Down
+ALTER TABLE community_posts DROP COLUMN IF EXISTS link_type;
+ALTER TABLE community_posts DROP COLUMN IF EXISTS link_url;
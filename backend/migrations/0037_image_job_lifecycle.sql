@@ -0,0 +1,21 @@
+-- +goose Up
+-- Image jobs are queued and assigned a provider only when a worker gets one of its concurrency
+-- slots, so provider_id starts out empty. tried_provider_ids lets a retry pick a different provider.
+ALTER TABLE image_jobs ALTER COLUMN provider_id DROP NOT NULL;
+ALTER TABLE image_jobs ALTER COLUMN status SET DEFAULT 'queued';
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS tried_provider_ids UUID[] NOT NULL DEFAULT '{}';
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+UPDATE image_jobs SET status = 'queued' WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_image_jobs_running_provider ON image_jobs(provider_id) WHERE status = 'running';
+
+-- +goose Down
+-- Jobs that never got a provider cannot satisfy NOT NULL again and are deleted.
+DROP INDEX IF EXISTS idx_image_jobs_running_provider;
+UPDATE image_jobs SET status = 'pending' WHERE status = 'queued';
+ALTER TABLE image_jobs DROP COLUMN IF EXISTS started_at;
+ALTER TABLE image_jobs DROP COLUMN IF EXISTS tried_provider_ids;
+ALTER TABLE image_jobs DROP COLUMN IF EXISTS attempts;
+ALTER TABLE image_jobs ALTER COLUMN status SET DEFAULT 'pending';
+DELETE FROM image_jobs WHERE provider_id IS NULL;
+ALTER TABLE image_jobs ALTER COLUMN provider_id SET NOT NULL;
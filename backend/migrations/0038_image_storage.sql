@@ -0,0 +1,27 @@
+-- +goose Up
+-- Generated images now live in object storage; image_jobs keeps only their keys. Images used to be
+-- stored inline as data URLs in result_url: park those in a side table that the server drains into
+-- storage on boot, so image_jobs rows stay small.
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS image_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE image_jobs ADD COLUMN IF NOT EXISTS thumbnail_key TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS image_job_legacy_data (
+    image_job_id UUID PRIMARY KEY REFERENCES image_jobs(id) ON DELETE CASCADE,
+    data_url TEXT NOT NULL
+);
+
+INSERT INTO image_job_legacy_data(image_job_id, data_url)
+SELECT id, result_url FROM image_jobs WHERE result_url LIKE 'data:%'
+ON CONFLICT (image_job_id) DO NOTHING;
+
+UPDATE image_jobs SET result_url = '' WHERE result_url LIKE 'data:%';
+
+-- +goose Down
+-- Images not yet drained into storage go back inline; those already in storage keep only their
+-- object, which the older release cannot show.
+UPDATE image_jobs j SET result_url = l.data_url
+FROM image_job_legacy_data l
+WHERE l.image_job_id = j.id;
+DROP TABLE IF EXISTS image_job_legacy_data;
+ALTER TABLE image_jobs DROP COLUMN IF EXISTS thumbnail_key;
+ALTER TABLE image_jobs DROP COLUMN IF EXISTS image_key;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Memories are now extracted from conversations by a model as well as written by users, who can
+-- pin them (pinned memories are never rewritten by the extractor) and edit them.
+ALTER TABLE memory_capsules ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'fact';
+ALTER TABLE memory_capsules ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE memory_capsules ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE memory_capsules ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- +goose Down
+ALTER TABLE memory_capsules DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE memory_capsules DROP COLUMN IF EXISTS source;
+ALTER TABLE memory_capsules DROP COLUMN IF EXISTS pinned;
+ALTER TABLE memory_capsules DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- Session summaries are built incrementally: chapter summaries cover the messages past the
+-- session's summary_watermark and are folded into one arc summary once they grow too long. Every
+-- change (new chapter, merge, user edit, regeneration) adds a row; is_current marks the live set
+-- and chat_sessions.summary keeps its rendered text for prompt building.
+CREATE TABLE IF NOT EXISTS chat_summaries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL REFERENCES chat_sessions(id) ON DELETE CASCADE,
+    level TEXT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    version INT NOT NULL,
+    content TEXT NOT NULL,
+    through_message_id UUID,
+    message_count INT NOT NULL DEFAULT 0,
+    source TEXT NOT NULL DEFAULT 'auto',
+    is_current BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (session_id, version)
+);
+CREATE INDEX IF NOT EXISTS idx_chat_summaries_current ON chat_summaries(session_id, position) WHERE is_current;
+
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS summary_watermark UUID;
+
+-- The old append-only summaries repeat themselves and record no watermark. Keep each as a retired
+-- version and let the sessions be summarized again from the start.
+INSERT INTO chat_summaries(session_id, level, version, content, source, is_current)
+SELECT id, 'arc', 1, summary, 'legacy', FALSE
+FROM chat_sessions
+WHERE COALESCE(summary, '') <> '';
+
+UPDATE chat_sessions SET summary = '' WHERE COALESCE(summary, '') <> '';
+
+-- +goose Down
+-- chat_sessions.summary already holds the rendered current summaries; sessions not summarized
+-- again since get their legacy summary back.
+UPDATE chat_sessions s SET summary = cs.content
+FROM chat_summaries cs
+WHERE cs.session_id = s.id AND cs.source = 'legacy' AND COALESCE(s.summary, '') = '';
+ALTER TABLE chat_sessions DROP COLUMN IF EXISTS summary_watermark;
+DROP TABLE IF EXISTS chat_summaries;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Personas are who the user plays in a chat: the name fills {{user}} and the description becomes a
+-- prompt section. A user has at most one default persona; a session may override it.
+CREATE TABLE IF NOT EXISTS personas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    avatar_url TEXT NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_personas_user ON personas(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_personas_default ON personas(user_id) WHERE is_default;
+
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS persona_id UUID REFERENCES personas(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE chat_sessions DROP COLUMN IF EXISTS persona_id;
+DROP TABLE IF EXISTS personas;
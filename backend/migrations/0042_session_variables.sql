@@ -0,0 +1,6 @@
+-- +goose Up
+-- Per-session variables read and written by the {{getvar}} / {{setvar}} macros of presets and roles.
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS variables JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- +goose Down
+ALTER TABLE chat_sessions DROP COLUMN IF EXISTS variables;
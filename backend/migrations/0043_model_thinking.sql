@@ -0,0 +1,6 @@
+-- +goose Up
+-- Extended thinking budget per model; 0 leaves thinking off.
+ALTER TABLE models ADD COLUMN IF NOT EXISTS thinking_budget_tokens INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE models DROP COLUMN IF EXISTS thinking_budget_tokens;
@@ -5,6 +5,8 @@ type ImageProvider = {
   name: string
   base_url: string
   api_key?: string
+  has_api_key?: boolean
+  api_key_hint?: string
   max_concurrency?: number
   weight?: number
   status?: string
@@ -1,10 +1,12 @@
 type ImageJob = {
   id: string
-  status: string
+  status: 'queued' | 'running' | 'succeeded' | 'failed'
   result_url?: string
+  thumbnail_url?: string
   error?: string
   final_prompt?: string
   negative_prompt?: string
+  attempts?: number
 }
 
 export const useImage = () => {
@@ -107,6 +107,7 @@ export interface ModelConfig {
   is_default?: boolean
   is_enabled?: boolean
   has_api_key?: boolean
+  api_key_hint?: string
   price_coins?: number
   price_hint?: string
   share_role_pct?: number